@@ -26,13 +26,17 @@ func (s *Since) ToTime() *time.Time {
 	case SinceToday:
 		val := time.Now().Add(-24 * time.Hour)
 		return &val
+	case SinceThisWeek:
+		val := time.Now().Add(-7 * 24 * time.Hour)
+		return &val
 	default:
 		panic("not defined for since value")
 	}
 }
 
 const (
-	SinceToday = "TODAY"
+	SinceToday    = "TODAY"
+	SinceThisWeek = "THIS_WEEK"
 )
 
 type MostPopularCursor struct {
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/config"
+	"github.com/navbryce/next-dorm-be/controllers"
+	"github.com/navbryce/next-dorm-be/db/backend"
+	"github.com/navbryce/next-dorm-be/services"
+	"log"
+)
+
+const usage = `usage: digest
+
+emails the digests that are due to the users who opted in, then exits. meant to be run
+periodically (hourly, for example) when the web server doesn't send them itself
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err == nil {
+		err = cfg.ValidateDigest()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := backend.Open(&cfg.DB)
+	if err != nil {
+		log.Fatal("Received err when attempting to connect to DB", err)
+	}
+	defer db.Close()
+
+	mailer, err := services.NewMailer(&cfg.Mail)
+	if err != nil {
+		log.Fatal("An error occurred while initializing the mailer", err)
+	}
+	report, err := controllers.NewDigester(db, mailer, &cfg.Digest, cfg.PublicURL).SendDue(context.Background())
+	fmt.Println(report)
+	if err != nil {
+		log.Fatal("error sending digests: ", err)
+	}
+}
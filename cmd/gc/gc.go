@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/config"
+	"github.com/navbryce/next-dorm-be/controllers"
+	"github.com/navbryce/next-dorm-be/db/backend"
+	"github.com/navbryce/next-dorm-be/services"
+	"log"
+
+	firebase "firebase.google.com/go/v4"
+)
+
+const usage = `usage: gc [-dry-run] [-grace DURATION] [-v]
+
+deletes user uploads that nothing references and that are older than the grace period,
+along with upload sessions that expired without being completed
+`
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report what would be deleted without deleting anything")
+	grace := flag.Duration("grace", 0, "overrides gc.grace_period (GC_GRACE_PERIOD)")
+	verbose := flag.Bool("v", false, "list every orphaned blob")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err == nil {
+		if *grace > 0 {
+			cfg.GC.GracePeriod = *grace
+		}
+		err = cfg.ValidateGC()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	db, err := backend.Open(&cfg.DB)
+	if err != nil {
+		log.Fatal("Received err when attempting to connect to DB", err)
+	}
+	defer db.Close()
+
+	var app *firebase.App
+	if cfg.Storage.Backend == config.StorageBackendGCS {
+		if app, err = services.NewFirebaseApp(ctx, &cfg.Firebase); err != nil {
+			log.Fatalf("error initializing firebase: %v\n", err)
+		}
+	}
+	store, err := services.NewBlobStore(ctx, &cfg.Storage, app)
+	if err != nil {
+		log.Fatal("An error occurred while connecting to the user uploads bucket", err)
+	}
+
+	report, err := controllers.NewBlobCollector(db, store, &cfg.GC).Collect(ctx, *dryRun)
+	if err != nil {
+		log.Fatal("error collecting orphaned blobs: ", err)
+	}
+	if *verbose {
+		for _, blob := range report.Orphaned {
+			fmt.Printf("%v  %10d  %v\n", blob.Created.Format("2006-01-02 15:04:05"), blob.Size, blob.Name)
+		}
+	}
+	fmt.Println(report)
+}
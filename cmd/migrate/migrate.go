@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/config"
+	"github.com/navbryce/next-dorm-be/db/backend"
+	"github.com/navbryce/next-dorm-be/db/migrations"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+const usage = `usage: migrate [-dir DIR] COMMAND
+
+commands:
+  up [N]       apply the next N pending migrations (all by default)
+  down [N]     roll back the N most recently applied migrations (1 by default)
+  status       list migrations and whether they have been applied
+  create NAME  write empty up/down files for a new migration to DIR
+  seal-creators
+               encrypt the creators of hidden content stored before db.creator_key was set
+`
+
+var migrationNameRegex = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+func main() {
+	dir := flag.String("dir", "db/migrations", "migrations directory used by create")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	command, args := flag.Arg(0), flag.Args()[1:]
+	if command == "create" {
+		if len(args) != 1 {
+			log.Fatal("create expects exactly one migration name")
+		}
+		if err := create(*dir, args[0]); err != nil {
+			log.Fatal("error creating migration: ", err)
+		}
+		return
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if command == "seal-creators" {
+		if err := sealCreators(&cfg.DB); err != nil {
+			log.Fatal("error sealing creators: ", err)
+		}
+		return
+	}
+	sqlDB, files, err := backend.OpenSQLDB(&cfg.DB)
+	if err != nil {
+		log.Fatal("Received err when attempting to connect to DB", err)
+	}
+	defer sqlDB.Close()
+
+	migrator, err := migrations.NewMigrator(sqlDB, files)
+	if err != nil {
+		log.Fatal("error loading migrations: ", err)
+	}
+
+	ctx := context.Background()
+	switch command {
+	case "up":
+		ran, err := migrator.Up(ctx, parseSteps(args, 0))
+		printMigrations("applied", ran)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "down":
+		ran, err := migrator.Down(ctx, parseSteps(args, 1))
+		printMigrations("rolled back", ran)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%06d  %-40s %v\n", status.Version, status.Name, appliedAt)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// sealCreators goes through db.Database, which knows how to seal, rather than the raw connection
+func sealCreators(cfg *config.DBConfig) error {
+	if cfg.CreatorKey == "" {
+		return fmt.Errorf("db.creator_key (DB_CREATOR_KEY) must be set")
+	}
+	database, err := backend.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	numSealed, err := database.SealCreators(context.Background())
+	fmt.Printf("sealed %v rows\n", numSealed)
+	return err
+}
+
+func parseSteps(args []string, defaultSteps int) int {
+	if len(args) == 0 {
+		return defaultSteps
+	}
+	steps, err := strconv.Atoi(args[0])
+	if err != nil || steps < 0 {
+		log.Fatalf("invalid number of steps %v", args[0])
+	}
+	return steps
+}
+
+func printMigrations(verb string, ran []*migrations.Migration) {
+	if len(ran) == 0 {
+		fmt.Printf("no migrations %v\n", verb)
+	}
+	for _, migration := range ran {
+		fmt.Printf("%v %06d_%v\n", verb, migration.Version, migration.Name)
+	}
+}
+
+func create(dir string, name string) error {
+	if !migrationNameRegex.MatchString(name) {
+		return fmt.Errorf("name must be snake_case, got %v", name)
+	}
+	existing, err := migrations.Load(os.DirFS(dir))
+	if err != nil {
+		return err
+	}
+	var version int64 = 1
+	if len(existing) > 0 {
+		version = existing[len(existing)-1].Version + 1
+	}
+	for _, direction := range []string{"up", "down"} {
+		path := filepath.Join(dir, fmt.Sprintf("%06d_%v.%v.sql", version, name, direction))
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		fmt.Println("created", path)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/services"
+	"log"
+)
+
+const usage = `usage: vapid
+
+prints a new VAPID key pair for web push. the private key goes in push.vapid_private_key
+(PUSH_VAPID_PRIVATE_KEY). changing it invalidates every push subscription, since browsers
+subscribe with the public key
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	privateKey, publicKey, err := services.NewVAPIDKeys()
+	if err != nil {
+		log.Fatal("error generating the key pair: ", err)
+	}
+	fmt.Println("private key:", privateKey)
+	fmt.Println("public key: ", publicKey)
+}
@@ -3,13 +3,14 @@ package main
 import (
 	"context"
 	"fmt"
+	"github.com/navbryce/next-dorm-be/config"
 	"github.com/navbryce/next-dorm-be/controllers"
-	"github.com/navbryce/next-dorm-be/db/planetscale"
+	"github.com/navbryce/next-dorm-be/db/backend"
+	"github.com/navbryce/next-dorm-be/middleware"
 	"github.com/navbryce/next-dorm-be/routes"
 	"github.com/navbryce/next-dorm-be/services"
+	"github.com/navbryce/next-dorm-be/util"
 	"log"
-	"os"
-	"strings"
 	"time"
 
 	firebase "firebase.google.com/go/v4"
@@ -18,89 +19,136 @@ import (
 )
 
 func main() {
-	db, err := planetscale.GetDatabase()
+	cfg, err := config.Load()
+	if err == nil {
+		err = cfg.ValidateServer()
+	}
 	if err != nil {
-		log.Fatal("Received err when attempting to connect to DB", err)
+		log.Fatal(err)
 	}
-	defer db.Close()
 
-	err = configureFirebaseCredentials()
+	db, err := backend.Open(&cfg.DB)
 	if err != nil {
-		log.Fatal("an error occurred while configuring firebase credentials", err)
+		log.Fatal("Received err when attempting to connect to DB", err)
 	}
-	app, err := firebase.NewApp(context.Background(), nil)
-	if err != nil {
-		log.Fatalf("error initializing firebase: %v\n", err)
+	defer db.Close()
+
+	var app *firebase.App
+	if cfg.NeedsFirebase() {
+		app, err = services.NewFirebaseApp(context.Background(), &cfg.Firebase)
+		if err != nil {
+			log.Fatalf("error initializing firebase: %v\n", err)
+		}
 	}
-	authClient, err := app.Auth(context.Background())
+	authenticator, err := getAuthenticator(context.Background(), &cfg.Auth, app)
 	if err != nil {
-		log.Fatal("error initializing auth client", err)
+		log.Fatal("error initializing authenticator", err)
 	}
 
-	// TODO: Move the port parsing to a configuration module
-	port := os.Getenv("PORT")
-	if port == "" {
-		log.Fatal("$PORT must be set")
-	}
+	avatars := util.NewAvatarBuilder(cfg.PublicURL)
 
-	gin.SetMode(os.Getenv("GIN_MODE"))
+	gin.SetMode(cfg.GinMode)
 	r := gin.New()
+	// gin trusts every proxy unless told otherwise
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatal("invalid trusted proxies", err)
+	}
+	r.Use(middleware.StripQueryToken())
 	r.Use(gin.Logger())
 	r.Use(gin.Recovery())
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:  strings.Split(os.Getenv("FE_ORIGINS"), ";"), // TODO: Update FE origin
+		AllowOrigins:  cfg.FEOrigins,
 		AllowMethods:  []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:  []string{"Origin", "Authorization"},
+		AllowHeaders:  []string{"Origin", "Authorization", "Content-Type"},
 		ExposeHeaders: []string{"Content-Length"},
 		MaxAge:        12 * time.Hour,
 	}))
 
-	userBucket, err := services.NewStorageBucket(context.Background(), app, "next-dorm-d5c03.appspot.com")
+	userBucket, err := services.NewBlobStore(context.Background(), &cfg.Storage, app)
 	if err != nil {
 		log.Fatal("An error occurred while connecting to the user uploads bucket", err)
 	}
 
+	if cfg.GC.Interval > 0 {
+		controllers.NewBlobCollector(db, userBucket, &cfg.GC).Start(context.Background())
+	}
+	if cfg.Digest.Interval > 0 {
+		mailer, err := services.NewMailer(&cfg.Mail)
+		if err != nil {
+			log.Fatal("An error occurred while initializing the mailer", err)
+		}
+		controllers.NewDigester(db, mailer, &cfg.Digest, cfg.PublicURL).Start(context.Background())
+	}
+
 	communityController, err := controllers.NewCommunityController(context.Background(), db)
 	if err != nil {
 		log.Fatal("An error occurred while initializing the community controller", err)
 	}
 
-	routes.AddCommunityRoutes(&r.RouterGroup, db, communityController, authClient)
-	routes.AddPostRoutes(&r.RouterGroup, db, authClient, userBucket)
-	routes.AddSubscriptionRoutes(&r.RouterGroup, db, authClient)
-	routes.AddUserRoutes(&r.RouterGroup, db, authClient, userBucket)
+	rateLimitStore, err := services.NewRateLimitStore(&cfg.RateLimits, db)
+	if err != nil {
+		log.Fatal("An error occurred while initializing the rate limit store", err)
+	}
+	limiter := services.NewRateLimiter(rateLimitStore, &cfg.RateLimits)
+	limiter.Start(context.Background())
+
+	policy := controllers.NewPolicy(db, db, communityController)
+	automod := controllers.NewAutomodController(db, db, communityController, policy)
+	var pusher *services.WebPusher
+	if cfg.Push.Enabled() {
+		if pusher, err = services.NewWebPusher(db, &cfg.Push); err != nil {
+			log.Fatal("An error occurred while initializing web push", err)
+		}
+		pusher.Start(context.Background())
+	}
+	push := controllers.NewPushController(db, pusher)
+	notifier := controllers.NewNotifier(db, db, push)
+
+	liveHub, err := services.NewLiveHub(&cfg.Live, db)
+	if err != nil {
+		log.Fatal("An error occurred while initializing the live hub", err)
+	}
+	live := controllers.NewLiveController(liveHub, db, avatars, &cfg.Live)
+	live.Start(context.Background())
+	webhooks := controllers.NewWebhookController(db, db, communityController, avatars)
+	services.NewWebhookSender(db, &cfg.Webhooks).Start(context.Background())
+
+	routes.AddCommunityRoutes(&r.RouterGroup, db, communityController, authenticator, live)
+	routes.AddRoleRoutes(&r.RouterGroup, db, authenticator, policy)
+	routes.AddBanRoutes(&r.RouterGroup, db, authenticator, policy)
+	routes.AddReportRoutes(&r.RouterGroup, db, authenticator, policy, communityController, limiter, notifier, live, webhooks)
+	routes.AddModLogRoutes(&r.RouterGroup, db, authenticator, policy, communityController)
+	routes.AddAutomodRoutes(&r.RouterGroup, db, authenticator, policy, automod)
+	routes.AddWebhookRoutes(&r.RouterGroup, db, authenticator, policy)
+	routes.AddPostRoutes(&r.RouterGroup, db, authenticator, userBucket, services.NewImageProcessor(userBucket, db, &cfg.Images),
+		services.NewAliasService(db, avatars), policy, automod, limiter, &cfg.Posts, notifier, live, webhooks, avatars)
+	routes.AddSubscriptionRoutes(&r.RouterGroup, db, authenticator)
+	routes.AddNotificationRoutes(&r.RouterGroup, db, authenticator)
+	routes.AddDigestRoutes(&r.RouterGroup, db, authenticator)
+	routes.AddPushRoutes(&r.RouterGroup, db, authenticator, policy, push, pusher)
+	routes.AddUserRoutes(&r.RouterGroup, db, db, authenticator)
+	routes.AddUploadRoutes(&r.RouterGroup, db, authenticator, userBucket, &cfg.Uploads, limiter)
+	routes.AddRevealRoutes(&r.RouterGroup, db, authenticator, policy, avatars)
+	routes.AddAvatarRoutes(&r.RouterGroup)
 	routes.AddHealthCheckRoutes(&r.RouterGroup)
 
-	if err := r.Run(); err != nil {
+	if err := r.Run(":" + cfg.Port); err != nil {
 		log.Fatal("Error when attempting to run web server", err)
 	}
 }
 
-const (
-	CredentialsPathEnvVar = "GOOGLE_APPLICATION_CREDENTIALS"
-	CredentialsJsonEnvVar = "GOOGLE_APPLICATION_CREDENTIALS_JSON"
-	TargetCredentialsFile = "./google-application-credentials.json"
-)
-
-func configureFirebaseCredentials() error {
-	credentialsPath, hasCredentialsPath := os.LookupEnv(CredentialsPathEnvVar)
-	if hasCredentialsPath {
-		log.Printf("Credentials path detected in env. Expecting credentails to be at %v\n", credentialsPath)
-		return nil
-	}
-	credentialsJson, hasCredentialsJson := os.LookupEnv(CredentialsJsonEnvVar)
-	if hasCredentialsJson {
-		log.Println("Credentials JSON string detected in env.")
-		err := os.WriteFile(TargetCredentialsFile, []byte(credentialsJson), 400)
-		if err != nil {
-			return fmt.Errorf("error writing credentials to temp file, %w", err)
-		}
-		err = os.Setenv(CredentialsPathEnvVar, TargetCredentialsFile)
+// getAuthenticator returns the services.Authenticator named by cfg.Provider
+func getAuthenticator(ctx context.Context, cfg *config.AuthConfig, app *firebase.App) (services.Authenticator, error) {
+	switch cfg.Provider {
+	case config.AuthProviderJWT:
+		return services.NewJWTAuthenticator(ctx, &cfg.JWT)
+	case config.AuthProviderFirebase:
+		authClient, err := app.Auth(ctx)
 		if err != nil {
-			return fmt.Errorf("error setting %v env var %w", CredentialsPathEnvVar, err)
+			return nil, err
 		}
-		return nil
+		return services.NewFirebaseAuthenticator(authClient), nil
+	default:
+		return nil, fmt.Errorf("unknown auth provider %v", cfg.Provider)
 	}
-	return fmt.Errorf("must specify either %v (a path)"+
-		" or %v (credentials as JSON string)", CredentialsPathEnvVar, CredentialsJsonEnvVar)
 }
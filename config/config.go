@@ -0,0 +1,955 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"net/mail"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileEnvVar points at an optional YAML file. Environment variables override values from the file
+const FileEnvVar = "CONFIG_FILE"
+
+const (
+	AuthProviderFirebase = "firebase"
+	AuthProviderJWT      = "jwt"
+)
+
+const (
+	StorageBackendGCS        = "gcs"
+	StorageBackendFilesystem = "filesystem"
+)
+
+const (
+	DBBackendPlanetScale = "planetscale"
+	DBBackendSQLite      = "sqlite"
+	DBBackendMemory      = "memory"
+)
+
+const (
+	RateLimitStoreMemory = "memory"
+	RateLimitStoreDB     = "db"
+)
+
+const (
+	LiveHubMemory = "memory"
+	LiveHubDB     = "db"
+)
+
+const (
+	MailerSMTP   = "smtp"
+	MailerFile   = "file"
+	MailerStdout = "stdout"
+)
+
+// MaxDigestPosts bounds digest.max_posts, so a digest stays readable
+const MaxDigestPosts = 50
+
+// The route groups that can be rate limited
+const (
+	RateLimitGroupPosts    = "posts"
+	RateLimitGroupComments = "comments"
+	RateLimitGroupVotes    = "votes"
+	RateLimitGroupReports  = "reports"
+	RateLimitGroupUploads  = "uploads"
+)
+
+var rateLimitGroups = []string{
+	RateLimitGroupPosts, RateLimitGroupComments, RateLimitGroupVotes, RateLimitGroupReports, RateLimitGroupUploads,
+}
+
+// SupportedImageTypes are the upload types the image processor can decode
+var SupportedImageTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+type Config struct {
+	Port string `yaml:"port"`
+	// PublicURL is where clients reach the web server. Used to build links to it, such as avatar URLs
+	PublicURL string         `yaml:"public_url"`
+	GinMode   string         `yaml:"gin_mode"`
+	FEOrigins []string       `yaml:"fe_origins"`
+	DB        DBConfig       `yaml:"db"`
+	Storage   StorageConfig  `yaml:"storage"`
+	Firebase  FirebaseConfig `yaml:"firebase"`
+	Auth      AuthConfig     `yaml:"auth"`
+	Posts     PostConfig     `yaml:"posts"`
+	Uploads   UploadConfig   `yaml:"uploads"`
+	Images    ImageConfig    `yaml:"images"`
+	GC        GCConfig       `yaml:"gc"`
+	// TrustedProxies are the networks (CIDRs or IPs) of the proxies in front of the server, whose X-Forwarded-For
+	// entries are believed. No proxy is trusted if unset
+	TrustedProxies []string        `yaml:"trusted_proxies"`
+	RateLimits     RateLimitConfig `yaml:"rate_limits"`
+	Live           LiveConfig      `yaml:"live"`
+	Webhooks       WebhookConfig   `yaml:"webhooks"`
+	Mail           MailConfig      `yaml:"mail"`
+	Digest         DigestConfig    `yaml:"digest"`
+	Push           PushConfig      `yaml:"push"`
+}
+
+type DBConfig struct {
+	Backend string `yaml:"backend"`
+
+	// planetscale (MySQL)
+	User         string `yaml:"user"`
+	Pass         string `yaml:"pass"`
+	Host         string `yaml:"host"`
+	Name         string `yaml:"name"`
+	MaxOpenConns int    `yaml:"max_open_conns"`
+	MaxIdleConns int    `yaml:"max_idle_conns"`
+
+	// sqlite
+	SQLitePath string `yaml:"sqlite_path"`
+
+	// CreatorKey (base64, 32 bytes) encrypts the creators of hidden content. Unset stores them in plain text. Ignored
+	// by the memory backend
+	CreatorKey string `yaml:"creator_key"`
+}
+
+type StorageConfig struct {
+	// Backend is gcs (the firebase storage bucket) or filesystem
+	Backend string `yaml:"backend"`
+	Bucket  string `yaml:"bucket"`
+	// Path is the root directory of the filesystem backend
+	Path string `yaml:"path"`
+}
+
+// FirebaseConfig holds the service account credentials. Only one of the two needs to be set
+type FirebaseConfig struct {
+	CredentialsPath string `yaml:"credentials_path"`
+	CredentialsJSON string `yaml:"credentials_json"`
+}
+
+// PostConfig limits what a post can be made of
+type PostConfig struct {
+	// MaxCommunities is how many communities a post can be cross-posted to
+	MaxCommunities int `yaml:"max_communities"`
+}
+
+// UploadConfig limits what can be sent through upload sessions
+type UploadConfig struct {
+	MaxImageBytes  int           `yaml:"max_image_bytes"`
+	MaxAvatarBytes int           `yaml:"max_avatar_bytes"`
+	AllowedTypes   []string      `yaml:"allowed_types"`
+	TokenTTL       time.Duration `yaml:"token_ttl"`
+}
+
+// ImageConfig controls how attached images are re-encoded
+type ImageConfig struct {
+	// ThumbnailSizes are the boxes (in pixels) thumbnails are scaled to fit in
+	ThumbnailSizes []int `yaml:"thumbnail_sizes"`
+	// MaxPixels (width * height) guards against decompression bombs
+	MaxPixels   int `yaml:"max_pixels"`
+	JPEGQuality int `yaml:"jpeg_quality"`
+}
+
+// GCConfig controls the collector of orphaned blobs
+type GCConfig struct {
+	// GracePeriod is how old an unreferenced blob must be before it's deleted. Gives clients time to attach uploads
+	GracePeriod time.Duration `yaml:"grace_period"`
+	// Interval between the collections run by the web server. 0 disables them
+	Interval time.Duration `yaml:"interval"`
+}
+
+// RateLimitConfig limits how fast a user, and everyone behind an IP, can write
+type RateLimitConfig struct {
+	// Store is memory (every instance keeps its own buckets) or db (the instances share them through the database)
+	Store string `yaml:"store"`
+	// Groups are keyed by route group. A group that isn't set isn't limited
+	Groups map[string]RateLimitGroup `yaml:"groups"`
+}
+
+type RateLimitGroup struct {
+	User RateLimit `yaml:"user"`
+	IP   RateLimit `yaml:"ip"`
+}
+
+// RateLimit is a token bucket: it allows bursts of Requests requests and refills at Requests per Per. 0 Requests
+// disables it
+type RateLimit struct {
+	Requests int           `yaml:"requests"`
+	Per      time.Duration `yaml:"per"`
+}
+
+func (rl RateLimit) IsEnabled() bool {
+	return rl.Requests > 0
+}
+
+// LiveConfig controls the Server-Sent Event streams
+type LiveConfig struct {
+	// Hub is memory (a stream only gets the events of its instance) or db (the instances exchange events through the
+	// database)
+	Hub string `yaml:"hub"`
+	// PollInterval is how often the db hub reads the events of the other instances
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// Retention is how long the db hub keeps events. Must be longer than PollInterval
+	Retention time.Duration `yaml:"retention"`
+	// Heartbeat is how often an idle stream gets a ping, so proxies don't time it out
+	Heartbeat time.Duration `yaml:"heartbeat"`
+}
+
+// WebhookConfig controls how the events of communities are delivered to their webhooks
+type WebhookConfig struct {
+	// PollInterval is how often the web server looks for deliveries that are due
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// Timeout is how long a receiver has to respond to a delivery
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxAttempts is how many times a delivery is sent before it's marked failed
+	MaxAttempts int `yaml:"max_attempts"`
+	// InitialBackoff is the wait before the first retry. It doubles with every retry, up to MaxBackoff
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+	// Retention is how long finished deliveries stay in the delivery log (and can be replayed)
+	Retention time.Duration `yaml:"retention"`
+	// AllowPrivateHosts lets webhooks reach loopback, private and link-local addresses. Only meant for development
+	AllowPrivateHosts bool `yaml:"allow_private_hosts"`
+}
+
+// MailConfig controls how emails are sent
+type MailConfig struct {
+	// Mailer is smtp, file (every email is written to Path) or stdout. file and stdout are meant for development
+	Mailer string `yaml:"mailer"`
+	// From is the sender of every email, such as "Nextdorm <digest@example.com>"
+	From string     `yaml:"from"`
+	SMTP SMTPConfig `yaml:"smtp"`
+	// Path is the directory the file mailer writes to
+	Path string `yaml:"path"`
+}
+
+// SMTPConfig points at a submission server. STARTTLS is used whenever the server offers it, and credentials are only
+// sent over TLS (or to localhost)
+type SMTPConfig struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	// User and Pass are only sent when User is set
+	User string `yaml:"user"`
+	Pass string `yaml:"pass"`
+}
+
+// DigestConfig controls the email digest of the top posts in the communities a user is subscribed to
+type DigestConfig struct {
+	// Interval between the runs of the web server, which send the digests that are due. 0 disables them
+	Interval time.Duration `yaml:"interval"`
+	// MaxPosts is how many posts a digest lists
+	MaxPosts int `yaml:"max_posts"`
+	// PostURL links the posts of a digest to the frontend. {id} is replaced with the id of the post. Posts aren't
+	// linked if unset
+	PostURL string `yaml:"post_url"`
+}
+
+// PushConfig controls Web Push notifications (VAPID, RFC 8292). Push is off unless VAPIDPrivateKey is set
+type PushConfig struct {
+	// VAPIDPrivateKey (base64url, 32 bytes) is the P-256 key the server signs its requests to push services with.
+	// Browsers subscribe with its public key. cmd/vapid generates one
+	VAPIDPrivateKey string `yaml:"vapid_private_key"`
+	// Subject is a mailto: or https: URL the push services can reach the operator at
+	Subject string `yaml:"subject"`
+	// Services are the URL prefixes the endpoints of subscriptions must start with, so notifications are only posted
+	// to known push services. A host starting with "*." matches its subdomains. Point it at a fake push service to test
+	Services []string `yaml:"services"`
+	// TTL is how long a push service keeps a notification for a device that is offline. 0 only delivers it to devices
+	// that are online
+	TTL time.Duration `yaml:"ttl"`
+	// Timeout is how long a push service has to accept a notification
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxAttempts is how many times a notification is sent while the push service is unavailable or rate limits the
+	// server
+	MaxAttempts int `yaml:"max_attempts"`
+}
+
+// Enabled is true when a VAPID key is set
+func (pc *PushConfig) Enabled() bool {
+	return pc.VAPIDPrivateKey != ""
+}
+
+type AuthConfig struct {
+	// Provider is firebase or jwt
+	Provider string    `yaml:"provider"`
+	JWT      JWTConfig `yaml:"jwt"`
+}
+
+// JWTConfig configures verification of RS256/ES256 tokens from an identity provider other than firebase
+type JWTConfig struct {
+	// only one of JWKSFile and JWKSURL may be set
+	JWKSFile string `yaml:"jwks_file"`
+	JWKSURL  string `yaml:"jwks_url"`
+	// JWKSRefresh is how often a JWKS URL is refetched. 0 only refetches when a token names an unknown key
+	JWKSRefresh time.Duration `yaml:"jwks_refresh"`
+	// Issuer and Audience are only checked when set
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// UIDClaim names the claim holding the user id
+	UIDClaim string `yaml:"uid_claim"`
+}
+
+// Default returns the values used when neither the file nor the environment sets a field
+func Default() *Config {
+	return &Config{
+		DB: DBConfig{
+			Backend:      DBBackendPlanetScale,
+			Name:         "next-dorm",
+			MaxOpenConns: 50,
+			MaxIdleConns: 50,
+		},
+		Storage: StorageConfig{
+			Backend: StorageBackendGCS,
+			Bucket:  "next-dorm-d5c03.appspot.com",
+		},
+		Posts: PostConfig{
+			MaxCommunities: 3,
+		},
+		Uploads: UploadConfig{
+			MaxImageBytes:  10 << 20,
+			MaxAvatarBytes: 2 << 20,
+			AllowedTypes:   SupportedImageTypes,
+			TokenTTL:       15 * time.Minute,
+		},
+		Images: ImageConfig{
+			ThumbnailSizes: []int{160, 480, 1080},
+			MaxPixels:      40_000_000,
+			JPEGQuality:    85,
+		},
+		GC: GCConfig{
+			GracePeriod: 24 * time.Hour,
+		},
+		RateLimits: RateLimitConfig{
+			Store: RateLimitStoreMemory,
+			// IPs get more room than users since a whole dorm can be behind one
+			Groups: map[string]RateLimitGroup{
+				RateLimitGroupPosts: {
+					User: RateLimit{Requests: 5, Per: 10 * time.Minute},
+					IP:   RateLimit{Requests: 50, Per: 10 * time.Minute},
+				},
+				RateLimitGroupComments: {
+					User: RateLimit{Requests: 20, Per: 5 * time.Minute},
+					IP:   RateLimit{Requests: 200, Per: 5 * time.Minute},
+				},
+				RateLimitGroupVotes: {
+					User: RateLimit{Requests: 60, Per: time.Minute},
+					IP:   RateLimit{Requests: 600, Per: time.Minute},
+				},
+				RateLimitGroupReports: {
+					User: RateLimit{Requests: 10, Per: 10 * time.Minute},
+					IP:   RateLimit{Requests: 100, Per: 10 * time.Minute},
+				},
+				RateLimitGroupUploads: {
+					User: RateLimit{Requests: 30, Per: 10 * time.Minute},
+					IP:   RateLimit{Requests: 300, Per: 10 * time.Minute},
+				},
+			},
+		},
+		Live: LiveConfig{
+			Hub:          LiveHubMemory,
+			PollInterval: time.Second,
+			Retention:    10 * time.Minute,
+			Heartbeat:    30 * time.Second,
+		},
+		Webhooks: WebhookConfig{
+			PollInterval:   5 * time.Second,
+			Timeout:        10 * time.Second,
+			MaxAttempts:    8,
+			InitialBackoff: 30 * time.Second,
+			MaxBackoff:     time.Hour,
+			Retention:      30 * 24 * time.Hour,
+		},
+		Mail: MailConfig{
+			Mailer: MailerStdout,
+			SMTP: SMTPConfig{
+				Port: 587,
+			},
+		},
+		Digest: DigestConfig{
+			MaxPosts: 10,
+		},
+		Push: PushConfig{
+			Services: []string{
+				"https://fcm.googleapis.com/",
+				"https://updates.push.services.mozilla.com/",
+				"https://web.push.apple.com/",
+				"https://*.notify.windows.com/",
+			},
+			TTL:         24 * time.Hour,
+			Timeout:     10 * time.Second,
+			MaxAttempts: 3,
+		},
+		Auth: AuthConfig{
+			Provider: AuthProviderFirebase,
+			JWT: JWTConfig{
+				JWKSRefresh: time.Hour,
+				UIDClaim:    "sub",
+			},
+		},
+	}
+}
+
+// Load builds the config from the defaults, then the file named by CONFIG_FILE (if any), then the environment. The
+// result is validated
+func Load() (*Config, error) {
+	return LoadFile(os.Getenv(FileEnvVar))
+}
+
+// LoadFile is Load with an explicit file path. An empty path skips the file
+func LoadFile(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+		// strict yaml refuses map keys that are already set, so the default rate limit groups are put back after
+		defaultGroups := cfg.RateLimits.Groups
+		cfg.RateLimits.Groups = nil
+		if err := yaml.UnmarshalStrict(contents, cfg); err != nil {
+			return nil, fmt.Errorf("parsing config file %v: %w", path, err)
+		}
+		for group, limits := range defaultGroups {
+			if _, ok := cfg.RateLimits.Groups[group]; ok {
+				continue
+			}
+			if cfg.RateLimits.Groups == nil {
+				cfg.RateLimits.Groups = make(map[string]RateLimitGroup)
+			}
+			cfg.RateLimits.Groups[group] = limits
+		}
+	}
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides fields with any environment variables that are set
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	strs := map[string]*string{
+		"PORT":                                &c.Port,
+		"PUBLIC_URL":                          &c.PublicURL,
+		"GIN_MODE":                            &c.GinMode,
+		"DB_BACKEND":                          &c.DB.Backend,
+		"DB_USER":                             &c.DB.User,
+		"DB_PASS":                             &c.DB.Pass,
+		"DB_HOST":                             &c.DB.Host,
+		"DB_NAME":                             &c.DB.Name,
+		"SQLITE_PATH":                         &c.DB.SQLitePath,
+		"DB_CREATOR_KEY":                      &c.DB.CreatorKey,
+		"STORAGE_BACKEND":                     &c.Storage.Backend,
+		"STORAGE_BUCKET":                      &c.Storage.Bucket,
+		"STORAGE_PATH":                        &c.Storage.Path,
+		"GOOGLE_APPLICATION_CREDENTIALS":      &c.Firebase.CredentialsPath,
+		"GOOGLE_APPLICATION_CREDENTIALS_JSON": &c.Firebase.CredentialsJSON,
+		"AUTH_PROVIDER":                       &c.Auth.Provider,
+		"JWT_JWKS_FILE":                       &c.Auth.JWT.JWKSFile,
+		"JWT_JWKS_URL":                        &c.Auth.JWT.JWKSURL,
+		"JWT_ISSUER":                          &c.Auth.JWT.Issuer,
+		"JWT_AUDIENCE":                        &c.Auth.JWT.Audience,
+		"JWT_UID_CLAIM":                       &c.Auth.JWT.UIDClaim,
+		"RATE_LIMIT_STORE":                    &c.RateLimits.Store,
+		"LIVE_HUB":                            &c.Live.Hub,
+		"MAILER":                              &c.Mail.Mailer,
+		"MAIL_FROM":                           &c.Mail.From,
+		"MAIL_PATH":                           &c.Mail.Path,
+		"SMTP_HOST":                           &c.Mail.SMTP.Host,
+		"SMTP_USER":                           &c.Mail.SMTP.User,
+		"SMTP_PASS":                           &c.Mail.SMTP.Pass,
+		"DIGEST_POST_URL":                     &c.Digest.PostURL,
+		"PUSH_VAPID_PRIVATE_KEY":              &c.Push.VAPIDPrivateKey,
+		"PUSH_SUBJECT":                        &c.Push.Subject,
+	}
+	for name, field := range strs {
+		if value, ok := lookup(name); ok {
+			*field = value
+		}
+	}
+
+	ints := map[string]*int{
+		"DB_MAX_OPEN_CONNS":       &c.DB.MaxOpenConns,
+		"DB_MAX_IDLE_CONNS":       &c.DB.MaxIdleConns,
+		"POST_MAX_COMMUNITIES":    &c.Posts.MaxCommunities,
+		"UPLOAD_MAX_IMAGE_BYTES":  &c.Uploads.MaxImageBytes,
+		"UPLOAD_MAX_AVATAR_BYTES": &c.Uploads.MaxAvatarBytes,
+		"IMAGE_MAX_PIXELS":        &c.Images.MaxPixels,
+		"IMAGE_JPEG_QUALITY":      &c.Images.JPEGQuality,
+		"WEBHOOK_MAX_ATTEMPTS":    &c.Webhooks.MaxAttempts,
+		"SMTP_PORT":               &c.Mail.SMTP.Port,
+		"DIGEST_MAX_POSTS":        &c.Digest.MaxPosts,
+		"PUSH_MAX_ATTEMPTS":       &c.Push.MaxAttempts,
+	}
+	for name, field := range ints {
+		if value, ok := lookup(name); ok {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%v must be an integer, got %q", name, value)
+			}
+			*field = parsed
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"JWT_JWKS_REFRESH":        &c.Auth.JWT.JWKSRefresh,
+		"UPLOAD_TOKEN_TTL":        &c.Uploads.TokenTTL,
+		"GC_GRACE_PERIOD":         &c.GC.GracePeriod,
+		"GC_INTERVAL":             &c.GC.Interval,
+		"LIVE_POLL_INTERVAL":      &c.Live.PollInterval,
+		"LIVE_RETENTION":          &c.Live.Retention,
+		"LIVE_HEARTBEAT":          &c.Live.Heartbeat,
+		"WEBHOOK_POLL_INTERVAL":   &c.Webhooks.PollInterval,
+		"WEBHOOK_TIMEOUT":         &c.Webhooks.Timeout,
+		"WEBHOOK_INITIAL_BACKOFF": &c.Webhooks.InitialBackoff,
+		"WEBHOOK_MAX_BACKOFF":     &c.Webhooks.MaxBackoff,
+		"WEBHOOK_RETENTION":       &c.Webhooks.Retention,
+		"DIGEST_INTERVAL":         &c.Digest.Interval,
+		"PUSH_TTL":                &c.Push.TTL,
+		"PUSH_TIMEOUT":            &c.Push.Timeout,
+	}
+	for name, field := range durations {
+		if value, ok := lookup(name); ok {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("%v must be a duration such as 1h or 30m, got %q", name, value)
+			}
+			*field = parsed
+		}
+	}
+
+	if value, ok := lookup("WEBHOOK_ALLOW_PRIVATE_HOSTS"); ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("WEBHOOK_ALLOW_PRIVATE_HOSTS must be true or false, got %q", value)
+		}
+		c.Webhooks.AllowPrivateHosts = parsed
+	}
+	if value, ok := lookup("FE_ORIGINS"); ok {
+		c.FEOrigins = splitList(value)
+	}
+	if value, ok := lookup("TRUSTED_PROXIES"); ok {
+		c.TrustedProxies = splitList(value)
+	}
+	for _, group := range rateLimitGroups {
+		limits := c.RateLimits.Groups[group]
+		for suffix, limit := range map[string]*RateLimit{"USER": &limits.User, "IP": &limits.IP} {
+			name := fmt.Sprintf("RATE_LIMIT_%v_%v", strings.ToUpper(group), suffix)
+			if value, ok := lookup(name); ok {
+				parsed, err := parseRateLimit(value)
+				if err != nil {
+					return fmt.Errorf("%v must look like 10/1m (requests per duration) or be 0, got %q", name, value)
+				}
+				*limit = *parsed
+			}
+		}
+		if limits.User.IsEnabled() || limits.IP.IsEnabled() {
+			if c.RateLimits.Groups == nil {
+				c.RateLimits.Groups = make(map[string]RateLimitGroup)
+			}
+			c.RateLimits.Groups[group] = limits
+		} else {
+			delete(c.RateLimits.Groups, group)
+		}
+	}
+	if value, ok := lookup("PUSH_SERVICES"); ok {
+		c.Push.Services = splitList(value)
+	}
+	if value, ok := lookup("UPLOAD_ALLOWED_TYPES"); ok {
+		c.Uploads.AllowedTypes = splitList(value)
+	}
+	if value, ok := lookup("IMAGE_THUMBNAIL_SIZES"); ok {
+		c.Images.ThumbnailSizes = nil
+		for _, item := range splitList(value) {
+			size, err := strconv.Atoi(item)
+			if err != nil {
+				return fmt.Errorf("IMAGE_THUMBNAIL_SIZES must be a ; separated list of integers, got %q", value)
+			}
+			c.Images.ThumbnailSizes = append(c.Images.ThumbnailSizes, size)
+		}
+	}
+	return nil
+}
+
+// ValidationError lists every problem found so they can all be fixed at once
+type ValidationError []string
+
+func (ve ValidationError) Error() string {
+	return "invalid config:\n  " + strings.Join(ve, "\n  ")
+}
+
+// Validate checks the fields every command depends on
+func (c *Config) Validate() error {
+	var problems ValidationError
+	switch c.GinMode {
+	case "", "debug", "release", "test":
+	default:
+		problems = append(problems, fmt.Sprintf("gin_mode (GIN_MODE) must be debug, release or test, got %q", c.GinMode))
+	}
+	problems = append(problems, c.DB.validate()...)
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// ValidateServer checks the fields only the web server needs
+func (c *Config) ValidateServer() error {
+	var problems ValidationError
+	if c.Port == "" {
+		problems = append(problems, "port (PORT) must be set")
+	}
+	if len(c.FEOrigins) == 0 {
+		problems = append(problems, "fe_origins (FE_ORIGINS) must list at least one origin")
+	}
+	if c.PublicURL != "" {
+		if parsed, err := url.Parse(c.PublicURL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			problems = append(problems, fmt.Sprintf("public_url (PUBLIC_URL) must be an absolute URL, got %q", c.PublicURL))
+		}
+	}
+	problems = append(problems, c.Storage.validate()...)
+	problems = append(problems, c.Uploads.validate()...)
+	problems = append(problems, c.Images.validate()...)
+	problems = append(problems, c.Auth.validate()...)
+	problems = append(problems, c.validateGC()...)
+	problems = append(problems, c.RateLimits.validate()...)
+	problems = append(problems, c.Live.validate()...)
+	problems = append(problems, c.Webhooks.validate()...)
+	if c.Digest.Interval < 0 {
+		problems = append(problems, "digest.interval (DIGEST_INTERVAL) can't be negative")
+	} else if c.Digest.Interval > 0 {
+		problems = append(problems, c.validateDigest()...)
+	}
+	if c.Push.Enabled() {
+		problems = append(problems, c.Push.validate()...)
+	}
+	if c.Posts.MaxCommunities < 1 {
+		problems = append(problems, "posts.max_communities (POST_MAX_COMMUNITIES) must be positive")
+	}
+	if c.NeedsFirebase() {
+		problems = append(problems, c.Firebase.validate()...)
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// ValidateGC checks the fields the blob collector needs
+func (c *Config) ValidateGC() error {
+	var problems ValidationError
+	problems = append(problems, c.Storage.validate()...)
+	problems = append(problems, c.validateGC()...)
+	if c.Storage.Backend == StorageBackendGCS {
+		problems = append(problems, c.Firebase.validate()...)
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// ValidateDigest checks the fields the digest job needs
+func (c *Config) ValidateDigest() error {
+	var problems ValidationError
+	problems = append(problems, c.validateDigest()...)
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// NeedsFirebase is true when a firebase app has to be initialized
+func (c *Config) NeedsFirebase() bool {
+	return c.Auth.Provider == AuthProviderFirebase || c.Storage.Backend == StorageBackendGCS
+}
+
+func (fc *FirebaseConfig) validate() []string {
+	if fc.CredentialsPath == "" && fc.CredentialsJSON == "" {
+		return []string{"firebase.credentials_path (GOOGLE_APPLICATION_CREDENTIALS) or " +
+			"firebase.credentials_json (GOOGLE_APPLICATION_CREDENTIALS_JSON) must be set"}
+	}
+	return nil
+}
+
+// validateGC is on Config because the grace period depends on the upload settings
+func (c *Config) validateGC() []string {
+	var problems []string
+	if c.GC.GracePeriod < c.Uploads.TokenTTL {
+		problems = append(problems, "gc.grace_period (GC_GRACE_PERIOD) can't be shorter than uploads.token_ttl (UPLOAD_TOKEN_TTL)")
+	}
+	if c.GC.Interval < 0 {
+		problems = append(problems, "gc.interval (GC_INTERVAL) can't be negative")
+	}
+	return problems
+}
+
+// validateDigest is on Config because the unsubscribe links are built on the public URL
+func (c *Config) validateDigest() []string {
+	var problems []string
+	if c.PublicURL == "" {
+		problems = append(problems, "public_url (PUBLIC_URL) must be set for the unsubscribe links of the digest")
+	}
+	if c.Digest.MaxPosts < 1 || c.Digest.MaxPosts > MaxDigestPosts {
+		problems = append(problems, fmt.Sprintf("digest.max_posts (DIGEST_MAX_POSTS) must be between 1 and %v", MaxDigestPosts))
+	}
+	if c.Digest.PostURL != "" {
+		if parsed, err := url.Parse(strings.ReplaceAll(c.Digest.PostURL, "{id}", "1")); err != nil || parsed.Scheme == "" ||
+			parsed.Host == "" || !strings.Contains(c.Digest.PostURL, "{id}") {
+			problems = append(problems, fmt.Sprintf("digest.post_url (DIGEST_POST_URL) must be an absolute URL containing {id}, got %q",
+				c.Digest.PostURL))
+		}
+	}
+	problems = append(problems, c.Mail.validate()...)
+	return problems
+}
+
+func (mc *MailConfig) validate() []string {
+	var problems []string
+	if _, err := mail.ParseAddress(mc.From); err != nil {
+		problems = append(problems, fmt.Sprintf("mail.from (MAIL_FROM) must be an email address, got %q", mc.From))
+	}
+	switch mc.Mailer {
+	case MailerSMTP:
+		if mc.SMTP.Host == "" {
+			problems = append(problems, "mail.smtp.host (SMTP_HOST) must be set for the smtp mailer")
+		}
+		if mc.SMTP.Port < 1 || mc.SMTP.Port > 65535 {
+			problems = append(problems, "mail.smtp.port (SMTP_PORT) must be a port number")
+		}
+	case MailerFile:
+		if mc.Path == "" {
+			problems = append(problems, "mail.path (MAIL_PATH) must be set for the file mailer")
+		}
+	case MailerStdout:
+	default:
+		problems = append(problems, fmt.Sprintf("mail.mailer (MAILER) must be %v, %v or %v, got %q",
+			MailerSMTP, MailerFile, MailerStdout, mc.Mailer))
+	}
+	return problems
+}
+
+func (sc *StorageConfig) validate() []string {
+	var problems []string
+	switch sc.Backend {
+	case StorageBackendGCS:
+		if sc.Bucket == "" {
+			problems = append(problems, "storage.bucket (STORAGE_BUCKET) must be set for the gcs backend")
+		}
+	case StorageBackendFilesystem:
+		if sc.Path == "" {
+			problems = append(problems, "storage.path (STORAGE_PATH) must be set for the filesystem backend")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("storage.backend (STORAGE_BACKEND) must be %v or %v, got %q",
+			StorageBackendGCS, StorageBackendFilesystem, sc.Backend))
+	}
+	return problems
+}
+
+func (uc *UploadConfig) validate() []string {
+	var problems []string
+	if uc.MaxImageBytes <= 0 || uc.MaxAvatarBytes <= 0 {
+		problems = append(problems, "uploads.max_image_bytes (UPLOAD_MAX_IMAGE_BYTES) and uploads.max_avatar_bytes (UPLOAD_MAX_AVATAR_BYTES) must be positive")
+	}
+	if len(uc.AllowedTypes) == 0 {
+		problems = append(problems, "uploads.allowed_types (UPLOAD_ALLOWED_TYPES) must list at least one MIME type")
+	}
+	for _, allowedType := range uc.AllowedTypes {
+		if !containsString(SupportedImageTypes, allowedType) {
+			problems = append(problems, fmt.Sprintf("uploads.allowed_types (UPLOAD_ALLOWED_TYPES) can only contain %v, got %v",
+				SupportedImageTypes, allowedType))
+		}
+	}
+	if uc.TokenTTL <= 0 {
+		problems = append(problems, "uploads.token_ttl (UPLOAD_TOKEN_TTL) must be positive")
+	}
+	return problems
+}
+
+func (ic *ImageConfig) validate() []string {
+	var problems []string
+	for _, size := range ic.ThumbnailSizes {
+		if size <= 0 {
+			problems = append(problems, "images.thumbnail_sizes (IMAGE_THUMBNAIL_SIZES) must be positive")
+			break
+		}
+	}
+	if ic.MaxPixels <= 0 {
+		problems = append(problems, "images.max_pixels (IMAGE_MAX_PIXELS) must be positive")
+	}
+	if ic.JPEGQuality < 1 || ic.JPEGQuality > 100 {
+		problems = append(problems, "images.jpeg_quality (IMAGE_JPEG_QUALITY) must be between 1 and 100")
+	}
+	return problems
+}
+
+func (rc *RateLimitConfig) validate() []string {
+	var problems []string
+	if rc.Store != RateLimitStoreMemory && rc.Store != RateLimitStoreDB {
+		problems = append(problems, fmt.Sprintf("rate_limits.store (RATE_LIMIT_STORE) must be %v or %v, got %q",
+			RateLimitStoreMemory, RateLimitStoreDB, rc.Store))
+	}
+	for group, limits := range rc.Groups {
+		if !containsString(rateLimitGroups, group) {
+			problems = append(problems, fmt.Sprintf("rate_limits.groups can only contain %v, got %v", rateLimitGroups, group))
+			continue
+		}
+		for kind, limit := range map[string]RateLimit{"user": limits.User, "ip": limits.IP} {
+			if limit.Requests < 0 || (limit.IsEnabled() && limit.Per <= 0) {
+				problems = append(problems, fmt.Sprintf("rate_limits.groups.%v.%v (RATE_LIMIT_%v_%v) must have positive requests and per, or 0 requests",
+					group, kind, strings.ToUpper(group), strings.ToUpper(kind)))
+			}
+		}
+	}
+	return problems
+}
+
+func (lc *LiveConfig) validate() []string {
+	var problems []string
+	if lc.Hub != LiveHubMemory && lc.Hub != LiveHubDB {
+		problems = append(problems, fmt.Sprintf("live.hub (LIVE_HUB) must be %v or %v, got %q", LiveHubMemory, LiveHubDB,
+			lc.Hub))
+	}
+	if lc.PollInterval <= 0 || lc.Heartbeat <= 0 {
+		problems = append(problems, "live.poll_interval (LIVE_POLL_INTERVAL) and live.heartbeat (LIVE_HEARTBEAT) must be positive")
+	}
+	if lc.Retention <= lc.PollInterval {
+		problems = append(problems, "live.retention (LIVE_RETENTION) must be longer than live.poll_interval (LIVE_POLL_INTERVAL)")
+	}
+	return problems
+}
+
+func (wc *WebhookConfig) validate() []string {
+	var problems []string
+	if wc.PollInterval <= 0 || wc.Timeout <= 0 || wc.Retention <= 0 {
+		problems = append(problems, "webhooks.poll_interval (WEBHOOK_POLL_INTERVAL), webhooks.timeout (WEBHOOK_TIMEOUT) and webhooks.retention (WEBHOOK_RETENTION) must be positive")
+	}
+	if wc.MaxAttempts < 1 {
+		problems = append(problems, "webhooks.max_attempts (WEBHOOK_MAX_ATTEMPTS) must be positive")
+	}
+	if wc.InitialBackoff <= 0 || wc.MaxBackoff < wc.InitialBackoff {
+		problems = append(problems, "webhooks.initial_backoff (WEBHOOK_INITIAL_BACKOFF) must be positive and at most webhooks.max_backoff (WEBHOOK_MAX_BACKOFF)")
+	}
+	return problems
+}
+
+func (pc *PushConfig) validate() []string {
+	var problems []string
+	if key, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(pc.VAPIDPrivateKey, "=")); err != nil || len(key) != 32 {
+		problems = append(problems, "push.vapid_private_key (PUSH_VAPID_PRIVATE_KEY) must be 32 bytes encoded as base64url")
+	}
+	if parsed, err := url.Parse(pc.Subject); err != nil || (parsed.Scheme != "mailto" && parsed.Scheme != "https") ||
+		(parsed.Opaque == "" && parsed.Host == "") {
+		problems = append(problems, fmt.Sprintf("push.subject (PUSH_SUBJECT) must be a mailto: or https: URL, got %q", pc.Subject))
+	}
+	if len(pc.Services) == 0 {
+		problems = append(problems, "push.services (PUSH_SERVICES) must list at least one push service")
+	}
+	for _, service := range pc.Services {
+		if parsed, err := url.Parse(service); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") ||
+			parsed.Host == "" {
+			problems = append(problems, fmt.Sprintf("push.services (PUSH_SERVICES) must be http or https URLs, got %q", service))
+		}
+	}
+	if pc.TTL < 0 {
+		problems = append(problems, "push.ttl (PUSH_TTL) can't be negative")
+	}
+	if pc.Timeout <= 0 {
+		problems = append(problems, "push.timeout (PUSH_TIMEOUT) must be positive")
+	}
+	if pc.MaxAttempts < 1 {
+		problems = append(problems, "push.max_attempts (PUSH_MAX_ATTEMPTS) must be positive")
+	}
+	return problems
+}
+
+// parseRateLimit parses "requests/per", such as 10/1m. "0" disables the limit
+func parseRateLimit(value string) (*RateLimit, error) {
+	if strings.TrimSpace(value) == "0" {
+		return &RateLimit{}, nil
+	}
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("missing /")
+	}
+	requests, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return nil, err
+	}
+	per, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return nil, err
+	}
+	return &RateLimit{Requests: requests, Per: per}, nil
+}
+
+func (ac *AuthConfig) validate() []string {
+	var problems []string
+	switch ac.Provider {
+	case AuthProviderFirebase:
+	case AuthProviderJWT:
+		if (ac.JWT.JWKSFile == "") == (ac.JWT.JWKSURL == "") {
+			problems = append(problems, "exactly one of auth.jwt.jwks_file (JWT_JWKS_FILE) and auth.jwt.jwks_url (JWT_JWKS_URL) must be set for the jwt provider")
+		}
+		if ac.JWT.UIDClaim == "" {
+			problems = append(problems, "auth.jwt.uid_claim (JWT_UID_CLAIM) must be set for the jwt provider")
+		}
+		if ac.JWT.JWKSRefresh < 0 {
+			problems = append(problems, "auth.jwt.jwks_refresh (JWT_JWKS_REFRESH) can't be negative")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("auth.provider (AUTH_PROVIDER) must be %v or %v, got %q",
+			AuthProviderFirebase, AuthProviderJWT, ac.Provider))
+	}
+	return problems
+}
+
+func (dc *DBConfig) validate() []string {
+	var problems []string
+	switch dc.Backend {
+	case DBBackendPlanetScale:
+		if dc.User == "" || dc.Host == "" || dc.Name == "" {
+			problems = append(problems, "db.user (DB_USER), db.host (DB_HOST) and db.name (DB_NAME) must be set for the planetscale backend")
+		}
+		if dc.MaxOpenConns <= 0 {
+			problems = append(problems, "db.max_open_conns (DB_MAX_OPEN_CONNS) must be positive")
+		}
+		if dc.MaxIdleConns < 0 || dc.MaxIdleConns > dc.MaxOpenConns {
+			problems = append(problems, "db.max_idle_conns (DB_MAX_IDLE_CONNS) must be between 0 and db.max_open_conns")
+		}
+	case DBBackendSQLite:
+		if dc.SQLitePath == "" {
+			problems = append(problems, "db.sqlite_path (SQLITE_PATH) must be set for the sqlite backend")
+		}
+	case DBBackendMemory:
+	default:
+		problems = append(problems, fmt.Sprintf("db.backend (DB_BACKEND) must be %v, %v or %v, got %q",
+			DBBackendPlanetScale, DBBackendSQLite, DBBackendMemory, dc.Backend))
+	}
+	if dc.CreatorKey != "" {
+		if key, err := base64.StdEncoding.DecodeString(dc.CreatorKey); err != nil || len(key) != 32 {
+			problems = append(problems, "db.creator_key (DB_CREATOR_KEY) must be 32 bytes encoded as base64")
+		}
+	}
+	return problems
+}
+
+// splitList splits a ";" separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,384 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testKey is 32 zero bytes as base64
+const testKey = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+
+func lookupIn(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+// validServer is the defaults with the fields the web server can't default
+func validServer() *Config {
+	cfg := Default()
+	cfg.Port = "8080"
+	cfg.FEOrigins = []string{"http://localhost:3000"}
+	cfg.DB.Backend = DBBackendMemory
+	cfg.Storage.Backend = StorageBackendFilesystem
+	cfg.Storage.Path = "./blobs"
+	cfg.Auth.Provider = AuthProviderJWT
+	cfg.Auth.JWT.JWKSFile = "jwks.json"
+	return cfg
+}
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		check   func(*Config) interface{}
+		want    interface{}
+		wantErr string
+	}{
+		{
+			name:  "nothing set keeps the defaults",
+			env:   map[string]string{},
+			check: func(c *Config) interface{} { return c.Webhooks },
+			want:  Default().Webhooks,
+		},
+		{
+			name:  "strings",
+			env:   map[string]string{"PORT": "9000", "DB_BACKEND": DBBackendSQLite},
+			check: func(c *Config) interface{} { return []string{c.Port, c.DB.Backend} },
+			want:  []string{"9000", DBBackendSQLite},
+		},
+		{
+			name:  "an empty variable still overrides",
+			env:   map[string]string{"STORAGE_BUCKET": ""},
+			check: func(c *Config) interface{} { return c.Storage.Bucket },
+			want:  "",
+		},
+		{
+			name:  "ints",
+			env:   map[string]string{"POST_MAX_COMMUNITIES": "5"},
+			check: func(c *Config) interface{} { return c.Posts.MaxCommunities },
+			want:  5,
+		},
+		{
+			name:    "a malformed int",
+			env:     map[string]string{"POST_MAX_COMMUNITIES": "five"},
+			wantErr: "POST_MAX_COMMUNITIES must be an integer",
+		},
+		{
+			name:  "durations",
+			env:   map[string]string{"UPLOAD_TOKEN_TTL": "1h30m"},
+			check: func(c *Config) interface{} { return c.Uploads.TokenTTL },
+			want:  90 * time.Minute,
+		},
+		{
+			name:    "a malformed duration",
+			env:     map[string]string{"LIVE_HEARTBEAT": "30"},
+			wantErr: "LIVE_HEARTBEAT must be a duration",
+		},
+		{
+			name:  "bools",
+			env:   map[string]string{"WEBHOOK_ALLOW_PRIVATE_HOSTS": "true"},
+			check: func(c *Config) interface{} { return c.Webhooks.AllowPrivateHosts },
+			want:  true,
+		},
+		{
+			name:    "a malformed bool",
+			env:     map[string]string{"WEBHOOK_ALLOW_PRIVATE_HOSTS": "sometimes"},
+			wantErr: "WEBHOOK_ALLOW_PRIVATE_HOSTS must be true or false",
+		},
+		{
+			name:  "lists drop empty entries",
+			env:   map[string]string{"FE_ORIGINS": " http://a.edu ;; http://b.edu;"},
+			check: func(c *Config) interface{} { return c.FEOrigins },
+			want:  []string{"http://a.edu", "http://b.edu"},
+		},
+		{
+			name:  "thumbnail sizes",
+			env:   map[string]string{"IMAGE_THUMBNAIL_SIZES": "100;200"},
+			check: func(c *Config) interface{} { return c.Images.ThumbnailSizes },
+			want:  []int{100, 200},
+		},
+		{
+			name:    "malformed thumbnail sizes",
+			env:     map[string]string{"IMAGE_THUMBNAIL_SIZES": "100;big"},
+			wantErr: "IMAGE_THUMBNAIL_SIZES must be a ; separated list of integers",
+		},
+		{
+			name:  "a rate limit replaces one bucket of the group",
+			env:   map[string]string{"RATE_LIMIT_POSTS_USER": "3/1m"},
+			check: func(c *Config) interface{} { return c.RateLimits.Groups[RateLimitGroupPosts] },
+			want: RateLimitGroup{
+				User: RateLimit{Requests: 3, Per: time.Minute},
+				IP:   Default().RateLimits.Groups[RateLimitGroupPosts].IP,
+			},
+		},
+		{
+			name: "turning off both buckets drops the group",
+			env:  map[string]string{"RATE_LIMIT_VOTES_USER": "0", "RATE_LIMIT_VOTES_IP": "0"},
+			check: func(c *Config) interface{} {
+				_, ok := c.RateLimits.Groups[RateLimitGroupVotes]
+				return ok
+			},
+			want: false,
+		},
+		{
+			name:    "a malformed rate limit",
+			env:     map[string]string{"RATE_LIMIT_COMMENTS_IP": "10 per minute"},
+			wantErr: "RATE_LIMIT_COMMENTS_IP must look like 10/1m",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := Default()
+			err := cfg.applyEnv(lookupIn(test.env))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("applyEnv() = %v, want an error containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyEnv() = %v", err)
+			}
+			if got := test.check(cfg); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    RateLimit
+		wantErr bool
+	}{
+		{value: "10/1m", want: RateLimit{Requests: 10, Per: time.Minute}},
+		{value: " 5 / 30s ", want: RateLimit{Requests: 5, Per: 30 * time.Second}},
+		{value: "0", want: RateLimit{}},
+		{value: "10", wantErr: true},
+		{value: "ten/1m", wantErr: true},
+		{value: "10/minute", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseRateLimit(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseRateLimit(%q) error = %v, want an error: %v", test.value, err, test.wantErr)
+			continue
+		}
+		if err == nil && *got != test.want {
+			t.Errorf("parseRateLimit(%q) = %v, want %v", test.value, *got, test.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		// want are substrings of the problems, none if the config is valid
+		want []string
+	}{
+		{
+			name:   "the defaults with the required fields",
+			modify: func(c *Config) {},
+		},
+		{
+			name:   "port",
+			modify: func(c *Config) { c.Port = "" },
+			want:   []string{"port (PORT) must be set"},
+		},
+		{
+			name:   "fe origins",
+			modify: func(c *Config) { c.FEOrigins = nil },
+			want:   []string{"fe_origins (FE_ORIGINS)"},
+		},
+		{
+			name:   "a relative public url",
+			modify: func(c *Config) { c.PublicURL = "api.example.edu" },
+			want:   []string{"public_url (PUBLIC_URL) must be an absolute URL"},
+		},
+		{
+			name:   "gin mode",
+			modify: func(c *Config) { c.GinMode = "loud" },
+			want:   []string{"gin_mode (GIN_MODE)"},
+		},
+		{
+			name:   "a sealing key",
+			modify: func(c *Config) { c.DB.CreatorKey = testKey },
+		},
+		{
+			name:   "a sealing key that isn't base64",
+			modify: func(c *Config) { c.DB.CreatorKey = "not a key!" },
+			want:   []string{"db.creator_key (DB_CREATOR_KEY) must be 32 bytes"},
+		},
+		{
+			name:   "a short sealing key",
+			modify: func(c *Config) { c.DB.CreatorKey = "AAAA" },
+			want:   []string{"db.creator_key (DB_CREATOR_KEY) must be 32 bytes"},
+		},
+		{
+			name:   "the sqlite backend needs a path",
+			modify: func(c *Config) { c.DB.Backend = DBBackendSQLite },
+			want:   []string{"db.sqlite_path (SQLITE_PATH)"},
+		},
+		{
+			name: "more idle than open connections",
+			modify: func(c *Config) {
+				c.DB = DBConfig{Backend: DBBackendPlanetScale, User: "u", Host: "h", Name: "n", MaxOpenConns: 5, MaxIdleConns: 10}
+			},
+			want: []string{"db.max_idle_conns (DB_MAX_IDLE_CONNS)"},
+		},
+		{
+			name: "a rate limit without a period",
+			modify: func(c *Config) {
+				c.RateLimits.Groups[RateLimitGroupPosts] = RateLimitGroup{User: RateLimit{Requests: 5}}
+			},
+			want: []string{"rate_limits.groups.posts.user (RATE_LIMIT_POSTS_USER)"},
+		},
+		{
+			name: "negative requests",
+			modify: func(c *Config) {
+				c.RateLimits.Groups[RateLimitGroupVotes] = RateLimitGroup{IP: RateLimit{Requests: -1, Per: time.Minute}}
+			},
+			want: []string{"rate_limits.groups.votes.ip (RATE_LIMIT_VOTES_IP)"},
+		},
+		{
+			name: "an unknown rate limit group",
+			modify: func(c *Config) {
+				c.RateLimits.Groups["likes"] = RateLimitGroup{User: RateLimit{Requests: 1, Per: time.Minute}}
+			},
+			want: []string{"rate_limits.groups can only contain"},
+		},
+		{
+			name:   "an unknown rate limit store",
+			modify: func(c *Config) { c.RateLimits.Store = "redis" },
+			want:   []string{"rate_limits.store (RATE_LIMIT_STORE)"},
+		},
+		{
+			name:   "a gc grace period shorter than upload tokens last",
+			modify: func(c *Config) { c.GC.GracePeriod = time.Minute },
+			want:   []string{"gc.grace_period (GC_GRACE_PERIOD) can't be shorter than uploads.token_ttl"},
+		},
+		{
+			name:   "live events kept for less than a poll",
+			modify: func(c *Config) { c.Live.Retention = c.Live.PollInterval },
+			want:   []string{"live.retention (LIVE_RETENTION)"},
+		},
+		{
+			name:   "a webhook backoff that starts above its max",
+			modify: func(c *Config) { c.Webhooks.InitialBackoff = 2 * c.Webhooks.MaxBackoff },
+			want:   []string{"webhooks.initial_backoff (WEBHOOK_INITIAL_BACKOFF)"},
+		},
+		{
+			name: "the digest needs the public url and a sender",
+			modify: func(c *Config) {
+				c.Digest.Interval = 24 * time.Hour
+			},
+			want: []string{"public_url (PUBLIC_URL) must be set", "mail.from (MAIL_FROM)"},
+		},
+		{
+			name:   "push is only checked once it has a key",
+			modify: func(c *Config) { c.Push.Subject = "nobody" },
+		},
+		{
+			name:   "the firebase provider needs credentials",
+			modify: func(c *Config) { c.Auth.Provider = AuthProviderFirebase },
+			want:   []string{"firebase.credentials_path (GOOGLE_APPLICATION_CREDENTIALS)"},
+		},
+		{
+			name: "every problem is reported",
+			modify: func(c *Config) {
+				c.Port = ""
+				c.Images.JPEGQuality = 0
+				c.Uploads.TokenTTL = 0
+			},
+			want: []string{"port (PORT)", "images.jpeg_quality (IMAGE_JPEG_QUALITY)", "uploads.token_ttl (UPLOAD_TOKEN_TTL)"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := validServer()
+			test.modify(cfg)
+			var problems []string
+			for _, err := range []error{cfg.Validate(), cfg.ValidateServer()} {
+				if err != nil {
+					problems = append(problems, err.(ValidationError)...)
+				}
+			}
+			if len(test.want) == 0 && len(problems) > 0 {
+				t.Errorf("got problems %q, want none", problems)
+			}
+			for _, want := range test.want {
+				found := false
+				for _, problem := range problems {
+					found = found || strings.Contains(problem, want)
+				}
+				if !found {
+					t.Errorf("got problems %q, want one containing %q", problems, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	contents := `port: "7000"
+db:
+  backend: sqlite
+  sqlite_path: from-file.db
+rate_limits:
+  store: db
+  groups:
+    posts:
+      user: {requests: 2, per: 1m}
+`
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SQLITE_PATH", "from-env.db")
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != "7000" {
+		t.Errorf("Port = %q, want the file's 7000", cfg.Port)
+	}
+	if cfg.DB.SQLitePath != "from-env.db" {
+		t.Errorf("SQLitePath = %q, want the environment's from-env.db", cfg.DB.SQLitePath)
+	}
+	if cfg.Images.JPEGQuality != Default().Images.JPEGQuality {
+		t.Errorf("JPEGQuality = %v, want the default %v", cfg.Images.JPEGQuality, Default().Images.JPEGQuality)
+	}
+	if want := (RateLimit{Requests: 2, Per: time.Minute}); cfg.RateLimits.Groups[RateLimitGroupPosts].User != want {
+		t.Errorf("posts user limit = %v, want %v", cfg.RateLimits.Groups[RateLimitGroupPosts].User, want)
+	}
+	if got := cfg.RateLimits.Groups[RateLimitGroupPosts].IP; got.IsEnabled() {
+		t.Errorf("posts ip limit = %v, want it off since the file's group replaces the default", got)
+	}
+	if got, want := cfg.RateLimits.Groups[RateLimitGroupComments], Default().RateLimits.Groups[RateLimitGroupComments]; got != want {
+		t.Errorf("comments limits = %v, want the default %v", got, want)
+	}
+
+	if err := os.WriteFile(path, []byte("prot: \"7000\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFile(path); err == nil {
+		t.Error("LoadFile() of a file with an unknown field succeeded")
+	}
+}
+
+func TestExampleConfig(t *testing.T) {
+	// the example points at planetscale without credentials
+	t.Setenv("DB_BACKEND", DBBackendMemory)
+	if _, err := LoadFile(filepath.Join("..", "config.example.yaml")); err != nil {
+		t.Errorf("LoadFile() of the example = %v", err)
+	}
+}
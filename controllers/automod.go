@@ -0,0 +1,333 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxAutomodKeywords        = 200
+	maxAutomodKeywordLength   = 100
+	maxAutomodPatternLength   = 500
+	maxAutomodAllowedDomains  = 100
+	maxAutomodAccountAgeHours = 24 * 365
+	maxAutomodPostsPerHour    = 1000
+	maxAutomodImages          = 10
+)
+
+// linkPattern finds links written with a scheme or starting with www. Bare domains are left alone since they can't be
+// told apart from file names and typos
+var linkPattern = regexp.MustCompile(`(?i)(?:https?://|www\.)([a-z0-9](?:[a-z0-9.-]*[a-z0-9])?)`)
+
+// AutomodContent is new or edited content to check
+type AutomodContent struct {
+	IsComment bool
+	// IsNew is false for edits. Rate rules only count new posts
+	IsNew bool
+	// Text is everything the user wrote (the title and content of a post)
+	Text      string
+	NumImages int
+	// CommunityIds are the communities the content is in
+	CommunityIds []int64
+}
+
+// AutomodVerdict is the strongest outcome of the rules the content matched
+type AutomodVerdict struct {
+	Outcome model.AutomodOutcome
+	Rule    *model.AutomodRule
+}
+
+// Reason is the rule's reason, or a description of the rule if it doesn't have one
+func (v *AutomodVerdict) Reason() string {
+	if len(v.Rule.Reason) > 0 {
+		return v.Rule.Reason
+	}
+	return fmt.Sprintf("matched automod rule %v (%v)", v.Rule.Id, v.Rule.Type)
+}
+
+// compiledPattern is the pattern of a keyword or regex rule, along with the source it was compiled from
+type compiledPattern struct {
+	source  string
+	pattern *regexp.Regexp
+}
+
+// AutomodController checks content against the automod rules of its communities and their ancestors
+type AutomodController struct {
+	rules       db.AutomodDatabase
+	posts       db.PostDatabase
+	communities *CommunityController
+	policy      *Policy
+
+	patternsMu sync.Mutex
+	patterns   map[int64]*compiledPattern // by rule id
+}
+
+func NewAutomodController(rules db.AutomodDatabase, posts db.PostDatabase, communities *CommunityController, policy *Policy) *AutomodController {
+	return &AutomodController{
+		rules:       rules,
+		posts:       posts,
+		communities: communities,
+		policy:      policy,
+		patterns:    make(map[int64]*compiledPattern),
+	}
+}
+
+// RuleSaved compiles the pattern of the rule, which was just created or updated, so checks don't have to
+func (ac *AutomodController) RuleSaved(rule *model.AutomodRule) {
+	if rule.Type == model.AutomodRuleKeyword || rule.Type == model.AutomodRuleRegex {
+		// the rule was validated, so its pattern compiles
+		_, _ = ac.pattern(rule)
+	}
+}
+
+// RuleDeleted drops the compiled pattern of the rule
+func (ac *AutomodController) RuleDeleted(ruleId int64) {
+	ac.patternsMu.Lock()
+	defer ac.patternsMu.Unlock()
+	delete(ac.patterns, ruleId)
+}
+
+// Rules returns the rules that apply in the community, including the ones inherited from its ancestors
+func (ac *AutomodController) Rules(ctx context.Context, communityId int64) ([]*model.AutomodRule, error) {
+	return ac.rules.GetAutomodRules(ctx, ac.communities.Ancestors(communityId))
+}
+
+// Check returns nil if the content doesn't match any rule. The rules of each of the content's communities are skipped
+// for its moderators (and admins), so a moderator cross-posting is still checked in the communities they don't moderate
+func (ac *AutomodController) Check(ctx context.Context, user *model.LocalUser, content *AutomodContent) (*AutomodVerdict, error) {
+	var communityIds []int64
+	for _, communityId := range content.CommunityIds {
+		exempt, err := ac.policy.Can(ctx, user, ActionBypassAutomod, &Resource{CommunityIds: []int64{communityId}})
+		if err != nil {
+			return nil, err
+		}
+		if exempt {
+			continue
+		}
+		for _, id := range ac.communities.Ancestors(communityId) {
+			if !containsInt64(communityIds, id) {
+				communityIds = append(communityIds, id)
+			}
+		}
+	}
+	if len(communityIds) == 0 {
+		return nil, nil
+	}
+	rules, err := ac.rules.GetAutomodRules(ctx, communityIds)
+	if err != nil {
+		return nil, err
+	}
+
+	var verdict *AutomodVerdict
+	for _, rule := range rules {
+		if (content.IsComment && !rule.AppliesToComments()) || (!content.IsComment && !rule.AppliesToPosts()) {
+			continue
+		}
+		// a weaker rule can't change the verdict, so it isn't worth a query
+		if verdict != nil && !rule.Outcome.StrongerThan(verdict.Outcome) {
+			continue
+		}
+		matched, err := ac.matches(ctx, user, content, rule)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			verdict = &AutomodVerdict{Outcome: rule.Outcome, Rule: rule}
+		}
+	}
+	return verdict, nil
+}
+
+func (ac *AutomodController) matches(ctx context.Context, user *model.LocalUser, content *AutomodContent, rule *model.AutomodRule) (bool, error) {
+	params := &rule.Params
+	switch rule.Type {
+	case model.AutomodRuleKeyword, model.AutomodRuleRegex:
+		pattern, err := ac.pattern(rule)
+		if err != nil {
+			return false, err
+		}
+		return pattern.MatchString(content.Text), nil
+	case model.AutomodRuleLink:
+		for _, match := range linkPattern.FindAllStringSubmatch(content.Text, -1) {
+			if !isAllowedDomain(strings.ToLower(match[1]), params.AllowedDomains) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case model.AutomodRuleAccountAge:
+		// users created before account ages were recorded are old enough
+		if user.CreatedAt == nil {
+			return false, nil
+		}
+		return time.Since(*user.CreatedAt) < time.Duration(params.MinAccountAgeHours)*time.Hour, nil
+	case model.AutomodRuleRate:
+		if !content.IsNew {
+			return false, nil
+		}
+		return ac.exceedsRate(ctx, user, rule)
+	case model.AutomodRuleImages:
+		return content.NumImages < params.MinImages, nil
+	default:
+		return false, nil
+	}
+}
+
+// pattern returns the compiled pattern of the keyword or regex rule. Rules are loaded on every check, so the pattern is
+// compiled the first time the rule is loaded and again only if the rule changed since
+func (ac *AutomodController) pattern(rule *model.AutomodRule) (*regexp.Regexp, error) {
+	source := rule.Params.Pattern
+	if rule.Type == model.AutomodRuleKeyword {
+		source = keywordPattern(rule.Params.Keywords)
+	}
+	ac.patternsMu.Lock()
+	defer ac.patternsMu.Unlock()
+	if compiled, ok := ac.patterns[rule.Id]; ok && compiled.source == source {
+		return compiled.pattern, nil
+	}
+	pattern, err := regexp.Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	ac.patterns[rule.Id] = &compiledPattern{source: source, pattern: pattern}
+	return pattern, nil
+}
+
+// exceedsRate is true if the user already made the maximum number of posts in the rule's community in the last hour.
+// Deleted and held posts count
+func (ac *AutomodController) exceedsRate(ctx context.Context, user *model.LocalUser, rule *model.AutomodRule) (bool, error) {
+	posts, err := ac.posts.GetPosts(ctx, &db.PostsListQuery{
+		CommunityIds:   ac.communities.Descendants(rule.CommunityId),
+		IncludeDeleted: true,
+		IncludeHeld:    true,
+		ByUser:         &db.ByUser{Id: user.Id},
+		PageByDate:     &db.ByDatePaging{},
+		PostsListQueryOpts: &db.PostsListQueryOpts{
+			Limit: int16(rule.Params.MaxPostsPerHour),
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	since := time.Now().Add(-time.Hour)
+	recent := 0
+	for _, post := range posts {
+		if post.CreatedAt.After(since) {
+			recent++
+		}
+	}
+	return recent >= rule.Params.MaxPostsPerHour, nil
+}
+
+// ValidateAutomodRule checks the rule's type, outcome, target and the params of its type, and clears the params of
+// other types
+func ValidateAutomodRule(rule *model.AutomodRule) error {
+	if !rule.Outcome.IsValid() {
+		return fmt.Errorf("outcome must be one of %v, %v or %v", model.AutomodOutcomeFlag, model.AutomodOutcomeHold,
+			model.AutomodOutcomeReject)
+	}
+	switch rule.AppliesTo {
+	case "":
+		rule.AppliesTo = model.AutomodTargetAll
+	case model.AutomodTargetAll, model.AutomodTargetPosts, model.AutomodTargetComments:
+	default:
+		return fmt.Errorf("appliesTo must be one of %v, %v or %v", model.AutomodTargetAll, model.AutomodTargetPosts,
+			model.AutomodTargetComments)
+	}
+	if rule.Type.IsPostOnly() && rule.AppliesTo == model.AutomodTargetComments {
+		return fmt.Errorf("%v rules only apply to posts", rule.Type)
+	}
+
+	params := rule.Params
+	rule.Params = model.AutomodParams{}
+	switch rule.Type {
+	case model.AutomodRuleKeyword:
+		var keywords []string
+		for _, keyword := range params.Keywords {
+			if keyword = strings.TrimSpace(keyword); len(keyword) > 0 {
+				keywords = append(keywords, keyword)
+			}
+		}
+		if len(keywords) == 0 || len(keywords) > maxAutomodKeywords {
+			return fmt.Errorf("keywords must have between 1 and %v keywords", maxAutomodKeywords)
+		}
+		for _, keyword := range keywords {
+			if len(keyword) > maxAutomodKeywordLength {
+				return fmt.Errorf("keywords must be at most %v characters", maxAutomodKeywordLength)
+			}
+		}
+		rule.Params.Keywords = keywords
+	case model.AutomodRuleRegex:
+		if len(params.Pattern) == 0 || len(params.Pattern) > maxAutomodPatternLength {
+			return fmt.Errorf("pattern must be between 1 and %v characters", maxAutomodPatternLength)
+		}
+		if _, err := regexp.Compile(params.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %v", err)
+		}
+		rule.Params.Pattern = params.Pattern
+	case model.AutomodRuleLink:
+		if len(params.AllowedDomains) > maxAutomodAllowedDomains {
+			return fmt.Errorf("allowedDomains must have at most %v domains", maxAutomodAllowedDomains)
+		}
+		for _, domain := range params.AllowedDomains {
+			domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "www.")
+			if len(domain) == 0 || strings.ContainsAny(domain, "/: ") {
+				return errors.New("allowedDomains must be domain names")
+			}
+			rule.Params.AllowedDomains = append(rule.Params.AllowedDomains, domain)
+		}
+	case model.AutomodRuleAccountAge:
+		if params.MinAccountAgeHours < 1 || params.MinAccountAgeHours > maxAutomodAccountAgeHours {
+			return fmt.Errorf("minAccountAgeHours must be between 1 and %v", maxAutomodAccountAgeHours)
+		}
+		rule.Params.MinAccountAgeHours = params.MinAccountAgeHours
+	case model.AutomodRuleRate:
+		if params.MaxPostsPerHour < 1 || params.MaxPostsPerHour > maxAutomodPostsPerHour {
+			return fmt.Errorf("maxPostsPerHour must be between 1 and %v", maxAutomodPostsPerHour)
+		}
+		rule.Params.MaxPostsPerHour = params.MaxPostsPerHour
+	case model.AutomodRuleImages:
+		if params.MinImages < 1 || params.MinImages > maxAutomodImages {
+			return fmt.Errorf("minImages must be between 1 and %v", maxAutomodImages)
+		}
+		rule.Params.MinImages = params.MinImages
+	default:
+		return fmt.Errorf("unknown rule type %v", rule.Type)
+	}
+	return nil
+}
+
+// keywordPattern is the source of a pattern matching any of the keywords as a whole word, ignoring case
+func keywordPattern(keywords []string) string {
+	quoted := make([]string, len(keywords))
+	for i, keyword := range keywords {
+		quoted[i] = regexp.QuoteMeta(keyword)
+	}
+	return `(?i)(?:^|\W)(?:` + strings.Join(quoted, "|") + `)(?:\W|$)`
+}
+
+// isAllowedDomain is true if the host is one of the domains or a subdomain of one
+func isAllowedDomain(host string, domains []string) bool {
+	host = strings.TrimPrefix(host, "www.")
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt64(ids []int64, id int64) bool {
+	for _, other := range ids {
+		if other == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/config"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/navbryce/next-dorm-be/services"
+	"log"
+	"strings"
+	"time"
+)
+
+// BlobCollector deletes the user uploads nothing references anymore: images removed from (or attached to) deleted
+// content, uploads that were never attached and avatars of users that never created a profile. Upload sessions that
+// expired without being completed are deleted along with them
+type BlobCollector struct {
+	db    db.Database
+	store services.BlobStore
+	cfg   *config.GCConfig
+}
+
+// GCReport summarizes a collection. In a dry run Orphaned lists what would have been deleted
+type GCReport struct {
+	DryRun           bool
+	Scanned          int
+	Referenced       int
+	InGracePeriod    int // unreferenced, but too new to delete
+	Orphaned         []*services.BlobAttrs
+	OrphanedBytes    int64
+	FailedDeletes    int
+	AbandonedUploads int
+}
+
+func (r *GCReport) String() string {
+	var sb strings.Builder
+	verb := "deleted"
+	if r.DryRun {
+		verb = "would delete"
+	}
+	fmt.Fprintf(&sb, "scanned %v blobs: %v referenced, %v in the grace period, %v orphaned (%v bytes)\n",
+		r.Scanned, r.Referenced, r.InGracePeriod, len(r.Orphaned), r.OrphanedBytes)
+	fmt.Fprintf(&sb, "%v %v orphaned blobs and %v abandoned upload sessions", verb, len(r.Orphaned)-r.FailedDeletes,
+		r.AbandonedUploads)
+	if r.FailedDeletes > 0 {
+		fmt.Fprintf(&sb, "\nfailed to delete %v blobs", r.FailedDeletes)
+	}
+	return sb.String()
+}
+
+func NewBlobCollector(db db.Database, store services.BlobStore, cfg *config.GCConfig) *BlobCollector {
+	return &BlobCollector{db: db, store: store, cfg: cfg}
+}
+
+// Start runs a collection every cfg.Interval until ctx is done
+func (bc *BlobCollector) Start(ctx context.Context) {
+	ticker := time.NewTicker(bc.cfg.Interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				bc.collectPeriodically(ctx)
+			}
+		}
+	}()
+}
+
+// collectPeriodically keeps a panic during one collection from stopping the ones after it
+func (bc *BlobCollector) collectPeriodically(ctx context.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("recovered while collecting orphaned blobs", r)
+		}
+	}()
+	report, err := bc.Collect(ctx, false)
+	if err != nil {
+		log.Println("an error occurred while collecting orphaned blobs", err)
+		return
+	}
+	log.Println(report)
+}
+
+// Collect deletes unreferenced blobs older than the grace period. Nothing is deleted when dryRun is set
+func (bc *BlobCollector) Collect(ctx context.Context, dryRun bool) (*GCReport, error) {
+	cutoff := time.Now().Add(-bc.cfg.GracePeriod)
+	abandoned, err := bc.db.GetAbandonedUploads(ctx, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	referenced, err := bc.referencedBlobNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	blobs, err := bc.store.List(ctx, model.UploadsPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &GCReport{
+		DryRun:           dryRun,
+		Scanned:          len(blobs),
+		Orphaned:         []*services.BlobAttrs{},
+		AbandonedUploads: len(abandoned),
+	}
+	for _, blob := range blobs {
+		switch {
+		case referenced[blob.Name]:
+			report.Referenced++
+		case blob.Created.After(cutoff):
+			report.InGracePeriod++
+		default:
+			report.Orphaned = append(report.Orphaned, blob)
+			report.OrphanedBytes += blob.Size
+		}
+	}
+	if dryRun {
+		return report, nil
+	}
+
+	// the upload rows go first so the blobs can't be attached while they're being deleted
+	orphanedNames := make([]string, len(report.Orphaned))
+	for i, blob := range report.Orphaned {
+		orphanedNames[i] = blob.Name
+	}
+	completed, err := bc.db.GetCompletedUploads(ctx, orphanedNames)
+	if err != nil {
+		return nil, err
+	}
+	uploadIds := make([]int64, 0, len(completed)+len(abandoned))
+	for _, upload := range append(completed, abandoned...) {
+		uploadIds = append(uploadIds, upload.Id)
+	}
+	if err := bc.db.DeleteUploads(ctx, uploadIds); err != nil {
+		return nil, err
+	}
+
+	for _, blob := range report.Orphaned {
+		if err := bc.store.Delete(ctx, blob.Name); err != nil && !errors.Is(err, services.ErrBlobNotExist) {
+			log.Println("error deleting orphaned blob", blob.Name, err)
+			report.FailedDeletes++
+		}
+	}
+	return report, nil
+}
+
+// referencedBlobNames is every blob in use: images of live content, their thumbnails and avatars
+func (bc *BlobCollector) referencedBlobNames(ctx context.Context) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	imageBlobNames, err := bc.db.GetLiveImageBlobNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, blobName := range imageBlobNames {
+		referenced[blobName] = true
+	}
+	userIds, err := bc.db.GetUserIds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, userId := range userIds {
+		referenced[(&model.LocalUser{Id: userId}).AvatarBlobNameForUser()] = true
+	}
+	return referenced, nil
+}
@@ -94,6 +94,35 @@ func (cc *CommunityController) GetCommunityPos(c *gin.Context, id int64) (*model
 	}, nil
 }
 
+// Ancestors returns the id of the community followed by the ids of its ancestors, from the parent up to the root.
+// Communities missing from the cached tree are treated as roots
+func (cc *CommunityController) Ancestors(id int64) []int64 {
+	cc.cachedTreeLock.Lock()
+	tree := cc.cachedTree
+	cc.cachedTreeLock.Unlock()
+
+	ids := []int64{id}
+	for parent := tree.parentAdjList[id]; parent != nil && parent != AllCommunity; parent = tree.parentAdjList[parent.Id] {
+		ids = append(ids, parent.Id)
+	}
+	return ids
+}
+
+// Descendants returns the id of the community followed by the ids of all of its descendants
+func (cc *CommunityController) Descendants(id int64) []int64 {
+	cc.cachedTreeLock.Lock()
+	tree := cc.cachedTree
+	cc.cachedTreeLock.Unlock()
+
+	ids := []int64{id}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range tree.adjList[ids[i]] {
+			ids = append(ids, child.Id)
+		}
+	}
+	return ids
+}
+
 func (cc *CommunityController) attemptToUpdateCachedTree(c context.Context) {
 	if err := cc.updateCachedTree(c); err != nil {
 		log.Println("an error occurred while updating the cached tree", err)
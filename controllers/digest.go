@@ -0,0 +1,268 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/app"
+	"github.com/navbryce/next-dorm-be/config"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/navbryce/next-dorm-be/services"
+	"github.com/navbryce/next-dorm-be/util"
+	htmlTemplate "html/template"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	textTemplate "text/template"
+	"time"
+)
+
+const (
+	// DigestUnsubscribePath is where the unsubscribe links of the digest point, under the public URL
+	DigestUnsubscribePath = "/digest/unsubscribe"
+	// digestBatch is how many due digests are read per query
+	digestBatch = 50
+	// digestRetryDelay is how long a digest that couldn't be sent waits before it's tried again
+	digestRetryDelay      = time.Hour
+	maxDigestExcerpt      = 280 // characters
+	unsubscribeTokenBytes = 32
+)
+
+var (
+	//go:embed templates/digest.html
+	digestHTML         string
+	digestHTMLTemplate = htmlTemplate.Must(htmlTemplate.New("digest.html").Parse(digestHTML))
+	//go:embed templates/digest.txt
+	digestText         string
+	digestTextTemplate = textTemplate.Must(textTemplate.New("digest.txt").Parse(digestText))
+)
+
+// digestData is what the digest templates are executed with
+type digestData struct {
+	Subject     string
+	DisplayName string
+	// When is the period the posts are from, such as "this week"
+	When string
+	// Every is how often the digest is sent, such as "every week"
+	Every          string
+	Posts          []*digestPost
+	UnsubscribeURL string
+}
+
+type digestPost struct {
+	Title string
+	// Excerpt is the start of the content, as plain text
+	Excerpt string
+	// Communities are the names of the communities the post is in
+	Communities  string
+	VoteTotal    int64
+	CommentCount int64
+	// URL is empty when posts aren't linked
+	URL string
+}
+
+// NewUnsubscribeToken returns a random token for the unsubscribe links of a user's digest
+func NewUnsubscribeToken() (string, error) {
+	token := make([]byte, unsubscribeTokenBytes)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// Digester emails users who opted in the most popular posts of the communities they're subscribed to, over the last
+// day or week. Posts are ranked like the most popular feed, and shown like they are to signed out users
+type Digester struct {
+	db        db.Database
+	mailer    services.Mailer
+	cfg       *config.DigestConfig
+	publicURL string
+}
+
+// DigestReport summarizes a run
+type DigestReport struct {
+	Sent int
+	// Empty digests had no posts, so they weren't sent
+	Empty  int
+	Failed int
+}
+
+func (r *DigestReport) String() string {
+	return fmt.Sprintf("sent %v digests, skipped %v without posts and failed to send %v", r.Sent, r.Empty, r.Failed)
+}
+
+func NewDigester(db db.Database, mailer services.Mailer, cfg *config.DigestConfig, publicURL string) *Digester {
+	return &Digester{db: db, mailer: mailer, cfg: cfg, publicURL: strings.TrimSuffix(publicURL, "/")}
+}
+
+// Start sends the digests that are due every cfg.Interval until ctx is done
+func (d *Digester) Start(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.Interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				d.sendPeriodically(ctx)
+			}
+		}
+	}()
+}
+
+// sendPeriodically keeps a panic while sending digests from stopping the sends after it
+func (d *Digester) sendPeriodically(ctx context.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("recovered while sending digests", r)
+		}
+	}()
+	report, err := d.SendDue(ctx)
+	if err != nil {
+		log.Println("an error occurred while sending digests", err)
+	}
+	if report.Sent > 0 || report.Failed > 0 {
+		log.Println(report)
+	}
+}
+
+// SendDue sends every digest that is due. Each one is claimed before it's sent, so instances running at the same time
+// don't send it twice. A digest that can't be sent is retried after digestRetryDelay, until the next one is due
+func (d *Digester) SendDue(ctx context.Context) (*DigestReport, error) {
+	report := &DigestReport{}
+	now := time.Now()
+	for {
+		preferences, err := d.db.GetDueDigests(ctx, now, digestBatch)
+		if err != nil {
+			return report, err
+		}
+		for _, preference := range preferences {
+			claimed, err := d.db.ClaimDigest(ctx, preference.UserId, now, now.Add(digestRetryDelay))
+			if err != nil {
+				return report, err
+			}
+			if claimed {
+				d.send(ctx, preference, now, report)
+			}
+		}
+		if len(preferences) < digestBatch {
+			return report, nil
+		}
+	}
+}
+
+// send sends the digest of the user and schedules the next one. The next digest is due a period after this one was,
+// or a period from now if this one is more than a period late
+func (d *Digester) send(ctx context.Context, preference *model.DigestPreference, now time.Time, report *DigestReport) {
+	period := preference.Frequency.Period()
+	nextSendAt := preference.NextSendAt.Add(period)
+	if !nextSendAt.After(now) {
+		nextSendAt = now.Add(period)
+	}
+
+	var sentAt *time.Time
+	email, err := d.build(ctx, preference)
+	if err == nil && email != nil {
+		err = d.mailer.Send(ctx, email)
+	}
+	switch {
+	case err != nil:
+		log.Println("an error occurred while sending the digest of user", preference.UserId, err)
+		report.Failed++
+		if now.Add(digestRetryDelay).Before(nextSendAt) {
+			// the claim expires after digestRetryDelay, so it's retried then
+			return
+		}
+	case email == nil:
+		report.Empty++
+	default:
+		report.Sent++
+		sentAt = &now
+	}
+	if err := d.db.ScheduleDigest(ctx, preference.UserId, preference.Frequency, nextSendAt, sentAt); err != nil {
+		log.Println("an error occurred while scheduling the next digest of user", preference.UserId, err)
+	}
+}
+
+// build renders the digest of the user. Nil if there is nothing to send
+func (d *Digester) build(ctx context.Context, preference *model.DigestPreference) (*services.Email, error) {
+	user, err := d.db.GetUser(ctx, preference.UserId)
+	if err != nil || user == nil {
+		return nil, err
+	}
+	subs, err := d.db.GetSubsForUser(ctx, user.Id)
+	if err != nil || len(subs) == 0 {
+		return nil, err
+	}
+	communityIds := make([]int64, len(subs))
+	for i, sub := range subs {
+		communityIds[i] = sub.CommunityId
+	}
+
+	data := &digestData{
+		DisplayName:    user.DisplayName,
+		UnsubscribeURL: d.publicURL + DigestUnsubscribePath + "?token=" + url.QueryEscape(preference.UnsubscribeToken),
+	}
+	since := app.Since(app.SinceToday)
+	data.When, data.Every = "today", "every day"
+	if preference.Frequency == model.DigestWeekly {
+		since = app.SinceThisWeek
+		data.When, data.Every = "this week", "every week"
+	}
+	cursor := &app.MostPopularCursor{Communities: communityIds, Since: &since}
+	posts, _, err := cursor.Posts(ctx, d.db, user, &app.PostCursorOpts{Limit: int16(d.cfg.MaxPosts)})
+	if err != nil || len(posts) == 0 {
+		return nil, err
+	}
+	for _, post := range posts {
+		data.Posts = append(data.Posts, d.digestPost(post))
+	}
+	data.Subject = fmt.Sprintf("Top posts in your communities %v", data.When)
+
+	var html, text bytes.Buffer
+	if err := digestHTMLTemplate.Execute(&html, data); err != nil {
+		return nil, err
+	}
+	if err := digestTextTemplate.Execute(&text, data); err != nil {
+		return nil, err
+	}
+	return &services.Email{
+		To:      preference.Email,
+		Subject: data.Subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+		// lets mail clients unsubscribe in one click (RFC 8058)
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + data.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}, nil
+}
+
+func (d *Digester) digestPost(post *model.Post) *digestPost {
+	names := make([]string, len(post.Communities))
+	for i, community := range post.Communities {
+		names[i] = community.Name
+	}
+	excerpt := []rune(strings.Join(strings.Fields(util.StripHTML(post.Content)), " "))
+	if len(excerpt) > maxDigestExcerpt {
+		excerpt = append(excerpt[:maxDigestExcerpt], '…')
+	}
+	digestPost := &digestPost{
+		Title:        post.Title,
+		Excerpt:      string(excerpt),
+		Communities:  strings.Join(names, ", "),
+		VoteTotal:    post.VoteTotal,
+		CommentCount: post.CommentCount,
+	}
+	if d.cfg.PostURL != "" {
+		digestPost.URL = strings.ReplaceAll(d.cfg.PostURL, "{id}", strconv.FormatInt(post.Id, 10))
+	}
+	return digestPost
+}
@@ -0,0 +1,285 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/config"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/navbryce/next-dorm-be/services"
+	"github.com/navbryce/next-dorm-be/util"
+	"log"
+	"sync"
+	"time"
+)
+
+// liveSubscriptionBuffer is how many messages a stream can fall behind before it's closed
+const liveSubscriptionBuffer = 32
+
+// The events sent to the streams
+const (
+	LiveMessagePost    = "post"    // a new post in the community. data is the post
+	LiveMessageComment = "comment" // a new comment. data is the comment and the id of its parent
+	LiveMessageEdit    = "edit"    // the post or a comment was edited. data is the post or comment
+	LiveMessageRemove  = "remove"  // the post or a comment was deleted or held for review. data is their ids
+	LiveMessageVotes   = "votes"   // the votes of the post or a comment changed. data is their ids and totals
+)
+
+// PostTopic is followed by the stream of a post: new comments, and edits, deletes and votes of the post or its comments
+func PostTopic(postId int64) string {
+	return fmt.Sprintf("post:%v", postId)
+}
+
+// CommunityTopic is followed by the stream of a community feed: new posts in the community
+func CommunityTopic(communityId int64) string {
+	return fmt.Sprintf("community:%v", communityId)
+}
+
+// LiveMessage is an event as a subscriber sees it
+type LiveMessage struct {
+	Event string
+	Data  interface{}
+}
+
+type liveCommentData struct {
+	Comment         *model.Comment `json:"comment"`
+	ParentCommentId *int64         `json:"parentCommentId"`
+}
+
+type liveRemoveData struct {
+	PostId    int64  `json:"postId"`
+	CommentId *int64 `json:"commentId"`
+}
+
+type liveVotesData struct {
+	PostId    int64  `json:"postId"`
+	CommentId *int64 `json:"commentId"`
+	NumVotes  uint64 `json:"numVotes"`
+	VoteTotal int64  `json:"voteTotal"`
+}
+
+// LiveSubscription receives the messages of a topic, made displayable for its user. Messages is closed when the
+// subscription ends, including when the subscriber falls too far behind
+type LiveSubscription struct {
+	Messages <-chan *LiveMessage
+	messages chan *LiveMessage
+	topic    string
+	user     *model.LocalUser
+}
+
+// LiveController turns the events of the hub into messages for the streams of this instance. The content is read once
+// per event and shown to each subscriber through MakeDisplayableFor
+type LiveController struct {
+	hub     services.LiveHub
+	posts   db.PostDatabase
+	avatars *util.AvatarBuilder
+	cfg     *config.LiveConfig
+
+	mu            sync.Mutex
+	subscriptions map[string]map[*LiveSubscription]bool // by topic
+}
+
+func NewLiveController(hub services.LiveHub, posts db.PostDatabase, avatars *util.AvatarBuilder, cfg *config.LiveConfig) *LiveController {
+	return &LiveController{
+		hub:           hub,
+		posts:         posts,
+		avatars:       avatars,
+		cfg:           cfg,
+		subscriptions: make(map[string]map[*LiveSubscription]bool),
+	}
+}
+
+// Start delivers the events of the hub until ctx is done
+func (lc *LiveController) Start(ctx context.Context) {
+	lc.hub.Listen(ctx, lc.deliver)
+}
+
+// Heartbeat is how often an idle stream is pinged
+func (lc *LiveController) Heartbeat() time.Duration {
+	return lc.cfg.Heartbeat
+}
+
+// Publish sends the event to the streams of every instance. A failed publish doesn't fail the write, so errors are
+// logged instead of returned
+func (lc *LiveController) Publish(ctx context.Context, event *model.LiveEvent) {
+	if err := lc.hub.Publish(ctx, event); err != nil {
+		log.Println("an error occurred while publishing live event", event.Type, event.PostId, err)
+	}
+}
+
+// Subscribe follows the topic until Unsubscribe is called. user is nil for signed out subscribers
+func (lc *LiveController) Subscribe(topic string, user *model.LocalUser) *LiveSubscription {
+	messages := make(chan *LiveMessage, liveSubscriptionBuffer)
+	sub := &LiveSubscription{Messages: messages, messages: messages, topic: topic, user: user}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if lc.subscriptions[topic] == nil {
+		lc.subscriptions[topic] = make(map[*LiveSubscription]bool)
+	}
+	lc.subscriptions[topic][sub] = true
+	return sub
+}
+
+func (lc *LiveController) Unsubscribe(sub *LiveSubscription) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.remove(sub)
+}
+
+// remove closes the subscription if it's still open. must hold mu
+func (lc *LiveController) remove(sub *LiveSubscription) {
+	subs := lc.subscriptions[sub.topic]
+	if !subs[sub] {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(lc.subscriptions, sub.topic)
+	}
+	close(sub.messages)
+}
+
+// hasSubscribers lets events nobody on this instance follows skip reading the content
+func (lc *LiveController) hasSubscribers(topic string) bool {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	return len(lc.subscriptions[topic]) > 0
+}
+
+// send passes each subscriber of the topic the message build returns for them. A subscriber too far behind is closed,
+// and has to reconnect and refetch
+func (lc *LiveController) send(topic string, build func(user *model.LocalUser) *LiveMessage) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	for sub := range lc.subscriptions[topic] {
+		select {
+		case sub.messages <- build(sub.user):
+		default:
+			lc.remove(sub)
+		}
+	}
+}
+
+func (lc *LiveController) deliver(event *model.LiveEvent) {
+	ctx := context.Background()
+	if event.CommentId != nil {
+		lc.deliverComment(ctx, event)
+	} else {
+		lc.deliverPost(ctx, event)
+	}
+}
+
+func (lc *LiveController) deliverPost(ctx context.Context, event *model.LiveEvent) {
+	if event.Type == model.LiveEventDeleted {
+		lc.sendRemove(event)
+		return
+	}
+	// new posts go to the feeds of their communities, which aren't known yet
+	if event.Type != model.LiveEventCreated && !lc.hasSubscribers(PostTopic(event.PostId)) {
+		return
+	}
+	post, err := lc.posts.GetPostById(ctx, event.PostId, &db.PostQueryOpts{})
+	if err != nil {
+		log.Println("an error occurred while reading the post of live event", event.Type, event.PostId, err)
+		return
+	}
+	if post == nil {
+		return
+	}
+	// the post could have been held since the event was published
+	if post.Held {
+		if event.Type != model.LiveEventCreated {
+			lc.sendRemove(event)
+		}
+		return
+	}
+
+	switch event.Type {
+	case model.LiveEventCreated:
+		for _, community := range post.Communities {
+			lc.send(CommunityTopic(community.Id), func(user *model.LocalUser) *LiveMessage {
+				return &LiveMessage{Event: LiveMessagePost, Data: displayablePost(post, user, lc.avatars)}
+			})
+		}
+	case model.LiveEventEdited:
+		lc.send(PostTopic(post.Id), func(user *model.LocalUser) *LiveMessage {
+			return &LiveMessage{Event: LiveMessageEdit, Data: displayablePost(post, user, lc.avatars)}
+		})
+	case model.LiveEventVoted:
+		lc.send(PostTopic(post.Id), func(user *model.LocalUser) *LiveMessage {
+			return &LiveMessage{Event: LiveMessageVotes, Data: &liveVotesData{
+				PostId:    post.Id,
+				NumVotes:  post.NumVotes,
+				VoteTotal: post.VoteTotal,
+			}}
+		})
+	}
+}
+
+func (lc *LiveController) deliverComment(ctx context.Context, event *model.LiveEvent) {
+	if event.Type == model.LiveEventDeleted {
+		lc.sendRemove(event)
+		return
+	}
+	if !lc.hasSubscribers(PostTopic(event.PostId)) {
+		return
+	}
+	comment, err := lc.posts.GetCommentById(ctx, *event.CommentId)
+	if err != nil {
+		log.Println("an error occurred while reading the comment of live event", event.Type, *event.CommentId, err)
+		return
+	}
+	if comment == nil {
+		return
+	}
+	if comment.Held {
+		if event.Type != model.LiveEventCreated {
+			lc.sendRemove(event)
+		}
+		return
+	}
+
+	lc.send(PostTopic(event.PostId), func(user *model.LocalUser) *LiveMessage {
+		switch event.Type {
+		case model.LiveEventCreated:
+			return &LiveMessage{Event: LiveMessageComment, Data: &liveCommentData{
+				Comment:         displayableComment(comment, user, lc.avatars),
+				ParentCommentId: event.ParentCommentId,
+			}}
+		case model.LiveEventVoted:
+			return &LiveMessage{Event: LiveMessageVotes, Data: &liveVotesData{
+				PostId:    event.PostId,
+				CommentId: event.CommentId,
+				NumVotes:  comment.NumVotes,
+				VoteTotal: comment.VoteTotal,
+			}}
+		default:
+			return &LiveMessage{Event: LiveMessageEdit, Data: displayableComment(comment, user, lc.avatars)}
+		}
+	})
+}
+
+func (lc *LiveController) sendRemove(event *model.LiveEvent) {
+	lc.send(PostTopic(event.PostId), func(user *model.LocalUser) *LiveMessage {
+		return &LiveMessage{Event: LiveMessageRemove, Data: &liveRemoveData{PostId: event.PostId, CommentId: event.CommentId}}
+	})
+}
+
+// displayablePost copies the post before making it displayable, since MakeDisplayableFor mutates it and every
+// subscriber sees the same post
+func displayablePost(post *model.Post, user *model.LocalUser, avatars *util.AvatarBuilder) *model.Post {
+	cp := *post
+	metadata := *post.ContentMetadata
+	cp.ContentMetadata = metadata.MakeDisplayableFor(user)
+	avatars.AddTo(cp.ContentMetadata)
+	return &cp
+}
+
+// displayableComment is displayablePost for comments
+func displayableComment(comment *model.Comment, user *model.LocalUser, avatars *util.AvatarBuilder) *model.Comment {
+	cp := *comment
+	metadata := *comment.ContentMetadata
+	cp.ContentMetadata = metadata.MakeDisplayableFor(user)
+	avatars.AddTo(cp.ContentMetadata)
+	return &cp
+}
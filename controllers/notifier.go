@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"context"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"log"
+	"regexp"
+)
+
+// maxMentions caps how many users one post or comment can notify by mentioning them
+const maxMentions = 10
+
+// mentionPattern finds @displayName. Only display names made of letters, digits, '_', '.' and '-' can be mentioned, and
+// an @ inside a word (an email address) isn't a mention
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@.])@([\w.-]{4,})`)
+
+// NewContent is a post or comment that was just created (or released by a moderator)
+type NewContent struct {
+	SenderId string
+	PostId   int64
+	// CommentId is the id of the comment. Nil for posts
+	CommentId *int64
+	// Post is the post a comment is on. Nil for posts
+	Post *model.ContentMetadata
+	// Parent is the comment replied to. Nil for posts and for comments on the post itself
+	Parent *model.ContentMetadata
+	// Text is everything the sender wrote (the title and content of a post)
+	Text string
+}
+
+// Notifier fills the inboxes of the users a write concerns, and pushes the notifications to their devices. A failed
+// notification doesn't fail the write, so errors are logged instead of returned
+type Notifier struct {
+	notifications db.NotificationDatabase
+	users         db.UserDatabase
+	push          *PushController
+}
+
+func NewNotifier(notifications db.NotificationDatabase, users db.UserDatabase, push *PushController) *Notifier {
+	return &Notifier{notifications: notifications, users: users, push: push}
+}
+
+// ContentCreated notifies the creator of the comment replied to, the creator of the post and the users mentioned. A
+// user is notified once per content, with the most specific type, and never about their own content
+func (n *Notifier) ContentCreated(ctx context.Context, content *NewContent) {
+	var notifications []*model.Notification
+	notified := map[string]bool{content.SenderId: true}
+	add := func(recipientId string, notificationType model.NotificationType) {
+		if len(recipientId) == 0 || notified[recipientId] {
+			return
+		}
+		notified[recipientId] = true
+		notifications = append(notifications, &model.Notification{
+			RecipientId: recipientId,
+			Type:        notificationType,
+			PostId:      content.PostId,
+			CommentId:   content.CommentId,
+		})
+	}
+
+	add(creatorId(content.Parent), model.NotificationCommentReply)
+	add(creatorId(content.Post), model.NotificationPostReply)
+	mentioned, err := n.mentionedUsers(ctx, content.Text)
+	if err != nil {
+		log.Println("an error occurred while looking up the users mentioned in post", content.PostId, err)
+	}
+	for _, user := range mentioned {
+		add(user.Id, model.NotificationMention)
+	}
+	n.create(ctx, notifications, content.Text)
+}
+
+// ModAction notifies the creator of the content a moderator acted on. entry is the moderation log entry of the action,
+// after it was recorded. It's nil if the action wasn't logged, in which case no one is notified
+func (n *Notifier) ModAction(ctx context.Context, content *model.ContentMetadata, entry *model.ModLogEntry) {
+	if entry == nil {
+		return
+	}
+	recipientId := creatorId(content)
+	if len(recipientId) == 0 || recipientId == entry.ActorId || entry.PostId == nil {
+		return
+	}
+	n.create(ctx, []*model.Notification{{
+		RecipientId: recipientId,
+		Type:        model.NotificationModAction,
+		PostId:      *entry.PostId,
+		CommentId:   entry.CommentId,
+		ModAction:   entry.Action,
+		Reason:      entry.Reason,
+	}}, entry.Reason)
+}
+
+// create adds the notifications to the inboxes and pushes them. text is what they're about
+func (n *Notifier) create(ctx context.Context, notifications []*model.Notification, text string) {
+	if len(notifications) == 0 {
+		return
+	}
+	if err := n.notifications.CreateNotifications(ctx, notifications); err != nil {
+		log.Println("an error occurred while creating notifications", err)
+		return
+	}
+	n.push.NotificationsCreated(ctx, notifications, text)
+}
+
+// mentionedUsers returns the users mentioned in the text that exist, up to maxMentions
+func (n *Notifier) mentionedUsers(ctx context.Context, text string) ([]*model.LocalUser, error) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		if seen[match[1]] {
+			continue
+		}
+		seen[match[1]] = true
+		names = append(names, match[1])
+		if len(names) == maxMentions {
+			break
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	return n.users.GetUsersByDisplayNames(ctx, names)
+}
+
+// creatorId is the id of the content's creator. Empty if it isn't known
+func creatorId(content *model.ContentMetadata) string {
+	if content == nil || content.Creator == nil || content.Creator.LocalUser == nil {
+		return ""
+	}
+	return content.Creator.LocalUser.Id
+}
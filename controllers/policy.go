@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"context"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"time"
+)
+
+// maxActiveBans bounds the bans loaded for a single check
+const maxActiveBans = 100
+
+// Action is something a user may be allowed to do
+type Action string
+
+const (
+	ActionEditContent   Action = "EDIT_CONTENT"
+	ActionRemoveContent Action = "REMOVE_CONTENT"
+	// ActionViewHiddenByUser is listing the hidden content of Resource.UserId, which would tie it to the user
+	ActionViewHiddenByUser Action = "VIEW_HIDDEN_BY_USER"
+	ActionRevealCreator    Action = "REVEAL_CREATOR"
+	// ActionManageRole is granting or revoking Resource.Role in Resource.CommunityIds
+	ActionManageRole Action = "MANAGE_ROLE"
+	// ActionBanUser is issuing or lifting a ban of Resource.User in Resource.CommunityIds (a global ban if empty)
+	ActionBanUser Action = "BAN_USER"
+	// ActionViewBans is listing the bans in Resource.CommunityIds (every ban if empty)
+	ActionViewBans Action = "VIEW_BANS"
+	// ActionViewReports is listing the reports in Resource.CommunityIds (every report if empty)
+	ActionViewReports Action = "VIEW_REPORTS"
+	// ActionResolveReport is viewing and resolving the reports of a target in Resource.CommunityIds (a user reported
+	// outside of a community if empty)
+	ActionResolveReport Action = "RESOLVE_REPORT"
+	// ActionViewModLog is reading the moderation log of Resource.CommunityIds (the whole log if empty)
+	ActionViewModLog Action = "VIEW_MOD_LOG"
+	// ActionManageAutomod is listing and changing the automod rules of Resource.CommunityIds
+	ActionManageAutomod Action = "MANAGE_AUTOMOD"
+	// ActionManageWebhooks is listing and changing the webhooks of Resource.CommunityIds and reading their delivery logs
+	ActionManageWebhooks Action = "MANAGE_WEBHOOKS"
+	// ActionAnnounce is pushing a post to the devices of the subscribers of Resource.CommunityIds
+	ActionAnnounce Action = "ANNOUNCE"
+	// ActionBypassAutomod is writing in Resource.CommunityIds without automod checking the content
+	ActionBypassAutomod Action = "BYPASS_AUTOMOD"
+	// ActionViewHeld is seeing Resource.Content while it's held for review in Resource.CommunityIds
+	ActionViewHeld Action = "VIEW_HELD"
+)
+
+// Resource is what an action is performed on. Only the fields the action needs are set
+type Resource struct {
+	Content *model.ContentMetadata
+	// CommunityIds are the communities the resource is in
+	CommunityIds []int64
+	UserId       string
+	// User is the user acted on
+	User *model.LocalUser
+	Role model.Role
+}
+
+// Policy makes every authorization decision. A role (or ban) on a community applies to all of its descendants, and
+// every user with a profile is a member of every community
+type Policy struct {
+	roles       db.RoleDatabase
+	bans        db.BanDatabase
+	communities *CommunityController
+}
+
+func NewPolicy(roles db.RoleDatabase, bans db.BanDatabase, communities *CommunityController) *Policy {
+	return &Policy{roles: roles, bans: bans, communities: communities}
+}
+
+// Can is true if the user (nil when logged out) may perform the action on the resource
+func (p *Policy) Can(ctx context.Context, user *model.LocalUser, action Action, resource *Resource) (bool, error) {
+	if user == nil {
+		return false, nil
+	}
+	switch action {
+	case ActionEditContent:
+		if resource.Content.Status == model.StatusDeleted {
+			return false, nil
+		}
+		return isCreator(user, resource.Content) || user.IsAdmin, nil
+	case ActionRemoveContent:
+		if isCreator(user, resource.Content) {
+			return true, nil
+		}
+		return p.hasRoleInAny(ctx, user, model.RoleModerator, resource.CommunityIds)
+	case ActionViewHiddenByUser:
+		// not even admins. they go through the audited reveal API
+		return user.Id == resource.UserId, nil
+	case ActionRevealCreator:
+		return user.IsAdmin, nil
+	case ActionManageRole:
+		// moderators manage members below them. only admins appoint moderators
+		if !resource.Role.IsCommunityRole() {
+			return false, nil
+		}
+		if resource.Role == model.RoleModerator {
+			return user.IsAdmin, nil
+		}
+		return p.hasRoleInAll(ctx, user, model.RoleModerator, resource.CommunityIds)
+	case ActionBanUser:
+		if user.IsAdmin {
+			return true, nil
+		}
+		if len(resource.CommunityIds) == 0 || resource.User.IsAdmin {
+			return false, nil
+		}
+		// moderators can't ban each other
+		if isModerator, err := p.hasRoleInAny(ctx, resource.User, model.RoleModerator, resource.CommunityIds); err != nil || isModerator {
+			return false, err
+		}
+		return p.hasRoleInAll(ctx, user, model.RoleModerator, resource.CommunityIds)
+	case ActionViewBans, ActionViewReports, ActionViewModLog, ActionManageAutomod, ActionManageWebhooks, ActionAnnounce:
+		if user.IsAdmin {
+			return true, nil
+		}
+		if len(resource.CommunityIds) == 0 {
+			return false, nil
+		}
+		return p.hasRoleInAll(ctx, user, model.RoleModerator, resource.CommunityIds)
+	case ActionResolveReport:
+		if user.IsAdmin {
+			return true, nil
+		}
+		// like removing content, a moderator of any of the communities will do
+		return p.hasRoleInAny(ctx, user, model.RoleModerator, resource.CommunityIds)
+	case ActionBypassAutomod:
+		if user.IsAdmin {
+			return true, nil
+		}
+		return p.hasRoleInAll(ctx, user, model.RoleModerator, resource.CommunityIds)
+	case ActionViewHeld:
+		if isCreator(user, resource.Content) {
+			return true, nil
+		}
+		return p.hasRoleInAny(ctx, user, model.RoleModerator, resource.CommunityIds)
+	default:
+		return false, nil
+	}
+}
+
+// ActiveBan returns the ban that stops the user from writing in any of the communities, or nil if there isn't one.
+// Global bans apply everywhere, including to writes that aren't in a community. When several bans apply, the one that
+// ends last is returned
+func (p *Policy) ActiveBan(ctx context.Context, user *model.LocalUser, communityIds []int64) (*model.Ban, error) {
+	now := time.Now()
+	bans, err := p.bans.GetBans(ctx, &db.BansQuery{UserId: user.Id, ActiveAt: &now, Limit: maxActiveBans})
+	if err != nil {
+		return nil, err
+	}
+	covered := make(map[int64]bool)
+	for _, communityId := range communityIds {
+		for _, id := range p.communities.Ancestors(communityId) {
+			covered[id] = true
+		}
+	}
+	var activeBan *model.Ban
+	for _, ban := range bans {
+		if !ban.IsGlobal() && !covered[*ban.CommunityId] {
+			continue
+		}
+		if activeBan == nil || endsAfter(ban, activeBan) {
+			activeBan = ban
+		}
+	}
+	return activeBan, nil
+}
+
+// ModeratesAny is true if the user moderates any of the communities, or is an admin. It's what ActionViewHeld checks
+// for content the user didn't create, for callers checking many pieces of content in the same communities at once
+func (p *Policy) ModeratesAny(ctx context.Context, user *model.LocalUser, communityIds []int64) (bool, error) {
+	if user == nil {
+		return false, nil
+	}
+	return p.hasRoleInAny(ctx, user, model.RoleModerator, communityIds)
+}
+
+// RoleIn returns the role the user has in the community, including roles inherited from its ancestors
+func (p *Policy) RoleIn(ctx context.Context, user *model.LocalUser, communityId int64) (model.Role, error) {
+	roles, err := p.rolesIn(ctx, user, []int64{communityId})
+	if err != nil {
+		return "", err
+	}
+	return roles[0], nil
+}
+
+func (p *Policy) hasRoleInAny(ctx context.Context, user *model.LocalUser, role model.Role, communityIds []int64) (bool, error) {
+	roles, err := p.rolesIn(ctx, user, communityIds)
+	if err != nil {
+		return false, err
+	}
+	for _, userRole := range roles {
+		if userRole.AtLeast(role) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (p *Policy) hasRoleInAll(ctx context.Context, user *model.LocalUser, role model.Role, communityIds []int64) (bool, error) {
+	roles, err := p.rolesIn(ctx, user, communityIds)
+	if err != nil {
+		return false, err
+	}
+	for _, userRole := range roles {
+		if !userRole.AtLeast(role) {
+			return false, nil
+		}
+	}
+	return len(roles) > 0, nil
+}
+
+// rolesIn returns the role of the user in each of the communities
+func (p *Policy) rolesIn(ctx context.Context, user *model.LocalUser, communityIds []int64) ([]model.Role, error) {
+	roles := make([]model.Role, len(communityIds))
+	if user.IsAdmin {
+		for i := range roles {
+			roles[i] = model.RoleAdmin
+		}
+		return roles, nil
+	}
+
+	grants, err := p.roles.GetRolesForUser(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+	granted := make(map[int64]model.Role)
+	for _, grant := range grants {
+		granted[grant.CommunityId] = grant.Role
+	}
+	for i, communityId := range communityIds {
+		roles[i] = model.RoleMember
+		for _, id := range p.communities.Ancestors(communityId) {
+			if role, ok := granted[id]; ok && role.AtLeast(roles[i]) {
+				roles[i] = role
+			}
+		}
+	}
+	return roles, nil
+}
+
+func endsAfter(ban *model.Ban, other *model.Ban) bool {
+	if other.ExpiresAt == nil {
+		return false
+	}
+	return ban.ExpiresAt == nil || ban.ExpiresAt.After(*other.ExpiresAt)
+}
+
+func isCreator(user *model.LocalUser, content *model.ContentMetadata) bool {
+	return content.Creator.LocalUser != nil && user.Id == content.Creator.Id
+}
@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/navbryce/next-dorm-be/services"
+	"github.com/navbryce/next-dorm-be/util"
+	"log"
+	"strings"
+)
+
+const (
+	// PushAnnouncement is the type of the notifications moderators send to the subscribers of a community
+	PushAnnouncement = "ANNOUNCEMENT"
+	// announcementBatch is how many devices are read per query when announcing
+	announcementBatch = 500
+	maxPushBody       = 200 // characters
+)
+
+// pushTitles are the titles of the notifications pushed for inbox notifications. The sender isn't named, since they
+// could be hiding their content
+var pushTitles = map[model.NotificationType]string{
+	model.NotificationPostReply:    "New comment on your post",
+	model.NotificationCommentReply: "New reply to your comment",
+	model.NotificationMention:      "You were mentioned",
+	model.NotificationModAction:    "A moderator acted on your content",
+}
+
+// pushMessage is the payload of a notification, as the service worker of the PWA gets it
+type pushMessage struct {
+	// Type is the type of the inbox notification, or PushAnnouncement
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+	PostId    int64  `json:"postId"`
+	CommentId *int64 `json:"commentId,omitempty"`
+	// CommunityId is the community an announcement was made in
+	CommunityId *int64 `json:"communityId,omitempty"`
+}
+
+// PushController sends Web Push notifications to the devices of users: one for every notification added to their
+// inbox, and the announcements of the communities they're subscribed to. It does nothing when push isn't configured
+// (pusher is nil). A failed notification doesn't fail the write, so errors are logged instead of returned
+type PushController struct {
+	subscriptions db.PushDatabase
+	pusher        *services.WebPusher
+}
+
+func NewPushController(subscriptions db.PushDatabase, pusher *services.WebPusher) *PushController {
+	return &PushController{subscriptions: subscriptions, pusher: pusher}
+}
+
+// Enabled is false when push isn't configured
+func (pc *PushController) Enabled() bool {
+	return pc.pusher != nil
+}
+
+// NotificationsCreated pushes the notifications to the devices of their recipients. text is what the notifications are
+// about (the content written, or the reason of a moderator), which becomes the body
+func (pc *PushController) NotificationsCreated(ctx context.Context, notifications []*model.Notification, text string) {
+	if !pc.Enabled() || len(notifications) == 0 {
+		return
+	}
+	byRecipient := make(map[string]*model.Notification, len(notifications))
+	recipientIds := make([]string, 0, len(notifications))
+	for _, notification := range notifications {
+		if _, ok := byRecipient[notification.RecipientId]; !ok {
+			byRecipient[notification.RecipientId] = notification
+			recipientIds = append(recipientIds, notification.RecipientId)
+		}
+	}
+	subscriptions, err := pc.subscriptions.GetPushSubscriptions(ctx, recipientIds)
+	if err != nil {
+		log.Println("an error occurred while reading the push subscriptions of notified users", err)
+		return
+	}
+
+	body := pushBody(text)
+	byType := make(map[model.NotificationType][]*model.PushSubscription)
+	for _, subscription := range subscriptions {
+		notificationType := byRecipient[subscription.UserId].Type
+		byType[notificationType] = append(byType[notificationType], subscription)
+	}
+	// notifications of the same type point at the same content, so they share a payload
+	for notificationType, subscriptions := range byType {
+		notification := byRecipient[subscriptions[0].UserId]
+		pc.push(subscriptions, &pushMessage{
+			Type:      string(notificationType),
+			Title:     pushTitles[notificationType],
+			Body:      body,
+			PostId:    notification.PostId,
+			CommentId: notification.CommentId,
+		})
+	}
+}
+
+// Announce pushes the post to the devices of the users subscribed to the community, except the moderator announcing
+// it. Subscribers of the community's descendants aren't included. Returns how many devices it was queued for
+func (pc *PushController) Announce(ctx context.Context, community *model.Community, post *model.Post, actorId string) (int, error) {
+	if !pc.Enabled() {
+		return 0, nil
+	}
+	message := &pushMessage{
+		Type:        PushAnnouncement,
+		Title:       community.Name,
+		Body:        pushBody(post.Title),
+		PostId:      post.Id,
+		CommunityId: &community.Id,
+	}
+	var queued int
+	var afterId int64
+	for {
+		subscriptions, err := pc.subscriptions.GetCommunityPushSubscriptions(ctx, community.Id, afterId, announcementBatch)
+		if err != nil {
+			return queued, err
+		}
+		recipients := make([]*model.PushSubscription, 0, len(subscriptions))
+		for _, subscription := range subscriptions {
+			if subscription.UserId != actorId {
+				recipients = append(recipients, subscription)
+			}
+		}
+		pc.push(recipients, message)
+		queued += len(recipients)
+		if len(subscriptions) < announcementBatch {
+			return queued, nil
+		}
+		afterId = subscriptions[len(subscriptions)-1].Id
+	}
+}
+
+func (pc *PushController) push(subscriptions []*model.PushSubscription, message *pushMessage) {
+	if len(subscriptions) == 0 {
+		return
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		log.Println("an error occurred while encoding a push notification", err)
+		return
+	}
+	pc.pusher.Push(subscriptions, payload)
+}
+
+// pushBody is the start of the text, as plain text on one line
+func pushBody(text string) string {
+	body := []rune(strings.Join(strings.Fields(util.StripHTML(text)), " "))
+	if len(body) > maxPushBody {
+		body = append(body[:maxPushBody], '…')
+	}
+	return string(body)
+}
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/navbryce/next-dorm-be/util"
+	"log"
+	"time"
+)
+
+// webhookPayload is the body of a delivery
+type webhookPayload struct {
+	Event     model.WebhookEvent `json:"event"`
+	CreatedAt time.Time          `json:"createdAt"`
+	Data      interface{}        `json:"data"`
+}
+
+type webhookPostData struct {
+	Post *model.Post `json:"post"`
+}
+
+type webhookCommentData struct {
+	PostId          int64          `json:"postId"`
+	ParentCommentId *int64         `json:"parentCommentId"`
+	Comment         *model.Comment `json:"comment"`
+}
+
+type webhookPostDeletedData struct {
+	PostId int64 `json:"postId"`
+	// CommunityIds are the communities the post was removed from
+	CommunityIds []int64 `json:"communityIds"`
+}
+
+type webhookCommentDeletedData struct {
+	PostId    int64 `json:"postId"`
+	CommentId int64 `json:"commentId"`
+}
+
+// WebhookController queues deliveries for the webhooks of the communities a write happened in, and of their
+// ancestors. Content is shown to webhooks as it is to signed out users, so hidden content only carries the alias of its
+// creator. A failed delivery doesn't fail the write, so errors are logged instead of returned
+type WebhookController struct {
+	webhooks    db.WebhookDatabase
+	posts       db.PostDatabase
+	communities *CommunityController
+	avatars     *util.AvatarBuilder
+}
+
+func NewWebhookController(webhooks db.WebhookDatabase, posts db.PostDatabase, communities *CommunityController, avatars *util.AvatarBuilder) *WebhookController {
+	return &WebhookController{webhooks: webhooks, posts: posts, communities: communities, avatars: avatars}
+}
+
+// PostCreated queues post.created. Called once the post is visible, so not for posts held for review until they're
+// released
+func (wc *WebhookController) PostCreated(ctx context.Context, postId int64) {
+	post, err := wc.posts.GetPostById(ctx, postId, &db.PostQueryOpts{})
+	if err != nil {
+		log.Println("an error occurred while reading the post of webhook event", model.WebhookEventPostCreated, postId, err)
+		return
+	}
+	if post == nil {
+		return
+	}
+	wc.queue(ctx, model.WebhookEventPostCreated, communityIdsOf(post), nil, &webhookPostData{
+		Post: displayablePost(post, nil, wc.avatars),
+	})
+}
+
+// CommentCreated queues comment.created, like PostCreated
+func (wc *WebhookController) CommentCreated(ctx context.Context, post *model.Post, commentId int64, parentCommentId *int64) {
+	if post.Held {
+		return
+	}
+	comment, err := wc.posts.GetCommentById(ctx, commentId)
+	if err != nil {
+		log.Println("an error occurred while reading the comment of webhook event", model.WebhookEventCommentCreated, commentId, err)
+		return
+	}
+	if comment == nil {
+		return
+	}
+	wc.queue(ctx, model.WebhookEventCommentCreated, communityIdsOf(post), nil, &webhookCommentData{
+		PostId:          post.Id,
+		ParentCommentId: parentCommentId,
+		Comment:         displayableComment(comment, nil, wc.avatars),
+	})
+}
+
+// PostDeleted queues post.deleted. post is the post as it was before it was deleted
+func (wc *WebhookController) PostDeleted(ctx context.Context, post *model.Post) {
+	if post.Held || post.Status == model.StatusDeleted {
+		return
+	}
+	communityIds := communityIdsOf(post)
+	wc.queue(ctx, model.WebhookEventPostDeleted, communityIds, nil, &webhookPostDeletedData{
+		PostId:       post.Id,
+		CommunityIds: communityIds,
+	})
+}
+
+// PostRemovedFromCommunity queues post.deleted for the webhooks that can no longer see the cross-posted post. post is
+// the post as it was before it was removed from the community
+func (wc *WebhookController) PostRemovedFromCommunity(ctx context.Context, post *model.Post, communityId int64) {
+	if post.Held || post.Status == model.StatusDeleted {
+		return
+	}
+	var remaining []int64
+	for _, id := range communityIdsOf(post) {
+		if id != communityId {
+			remaining = append(remaining, id)
+		}
+	}
+	wc.queue(ctx, model.WebhookEventPostDeleted, []int64{communityId}, remaining, &webhookPostDeletedData{
+		PostId:       post.Id,
+		CommunityIds: []int64{communityId},
+	})
+}
+
+// CommentDeleted queues comment.deleted. comment is the comment as it was before it was deleted
+func (wc *WebhookController) CommentDeleted(ctx context.Context, post *model.Post, comment *model.Comment) {
+	if post.Held || comment.Held || comment.Status == model.StatusDeleted {
+		return
+	}
+	wc.queue(ctx, model.WebhookEventCommentDeleted, communityIdsOf(post), nil, &webhookCommentDeletedData{
+		PostId:    post.Id,
+		CommentId: comment.Id,
+	})
+}
+
+// queue creates a delivery of the event for every active webhook subscribed to it on the communities or their
+// ancestors, except the webhooks that also cover one of the excluded communities
+func (wc *WebhookController) queue(ctx context.Context, event model.WebhookEvent, communityIds []int64, excluded []int64, data interface{}) {
+	covered := make(map[int64]bool)
+	for _, communityId := range communityIds {
+		for _, id := range wc.communities.Ancestors(communityId) {
+			covered[id] = true
+		}
+	}
+	for _, communityId := range excluded {
+		for _, id := range wc.communities.Ancestors(communityId) {
+			delete(covered, id)
+		}
+	}
+	ids := make([]int64, 0, len(covered))
+	for id := range covered {
+		ids = append(ids, id)
+	}
+
+	webhooks, err := wc.webhooks.GetWebhooks(ctx, ids)
+	if err != nil {
+		log.Println("an error occurred while reading the webhooks of event", event, err)
+		return
+	}
+	var deliveries []*model.WebhookDelivery
+	var payload []byte
+	now := time.Now()
+	for _, webhook := range webhooks {
+		if !webhook.Active || !webhook.Events.Contains(event) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(&webhookPayload{Event: event, CreatedAt: now.UTC(), Data: data}); err != nil {
+				log.Println("an error occurred while encoding the payload of event", event, err)
+				return
+			}
+		}
+		deliveries = append(deliveries, &model.WebhookDelivery{
+			WebhookId:     webhook.Id,
+			Event:         event,
+			Payload:       string(payload),
+			Status:        model.WebhookDeliveryPending,
+			NextAttemptAt: &now,
+		})
+	}
+	if err := wc.webhooks.CreateWebhookDeliveries(ctx, deliveries); err != nil {
+		log.Println("an error occurred while queueing the deliveries of event", event, err)
+	}
+}
+
+func communityIdsOf(post *model.Post) []int64 {
+	communityIds := make([]int64, len(post.Communities))
+	for i, community := range post.Communities {
+		communityIds[i] = community.Id
+	}
+	return communityIds
+}
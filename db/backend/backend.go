@@ -0,0 +1,46 @@
+package backend
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/config"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/db/internal/sealed"
+	"github.com/navbryce/next-dorm-be/db/memory"
+	"github.com/navbryce/next-dorm-be/db/migrations"
+	"github.com/navbryce/next-dorm-be/db/planetscale"
+	"github.com/navbryce/next-dorm-be/db/sqlite"
+	"io/fs"
+)
+
+// Open returns the db.Database implementation named by cfg.Backend
+func Open(cfg *config.DBConfig) (appDb.Database, error) {
+	sealer, err := sealed.FromBase64(cfg.CreatorKey)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.Backend {
+	case config.DBBackendPlanetScale:
+		return planetscale.GetDatabase(cfg, sealer)
+	case config.DBBackendSQLite:
+		return sqlite.GetDatabase(cfg.SQLitePath, sealer)
+	case config.DBBackendMemory:
+		return memory.GetDatabase(), nil
+	default:
+		return nil, fmt.Errorf("unknown db backend %v", cfg.Backend)
+	}
+}
+
+// OpenSQLDB returns the raw connection pool for cfg.Backend along with the migrations written for it
+func OpenSQLDB(cfg *config.DBConfig) (*sql.DB, fs.FS, error) {
+	switch cfg.Backend {
+	case config.DBBackendPlanetScale:
+		sqlDB, err := planetscale.OpenSQLDB(cfg)
+		return sqlDB, migrations.Files, err
+	case config.DBBackendSQLite:
+		sqlDB, err := sqlite.OpenSQLDB(cfg.SQLitePath)
+		return sqlDB, migrations.SQLiteFiles(), err
+	default:
+		return nil, nil, fmt.Errorf("the %v backend has no SQL database", cfg.Backend)
+	}
+}
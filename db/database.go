@@ -18,6 +18,23 @@ type Database interface {
 	PostDatabase
 	SubscriptionDatabase
 	UserDatabase
+	UploadDatabase
+	AliasDatabase
+	RevealDatabase
+	RoleDatabase
+	BanDatabase
+	ReportDatabase
+	ModLogDatabase
+	AutomodDatabase
+	RateLimitDatabase
+	NotificationDatabase
+	LiveEventDatabase
+	WebhookDatabase
+	DigestDatabase
+	PushDatabase
+	// SealCreators seals the creators of hidden content (and the thread aliases) stored before db.creator_key was
+	// set. Returns the number of rows sealed
+	SealCreators(ctx context.Context) (int64, error)
 	GetSQLDB() *sql.DB
 	Close() error
 }
@@ -32,17 +49,26 @@ type CommunityDatabase interface {
 }
 
 type CreateContentMetadata struct {
-	CreatorId      string
-	Visibility     model.Visibility
-	CreatorAlias   string // only required if visibility is None
-	ImageBlobNames []string
+	CreatorId    string
+	Visibility   model.Visibility
+	CreatorAlias string // only required if visibility is None
+	Images       []*model.Image
+	Held         bool
+	// AutomodReport puts the content in the moderation queue, reported by automod, in the same transaction. The id of
+	// the new post or comment is set in its target. nil if automod didn't hold or flag it
+	AutomodReport *CreateReport
 }
 
 type EditContentMetadata struct {
 	CreatorAlias           string
-	ImageBlobNamesToAdd    []string
+	ImagesToAdd            []*model.Image
 	ImageBlobNamesToRemove []string
 	Visibility             model.Visibility
+	ModLog                 *model.ModLogEntry // nil if the edit isn't logged
+	Held                   bool               // holds the content for review. Held content stays held either way
+	// AutomodReport puts the content in the moderation queue, reported by automod, in the same transaction. Nothing
+	// is reported if automod already reported the content there. nil if automod didn't hold or flag it
+	AutomodReport *CreateReport
 }
 
 type CreatePost struct {
@@ -70,11 +96,6 @@ type EditComment struct {
 	Content string
 }
 
-type CreateReport struct {
-	PostId int64
-	Reason string
-}
-
 type PostQueryOpts struct {
 	VoteHistoryOf string
 }
@@ -86,6 +107,7 @@ type ByUser struct {
 type PostsListQuery struct {
 	CommunityIds   []int64
 	IncludeDeleted bool
+	IncludeHeld    bool
 	*ByUser
 	Visibility *model.Visibility
 	PageByDate *ByDatePaging
@@ -118,14 +140,20 @@ type PostDatabase interface {
 	EditPost(ctx context.Context, id int64, req *EditPost) error
 	CreateComment(ctx context.Context, req *CreateComment) (commentId int64, err error)
 	EditComment(ctx context.Context, id int64, req *EditComment) error
-	MarkPostAsDeleted(context.Context, int64) error
-	MarkCommentAsDeleted(context.Context, int64) error
+	MarkPostAsDeleted(ctx context.Context, id int64, modLog *model.ModLogEntry) error
+	MarkCommentAsDeleted(ctx context.Context, id int64, modLog *model.ModLogEntry) error
+	// SetContentHeld holds the post or comment for review, or releases it. Either way it's no longer held on create
+	SetContentHeld(ctx context.Context, metadataId int64, held bool) error
+	// RemovePostFromCommunity takes the post out of one of its communities. Returns ErrNotFound if the post isn't in
+	// the community and ErrLastCommunity if it's the only one the post is in
+	RemovePostFromCommunity(ctx context.Context, postId int64, communityId int64, modLog *model.ModLogEntry) error
 	GetPostById(context.Context, int64, *PostQueryOpts) (*model.Post, error)
 	GetPosts(context.Context, *PostsListQuery) ([]*model.Post, error)
 	GetCommentById(ctx context.Context, id int64) (*model.Comment, error)
 	GetCommentForest(ctx context.Context, rootMetadataId int64, opts *CommentTreeQueryOpts) ([]*model.CommentTree, error)
 	Vote(ctx context.Context, userId string, contentMetadataId int64, value int8) error
-	CreateReport(ctx context.Context, userId string, req *CreateReport) (reportId int64, err error)
+	// GetLiveImageBlobNames returns the blobs of the images (and thumbnails) attached to content that isn't deleted
+	GetLiveImageBlobNames(ctx context.Context) ([]string, error)
 }
 
 type SubscriptionDatabase interface {
@@ -137,4 +165,274 @@ type SubscriptionDatabase interface {
 type UserDatabase interface {
 	CreateUser(context.Context, *model.LocalUser) error
 	GetUser(context.Context, string) (*model.LocalUser, error)
+	GetUserIds(context.Context) ([]string, error)
+	// GetUsersByDisplayNames returns the users with any of the display names, in no particular order
+	GetUsersByDisplayNames(ctx context.Context, displayNames []string) ([]*model.LocalUser, error)
+}
+
+type UploadDatabase interface {
+	CreateUpload(context.Context, *model.Upload) (uploadId int64, err error)
+	// GetUploadByTokenHash returns nil if there is no upload for the token
+	GetUploadByTokenHash(ctx context.Context, tokenHash string) (*model.Upload, error)
+	// CompleteUpload marks the upload as completed. Returns ErrNotFound if it already is, so only one request can
+	// complete it
+	CompleteUpload(ctx context.Context, id int64, size int64) error
+	// ReopenUpload undoes CompleteUpload, such as when the blob couldn't be stored
+	ReopenUpload(ctx context.Context, id int64) error
+	// GetCompletedUploads returns the completed uploads of the blobs (in no particular order)
+	GetCompletedUploads(ctx context.Context, blobNames []string) ([]*model.Upload, error)
+	// SetUploadProcessed marks the completed uploads of the blob as processed
+	SetUploadProcessed(ctx context.Context, blobName string) error
+	// GetAbandonedUploads returns the uploads that expired before expiredBefore without being completed
+	GetAbandonedUploads(ctx context.Context, expiredBefore time.Time) ([]*model.Upload, error)
+	DeleteUploads(ctx context.Context, ids []int64) error
+}
+
+// AliasDatabase holds the alias each user posts hidden content under in a thread (a post and its comments)
+type AliasDatabase interface {
+	// GetThreadAlias returns "" if the user doesn't have an alias in the thread
+	GetThreadAlias(ctx context.Context, postMetadataId int64, userId string) (string, error)
+	// CreateThreadAlias returns a dup key error if the user already has an alias in the thread or another user has
+	// the alias
+	CreateThreadAlias(ctx context.Context, postMetadataId int64, userId string, alias string) error
+}
+
+type RevealsQuery struct {
+	AdminId  string // every admin if empty
+	PostId   int64  // every post if 0
+	BeforeId int64  // only reveals older than this one if not 0
+	Limit    int
+}
+
+// RevealDatabase is the audit log of admins revealing the creators of hidden content. It's append-only
+type RevealDatabase interface {
+	CreateReveal(ctx context.Context, reveal *model.Reveal, modLog *model.ModLogEntry) (revealId int64, err error)
+	// GetReveals returns the newest reveals first
+	GetReveals(context.Context, *RevealsQuery) ([]*model.Reveal, error)
+}
+
+// RoleDatabase holds the roles granted on communities. A user has at most one role per community
+type RoleDatabase interface {
+	// GrantRole replaces any role the user already has in the community
+	GrantRole(ctx context.Context, grant *model.RoleGrant, modLog *model.ModLogEntry) error
+	RevokeRole(ctx context.Context, userId string, communityId int64, modLog *model.ModLogEntry) error
+	GetRolesForUser(ctx context.Context, userId string) ([]*model.RoleGrant, error)
+	GetRolesInCommunity(ctx context.Context, communityId int64) ([]*model.RoleGrant, error)
+}
+
+type BansQuery struct {
+	UserId      string     // every user if empty
+	CommunityId *int64     // bans of every scope if nil
+	ActiveAt    *time.Time // only bans that are in effect at the time if not nil
+	BeforeId    int64      // only bans older than this one if not 0
+	Limit       int
+}
+
+type BanDatabase interface {
+	CreateBan(ctx context.Context, ban *model.Ban, modLog *model.ModLogEntry) (banId int64, err error)
+	// GetBan returns nil if the ban doesn't exist
+	GetBan(ctx context.Context, id int64) (*model.Ban, error)
+	// GetBans returns the newest bans first
+	GetBans(context.Context, *BansQuery) ([]*model.Ban, error)
+	LiftBan(ctx context.Context, id int64, liftedBy string, modLog *model.ModLogEntry) error
+}
+
+type CreateReport struct {
+	Target *model.ReportTarget
+	Reason string
+}
+
+type ReportGroupsQuery struct {
+	// CommunityIds only includes groups of content in (and users reported in) one of the communities. Every group if
+	// nil
+	CommunityIds []int64
+	Status       model.ReportStatus     // every status if empty
+	TargetType   model.ReportTargetType // every type if empty
+	BeforeId     int64                  // only groups older than this one if not 0
+	Limit        int
+}
+
+type ResolveReportGroup struct {
+	Status     model.ReportStatus
+	ResolvedBy string
+	Resolution *string // nil if the moderator didn't leave a note
+	ModLog     *model.ModLogEntry
+	// the actions taken against the target, in the same transaction. nil if they aren't taken
+	Remove *RemoveReportedContent
+	Reveal *CreateReveal // the creator of hidden content is revealed to ban them
+	Ban    *CreateBan
+}
+
+// RemoveReportedContent removes the post, or the comment if CommentId is set
+type RemoveReportedContent struct {
+	PostId    int64
+	CommentId *int64
+	ModLog    *model.ModLogEntry
+}
+
+// CreateReveal records Reveal and sets its id
+type CreateReveal struct {
+	Reveal *model.Reveal
+	ModLog *model.ModLogEntry
+}
+
+// CreateBan records Ban and sets its id
+type CreateBan struct {
+	Ban    *model.Ban
+	ModLog *model.ModLogEntry
+}
+
+// ReportDatabase holds the reports of content and users, grouped per target
+type ReportDatabase interface {
+	// CreateReport adds the report to the open group of its target, opening one if there isn't one. Returns a dup key
+	// error if the user already reported the target in the group
+	CreateReport(ctx context.Context, reporterId string, req *CreateReport) (*model.Report, error)
+	// GetReportGroup returns nil if the group doesn't exist
+	GetReportGroup(ctx context.Context, id int64) (*model.ReportGroup, error)
+	// GetReportGroups returns the newest groups first
+	GetReportGroups(context.Context, *ReportGroupsQuery) ([]*model.ReportGroup, error)
+	// GetReports returns the reports of the group, oldest first
+	GetReports(ctx context.Context, groupId int64) ([]*model.Report, error)
+	// ResolveReportGroup closes the group and takes the actions of the request. Returns ErrNotFound, and takes none of
+	// them, if the group isn't open
+	ResolveReportGroup(ctx context.Context, id int64, req *ResolveReportGroup) error
+}
+
+type ModLogQuery struct {
+	// CommunityIds only includes entries in one of the communities. Every entry if nil
+	CommunityIds []int64
+	ActorId      string          // every actor if empty
+	Action       model.ModAction // every action if empty
+	BeforeId     int64           // only entries older than this one if not 0
+	Limit        int
+}
+
+// ModLogDatabase is the moderation log. It's append-only. The methods of moderation actions take the entry that
+// records the action (nil if it isn't logged) and add it in the same transaction. Entries of actions that create a row
+// get the id of the row as their target
+type ModLogDatabase interface {
+	CreateModLogEntry(context.Context, *model.ModLogEntry) (entryId int64, err error)
+	// GetModLogEntries returns the newest entries first
+	GetModLogEntries(context.Context, *ModLogQuery) ([]*model.ModLogEntry, error)
+}
+
+// AutomodDatabase holds the automod rules of the communities
+type AutomodDatabase interface {
+	CreateAutomodRule(ctx context.Context, rule *model.AutomodRule, modLog *model.ModLogEntry) (ruleId int64, err error)
+	// UpdateAutomodRule replaces the outcome, target, params and reason of the rule
+	UpdateAutomodRule(ctx context.Context, rule *model.AutomodRule, modLog *model.ModLogEntry) error
+	DeleteAutomodRule(ctx context.Context, id int64, modLog *model.ModLogEntry) error
+	// GetAutomodRule returns nil if the rule doesn't exist
+	GetAutomodRule(ctx context.Context, id int64) (*model.AutomodRule, error)
+	// GetAutomodRules returns the rules set directly on any of the communities, oldest first
+	GetAutomodRules(ctx context.Context, communityIds []int64) ([]*model.AutomodRule, error)
+}
+
+// RateLimitDatabase holds the rate limit buckets the instances of the web server share
+type RateLimitDatabase interface {
+	// UpdateRateLimitBuckets passes the buckets of the keys (nil for those there isn't one of) to update and saves the
+	// buckets it returns, in the same order. Updates sharing a key don't interleave
+	UpdateRateLimitBuckets(ctx context.Context, keys []string, update func([]*model.RateLimitBucket) []*model.RateLimitBucket) error
+	// DeleteRateLimitBuckets removes the buckets last updated before the time
+	DeleteRateLimitBuckets(ctx context.Context, updatedBefore time.Time) error
+}
+
+type NotificationsQuery struct {
+	UserId     string
+	UnreadOnly bool
+	BeforeId   int64 // only notifications older than this one if not 0
+	Limit      int
+}
+
+// NotificationDatabase holds the inboxes of the users
+type NotificationDatabase interface {
+	CreateNotifications(ctx context.Context, notifications []*model.Notification) error
+	// GetNotifications returns the newest notifications first
+	GetNotifications(context.Context, *NotificationsQuery) ([]*model.Notification, error)
+	CountUnreadNotifications(ctx context.Context, userId string) (int64, error)
+	// MarkNotificationsRead marks the user's notifications with the ids read, or all of them if ids is nil
+	MarkNotificationsRead(ctx context.Context, userId string, ids []int64) error
+}
+
+// LiveEventDatabase passes live events between the instances of the web server
+type LiveEventDatabase interface {
+	CreateLiveEvent(ctx context.Context, event *model.LiveEvent) (int64, error)
+	// GetLiveEvents returns up to limit events with ids greater than afterId, oldest first
+	GetLiveEvents(ctx context.Context, afterId int64, limit int) ([]*model.LiveEvent, error)
+	// GetLastLiveEventId returns 0 if there are no events
+	GetLastLiveEventId(ctx context.Context) (int64, error)
+	// DeleteLiveEvents removes the events created before the time
+	DeleteLiveEvents(ctx context.Context, createdBefore time.Time) error
+}
+
+type WebhookDeliveriesQuery struct {
+	WebhookId int64
+	Status    model.WebhookDeliveryStatus // every status if empty
+	BeforeId  int64                       // only deliveries older than this one if not 0
+	Limit     int
+}
+
+// WebhookDatabase holds the webhooks of the communities and the log of what was sent to them
+type WebhookDatabase interface {
+	CreateWebhook(ctx context.Context, webhook *model.Webhook, modLog *model.ModLogEntry) (webhookId int64, err error)
+	// UpdateWebhook replaces the url, events and active flag of the webhook
+	UpdateWebhook(ctx context.Context, webhook *model.Webhook, modLog *model.ModLogEntry) error
+	// DeleteWebhook removes the webhook and its deliveries
+	DeleteWebhook(ctx context.Context, id int64, modLog *model.ModLogEntry) error
+	// GetWebhook returns nil if the webhook doesn't exist
+	GetWebhook(ctx context.Context, id int64) (*model.Webhook, error)
+	// GetWebhooks returns the webhooks set directly on any of the communities, oldest first
+	GetWebhooks(ctx context.Context, communityIds []int64) ([]*model.Webhook, error)
+
+	// CreateWebhookDeliveries sets the ids of the deliveries
+	CreateWebhookDeliveries(ctx context.Context, deliveries []*model.WebhookDelivery) error
+	// GetWebhookDelivery returns nil if the delivery doesn't exist
+	GetWebhookDelivery(ctx context.Context, id int64) (*model.WebhookDelivery, error)
+	// GetWebhookDeliveries returns the newest deliveries first
+	GetWebhookDeliveries(context.Context, *WebhookDeliveriesQuery) ([]*model.WebhookDelivery, error)
+	// GetDueWebhookDeliveries returns up to limit pending deliveries whose next attempt is at or before the time, the
+	// ones due first first
+	GetDueWebhookDeliveries(ctx context.Context, dueAt time.Time, limit int) ([]*model.WebhookDelivery, error)
+	// ClaimWebhookDelivery pushes the next attempt of the delivery to leaseUntil if it's still pending and due at
+	// dueAt. False if it isn't, such as when another instance claimed it first
+	ClaimWebhookDelivery(ctx context.Context, id int64, dueAt time.Time, leaseUntil time.Time) (bool, error)
+	// UpdateWebhookDelivery saves the status, attempts, next attempt and last response of the delivery
+	UpdateWebhookDelivery(context.Context, *model.WebhookDelivery) error
+	// DeleteWebhookDeliveries removes the deliveries that are no longer pending and were created before the time
+	DeleteWebhookDeliveries(ctx context.Context, createdBefore time.Time) error
+}
+
+// DigestDatabase holds who gets the email digest, how often, and when the next one is due
+type DigestDatabase interface {
+	CreateDigestPreference(context.Context, *model.DigestPreference) error
+	// UpdateDigestPreference replaces the email, frequency and next digest of the user
+	UpdateDigestPreference(context.Context, *model.DigestPreference) error
+	// GetDigestPreference returns nil if the user never opted in
+	GetDigestPreference(ctx context.Context, userId string) (*model.DigestPreference, error)
+	// GetDigestPreferenceByToken returns nil if no preference has the unsubscribe token
+	GetDigestPreferenceByToken(ctx context.Context, token string) (*model.DigestPreference, error)
+	// GetDueDigests returns up to limit preferences whose next digest is at or before the time, the ones due first first
+	GetDueDigests(ctx context.Context, dueAt time.Time, limit int) ([]*model.DigestPreference, error)
+	// ClaimDigest pushes the next digest of the user to leaseUntil if it's still due at dueAt. False if it isn't, such
+	// as when another instance claimed it first
+	ClaimDigest(ctx context.Context, userId string, dueAt time.Time, leaseUntil time.Time) (bool, error)
+	// ScheduleDigest sets when the next digest of the user is due, and when the last one was sent if sentAt isn't nil.
+	// Does nothing if the frequency changed since the digest was claimed
+	ScheduleDigest(ctx context.Context, userId string, frequency model.DigestFrequency, nextSendAt time.Time, sentAt *time.Time) error
+}
+
+// PushDatabase holds the devices users get Web Push notifications on
+type PushDatabase interface {
+	// SavePushSubscription registers the device and sets the id of the subscription. A device registered before (by
+	// anyone, since the endpoint identifies the browser and not the account) is moved to the user, with its new keys
+	SavePushSubscription(context.Context, *model.PushSubscription) error
+	// DeletePushSubscription unregisters the device with the endpoint hash. Does nothing if the user didn't register it
+	DeletePushSubscription(ctx context.Context, userId string, endpointHash string) error
+	// DeletePushSubscriptionById unregisters the device, such as when its push service no longer knows it
+	DeletePushSubscriptionById(ctx context.Context, id int64) error
+	// GetPushSubscriptions returns the devices of the users
+	GetPushSubscriptions(ctx context.Context, userIds []string) ([]*model.PushSubscription, error)
+	// GetCommunityPushSubscriptions returns up to limit devices of the users subscribed (directly) to the community,
+	// ordered by id, starting after afterId
+	GetCommunityPushSubscriptions(ctx context.Context, communityId int64, afterId int64, limit int) ([]*model.PushSubscription, error)
 }
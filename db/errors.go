@@ -1,16 +1,46 @@
 package db
 
 import (
+	"errors"
+	"fmt"
 	"github.com/go-sql-driver/mysql"
 	"regexp"
 	"strings"
 )
 
-func IsDupKeyErr(error *mysql.MySQLError) bool {
-	return strings.Contains(error.Error(), "Duplicate")
+var ErrNotFound = errors.New("entity not found")
+
+// ErrLastCommunity is returned when removing a post from the only community it's still in
+var ErrLastCommunity = errors.New("post is only in one community")
+
+// DupKeyErr is returned by backends that aren't MySQL when a unique key is violated
+type DupKeyErr struct {
+	Key string
+}
+
+func (dke *DupKeyErr) Error() string {
+	return fmt.Sprintf("Duplicate entry for key '%v'", dke.Key)
 }
-func GetDupKey(error *mysql.MySQLError) string {
-	r := regexp.MustCompile(`(for key ')((.)+)(')`)
-	match := r.FindString(error.Error())[9:]
-	return match[7 : len(match)-1]
+
+func IsDupKeyErr(err error) bool {
+	switch err := err.(type) {
+	case *mysql.MySQLError:
+		return strings.Contains(err.Error(), "Duplicate")
+	case *DupKeyErr:
+		return true
+	}
+	return false
+}
+
+// GetDupKey returns the name of the violated key (without the table prefix)
+func GetDupKey(err error) string {
+	switch err := err.(type) {
+	case *mysql.MySQLError:
+		r := regexp.MustCompile(`(for key ')((.)+)(')`)
+		match := r.FindString(err.Error())[9:]
+		return match[7 : len(match)-1]
+	case *DupKeyErr:
+		return err.Key
+	}
+	return ""
 }
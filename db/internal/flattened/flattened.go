@@ -0,0 +1,148 @@
+package flattened
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/navbryce/next-dorm-be/model"
+	"time"
+)
+
+// Rows as they are selected by the SQL backends, before being built into the model
+
+type UserVote struct {
+	Value sql.NullInt16 `db:"value"`
+}
+
+type ContentAuthor struct {
+	Id string `db:"creator_id"`
+	// SealedId is set instead of Id when the creator is sealed
+	SealedId       sql.NullString `db:"creator_id_enc"`
+	DisplayName    string         `db:"display_name"`
+	Alias          string         `db:"creator_alias"`
+	AvatarBlobName string         `db:"avatar_blob_name"`
+}
+
+type ContentMetadata struct {
+	Id                int64            `db:"metadata_id"`
+	NumVotes          uint64           `db:"num_votes"`
+	VoteTotal         int64            `db:"vote_total"`
+	Creator           ContentAuthor    `db:",inline"`
+	Visibility        model.Visibility `db:"visibility"`
+	Status            model.Status     `db:"status"`
+	Held              bool             `db:"held"`
+	HeldOnCreate      bool             `db:"held_on_create"`
+	UserVote          `db:",inline"`
+	ImageBlobNamesStr string    `db:"image_blob_names"`
+	CreatedAt         time.Time `db:"created_at"`
+	UpdatedAt         time.Time `db:"updated_at"`
+}
+
+type Post struct {
+	ContentMetadata    `db:",inline"`
+	Id                 int64  `db:"id"`
+	Title              string `db:"title"`
+	Content            string `db:"content"`
+	CommunitiesJSONStr string `db:"communities"`
+	CommentCount       int64  `db:"comment_count"`
+}
+
+// PostCommunity is an element of Post.CommunitiesJSONStr
+type PostCommunity struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type Comment struct {
+	ContentMetadata  `db:",inline"`
+	Id               int64  `db:"id"`
+	RootMetadataId   int64  `db:"root_metadata_id"`
+	ParentMetadataId int64  `db:"parent_metadata_id"`
+	Content          string `db:"content"`
+}
+
+func BuildPost(post *Post) (*model.Post, error) {
+	var postCommunities []PostCommunity
+	if err := json.Unmarshal([]byte(post.CommunitiesJSONStr), &postCommunities); err != nil {
+		return nil, err
+	}
+
+	communities := make([]*model.Community, len(postCommunities))
+	for i, community := range postCommunities {
+		communities[i] = &model.Community{
+			Id:   community.Id,
+			Name: community.Name,
+		}
+	}
+	metadata, err := BuildContentMetadata(&post.ContentMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Post{
+		Id:              post.Id,
+		ContentMetadata: metadata,
+		Title:           post.Title,
+		Content:         post.Content,
+		Communities:     communities,
+		CommentCount:    post.CommentCount,
+	}, nil
+}
+
+func BuildComment(comment *Comment) (*model.Comment, error) {
+	metadata, err := BuildContentMetadata(&comment.ContentMetadata)
+	if err != nil {
+		return nil, err
+	}
+	return &model.Comment{
+		Id:               comment.Id,
+		ContentMetadata:  metadata,
+		PostMetadataId:   comment.RootMetadataId,
+		ParentMetadataId: comment.ParentMetadataId,
+		Content:          comment.Content,
+	}, nil
+}
+
+func BuildContentMetadata(metadata *ContentMetadata) (*model.ContentMetadata, error) {
+	var vote *model.Vote
+	if metadata.UserVote.Value.Valid {
+		value, err := metadata.UserVote.Value.Value()
+		if err != nil {
+			panic(err)
+		}
+		vote = &model.Vote{Value: int8(value.(int64))}
+	}
+	var imageBlobNames = []string{} // make sure the array isn't nil
+	if len(metadata.ImageBlobNamesStr) > 0 {
+		if err := json.Unmarshal([]byte(metadata.ImageBlobNamesStr), &imageBlobNames); err != nil {
+			return nil, err
+		}
+		// remove empty blob names (nulls)
+		for i, blobName := range imageBlobNames {
+			if len(blobName) == 0 {
+				imageBlobNames = append(imageBlobNames[0:i], imageBlobNames[i+1:]...)
+			}
+		}
+	}
+
+	return &model.ContentMetadata{
+		Id: metadata.Id,
+		Creator: &model.ContentAuthor{
+			LocalUser: &model.LocalUser{
+				Id:          metadata.Creator.Id,
+				DisplayName: metadata.Creator.DisplayName,
+			},
+			AnonymousUser: &model.AnonymousUser{DisplayName: metadata.Creator.Alias},
+		},
+		UserVote:       vote,
+		Status:         metadata.Status,
+		Held:           metadata.Held,
+		HeldOnCreate:   metadata.HeldOnCreate,
+		NumVotes:       metadata.NumVotes,
+		VoteTotal:      metadata.VoteTotal,
+		Visibility:     metadata.Visibility,
+		ImageBlobNames: imageBlobNames,
+		Images:         []*model.Image{},
+		CreatedAt:      metadata.CreatedAt,
+		UpdatedAt:      metadata.UpdatedAt,
+	}, nil
+}
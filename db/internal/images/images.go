@@ -0,0 +1,146 @@
+package images
+
+import (
+	"context"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/upper/db/v4"
+)
+
+// SQL shared by the MySQL and SQLite backends. Writes must be passed the session of the enclosing transaction
+
+// InsertForContent inserts the image rows, along with their thumbnails, and links them to the content
+func InsertForContent(ctx context.Context, sess db.Session, metadataId int64, images []*model.Image) error {
+	for _, image := range images {
+		res, err := sess.SQL().
+			InsertInto("image").
+			Columns("blob_name", "width", "height").
+			Values(image.BlobName, image.Width, image.Height).
+			ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+		imageId, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for _, thumbnail := range image.Thumbnails {
+			if _, err := sess.SQL().
+				InsertInto("image_thumbnail").
+				Columns("image_id", "blob_name", "width", "height").
+				Values(imageId, thumbnail.BlobName, thumbnail.Width, thumbnail.Height).
+				ExecContext(ctx); err != nil {
+				return err
+			}
+		}
+		if _, err := sess.SQL().
+			InsertInto("content_image").
+			Columns("metadata_id", "image_id").
+			Values(metadataId, imageId).
+			ExecContext(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type contentImage struct {
+	MetadataId int64  `db:"metadata_id"`
+	ImageId    int64  `db:"image_id"`
+	BlobName   string `db:"blob_name"`
+	Width      int    `db:"width"`
+	Height     int    `db:"height"`
+}
+
+type imageThumbnail struct {
+	ImageId         int64 `db:"image_id"`
+	model.Thumbnail `db:",inline"`
+}
+
+// AttachTo loads the images (and thumbnails) of every piece of content into its Images field
+func AttachTo(ctx context.Context, sess db.Session, contents []*model.ContentMetadata) error {
+	byMetadataId := make(map[int64]*model.ContentMetadata)
+	metadataIds := make([]int64, len(contents))
+	for i, content := range contents {
+		content.Images = []*model.Image{}
+		byMetadataId[content.Id] = content
+		metadataIds[i] = content.Id
+	}
+	if len(metadataIds) == 0 {
+		return nil
+	}
+
+	var contentImages []*contentImage
+	if err := sess.SQL().
+		Select("ci.metadata_id", "i.id AS image_id", "i.blob_name", "i.width", "i.height").
+		From("content_image AS ci").
+		Join("image AS i").On("ci.image_id = i.id").
+		Where("ci.metadata_id IN ?", metadataIds).
+		OrderBy("i.id").
+		IteratorContext(ctx).
+		All(&contentImages); err != nil {
+		return err
+	}
+	if len(contentImages) == 0 {
+		return nil
+	}
+
+	byImageId := make(map[int64]*model.Image)
+	imageIds := make([]int64, len(contentImages))
+	for i, contentImage := range contentImages {
+		image := &model.Image{
+			BlobName:   contentImage.BlobName,
+			Width:      contentImage.Width,
+			Height:     contentImage.Height,
+			Thumbnails: []*model.Thumbnail{},
+		}
+		content := byMetadataId[contentImage.MetadataId]
+		content.Images = append(content.Images, image)
+		byImageId[contentImage.ImageId] = image
+		imageIds[i] = contentImage.ImageId
+	}
+
+	var thumbnails []*imageThumbnail
+	if err := sess.SQL().
+		Select("image_id", "blob_name", "width", "height").
+		From("image_thumbnail").
+		Where("image_id IN ?", imageIds).
+		OrderBy("image_id", "id").
+		IteratorContext(ctx).
+		All(&thumbnails); err != nil {
+		return err
+	}
+	for _, thumbnail := range thumbnails {
+		image := byImageId[thumbnail.ImageId]
+		thumbnailCopy := thumbnail.Thumbnail
+		image.Thumbnails = append(image.Thumbnails, &thumbnailCopy)
+	}
+	return nil
+}
+
+// LiveBlobNames returns the blobs of every image, and thumbnail, attached to content that isn't deleted
+func LiveBlobNames(ctx context.Context, sess db.Session) ([]string, error) {
+	var rows []*struct {
+		BlobName string `db:"blob_name"`
+	}
+	if err := sess.SQL().
+		IteratorContext(ctx, `
+			SELECT i.blob_name
+			FROM image AS i
+			JOIN content_image AS ci ON ci.image_id = i.id
+			JOIN content_metadata AS cm ON cm.id = ci.metadata_id
+			WHERE cm.status = ?
+			UNION ALL
+			SELECT t.blob_name
+			FROM image_thumbnail AS t
+			JOIN content_image AS ci ON ci.image_id = t.image_id
+			JOIN content_metadata AS cm ON cm.id = ci.metadata_id
+			WHERE cm.status = ?`, model.StatusPosted, model.StatusPosted).
+		All(&rows); err != nil {
+		return nil, err
+	}
+	blobNames := make([]string, len(rows))
+	for i, row := range rows {
+		blobNames[i] = row.BlobName
+	}
+	return blobNames, nil
+}
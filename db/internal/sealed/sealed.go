@@ -0,0 +1,250 @@
+package sealed
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/db/internal/flattened"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/upper/db/v4"
+	"io"
+)
+
+// Creators of hidden content are stored encrypted (creator_id_enc) along with a keyed hash (creator_id_hash) used to
+// look up content by user. creator_id is left empty on those rows, so a dump of the database doesn't tell who wrote
+// them. Thread aliases are keyed by the hash too.
+//
+// A nil *Sealer is valid: nothing is sealed and user ids are stored as is
+
+var ErrNoKey = errors.New("content has a sealed creator but db.creator_key isn't set")
+
+type Sealer struct {
+	aead    cipher.AEAD
+	hashKey []byte
+}
+
+// New derives the encryption and hash keys from key, which must be 32 bytes
+func New(key []byte) (*Sealer, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("creator key must be 32 bytes, got %v", len(key))
+	}
+	block, err := aes.NewCipher(derive(key, "creator encryption"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{aead: aead, hashKey: derive(key, "creator hash")}, nil
+}
+
+// FromBase64 is New for a base64 key. An empty key returns a nil Sealer
+func FromBase64(key string) (*Sealer, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("creator key must be base64: %w", err)
+	}
+	return New(raw)
+}
+
+func derive(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+func (s *Sealer) seal(userId string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(s.aead.Seal(nonce, nonce, []byte(userId), nil)), nil
+}
+
+func (s *Sealer) open(sealedId string) (string, error) {
+	if s == nil {
+		return "", ErrNoKey
+	}
+	raw, err := base64.StdEncoding.DecodeString(sealedId)
+	if err != nil || len(raw) < s.aead.NonceSize() {
+		return "", fmt.Errorf("malformed sealed creator")
+	}
+	userId, err := s.aead.Open(nil, raw[:s.aead.NonceSize()], raw[s.aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("error opening sealed creator: %w", err)
+	}
+	return string(userId), nil
+}
+
+// UserKey is what identifies the user in creator_id_hash and thread_alias.user_id
+func (s *Sealer) UserKey(userId string) string {
+	if s == nil {
+		return userId
+	}
+	mac := hmac.New(sha256.New, s.hashKey)
+	mac.Write([]byte(userId))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CreatorColumns are the values of creator_id, creator_id_enc and creator_id_hash
+type CreatorColumns struct {
+	Id   string
+	Enc  sql.NullString
+	Hash sql.NullString
+}
+
+// Creator returns how the creator of content with the visibility is stored
+func (s *Sealer) Creator(userId string, visibility model.Visibility) (*CreatorColumns, error) {
+	if s == nil || visibility != model.VisibilityHidden {
+		return &CreatorColumns{Id: userId}, nil
+	}
+	enc, err := s.seal(userId)
+	if err != nil {
+		return nil, err
+	}
+	return &CreatorColumns{
+		Enc:  sql.NullString{String: enc, Valid: true},
+		Hash: sql.NullString{String: s.UserKey(userId), Valid: true},
+	}, nil
+}
+
+// CurrentCreator returns the (opened) creator of the content
+func (s *Sealer) CurrentCreator(ctx context.Context, sess db.Session, metadataId int64) (string, error) {
+	var row struct {
+		Id  string         `db:"creator_id"`
+		Enc sql.NullString `db:"creator_id_enc"`
+	}
+	if err := sess.SQL().
+		Select("creator_id", "creator_id_enc").
+		From("content_metadata").
+		Where("id = ?", metadataId).
+		IteratorContext(ctx).
+		One(&row); err != nil {
+		return "", err
+	}
+	if row.Enc.Valid {
+		return s.open(row.Enc.String)
+	}
+	return row.Id, nil
+}
+
+// OpenCreators fills in the id and display name of every sealed author. Their rows can't be joined with person, so
+// the display names are loaded separately
+func (s *Sealer) OpenCreators(ctx context.Context, sess db.Session, authors []*flattened.ContentAuthor) error {
+	var opened []*flattened.ContentAuthor
+	var userIds []string
+	for _, author := range authors {
+		if !author.SealedId.Valid {
+			continue
+		}
+		userId, err := s.open(author.SealedId.String)
+		if err != nil {
+			return err
+		}
+		author.Id = userId
+		opened = append(opened, author)
+		userIds = append(userIds, userId)
+	}
+	if len(userIds) == 0 {
+		return nil
+	}
+
+	var people []*model.LocalUser
+	if err := sess.SQL().
+		Select("firebase_id", "display_name").
+		From("person").
+		Where("firebase_id IN ?", userIds).
+		IteratorContext(ctx).
+		All(&people); err != nil {
+		return err
+	}
+	displayNames := make(map[string]string)
+	for _, person := range people {
+		displayNames[person.Id] = person.DisplayName
+	}
+	for _, author := range opened {
+		author.DisplayName = displayNames[author.Id]
+	}
+	return nil
+}
+
+// SealExisting seals the creators of hidden content, and the thread aliases, stored in plain text before the key was
+// set. It's all done in one transaction, so a failure leaves nothing half sealed. Returns the number of rows sealed
+func (s *Sealer) SealExisting(ctx context.Context, sess db.Session) (int64, error) {
+	if s == nil {
+		return 0, ErrNoKey
+	}
+	var numSealed int64
+	err := sess.TxContext(ctx, func(sess db.Session) error {
+		numSealed = 0
+		var rows []*struct {
+			Id        int64  `db:"id"`
+			CreatorId string `db:"creator_id"`
+		}
+		if err := sess.SQL().
+			Select("id", "creator_id").
+			From("content_metadata").
+			Where("visibility = ? AND creator_id_enc IS NULL", model.VisibilityHidden).
+			IteratorContext(ctx).
+			All(&rows); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			columns, err := s.Creator(row.CreatorId, model.VisibilityHidden)
+			if err != nil {
+				return err
+			}
+			if _, err := sess.SQL().
+				Update("content_metadata").
+				Set("creator_id = ?", columns.Id).
+				Set("creator_id_enc = ?", columns.Enc).
+				Set("creator_id_hash = ?", columns.Hash).
+				Where("id = ?", row.Id).
+				ExecContext(ctx); err != nil {
+				return err
+			}
+			numSealed++
+		}
+
+		var aliases []*struct {
+			PostMetadataId int64  `db:"post_metadata_id"`
+			UserId         string `db:"user_id"`
+		}
+		if err := sess.SQL().
+			Select("post_metadata_id", "user_id").
+			From("thread_alias").
+			Where("sealed = ?", false).
+			IteratorContext(ctx).
+			All(&aliases); err != nil {
+			return err
+		}
+		for _, alias := range aliases {
+			if _, err := sess.SQL().
+				Update("thread_alias").
+				Set("user_id = ?", s.UserKey(alias.UserId)).
+				Set("sealed = ?", true).
+				Where("post_metadata_id = ? AND user_id = ?", alias.PostMetadataId, alias.UserId).
+				ExecContext(ctx); err != nil {
+				return err
+			}
+			numSealed++
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return 0, err
+	}
+	return numSealed, nil
+}
@@ -0,0 +1,71 @@
+package sealed
+
+import (
+	"github.com/navbryce/next-dorm-be/model"
+	"testing"
+)
+
+// testKey is the bytes 0 to 31
+const testKey = "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8="
+
+func newTestSealer(t *testing.T) *Sealer {
+	sealer, err := FromBase64(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sealer
+}
+
+func TestUserKey(t *testing.T) {
+	sealer := newTestSealer(t)
+	// HMAC-SHA256 of "u1" keyed with HMAC-SHA256("creator hash") of the key
+	want := "447685bfeeb15c35057d5bbdb43cebbd314a2a89b2c7fad553fa1b621b725a62"
+	if got := sealer.UserKey("u1"); got != want {
+		t.Errorf("UserKey() = %v, want %v", got, want)
+	}
+	var unsealed *Sealer
+	if got := unsealed.UserKey("u1"); got != "u1" {
+		t.Errorf("UserKey() without a key = %v, want u1", got)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	sealer := newTestSealer(t)
+	// "u1" sealed with AES-256-GCM, keyed with HMAC-SHA256("creator encryption") of the key, and the nonce 0 to 11
+	userId, err := sealer.open("AAECAwQFBgcICQoLxg1hIOH70FdX/nqslnjO9AKM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userId != "u1" {
+		t.Errorf("open() = %v, want u1", userId)
+	}
+	if _, err := sealer.open("AAECAwQFBgcICQoLxg1hIOH70FdX/nqslnjO9AKN"); err == nil {
+		t.Error("a tampered creator was opened")
+	}
+	var unsealed *Sealer
+	if _, err := unsealed.open("AAECAwQFBgcICQoLxg1hIOH70FdX/nqslnjO9AKM"); err != ErrNoKey {
+		t.Errorf("open() without a key = %v, want ErrNoKey", err)
+	}
+}
+
+func TestCreator(t *testing.T) {
+	sealer := newTestSealer(t)
+	columns, err := sealer.Creator("u1", model.VisibilityHidden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if columns.Id != "" || !columns.Enc.Valid || columns.Hash.String != sealer.UserKey("u1") {
+		t.Errorf("Creator() = %+v, want only the sealed id and hash", columns)
+	}
+	if userId, err := sealer.open(columns.Enc.String); err != nil || userId != "u1" {
+		t.Errorf("open(Creator().Enc) = %v, %v, want u1", userId, err)
+	}
+
+	columns, err = sealer.Creator("u1", model.VisibilityNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if columns.Id != "u1" || columns.Enc.Valid || columns.Hash.Valid {
+		t.Errorf("Creator() of normal content = %+v, want the plain id", columns)
+	}
+}
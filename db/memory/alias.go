@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"context"
+	appDb "github.com/navbryce/next-dorm-be/db"
+)
+
+type threadAliasKey struct {
+	postMetadataId int64
+	userId         string
+}
+
+type AliasDB struct {
+	*store
+}
+
+func getAliasDB(store *store) *AliasDB {
+	return &AliasDB{store}
+}
+
+func (adb *AliasDB) GetThreadAlias(ctx context.Context, postMetadataId int64, userId string) (string, error) {
+	adb.mu.RLock()
+	defer adb.mu.RUnlock()
+	return adb.threadAliases[threadAliasKey{postMetadataId, userId}], nil
+}
+
+func (adb *AliasDB) CreateThreadAlias(ctx context.Context, postMetadataId int64, userId string, alias string) error {
+	adb.mu.Lock()
+	defer adb.mu.Unlock()
+	return adb.insertThreadAlias(postMetadataId, userId, alias)
+}
+
+// insertThreadAlias must hold the write lock
+func (s *store) insertThreadAlias(postMetadataId int64, userId string, alias string) error {
+	if _, ok := s.threadAliases[threadAliasKey{postMetadataId, userId}]; ok {
+		return &appDb.DupKeyErr{Key: "PRIMARY"}
+	}
+	for key, existing := range s.threadAliases {
+		if key.postMetadataId == postMetadataId && existing == alias {
+			return &appDb.DupKeyErr{Key: "U_IDX_ALIAS_IN_THREAD"}
+		}
+	}
+	s.threadAliases[threadAliasKey{postMetadataId, userId}] = alias
+	return nil
+}
@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+	"github.com/navbryce/next-dorm-be/model"
+	"sort"
+)
+
+type AutomodDB struct {
+	*store
+}
+
+func getAutomodDB(store *store) *AutomodDB {
+	return &AutomodDB{store}
+}
+
+func (adb *AutomodDB) CreateAutomodRule(ctx context.Context, rule *model.AutomodRule, modLog *model.ModLogEntry) (int64, error) {
+	adb.mu.Lock()
+	defer adb.mu.Unlock()
+	row := copyAutomodRule(rule)
+	row.Id = adb.nextId("automod_rule")
+	row.CreatedAt = now()
+	row.UpdatedAt = row.CreatedAt
+	adb.automodRules[row.Id] = row
+	if modLog != nil {
+		modLog.TargetId = &row.Id
+	}
+	adb.appendModLogEntry(modLog)
+	return row.Id, nil
+}
+
+func (adb *AutomodDB) UpdateAutomodRule(ctx context.Context, rule *model.AutomodRule, modLog *model.ModLogEntry) error {
+	adb.mu.Lock()
+	defer adb.mu.Unlock()
+	row, ok := adb.automodRules[rule.Id]
+	if !ok {
+		return nil
+	}
+	updated := copyAutomodRule(rule)
+	row.Outcome = updated.Outcome
+	row.AppliesTo = updated.AppliesTo
+	row.Params = updated.Params
+	row.Reason = updated.Reason
+	row.UpdatedAt = now()
+	adb.appendModLogEntry(modLog)
+	return nil
+}
+
+func (adb *AutomodDB) DeleteAutomodRule(ctx context.Context, id int64, modLog *model.ModLogEntry) error {
+	adb.mu.Lock()
+	defer adb.mu.Unlock()
+	delete(adb.automodRules, id)
+	adb.appendModLogEntry(modLog)
+	return nil
+}
+
+func (adb *AutomodDB) GetAutomodRule(ctx context.Context, id int64) (*model.AutomodRule, error) {
+	adb.mu.RLock()
+	defer adb.mu.RUnlock()
+	if rule, ok := adb.automodRules[id]; ok {
+		return copyAutomodRule(rule), nil
+	}
+	return nil, nil
+}
+
+func (adb *AutomodDB) GetAutomodRules(ctx context.Context, communityIds []int64) ([]*model.AutomodRule, error) {
+	adb.mu.RLock()
+	defer adb.mu.RUnlock()
+	rules := make([]*model.AutomodRule, 0)
+	for _, rule := range adb.automodRules {
+		if containsId(communityIds, rule.CommunityId) {
+			rules = append(rules, copyAutomodRule(rule))
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].Id < rules[j].Id
+	})
+	return rules, nil
+}
+
+func copyAutomodRule(rule *model.AutomodRule) *model.AutomodRule {
+	cp := *rule
+	cp.Params.Keywords = append([]string(nil), rule.Params.Keywords...)
+	cp.Params.AllowedDomains = append([]string(nil), rule.Params.AllowedDomains...)
+	return &cp
+}
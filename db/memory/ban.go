@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"context"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"sort"
+	"time"
+)
+
+type BanDB struct {
+	*store
+}
+
+func getBanDB(store *store) *BanDB {
+	return &BanDB{store}
+}
+
+func (bdb *BanDB) CreateBan(ctx context.Context, ban *model.Ban, modLog *model.ModLogEntry) (int64, error) {
+	bdb.mu.Lock()
+	defer bdb.mu.Unlock()
+	return bdb.insertBan(ban, modLog), nil
+}
+
+// insertBan records the ban, and the entry with the ban as its target. must hold the write lock
+func (s *store) insertBan(ban *model.Ban, modLog *model.ModLogEntry) int64 {
+	row := copyBan(ban)
+	row.Id = s.nextId("ban")
+	row.CreatedAt = now()
+	if row.ExpiresAt != nil {
+		expiresAt := row.ExpiresAt.UTC().Truncate(time.Second)
+		row.ExpiresAt = &expiresAt
+	}
+	row.LiftedAt = nil
+	row.LiftedBy = nil
+	s.bans[row.Id] = row
+	if modLog != nil {
+		modLog.TargetId = &row.Id
+	}
+	s.appendModLogEntry(modLog)
+	return row.Id
+}
+
+func (bdb *BanDB) GetBan(ctx context.Context, id int64) (*model.Ban, error) {
+	bdb.mu.RLock()
+	defer bdb.mu.RUnlock()
+	if ban, ok := bdb.bans[id]; ok {
+		return copyBan(ban), nil
+	}
+	return nil, nil
+}
+
+func (bdb *BanDB) GetBans(ctx context.Context, query *appDb.BansQuery) ([]*model.Ban, error) {
+	bdb.mu.RLock()
+	defer bdb.mu.RUnlock()
+	bans := make([]*model.Ban, 0)
+	for _, ban := range bdb.bans {
+		if (query.UserId != "" && ban.UserId != query.UserId) ||
+			(query.CommunityId != nil && (ban.CommunityId == nil || *ban.CommunityId != *query.CommunityId)) ||
+			(query.ActiveAt != nil && !ban.IsActive(*query.ActiveAt)) ||
+			(query.BeforeId != 0 && ban.Id >= query.BeforeId) {
+			continue
+		}
+		bans = append(bans, copyBan(ban))
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Id > bans[j].Id
+	})
+	if len(bans) > query.Limit {
+		bans = bans[:query.Limit]
+	}
+	return bans, nil
+}
+
+func (bdb *BanDB) LiftBan(ctx context.Context, id int64, liftedBy string, modLog *model.ModLogEntry) error {
+	bdb.mu.Lock()
+	defer bdb.mu.Unlock()
+	if ban, ok := bdb.bans[id]; ok && ban.LiftedAt == nil {
+		liftedAt := now()
+		ban.LiftedAt = &liftedAt
+		ban.LiftedBy = &liftedBy
+	}
+	bdb.appendModLogEntry(modLog)
+	return nil
+}
+
+func copyBan(ban *model.Ban) *model.Ban {
+	cp := *ban
+	if ban.CommunityId != nil {
+		communityId := *ban.CommunityId
+		cp.CommunityId = &communityId
+	}
+	if ban.ExpiresAt != nil {
+		expiresAt := *ban.ExpiresAt
+		cp.ExpiresAt = &expiresAt
+	}
+	if ban.LiftedAt != nil {
+		liftedAt := *ban.LiftedAt
+		cp.LiftedAt = &liftedAt
+	}
+	if ban.LiftedBy != nil {
+		liftedBy := *ban.LiftedBy
+		cp.LiftedBy = &liftedBy
+	}
+	return &cp
+}
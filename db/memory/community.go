@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/db/dao"
+	"github.com/navbryce/next-dorm-be/model"
+	"sort"
+	"time"
+)
+
+type communityRow struct {
+	id        int64
+	name      string
+	parentId  sql.NullInt64
+	createdAt time.Time
+}
+
+type CommunityDB struct {
+	*store
+}
+
+func getCommunityDB(store *store) *CommunityDB {
+	return &CommunityDB{store}
+}
+
+func (cdb *CommunityDB) CreateCommunity(ctx context.Context, name string) (int64, error) {
+	return cdb.insertCommunity(name, sql.NullInt64{})
+}
+
+// CreateChildCommunity creates a community under parentId. Not part of db.Database; used to seed the community tree
+func (cdb *CommunityDB) CreateChildCommunity(ctx context.Context, name string, parentId int64) (int64, error) {
+	return cdb.insertCommunity(name, sql.NullInt64{Int64: parentId, Valid: true})
+}
+
+func (cdb *CommunityDB) insertCommunity(name string, parentId sql.NullInt64) (int64, error) {
+	cdb.mu.Lock()
+	defer cdb.mu.Unlock()
+	for _, community := range cdb.communities {
+		if community.parentId == parentId && community.name == name {
+			return 0, &appDb.DupKeyErr{Key: "U_IDX_NAME_TO_PARENT"}
+		}
+	}
+	id := cdb.nextId("community")
+	cdb.communities[id] = &communityRow{
+		id:        id,
+		name:      name,
+		parentId:  parentId,
+		createdAt: now(),
+	}
+	return id, nil
+}
+
+// GetCommunitiesByIds gets communities. nil ids gets all communities
+func (cdb *CommunityDB) GetCommunitiesByIds(ctx context.Context, ids []int64, opts *appDb.GetCommunitiesQueryOpts) ([]*model.CommunityWithSubStatus, error) {
+	cdb.mu.RLock()
+	defer cdb.mu.RUnlock()
+
+	var rows []*communityRow
+	if ids == nil {
+		for _, community := range cdb.communities {
+			rows = append(rows, community)
+		}
+	} else {
+		seen := make(map[int64]bool)
+		for _, id := range ids {
+			if community, ok := cdb.communities[id]; ok && !seen[id] {
+				rows = append(rows, community)
+				seen[id] = true
+			}
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].id < rows[j].id
+	})
+
+	communities := make([]*model.CommunityWithSubStatus, len(rows))
+	for i, row := range rows {
+		communities[i] = &model.CommunityWithSubStatus{
+			Community: row.toModel(),
+			IsSubscribed: cdb.subscriptions[subscriptionKey{
+				userId:      opts.ForUserId,
+				communityId: row.id,
+			}],
+		}
+	}
+	return communities, nil
+}
+
+func (cr *communityRow) toModel() *model.Community {
+	createdAt := cr.createdAt
+	return &model.Community{
+		Id:        cr.id,
+		Name:      cr.name,
+		ParentId:  dao.NullInt64{NullInt64: cr.parentId},
+		CreatedAt: &createdAt,
+	}
+}
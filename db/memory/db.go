@@ -0,0 +1,146 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"sync"
+	"time"
+)
+
+// MemoryDB is an in-memory implementation of db.Database. Useful for tests and running the server offline.
+// Nothing is persisted between restarts
+type MemoryDB struct {
+	*CommunityDB
+	*PostDB
+	*SubscriptionDB
+	*UserDB
+	*UploadDB
+	*AliasDB
+	*RevealDB
+	*RoleDB
+	*BanDB
+	*ReportDB
+	*ModLogDB
+	*AutomodDB
+	*RateLimitDB
+	*NotificationDB
+	*LiveEventDB
+	*WebhookDB
+	*DigestDB
+	*PushDB
+	store *store
+}
+
+var _ appDb.Database = (*MemoryDB)(nil)
+
+func GetDatabase() *MemoryDB {
+	store := newStore()
+	return &MemoryDB{
+		CommunityDB:    getCommunityDB(store),
+		PostDB:         getPostDB(store),
+		SubscriptionDB: getSubscriptionDB(store),
+		UserDB:         getUserDB(store),
+		UploadDB:       getUploadDB(store),
+		AliasDB:        getAliasDB(store),
+		RevealDB:       getRevealDB(store),
+		RoleDB:         getRoleDB(store),
+		BanDB:          getBanDB(store),
+		ReportDB:       getReportDB(store),
+		ModLogDB:       getModLogDB(store),
+		AutomodDB:      getAutomodDB(store),
+		RateLimitDB:    getRateLimitDB(store),
+		NotificationDB: getNotificationDB(store),
+		LiveEventDB:    getLiveEventDB(store),
+		WebhookDB:      getWebhookDB(store),
+		DigestDB:       getDigestDB(store),
+		PushDB:         getPushDB(store),
+		store:          store,
+	}
+}
+
+// SealCreators does nothing: creators are never sealed in memory since nothing is persisted
+func (mdb *MemoryDB) SealCreators(context.Context) (int64, error) {
+	return 0, nil
+}
+
+// GetSQLDB returns nil. there is no SQL database backing the in-memory implementation
+func (mdb *MemoryDB) GetSQLDB() *sql.DB {
+	return nil
+}
+
+func (mdb *MemoryDB) Close() error {
+	return nil
+}
+
+// store holds every "table". a single lock guards all of them, so multi-table writes behave like transactions
+type store struct {
+	mu sync.RWMutex
+
+	lastIds map[string]int64
+
+	people          map[string]*personRow
+	communities     map[int64]*communityRow
+	subscriptions   map[subscriptionKey]bool
+	contentMetadata map[int64]*contentMetadataRow
+	images          map[int64]*imageRow
+	posts           map[int64]*postRow
+	comments        map[int64]*commentRow
+	votes           map[voteKey]int8
+	reportGroups    map[int64]*model.ReportGroup
+	openReportGroup map[string]int64 // report_group.open_key
+	reports         map[int64]*model.Report
+	modLog          []*model.ModLogEntry // append-only, so ordered by id
+	uploads         map[int64]*model.Upload
+	threadAliases   map[threadAliasKey]string
+	reveals         []*model.Reveal // append-only, so ordered by id
+	roles           map[roleKey]*model.RoleGrant
+	bans            map[int64]*model.Ban
+	automodRules    map[int64]*model.AutomodRule
+	rateLimits      map[string]*model.RateLimitBucket // by bucket key
+	notifications   []*notificationRow                // append-only, so ordered by id
+	liveEvents      []*model.LiveEvent                // ordered by id
+	webhooks        map[int64]*model.Webhook
+	deliveries      map[int64]*model.WebhookDelivery   // webhook_delivery
+	digests         map[string]*model.DigestPreference // digest_preference, by user id
+	pushSubs        map[int64]*model.PushSubscription  // push_subscription
+}
+
+func newStore() *store {
+	return &store{
+		lastIds:         make(map[string]int64),
+		people:          make(map[string]*personRow),
+		communities:     make(map[int64]*communityRow),
+		subscriptions:   make(map[subscriptionKey]bool),
+		contentMetadata: make(map[int64]*contentMetadataRow),
+		images:          make(map[int64]*imageRow),
+		posts:           make(map[int64]*postRow),
+		comments:        make(map[int64]*commentRow),
+		votes:           make(map[voteKey]int8),
+		reportGroups:    make(map[int64]*model.ReportGroup),
+		openReportGroup: make(map[string]int64),
+		reports:         make(map[int64]*model.Report),
+		uploads:         make(map[int64]*model.Upload),
+		threadAliases:   make(map[threadAliasKey]string),
+		roles:           make(map[roleKey]*model.RoleGrant),
+		bans:            make(map[int64]*model.Ban),
+		automodRules:    make(map[int64]*model.AutomodRule),
+		rateLimits:      make(map[string]*model.RateLimitBucket),
+		webhooks:        make(map[int64]*model.Webhook),
+		deliveries:      make(map[int64]*model.WebhookDelivery),
+		digests:         make(map[string]*model.DigestPreference),
+		pushSubs:        make(map[int64]*model.PushSubscription),
+	}
+}
+
+// nextId mimics AUTO_INCREMENT. must hold the write lock
+func (s *store) nextId(table string) int64 {
+	s.lastIds[table]++
+	return s.lastIds[table]
+}
+
+// now mimics CURRENT_TIMESTAMP for DATETIME columns (second precision)
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
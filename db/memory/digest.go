@@ -0,0 +1,136 @@
+package memory
+
+import (
+	"context"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"sort"
+	"time"
+)
+
+type DigestDB struct {
+	*store
+}
+
+func getDigestDB(store *store) *DigestDB {
+	return &DigestDB{store}
+}
+
+func (ddb *DigestDB) CreateDigestPreference(ctx context.Context, preference *model.DigestPreference) error {
+	ddb.mu.Lock()
+	defer ddb.mu.Unlock()
+	if _, ok := ddb.digests[preference.UserId]; ok {
+		return &appDb.DupKeyErr{Key: "PRIMARY"}
+	}
+	for _, existing := range ddb.digests {
+		if existing.UnsubscribeToken == preference.UnsubscribeToken {
+			return &appDb.DupKeyErr{Key: "IDX_DIGEST_PREFERENCE_BY_TOKEN"}
+		}
+	}
+	row := copyDigestPreference(preference)
+	row.LastSentAt = nil
+	row.CreatedAt = now()
+	row.UpdatedAt = row.CreatedAt
+	ddb.digests[row.UserId] = row
+	return nil
+}
+
+func (ddb *DigestDB) UpdateDigestPreference(ctx context.Context, preference *model.DigestPreference) error {
+	ddb.mu.Lock()
+	defer ddb.mu.Unlock()
+	row, ok := ddb.digests[preference.UserId]
+	if !ok {
+		return nil
+	}
+	updated := copyDigestPreference(preference)
+	row.Email = updated.Email
+	row.Frequency = updated.Frequency
+	row.NextSendAt = updated.NextSendAt
+	row.UpdatedAt = now()
+	return nil
+}
+
+func (ddb *DigestDB) GetDigestPreference(ctx context.Context, userId string) (*model.DigestPreference, error) {
+	ddb.mu.RLock()
+	defer ddb.mu.RUnlock()
+	if preference, ok := ddb.digests[userId]; ok {
+		return copyDigestPreference(preference), nil
+	}
+	return nil, nil
+}
+
+func (ddb *DigestDB) GetDigestPreferenceByToken(ctx context.Context, token string) (*model.DigestPreference, error) {
+	ddb.mu.RLock()
+	defer ddb.mu.RUnlock()
+	for _, preference := range ddb.digests {
+		if preference.UnsubscribeToken == token {
+			return copyDigestPreference(preference), nil
+		}
+	}
+	return nil, nil
+}
+
+func (ddb *DigestDB) GetDueDigests(ctx context.Context, dueAt time.Time, limit int) ([]*model.DigestPreference, error) {
+	ddb.mu.RLock()
+	defer ddb.mu.RUnlock()
+	preferences := make([]*model.DigestPreference, 0)
+	for _, preference := range ddb.digests {
+		if isDigestDue(preference, dueAt) {
+			preferences = append(preferences, copyDigestPreference(preference))
+		}
+	}
+	sort.Slice(preferences, func(i, j int) bool {
+		if !preferences[i].NextSendAt.Equal(*preferences[j].NextSendAt) {
+			return preferences[i].NextSendAt.Before(*preferences[j].NextSendAt)
+		}
+		return preferences[i].UserId < preferences[j].UserId
+	})
+	if len(preferences) > limit {
+		preferences = preferences[:limit]
+	}
+	return preferences, nil
+}
+
+func (ddb *DigestDB) ClaimDigest(ctx context.Context, userId string, dueAt time.Time, leaseUntil time.Time) (bool, error) {
+	ddb.mu.Lock()
+	defer ddb.mu.Unlock()
+	preference, ok := ddb.digests[userId]
+	if !ok || !isDigestDue(preference, dueAt) {
+		return false, nil
+	}
+	preference.NextSendAt = &leaseUntil
+	return true, nil
+}
+
+func (ddb *DigestDB) ScheduleDigest(ctx context.Context, userId string, frequency model.DigestFrequency, nextSendAt time.Time, sentAt *time.Time) error {
+	ddb.mu.Lock()
+	defer ddb.mu.Unlock()
+	preference, ok := ddb.digests[userId]
+	if !ok || preference.Frequency != frequency {
+		return nil
+	}
+	preference.NextSendAt = &nextSendAt
+	if sentAt != nil {
+		lastSentAt := *sentAt
+		preference.LastSentAt = &lastSentAt
+	}
+	preference.UpdatedAt = now()
+	return nil
+}
+
+func isDigestDue(preference *model.DigestPreference, dueAt time.Time) bool {
+	return preference.Frequency != model.DigestOff && preference.NextSendAt != nil && !preference.NextSendAt.After(dueAt)
+}
+
+func copyDigestPreference(preference *model.DigestPreference) *model.DigestPreference {
+	cp := *preference
+	if preference.NextSendAt != nil {
+		nextSendAt := *preference.NextSendAt
+		cp.NextSendAt = &nextSendAt
+	}
+	if preference.LastSentAt != nil {
+		lastSentAt := *preference.LastSentAt
+		cp.LastSentAt = &lastSentAt
+	}
+	return &cp
+}
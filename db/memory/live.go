@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"context"
+	"github.com/navbryce/next-dorm-be/model"
+	"time"
+)
+
+type LiveEventDB struct {
+	*store
+}
+
+func getLiveEventDB(store *store) *LiveEventDB {
+	return &LiveEventDB{store}
+}
+
+func (ldb *LiveEventDB) CreateLiveEvent(ctx context.Context, event *model.LiveEvent) (int64, error) {
+	ldb.mu.Lock()
+	defer ldb.mu.Unlock()
+	row := *event
+	row.Id = ldb.nextId("live_event")
+	row.CreatedAt = now()
+	ldb.liveEvents = append(ldb.liveEvents, &row)
+	return row.Id, nil
+}
+
+func (ldb *LiveEventDB) GetLiveEvents(ctx context.Context, afterId int64, limit int) ([]*model.LiveEvent, error) {
+	ldb.mu.RLock()
+	defer ldb.mu.RUnlock()
+	events := make([]*model.LiveEvent, 0)
+	for _, event := range ldb.liveEvents {
+		if len(events) == limit {
+			break
+		}
+		if event.Id > afterId {
+			cp := *event
+			events = append(events, &cp)
+		}
+	}
+	return events, nil
+}
+
+func (ldb *LiveEventDB) GetLastLiveEventId(ctx context.Context) (int64, error) {
+	ldb.mu.RLock()
+	defer ldb.mu.RUnlock()
+	if len(ldb.liveEvents) == 0 {
+		return 0, nil
+	}
+	return ldb.liveEvents[len(ldb.liveEvents)-1].Id, nil
+}
+
+func (ldb *LiveEventDB) DeleteLiveEvents(ctx context.Context, createdBefore time.Time) error {
+	ldb.mu.Lock()
+	defer ldb.mu.Unlock()
+	kept := ldb.liveEvents[:0]
+	for _, event := range ldb.liveEvents {
+		if !event.CreatedAt.Before(createdBefore) {
+			kept = append(kept, event)
+		}
+	}
+	ldb.liveEvents = kept
+	return nil
+}
@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"context"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+)
+
+type ModLogDB struct {
+	*store
+}
+
+func getModLogDB(store *store) *ModLogDB {
+	return &ModLogDB{store}
+}
+
+func (mdb *ModLogDB) CreateModLogEntry(ctx context.Context, entry *model.ModLogEntry) (int64, error) {
+	mdb.mu.Lock()
+	defer mdb.mu.Unlock()
+	return mdb.appendModLogEntry(entry), nil
+}
+
+// appendModLogEntry adds the entry along with the action it records, so the caller must hold the lock. Does nothing if
+// the entry is nil, which is the case when the action isn't logged
+func (s *store) appendModLogEntry(entry *model.ModLogEntry) int64 {
+	if entry == nil {
+		return 0
+	}
+	row := copyModLogEntry(entry)
+	row.Id = s.nextId("mod_log")
+	row.CreatedAt = now()
+	s.modLog = append(s.modLog, row)
+	return row.Id
+}
+
+func (mdb *ModLogDB) GetModLogEntries(ctx context.Context, query *appDb.ModLogQuery) ([]*model.ModLogEntry, error) {
+	mdb.mu.RLock()
+	defer mdb.mu.RUnlock()
+	var communityIds map[int64]bool
+	if query.CommunityIds != nil {
+		communityIds = make(map[int64]bool)
+		for _, id := range query.CommunityIds {
+			communityIds[id] = true
+		}
+	}
+	entries := make([]*model.ModLogEntry, 0)
+	for i := len(mdb.modLog) - 1; i >= 0 && len(entries) < query.Limit; i-- {
+		entry := mdb.modLog[i]
+		if (query.ActorId != "" && entry.ActorId != query.ActorId) ||
+			(query.Action != "" && entry.Action != query.Action) ||
+			(query.BeforeId != 0 && entry.Id >= query.BeforeId) ||
+			(communityIds != nil && !inAny(entry.CommunityIds, communityIds)) {
+			continue
+		}
+		entries = append(entries, copyModLogEntry(entry))
+	}
+	return entries, nil
+}
+
+func inAny(ids []int64, set map[int64]bool) bool {
+	for _, id := range ids {
+		if set[id] {
+			return true
+		}
+	}
+	return false
+}
+
+func copyModLogEntry(entry *model.ModLogEntry) *model.ModLogEntry {
+	cp := *entry
+	if entry.PostId != nil {
+		postId := *entry.PostId
+		cp.PostId = &postId
+	}
+	if entry.CommentId != nil {
+		commentId := *entry.CommentId
+		cp.CommentId = &commentId
+	}
+	if entry.UserId != nil {
+		userId := *entry.UserId
+		cp.UserId = &userId
+	}
+	if entry.TargetId != nil {
+		targetId := *entry.TargetId
+		cp.TargetId = &targetId
+	}
+	cp.CommunityIds = append([]int64{}, entry.CommunityIds...)
+	return &cp
+}
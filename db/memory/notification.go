@@ -0,0 +1,115 @@
+package memory
+
+import (
+	"context"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+)
+
+type notificationRow struct {
+	model.Notification
+	recipientId string
+}
+
+type NotificationDB struct {
+	*store
+}
+
+func getNotificationDB(store *store) *NotificationDB {
+	return &NotificationDB{store}
+}
+
+func (ndb *NotificationDB) CreateNotifications(ctx context.Context, notifications []*model.Notification) error {
+	ndb.mu.Lock()
+	defer ndb.mu.Unlock()
+	for _, notification := range notifications {
+		row := &notificationRow{
+			Notification: model.Notification{
+				Id:        ndb.nextId("notification"),
+				Type:      notification.Type,
+				PostId:    notification.PostId,
+				ModAction: notification.ModAction,
+				Reason:    notification.Reason,
+				CreatedAt: now(),
+			},
+			recipientId: notification.RecipientId,
+		}
+		if notification.CommentId != nil {
+			commentId := *notification.CommentId
+			row.CommentId = &commentId
+		}
+		ndb.notifications = append(ndb.notifications, row)
+	}
+	return nil
+}
+
+func (ndb *NotificationDB) GetNotifications(ctx context.Context, query *appDb.NotificationsQuery) ([]*model.Notification, error) {
+	ndb.mu.RLock()
+	defer ndb.mu.RUnlock()
+	notifications := make([]*model.Notification, 0)
+	for i := len(ndb.notifications) - 1; i >= 0 && len(notifications) < query.Limit; i-- {
+		row := ndb.notifications[i]
+		if row.recipientId != query.UserId ||
+			(query.UnreadOnly && row.Read) ||
+			(query.BeforeId != 0 && row.Id >= query.BeforeId) {
+			continue
+		}
+		notifications = append(notifications, ndb.toModel(row))
+	}
+	return notifications, nil
+}
+
+// toModel reads the sender and excerpt from the content like the SQL backends. must hold the read lock
+func (ndb *NotificationDB) toModel(row *notificationRow) *model.Notification {
+	notification := row.Notification
+	if row.CommentId != nil {
+		commentId := *row.CommentId
+		notification.CommentId = &commentId
+	}
+	var metadata *contentMetadataRow
+	if row.CommentId != nil {
+		if comment, ok := ndb.comments[*row.CommentId]; ok {
+			notification.Excerpt = comment.content
+			metadata = ndb.contentMetadata[comment.metadataId]
+		}
+	} else if post, ok := ndb.posts[row.PostId]; ok {
+		notification.Excerpt = post.title
+		metadata = ndb.contentMetadata[post.metadataId]
+	}
+	if metadata == nil || row.Type == model.NotificationModAction {
+		return &notification
+	}
+	if metadata.visibility != model.VisibilityNormal {
+		notification.SenderName = metadata.creatorAlias
+		return &notification
+	}
+	senderId := metadata.creatorId
+	notification.SenderId = &senderId
+	if person, ok := ndb.people[senderId]; ok {
+		notification.SenderName = person.displayName
+	}
+	return &notification
+}
+
+func (ndb *NotificationDB) CountUnreadNotifications(ctx context.Context, userId string) (int64, error) {
+	ndb.mu.RLock()
+	defer ndb.mu.RUnlock()
+	var count int64
+	for _, row := range ndb.notifications {
+		if row.recipientId == userId && !row.Read {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (ndb *NotificationDB) MarkNotificationsRead(ctx context.Context, userId string, ids []int64) error {
+	ndb.mu.Lock()
+	defer ndb.mu.Unlock()
+	for _, row := range ndb.notifications {
+		if row.recipientId == userId && (ids == nil || containsId(ids, row.Id)) {
+			row.Read = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,642 @@
+package memory
+
+import (
+	"context"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type contentMetadataRow struct {
+	id           int64
+	creatorId    string
+	creatorAlias string
+	visibility   model.Visibility
+	status       model.Status
+	held         bool
+	heldOnCreate bool
+	voteTotal    int64
+	numVotes     int64
+	imageIds     []int64 // content_image
+	createdAt    time.Time
+	updatedAt    time.Time
+}
+
+type imageRow struct {
+	id         int64
+	blobName   string
+	width      int
+	height     int
+	thumbnails []model.Thumbnail // image_thumbnail
+	createdAt  time.Time
+}
+
+type postRow struct {
+	id           int64
+	metadataId   int64
+	title        string
+	content      string
+	commentCount int64
+	communityIds []int64 // post_communities
+}
+
+type commentRow struct {
+	id               int64
+	rootMetadataId   int64
+	parentMetadataId int64
+	metadataId       int64
+	content          string
+}
+
+type voteKey struct {
+	tgtMetadataId int64
+	voterId       string
+}
+
+type PostDB struct {
+	*store
+}
+
+func getPostDB(store *store) *PostDB {
+	return &PostDB{store}
+}
+
+func (pdb *PostDB) CreatePost(ctx context.Context, post *appDb.CreatePost) (int64, error) {
+	pdb.mu.Lock()
+	defer pdb.mu.Unlock()
+
+	metadataId := pdb.insertContentMetadata(post.CreateContentMetadata)
+	if len(post.CreatorAlias) > 0 {
+		// the thread is new, so the creator's alias can't collide
+		_ = pdb.insertThreadAlias(metadataId, post.CreatorId, post.CreatorAlias)
+	}
+	postId := pdb.nextId("post")
+	communityIds := make([]int64, 0, len(post.Communities))
+	for _, communityId := range post.Communities {
+		if !containsId(communityIds, communityId) {
+			communityIds = append(communityIds, communityId)
+		}
+	}
+	pdb.posts[postId] = &postRow{
+		id:           postId,
+		metadataId:   metadataId,
+		title:        post.Title,
+		content:      post.Content,
+		communityIds: communityIds,
+	}
+	if post.AutomodReport != nil {
+		post.AutomodReport.Target.PostId = &postId
+		pdb.insertAutomodReport(post.AutomodReport)
+	}
+	return postId, nil
+}
+
+// EditPost updates the post. Only updates title or content if they are non-empty.
+func (pdb *PostDB) EditPost(ctx context.Context, id int64, req *appDb.EditPost) error {
+	pdb.mu.Lock()
+	defer pdb.mu.Unlock()
+
+	post, ok := pdb.posts[id]
+	if !ok {
+		return appDb.ErrNotFound
+	}
+	pdb.editContentMetadata(post.metadataId, req.EditContentMetadata)
+	if len(req.Title) > 0 {
+		post.title = req.Title
+	}
+	if len(req.Content) > 0 {
+		post.content = req.Content
+	}
+	return nil
+}
+
+func (pdb *PostDB) MarkPostAsDeleted(ctx context.Context, id int64, modLog *model.ModLogEntry) error {
+	pdb.mu.Lock()
+	defer pdb.mu.Unlock()
+
+	if pdb.markPostAsDeleted(id) {
+		pdb.appendModLogEntry(modLog)
+	}
+	return nil
+}
+
+// markPostAsDeleted is false if there's no such post. must hold the write lock
+func (s *store) markPostAsDeleted(id int64) bool {
+	post, ok := s.posts[id]
+	if !ok {
+		return false
+	}
+	post.content = ""
+	s.markContentMetadataAsDeleted(post.metadataId)
+	return true
+}
+
+func (pdb *PostDB) CreateComment(ctx context.Context, req *appDb.CreateComment) (int64, error) {
+	pdb.mu.Lock()
+	defer pdb.mu.Unlock()
+
+	metadataId := pdb.insertContentMetadata(req.CreateContentMetadata)
+	commentId := pdb.nextId("comment")
+	pdb.comments[commentId] = &commentRow{
+		id:               commentId,
+		rootMetadataId:   req.PostMetadataId,
+		parentMetadataId: req.ParentMetadataId,
+		metadataId:       metadataId,
+		content:          req.Content,
+	}
+	if post := pdb.postByMetadataId(req.PostMetadataId); post != nil {
+		post.commentCount++
+	}
+	if req.AutomodReport != nil {
+		req.AutomodReport.Target.CommentId = &commentId
+		pdb.insertAutomodReport(req.AutomodReport)
+	}
+	return commentId, nil
+}
+
+// EditComment edits the comment. currently ignores the images params
+func (pdb *PostDB) EditComment(ctx context.Context, id int64, req *appDb.EditComment) error {
+	pdb.mu.Lock()
+	defer pdb.mu.Unlock()
+
+	comment, ok := pdb.comments[id]
+	if !ok {
+		return appDb.ErrNotFound
+	}
+	pdb.editContentMetadata(comment.metadataId, &appDb.EditContentMetadata{
+		Visibility:    req.Visibility,
+		CreatorAlias:  req.CreatorAlias,
+		ModLog:        req.ModLog,
+		Held:          req.Held,
+		AutomodReport: req.AutomodReport,
+	})
+	if len(req.Content) > 0 {
+		comment.content = req.Content
+	}
+	return nil
+}
+
+func (pdb *PostDB) MarkCommentAsDeleted(ctx context.Context, id int64, modLog *model.ModLogEntry) error {
+	pdb.mu.Lock()
+	defer pdb.mu.Unlock()
+
+	if pdb.markCommentAsDeleted(id) {
+		pdb.appendModLogEntry(modLog)
+	}
+	return nil
+}
+
+// markCommentAsDeleted is false if there's no such comment. must hold the write lock
+func (s *store) markCommentAsDeleted(id int64) bool {
+	comment, ok := s.comments[id]
+	if !ok {
+		return false
+	}
+	comment.content = ""
+	s.markContentMetadataAsDeleted(comment.metadataId)
+	return true
+}
+
+func (pdb *PostDB) SetContentHeld(ctx context.Context, metadataId int64, held bool) error {
+	pdb.mu.Lock()
+	defer pdb.mu.Unlock()
+
+	if metadata, ok := pdb.contentMetadata[metadataId]; ok {
+		metadata.held = held
+		metadata.heldOnCreate = false
+	}
+	return nil
+}
+
+func (pdb *PostDB) RemovePostFromCommunity(ctx context.Context, postId int64, communityId int64, modLog *model.ModLogEntry) error {
+	pdb.mu.Lock()
+	defer pdb.mu.Unlock()
+
+	post, ok := pdb.posts[postId]
+	if !ok || !containsId(post.communityIds, communityId) {
+		return appDb.ErrNotFound
+	}
+	if len(post.communityIds) == 1 {
+		return appDb.ErrLastCommunity
+	}
+	communityIds := make([]int64, 0, len(post.communityIds)-1)
+	for _, id := range post.communityIds {
+		if id != communityId {
+			communityIds = append(communityIds, id)
+		}
+	}
+	post.communityIds = communityIds
+	pdb.appendModLogEntry(modLog)
+	return nil
+}
+
+// insertContentMetadata must hold the write lock
+func (pdb *PostDB) insertContentMetadata(metadata *appDb.CreateContentMetadata) int64 {
+	id := pdb.nextId("content_metadata")
+	createdAt := now()
+	pdb.contentMetadata[id] = &contentMetadataRow{
+		id:           id,
+		creatorId:    metadata.CreatorId,
+		creatorAlias: metadata.CreatorAlias,
+		visibility:   metadata.Visibility,
+		status:       model.StatusPosted,
+		held:         metadata.Held,
+		heldOnCreate: metadata.Held,
+		imageIds:     pdb.insertImages(metadata.Images),
+		createdAt:    createdAt,
+		updatedAt:    createdAt,
+	}
+	return id
+}
+
+// editContentMetadata must hold the write lock
+func (pdb *PostDB) editContentMetadata(metadataId int64, req *appDb.EditContentMetadata) {
+	metadata, ok := pdb.contentMetadata[metadataId]
+	if !ok {
+		return
+	}
+	var imageIds []int64
+	for _, imageId := range metadata.imageIds {
+		if !containsString(req.ImageBlobNamesToRemove, pdb.images[imageId].blobName) {
+			imageIds = append(imageIds, imageId)
+		}
+	}
+	metadata.imageIds = append(imageIds, pdb.insertImages(req.ImagesToAdd)...)
+	metadata.visibility = req.Visibility
+	if len(req.CreatorAlias) > 0 {
+		metadata.creatorAlias = req.CreatorAlias
+	}
+	if req.Held {
+		metadata.held = true
+	}
+	metadata.updatedAt = now()
+	pdb.insertAutomodReport(req.AutomodReport)
+	pdb.appendModLogEntry(req.ModLog)
+}
+
+// markContentMetadataAsDeleted must hold the write lock
+func (s *store) markContentMetadataAsDeleted(metadataId int64) {
+	if metadata, ok := s.contentMetadata[metadataId]; ok {
+		metadata.status = model.StatusDeleted
+		metadata.updatedAt = now()
+	}
+}
+
+// insertImages must hold the write lock
+func (pdb *PostDB) insertImages(images []*model.Image) []int64 {
+	imageIds := make([]int64, len(images))
+	for i, image := range images {
+		id := pdb.nextId("image")
+		row := &imageRow{
+			id:        id,
+			blobName:  image.BlobName,
+			width:     image.Width,
+			height:    image.Height,
+			createdAt: now(),
+		}
+		for _, thumbnail := range image.Thumbnails {
+			row.thumbnails = append(row.thumbnails, *thumbnail)
+		}
+		pdb.images[id] = row
+		imageIds[i] = id
+	}
+	return imageIds
+}
+
+func (pdb *PostDB) GetPostById(ctx context.Context, id int64, opts *appDb.PostQueryOpts) (*model.Post, error) {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+
+	post, ok := pdb.posts[id]
+	if !ok {
+		return nil, nil
+	}
+	return pdb.buildPost(post, opts.VoteHistoryOf), nil
+}
+
+func (pdb *PostDB) GetPosts(ctx context.Context, query *appDb.PostsListQuery) ([]*model.Post, error) {
+	if query.CommunityIds != nil && len(query.CommunityIds) == 0 {
+		return []*model.Post{}, nil
+	}
+
+	var matches func(post *postRow, metadata *contentMetadataRow) bool
+	var less func(a, b *contentMetadataRow) bool
+	if query.PageByVote != nil {
+		paging := query.PageByVote
+		lastId, err := parseLastId(paging.LastId)
+		if err != nil {
+			return nil, err
+		}
+		less = func(a, b *contentMetadataRow) bool {
+			if a.voteTotal != b.voteTotal {
+				return a.voteTotal > b.voteTotal
+			}
+			return a.id > b.id
+		}
+		matches = func(post *postRow, metadata *contentMetadataRow) bool {
+			if paging.Since != nil && !metadata.createdAt.After(*paging.Since) {
+				return false
+			}
+			if paging.MaxUpvotes != nil {
+				return metadata.voteTotal < paging.MaxUpvotes.Val ||
+					(metadata.voteTotal == paging.MaxUpvotes.Val && (lastId == nil || post.id < *lastId))
+			}
+			return true
+		}
+	} else if query.PageByDate != nil {
+		paging := query.PageByDate
+		lastId, err := parseLastId(paging.LastId)
+		if err != nil {
+			return nil, err
+		}
+		less = func(a, b *contentMetadataRow) bool {
+			if !a.createdAt.Equal(b.createdAt) {
+				return a.createdAt.After(b.createdAt)
+			}
+			return a.id > b.id
+		}
+		matches = func(post *postRow, metadata *contentMetadataRow) bool {
+			if paging.From != nil {
+				return metadata.createdAt.Before(*paging.From) ||
+					(metadata.createdAt.Equal(*paging.From) && (lastId == nil || post.id < *lastId))
+			}
+			return true
+		}
+	} else {
+		panic("must provide a paging option")
+	}
+
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+
+	var rows []*postRow
+	for _, post := range pdb.posts {
+		metadata := pdb.contentMetadata[post.metadataId]
+		if _, ok := pdb.people[metadata.creatorId]; !ok {
+			continue
+		}
+		if query.CommunityIds != nil && !containsAnyId(post.communityIds, query.CommunityIds) {
+			continue
+		}
+		if query.ByUser != nil && metadata.creatorId != query.ByUser.Id {
+			continue
+		}
+		if query.Visibility != nil && metadata.visibility != *query.Visibility {
+			continue
+		}
+		if !query.IncludeDeleted && metadata.status == model.StatusDeleted {
+			continue
+		}
+		if !query.IncludeHeld && metadata.held {
+			continue
+		}
+		if matches(post, metadata) {
+			rows = append(rows, post)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return less(pdb.contentMetadata[rows[i].metadataId], pdb.contentMetadata[rows[j].metadataId])
+	})
+	if query.Limit > 0 && len(rows) > int(query.Limit) {
+		rows = rows[:query.Limit]
+	}
+
+	posts := make([]*model.Post, len(rows))
+	for i, row := range rows {
+		posts[i] = pdb.buildPost(row, query.VoteHistoryOf)
+	}
+	return posts, nil
+}
+
+func (pdb *PostDB) GetCommentById(ctx context.Context, id int64) (*model.Comment, error) {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+
+	comment, ok := pdb.comments[id]
+	if !ok {
+		return nil, nil
+	}
+	return pdb.buildComment(comment, ""), nil
+}
+
+func (pdb *PostDB) GetCommentForest(ctx context.Context, rootMetadataId int64, opts *appDb.CommentTreeQueryOpts) ([]*model.CommentTree, error) {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+
+	var rows []*commentRow
+	for _, comment := range pdb.comments {
+		if comment.rootMetadataId == rootMetadataId {
+			rows = append(rows, comment)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := pdb.contentMetadata[rows[i].metadataId], pdb.contentMetadata[rows[j].metadataId]
+		if !a.createdAt.Equal(b.createdAt) {
+			return a.createdAt.Before(b.createdAt)
+		}
+		return a.id < b.id
+	})
+
+	comments := make([]*model.Comment, len(rows))
+	for i, row := range rows {
+		comments[i] = pdb.buildComment(row, opts.VoteHistoryOf)
+	}
+	return model.BuildCommentForest(rootMetadataId, comments), nil
+}
+
+// buildPost must hold the read lock
+func (pdb *PostDB) buildPost(post *postRow, voteHistoryOf string) *model.Post {
+	communities := make([]*model.Community, 0, len(post.communityIds))
+	for _, communityId := range post.communityIds {
+		if community, ok := pdb.communities[communityId]; ok {
+			communities = append(communities, &model.Community{
+				Id:   community.id,
+				Name: community.name,
+			})
+		}
+	}
+	return &model.Post{
+		Id:              post.id,
+		ContentMetadata: pdb.buildContentMetadata(pdb.contentMetadata[post.metadataId], voteHistoryOf),
+		Title:           post.title,
+		Content:         post.content,
+		Communities:     communities,
+		CommentCount:    post.commentCount,
+	}
+}
+
+// buildComment must hold the read lock
+func (pdb *PostDB) buildComment(comment *commentRow, voteHistoryOf string) *model.Comment {
+	return &model.Comment{
+		Id:               comment.id,
+		ContentMetadata:  pdb.buildContentMetadata(pdb.contentMetadata[comment.metadataId], voteHistoryOf),
+		PostMetadataId:   comment.rootMetadataId,
+		ParentMetadataId: comment.parentMetadataId,
+		Content:          comment.content,
+	}
+}
+
+// buildContentMetadata must hold the read lock
+func (pdb *PostDB) buildContentMetadata(metadata *contentMetadataRow, voteHistoryOf string) *model.ContentMetadata {
+	var vote *model.Vote
+	if value, ok := pdb.votes[voteKey{tgtMetadataId: metadata.id, voterId: voteHistoryOf}]; ok {
+		vote = &model.Vote{Value: value}
+	}
+	imageBlobNames := make([]string, len(metadata.imageIds))
+	images := make([]*model.Image, len(metadata.imageIds))
+	for i, imageId := range metadata.imageIds {
+		imageBlobNames[i] = pdb.images[imageId].blobName
+		images[i] = pdb.images[imageId].toModel()
+	}
+	var displayName string
+	if person, ok := pdb.people[metadata.creatorId]; ok {
+		displayName = person.displayName
+	}
+
+	return &model.ContentMetadata{
+		Id: metadata.id,
+		Creator: &model.ContentAuthor{
+			LocalUser: &model.LocalUser{
+				Id:          metadata.creatorId,
+				DisplayName: displayName,
+			},
+			AnonymousUser: &model.AnonymousUser{DisplayName: metadata.creatorAlias},
+		},
+		UserVote:       vote,
+		Status:         metadata.status,
+		Held:           metadata.held,
+		HeldOnCreate:   metadata.heldOnCreate,
+		NumVotes:       uint64(metadata.numVotes),
+		VoteTotal:      metadata.voteTotal,
+		Visibility:     metadata.visibility,
+		ImageBlobNames: imageBlobNames,
+		Images:         images,
+		CreatedAt:      metadata.createdAt,
+		UpdatedAt:      metadata.updatedAt,
+	}
+}
+
+func (ir *imageRow) toModel() *model.Image {
+	thumbnails := make([]*model.Thumbnail, len(ir.thumbnails))
+	for i := range ir.thumbnails {
+		thumbnail := ir.thumbnails[i]
+		thumbnails[i] = &thumbnail
+	}
+	return &model.Image{
+		BlobName:   ir.blobName,
+		Width:      ir.width,
+		Height:     ir.height,
+		Thumbnails: thumbnails,
+	}
+}
+
+// postByMetadataId must hold the read lock
+func (pdb *PostDB) postByMetadataId(metadataId int64) *postRow {
+	for _, post := range pdb.posts {
+		if post.metadataId == metadataId {
+			return post
+		}
+	}
+	return nil
+}
+
+func (pdb *PostDB) Vote(ctx context.Context, userId string, targetMetadataId int64, value int8) error {
+	pdb.mu.Lock()
+	defer pdb.mu.Unlock()
+
+	metadata, ok := pdb.contentMetadata[targetMetadataId]
+	if !ok {
+		return appDb.ErrNotFound
+	}
+
+	key := voteKey{tgtMetadataId: targetMetadataId, voterId: userId}
+	previousVoteValue := pdb.votes[key]
+
+	netVoteChange := value
+	var numVotesChange int8
+	if previousVoteValue != 0 {
+		netVoteChange -= previousVoteValue
+
+		// the previous vote value is the same as the new vote value
+		if netVoteChange == 0 {
+			return nil
+		}
+
+		if value == 0 {
+			delete(pdb.votes, key)
+			numVotesChange -= 1
+		} else {
+			pdb.votes[key] = value
+		}
+	} else if value == 0 {
+		return nil
+	} else {
+		pdb.votes[key] = value
+		numVotesChange += 1
+	}
+
+	metadata.voteTotal += int64(netVoteChange)
+	metadata.numVotes += int64(numVotesChange)
+	metadata.updatedAt = now()
+	return nil
+}
+
+func (pdb *PostDB) GetLiveImageBlobNames(ctx context.Context) ([]string, error) {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+	blobNames := make([]string, 0)
+	for _, metadata := range pdb.contentMetadata {
+		if metadata.status == model.StatusDeleted {
+			continue
+		}
+		for _, imageId := range metadata.imageIds {
+			image := pdb.images[imageId]
+			blobNames = append(blobNames, image.blobName)
+			for _, thumbnail := range image.thumbnails {
+				blobNames = append(blobNames, thumbnail.BlobName)
+			}
+		}
+	}
+	return blobNames, nil
+}
+
+// parseLastId parses the keyset paging id. an empty id means "no id constraint"
+func parseLastId(lastId string) (*int64, error) {
+	if len(lastId) == 0 {
+		return nil, nil
+	}
+	id, err := strconv.ParseInt(lastId, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+func containsId(ids []int64, id int64) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAnyId(ids []int64, candidates []int64) bool {
+	for _, candidate := range candidates {
+		if containsId(ids, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(vals []string, val string) bool {
+	for _, candidate := range vals {
+		if candidate == val {
+			return true
+		}
+	}
+	return false
+}
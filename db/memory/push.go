@@ -0,0 +1,92 @@
+package memory
+
+import (
+	"context"
+	"github.com/navbryce/next-dorm-be/model"
+	"sort"
+)
+
+type PushDB struct {
+	*store
+}
+
+func getPushDB(store *store) *PushDB {
+	return &PushDB{store}
+}
+
+func (pdb *PushDB) SavePushSubscription(ctx context.Context, subscription *model.PushSubscription) error {
+	pdb.mu.Lock()
+	defer pdb.mu.Unlock()
+	for _, row := range pdb.pushSubs {
+		if row.EndpointHash == subscription.EndpointHash {
+			row.UserId = subscription.UserId
+			row.P256dh = subscription.P256dh
+			row.Auth = subscription.Auth
+			row.UpdatedAt = now()
+			subscription.Id = row.Id
+			return nil
+		}
+	}
+	row := *subscription
+	row.Id = pdb.nextId("push_subscription")
+	row.CreatedAt = now()
+	row.UpdatedAt = row.CreatedAt
+	pdb.pushSubs[row.Id] = &row
+	subscription.Id = row.Id
+	return nil
+}
+
+func (pdb *PushDB) DeletePushSubscription(ctx context.Context, userId string, endpointHash string) error {
+	pdb.mu.Lock()
+	defer pdb.mu.Unlock()
+	for id, row := range pdb.pushSubs {
+		if row.UserId == userId && row.EndpointHash == endpointHash {
+			delete(pdb.pushSubs, id)
+		}
+	}
+	return nil
+}
+
+func (pdb *PushDB) DeletePushSubscriptionById(ctx context.Context, id int64) error {
+	pdb.mu.Lock()
+	defer pdb.mu.Unlock()
+	delete(pdb.pushSubs, id)
+	return nil
+}
+
+func (pdb *PushDB) GetPushSubscriptions(ctx context.Context, userIds []string) ([]*model.PushSubscription, error) {
+	users := make(map[string]bool, len(userIds))
+	for _, userId := range userIds {
+		users[userId] = true
+	}
+	return pdb.getPushSubscriptions(func(subscription *model.PushSubscription) bool {
+		return users[subscription.UserId]
+	}, 0), nil
+}
+
+func (pdb *PushDB) GetCommunityPushSubscriptions(ctx context.Context, communityId int64, afterId int64, limit int) ([]*model.PushSubscription, error) {
+	return pdb.getPushSubscriptions(func(subscription *model.PushSubscription) bool {
+		return subscription.Id > afterId &&
+			pdb.subscriptions[subscriptionKey{userId: subscription.UserId, communityId: communityId}]
+	}, limit), nil
+}
+
+// getPushSubscriptions returns copies of the matching subscriptions ordered by id, up to limit (all of them if 0)
+func (pdb *PushDB) getPushSubscriptions(matches func(*model.PushSubscription) bool, limit int) []*model.PushSubscription {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+	subscriptions := make([]*model.PushSubscription, 0)
+	for _, row := range pdb.pushSubs {
+		if matches(row) {
+			subscription := *row
+			subscriptions = append(subscriptions, &subscription)
+		}
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].Id < subscriptions[j].Id
+	})
+	if limit > 0 && len(subscriptions) > limit {
+		subscriptions = subscriptions[:limit]
+	}
+	return subscriptions
+}
@@ -0,0 +1,43 @@
+package memory
+
+import (
+	"context"
+	"github.com/navbryce/next-dorm-be/model"
+	"time"
+)
+
+type RateLimitDB struct {
+	*store
+}
+
+func getRateLimitDB(store *store) *RateLimitDB {
+	return &RateLimitDB{store}
+}
+
+func (rdb *RateLimitDB) UpdateRateLimitBuckets(ctx context.Context, keys []string, update func([]*model.RateLimitBucket) []*model.RateLimitBucket) error {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+	buckets := make([]*model.RateLimitBucket, len(keys))
+	for i, key := range keys {
+		if existing, ok := rdb.rateLimits[key]; ok {
+			cp := *existing
+			buckets[i] = &cp
+		}
+	}
+	for i, bucket := range update(buckets) {
+		updated := *bucket
+		rdb.rateLimits[keys[i]] = &updated
+	}
+	return nil
+}
+
+func (rdb *RateLimitDB) DeleteRateLimitBuckets(ctx context.Context, updatedBefore time.Time) error {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+	for key, bucket := range rdb.rateLimits {
+		if bucket.UpdatedAt.Before(updatedBefore) {
+			delete(rdb.rateLimits, key)
+		}
+	}
+	return nil
+}
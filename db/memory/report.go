@@ -0,0 +1,214 @@
+package memory
+
+import (
+	"context"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"sort"
+)
+
+type ReportDB struct {
+	*store
+}
+
+func getReportDB(store *store) *ReportDB {
+	return &ReportDB{store}
+}
+
+func (rdb *ReportDB) CreateReport(ctx context.Context, reporterId string, req *appDb.CreateReport) (*model.Report, error) {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+	return rdb.insertReport(reporterId, req)
+}
+
+// insertReport must hold the write lock
+func (s *store) insertReport(reporterId string, req *appDb.CreateReport) (*model.Report, error) {
+	groupId, ok := s.openReportGroup[req.Target.Key()]
+	if ok {
+		for _, report := range s.reports {
+			if report.GroupId == groupId && report.ReporterId == reporterId {
+				return nil, &appDb.DupKeyErr{Key: "IDX_REPORT_BY_REPORTER"}
+			}
+		}
+	} else {
+		groupId = s.nextId("report_group")
+		target := copyReportGroup(&model.ReportGroup{ReportTarget: *req.Target}).ReportTarget
+		s.reportGroups[groupId] = &model.ReportGroup{
+			Id:           groupId,
+			ReportTarget: target,
+			Status:       model.ReportStatusOpen,
+			CreatedAt:    now(),
+		}
+		s.openReportGroup[req.Target.Key()] = groupId
+	}
+
+	report := &model.Report{
+		Id:         s.nextId("report"),
+		GroupId:    groupId,
+		ReporterId: reporterId,
+		Reason:     req.Reason,
+		CreatedAt:  now(),
+	}
+	s.reports[report.Id] = report
+	group := s.reportGroups[groupId]
+	group.NumReports++
+	group.LastReportedAt = report.CreatedAt
+	cp := *report
+	return &cp, nil
+}
+
+// insertAutomodReport reports the content as automod, unless automod already reported it in its open group. Does
+// nothing if req is nil. must hold the write lock
+func (s *store) insertAutomodReport(req *appDb.CreateReport) {
+	if req == nil {
+		return
+	}
+	// the only error is automod having reported it already
+	_, _ = s.insertReport(model.AutomodReporterId, req)
+}
+
+func (rdb *ReportDB) GetReportGroup(ctx context.Context, id int64) (*model.ReportGroup, error) {
+	rdb.mu.RLock()
+	defer rdb.mu.RUnlock()
+	if group, ok := rdb.reportGroups[id]; ok {
+		return copyReportGroup(group), nil
+	}
+	return nil, nil
+}
+
+func (rdb *ReportDB) GetReportGroups(ctx context.Context, query *appDb.ReportGroupsQuery) ([]*model.ReportGroup, error) {
+	rdb.mu.RLock()
+	defer rdb.mu.RUnlock()
+	var communityIds map[int64]bool
+	if query.CommunityIds != nil {
+		communityIds = make(map[int64]bool)
+		for _, id := range query.CommunityIds {
+			communityIds[id] = true
+		}
+	}
+	groups := make([]*model.ReportGroup, 0)
+	for _, group := range rdb.reportGroups {
+		if (query.Status != "" && group.Status != query.Status) ||
+			(query.TargetType != "" && group.Type != query.TargetType) ||
+			(query.BeforeId != 0 && group.Id >= query.BeforeId) ||
+			(communityIds != nil && !rdb.reportGroupIn(group, communityIds)) {
+			continue
+		}
+		groups = append(groups, copyReportGroup(group))
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Id > groups[j].Id
+	})
+	if len(groups) > query.Limit {
+		groups = groups[:query.Limit]
+	}
+	return groups, nil
+}
+
+func (rdb *ReportDB) GetReports(ctx context.Context, groupId int64) ([]*model.Report, error) {
+	rdb.mu.RLock()
+	defer rdb.mu.RUnlock()
+	reports := make([]*model.Report, 0)
+	for _, report := range rdb.reports {
+		if report.GroupId == groupId {
+			cp := *report
+			reports = append(reports, &cp)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Id < reports[j].Id
+	})
+	return reports, nil
+}
+
+func (rdb *ReportDB) ResolveReportGroup(ctx context.Context, id int64, req *appDb.ResolveReportGroup) error {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+	group, ok := rdb.reportGroups[id]
+	if !ok || group.Status != model.ReportStatusOpen {
+		return appDb.ErrNotFound
+	}
+	resolvedAt := now()
+	resolvedBy := req.ResolvedBy
+	group.Status = req.Status
+	group.ResolvedBy = &resolvedBy
+	group.ResolvedAt = &resolvedAt
+	if req.Resolution != nil {
+		resolution := *req.Resolution
+		group.Resolution = &resolution
+	}
+	delete(rdb.openReportGroup, group.Key())
+	if req.Remove != nil {
+		var removed bool
+		if req.Remove.CommentId != nil {
+			removed = rdb.markCommentAsDeleted(*req.Remove.CommentId)
+		} else {
+			removed = rdb.markPostAsDeleted(req.Remove.PostId)
+		}
+		if removed {
+			rdb.appendModLogEntry(req.Remove.ModLog)
+		}
+	}
+	if req.Reveal != nil {
+		req.Reveal.Reveal.Id = rdb.insertReveal(req.Reveal.Reveal, req.Reveal.ModLog)
+	}
+	if req.Ban != nil {
+		req.Ban.Ban.Id = rdb.insertBan(req.Ban.Ban, req.Ban.ModLog)
+	}
+	rdb.appendModLogEntry(req.ModLog)
+	return nil
+}
+
+// reportGroupIn is true if the group is of content in (or a user reported in) one of the communities. must hold the
+// read lock
+func (rdb *ReportDB) reportGroupIn(group *model.ReportGroup, communityIds map[int64]bool) bool {
+	if group.CommunityId != nil && communityIds[*group.CommunityId] {
+		return true
+	}
+	if group.PostId == nil {
+		return false
+	}
+	post, ok := rdb.posts[*group.PostId]
+	if !ok {
+		return false
+	}
+	for _, communityId := range post.communityIds {
+		if communityIds[communityId] {
+			return true
+		}
+	}
+	return false
+}
+
+func copyReportGroup(group *model.ReportGroup) *model.ReportGroup {
+	cp := *group
+	if group.PostId != nil {
+		postId := *group.PostId
+		cp.PostId = &postId
+	}
+	if group.CommentId != nil {
+		commentId := *group.CommentId
+		cp.CommentId = &commentId
+	}
+	if group.UserId != nil {
+		userId := *group.UserId
+		cp.UserId = &userId
+	}
+	if group.CommunityId != nil {
+		communityId := *group.CommunityId
+		cp.CommunityId = &communityId
+	}
+	if group.ResolvedBy != nil {
+		resolvedBy := *group.ResolvedBy
+		cp.ResolvedBy = &resolvedBy
+	}
+	if group.ResolvedAt != nil {
+		resolvedAt := *group.ResolvedAt
+		cp.ResolvedAt = &resolvedAt
+	}
+	if group.Resolution != nil {
+		resolution := *group.Resolution
+		cp.Resolution = &resolution
+	}
+	return &cp
+}
@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"context"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+)
+
+type RevealDB struct {
+	*store
+}
+
+func getRevealDB(store *store) *RevealDB {
+	return &RevealDB{store}
+}
+
+func (rdb *RevealDB) CreateReveal(ctx context.Context, reveal *model.Reveal, modLog *model.ModLogEntry) (int64, error) {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+	return rdb.insertReveal(reveal, modLog), nil
+}
+
+// insertReveal records the reveal, and the entry with the reveal as its target. must hold the write lock
+func (s *store) insertReveal(reveal *model.Reveal, modLog *model.ModLogEntry) int64 {
+	row := *reveal
+	row.Id = s.nextId("reveal_audit")
+	row.CreatedAt = now()
+	s.reveals = append(s.reveals, &row)
+	if modLog != nil {
+		modLog.TargetId = &row.Id
+	}
+	s.appendModLogEntry(modLog)
+	return row.Id
+}
+
+func (rdb *RevealDB) GetReveals(ctx context.Context, query *appDb.RevealsQuery) ([]*model.Reveal, error) {
+	rdb.mu.RLock()
+	defer rdb.mu.RUnlock()
+	reveals := make([]*model.Reveal, 0)
+	for i := len(rdb.reveals) - 1; i >= 0 && len(reveals) < query.Limit; i-- {
+		reveal := rdb.reveals[i]
+		if (query.AdminId != "" && reveal.AdminId != query.AdminId) ||
+			(query.PostId != 0 && reveal.PostId != query.PostId) ||
+			(query.BeforeId != 0 && reveal.Id >= query.BeforeId) {
+			continue
+		}
+		cp := *reveal
+		reveals = append(reveals, &cp)
+	}
+	return reveals, nil
+}
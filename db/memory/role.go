@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"context"
+	"github.com/navbryce/next-dorm-be/model"
+	"sort"
+)
+
+type RoleDB struct {
+	*store
+}
+
+type roleKey struct {
+	userId      string
+	communityId int64
+}
+
+func getRoleDB(store *store) *RoleDB {
+	return &RoleDB{store}
+}
+
+func (rdb *RoleDB) GrantRole(ctx context.Context, grant *model.RoleGrant, modLog *model.ModLogEntry) error {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+	row := *grant
+	row.CreatedAt = now()
+	rdb.roles[roleKey{grant.UserId, grant.CommunityId}] = &row
+	rdb.appendModLogEntry(modLog)
+	return nil
+}
+
+func (rdb *RoleDB) RevokeRole(ctx context.Context, userId string, communityId int64, modLog *model.ModLogEntry) error {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+	delete(rdb.roles, roleKey{userId, communityId})
+	rdb.appendModLogEntry(modLog)
+	return nil
+}
+
+func (rdb *RoleDB) GetRolesForUser(ctx context.Context, userId string) ([]*model.RoleGrant, error) {
+	return rdb.getRoles(func(grant *model.RoleGrant) bool {
+		return grant.UserId == userId
+	}), nil
+}
+
+func (rdb *RoleDB) GetRolesInCommunity(ctx context.Context, communityId int64) ([]*model.RoleGrant, error) {
+	return rdb.getRoles(func(grant *model.RoleGrant) bool {
+		return grant.CommunityId == communityId
+	}), nil
+}
+
+func (rdb *RoleDB) getRoles(matches func(*model.RoleGrant) bool) []*model.RoleGrant {
+	rdb.mu.RLock()
+	defer rdb.mu.RUnlock()
+	grants := make([]*model.RoleGrant, 0)
+	for _, grant := range rdb.roles {
+		if matches(grant) {
+			cp := *grant
+			grants = append(grants, &cp)
+		}
+	}
+	sort.Slice(grants, func(i, j int) bool {
+		return grants[i].CreatedAt.Before(grants[j].CreatedAt)
+	})
+	return grants
+}
@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"context"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"sort"
+)
+
+type subscriptionKey struct {
+	userId      string
+	communityId int64
+}
+
+type SubscriptionDB struct {
+	*store
+}
+
+func getSubscriptionDB(store *store) *SubscriptionDB {
+	return &SubscriptionDB{store}
+}
+
+func (sdb *SubscriptionDB) CreateSubForUser(ctx context.Context, sub *model.Subscription) error {
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+	key := subscriptionKey{userId: sub.UserId, communityId: sub.CommunityId}
+	if sdb.subscriptions[key] {
+		return &appDb.DupKeyErr{Key: "PRIMARY"}
+	}
+	sdb.subscriptions[key] = true
+	return nil
+}
+
+func (sdb *SubscriptionDB) DeleteSubForUser(ctx context.Context, sub *model.Subscription) error {
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+	delete(sdb.subscriptions, subscriptionKey{userId: sub.UserId, communityId: sub.CommunityId})
+	return nil
+}
+
+func (sdb *SubscriptionDB) GetSubsForUser(ctx context.Context, userId string) ([]*model.Subscription, error) {
+	sdb.mu.RLock()
+	defer sdb.mu.RUnlock()
+	var subs []*model.Subscription
+	for key := range sdb.subscriptions {
+		if key.userId == userId {
+			subs = append(subs, &model.Subscription{UserId: key.userId, CommunityId: key.communityId})
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].CommunityId < subs[j].CommunityId
+	})
+	return subs, nil
+}
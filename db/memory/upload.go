@@ -0,0 +1,126 @@
+package memory
+
+import (
+	"context"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"time"
+)
+
+type UploadDB struct {
+	*store
+}
+
+func getUploadDB(store *store) *UploadDB {
+	return &UploadDB{store}
+}
+
+func (udb *UploadDB) CreateUpload(ctx context.Context, upload *model.Upload) (int64, error) {
+	udb.mu.Lock()
+	defer udb.mu.Unlock()
+	for _, existing := range udb.uploads {
+		if existing.TokenHash == upload.TokenHash {
+			return 0, &appDb.DupKeyErr{Key: "U_IDX_TOKEN_HASH"}
+		}
+	}
+	row := *upload
+	row.Id = udb.nextId("upload")
+	row.Size = 0
+	row.CreatedAt = now()
+	row.ExpiresAt = upload.ExpiresAt.UTC().Truncate(time.Second)
+	row.CompletedAt = nil
+	row.ProcessedAt = nil
+	udb.uploads[row.Id] = &row
+	return row.Id, nil
+}
+
+func (udb *UploadDB) GetUploadByTokenHash(ctx context.Context, tokenHash string) (*model.Upload, error) {
+	udb.mu.RLock()
+	defer udb.mu.RUnlock()
+	for _, upload := range udb.uploads {
+		if upload.TokenHash == tokenHash {
+			return copyUpload(upload), nil
+		}
+	}
+	return nil, nil
+}
+
+func (udb *UploadDB) CompleteUpload(ctx context.Context, id int64, size int64) error {
+	udb.mu.Lock()
+	defer udb.mu.Unlock()
+	upload, ok := udb.uploads[id]
+	if !ok || upload.IsCompleted() {
+		return appDb.ErrNotFound
+	}
+	completedAt := now()
+	upload.Size = size
+	upload.CompletedAt = &completedAt
+	return nil
+}
+
+func (udb *UploadDB) ReopenUpload(ctx context.Context, id int64) error {
+	udb.mu.Lock()
+	defer udb.mu.Unlock()
+	if upload, ok := udb.uploads[id]; ok {
+		upload.CompletedAt = nil
+	}
+	return nil
+}
+
+func (udb *UploadDB) GetCompletedUploads(ctx context.Context, blobNames []string) ([]*model.Upload, error) {
+	udb.mu.RLock()
+	defer udb.mu.RUnlock()
+	uploads := make([]*model.Upload, 0)
+	for _, upload := range udb.uploads {
+		if upload.IsCompleted() && containsString(blobNames, upload.BlobName) {
+			uploads = append(uploads, copyUpload(upload))
+		}
+	}
+	return uploads, nil
+}
+
+func (udb *UploadDB) SetUploadProcessed(ctx context.Context, blobName string) error {
+	udb.mu.Lock()
+	defer udb.mu.Unlock()
+	for _, upload := range udb.uploads {
+		if upload.IsCompleted() && upload.BlobName == blobName {
+			processedAt := now()
+			upload.ProcessedAt = &processedAt
+		}
+	}
+	return nil
+}
+
+func (udb *UploadDB) GetAbandonedUploads(ctx context.Context, expiredBefore time.Time) ([]*model.Upload, error) {
+	udb.mu.RLock()
+	defer udb.mu.RUnlock()
+	uploads := make([]*model.Upload, 0)
+	for _, upload := range udb.uploads {
+		if !upload.IsCompleted() && upload.ExpiresAt.Before(expiredBefore) {
+			uploads = append(uploads, copyUpload(upload))
+		}
+	}
+	return uploads, nil
+}
+
+func (udb *UploadDB) DeleteUploads(ctx context.Context, ids []int64) error {
+	udb.mu.Lock()
+	defer udb.mu.Unlock()
+	for _, id := range ids {
+		delete(udb.uploads, id)
+	}
+	return nil
+}
+
+func copyUpload(upload *model.Upload) *model.Upload {
+	cp := *upload
+	if upload.CompletedAt != nil {
+		completedAt := *upload.CompletedAt
+		cp.CompletedAt = &completedAt
+	}
+	if upload.ProcessedAt != nil {
+		processedAt := *upload.ProcessedAt
+		cp.ProcessedAt = &processedAt
+	}
+	return &cp
+}
@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"context"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"time"
+)
+
+type personRow struct {
+	firebaseId  string
+	displayName string
+	isAdmin     bool
+	createdAt   time.Time
+}
+
+type UserDB struct {
+	*store
+}
+
+func getUserDB(store *store) *UserDB {
+	return &UserDB{store}
+}
+
+func (udb *UserDB) CreateUser(ctx context.Context, user *model.LocalUser) error {
+	udb.mu.Lock()
+	defer udb.mu.Unlock()
+	if _, ok := udb.people[user.Id]; ok {
+		return &appDb.DupKeyErr{Key: "PRIMARY"}
+	}
+	for _, person := range udb.people {
+		if person.displayName == user.DisplayName {
+			return &appDb.DupKeyErr{Key: "display_name"}
+		}
+	}
+	udb.people[user.Id] = &personRow{
+		firebaseId:  user.Id,
+		displayName: user.DisplayName,
+		isAdmin:     user.IsAdmin,
+		createdAt:   now(),
+	}
+	return nil
+}
+
+func (udb *UserDB) GetUser(ctx context.Context, id string) (*model.LocalUser, error) {
+	udb.mu.RLock()
+	defer udb.mu.RUnlock()
+	person, ok := udb.people[id]
+	if !ok {
+		return nil, nil
+	}
+	return person.toModel(), nil
+}
+
+func (udb *UserDB) GetUserIds(ctx context.Context) ([]string, error) {
+	udb.mu.RLock()
+	defer udb.mu.RUnlock()
+	ids := make([]string, 0, len(udb.people))
+	for id := range udb.people {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (udb *UserDB) GetUsersByDisplayNames(ctx context.Context, displayNames []string) ([]*model.LocalUser, error) {
+	udb.mu.RLock()
+	defer udb.mu.RUnlock()
+	people := make([]*model.LocalUser, 0)
+	for _, person := range udb.people {
+		for _, displayName := range displayNames {
+			if person.displayName == displayName {
+				people = append(people, person.toModel())
+				break
+			}
+		}
+	}
+	return people, nil
+}
+
+func (pr *personRow) toModel() *model.LocalUser {
+	createdAt := pr.createdAt
+	return &model.LocalUser{
+		Id:          pr.firebaseId,
+		DisplayName: pr.displayName,
+		IsAdmin:     pr.isAdmin,
+		CreatedAt:   &createdAt,
+	}
+}
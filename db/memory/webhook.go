@@ -0,0 +1,219 @@
+package memory
+
+import (
+	"context"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"sort"
+	"time"
+)
+
+type WebhookDB struct {
+	*store
+}
+
+func getWebhookDB(store *store) *WebhookDB {
+	return &WebhookDB{store}
+}
+
+func (wdb *WebhookDB) CreateWebhook(ctx context.Context, webhook *model.Webhook, modLog *model.ModLogEntry) (int64, error) {
+	wdb.mu.Lock()
+	defer wdb.mu.Unlock()
+	row := copyWebhook(webhook)
+	row.Id = wdb.nextId("webhook")
+	row.CreatedAt = now()
+	row.UpdatedAt = row.CreatedAt
+	wdb.webhooks[row.Id] = row
+	if modLog != nil {
+		modLog.TargetId = &row.Id
+	}
+	wdb.appendModLogEntry(modLog)
+	return row.Id, nil
+}
+
+func (wdb *WebhookDB) UpdateWebhook(ctx context.Context, webhook *model.Webhook, modLog *model.ModLogEntry) error {
+	wdb.mu.Lock()
+	defer wdb.mu.Unlock()
+	row, ok := wdb.webhooks[webhook.Id]
+	if !ok {
+		return nil
+	}
+	updated := copyWebhook(webhook)
+	row.URL = updated.URL
+	row.Events = updated.Events
+	row.Active = updated.Active
+	row.UpdatedAt = now()
+	wdb.appendModLogEntry(modLog)
+	return nil
+}
+
+func (wdb *WebhookDB) DeleteWebhook(ctx context.Context, id int64, modLog *model.ModLogEntry) error {
+	wdb.mu.Lock()
+	defer wdb.mu.Unlock()
+	for deliveryId, delivery := range wdb.deliveries {
+		if delivery.WebhookId == id {
+			delete(wdb.deliveries, deliveryId)
+		}
+	}
+	delete(wdb.webhooks, id)
+	wdb.appendModLogEntry(modLog)
+	return nil
+}
+
+func (wdb *WebhookDB) GetWebhook(ctx context.Context, id int64) (*model.Webhook, error) {
+	wdb.mu.RLock()
+	defer wdb.mu.RUnlock()
+	if webhook, ok := wdb.webhooks[id]; ok {
+		return copyWebhook(webhook), nil
+	}
+	return nil, nil
+}
+
+func (wdb *WebhookDB) GetWebhooks(ctx context.Context, communityIds []int64) ([]*model.Webhook, error) {
+	wdb.mu.RLock()
+	defer wdb.mu.RUnlock()
+	webhooks := make([]*model.Webhook, 0)
+	for _, webhook := range wdb.webhooks {
+		if containsId(communityIds, webhook.CommunityId) {
+			webhooks = append(webhooks, copyWebhook(webhook))
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].Id < webhooks[j].Id
+	})
+	return webhooks, nil
+}
+
+func (wdb *WebhookDB) CreateWebhookDeliveries(ctx context.Context, deliveries []*model.WebhookDelivery) error {
+	wdb.mu.Lock()
+	defer wdb.mu.Unlock()
+	for _, delivery := range deliveries {
+		row := copyWebhookDelivery(delivery)
+		row.Id = wdb.nextId("webhook_delivery")
+		row.Attempts = 0
+		row.LastStatusCode = nil
+		row.CreatedAt = now()
+		row.UpdatedAt = row.CreatedAt
+		wdb.deliveries[row.Id] = row
+		delivery.Id = row.Id
+	}
+	return nil
+}
+
+func (wdb *WebhookDB) GetWebhookDelivery(ctx context.Context, id int64) (*model.WebhookDelivery, error) {
+	wdb.mu.RLock()
+	defer wdb.mu.RUnlock()
+	if delivery, ok := wdb.deliveries[id]; ok {
+		return copyWebhookDelivery(delivery), nil
+	}
+	return nil, nil
+}
+
+func (wdb *WebhookDB) GetWebhookDeliveries(ctx context.Context, query *appDb.WebhookDeliveriesQuery) ([]*model.WebhookDelivery, error) {
+	wdb.mu.RLock()
+	defer wdb.mu.RUnlock()
+	deliveries := make([]*model.WebhookDelivery, 0)
+	for _, delivery := range wdb.deliveries {
+		if delivery.WebhookId != query.WebhookId ||
+			(query.Status != "" && delivery.Status != query.Status) ||
+			(query.BeforeId != 0 && delivery.Id >= query.BeforeId) {
+			continue
+		}
+		deliveries = append(deliveries, copyWebhookDelivery(delivery))
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].Id > deliveries[j].Id
+	})
+	if len(deliveries) > query.Limit {
+		deliveries = deliveries[:query.Limit]
+	}
+	return deliveries, nil
+}
+
+func (wdb *WebhookDB) GetDueWebhookDeliveries(ctx context.Context, dueAt time.Time, limit int) ([]*model.WebhookDelivery, error) {
+	wdb.mu.RLock()
+	defer wdb.mu.RUnlock()
+	deliveries := make([]*model.WebhookDelivery, 0)
+	for _, delivery := range wdb.deliveries {
+		if isDue(delivery, dueAt) {
+			deliveries = append(deliveries, copyWebhookDelivery(delivery))
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].NextAttemptAt.Equal(*deliveries[j].NextAttemptAt) {
+			return deliveries[i].NextAttemptAt.Before(*deliveries[j].NextAttemptAt)
+		}
+		return deliveries[i].Id < deliveries[j].Id
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (wdb *WebhookDB) ClaimWebhookDelivery(ctx context.Context, id int64, dueAt time.Time, leaseUntil time.Time) (bool, error) {
+	wdb.mu.Lock()
+	defer wdb.mu.Unlock()
+	delivery, ok := wdb.deliveries[id]
+	if !ok || !isDue(delivery, dueAt) {
+		return false, nil
+	}
+	delivery.NextAttemptAt = &leaseUntil
+	return true, nil
+}
+
+func (wdb *WebhookDB) UpdateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	wdb.mu.Lock()
+	defer wdb.mu.Unlock()
+	row, ok := wdb.deliveries[delivery.Id]
+	if !ok {
+		return nil
+	}
+	updated := copyWebhookDelivery(delivery)
+	row.Status = updated.Status
+	row.Attempts = updated.Attempts
+	row.NextAttemptAt = updated.NextAttemptAt
+	row.LastStatusCode = updated.LastStatusCode
+	row.LastError = updated.LastError
+	row.UpdatedAt = now()
+	return nil
+}
+
+func (wdb *WebhookDB) DeleteWebhookDeliveries(ctx context.Context, createdBefore time.Time) error {
+	wdb.mu.Lock()
+	defer wdb.mu.Unlock()
+	for id, delivery := range wdb.deliveries {
+		if delivery.Status != model.WebhookDeliveryPending && delivery.CreatedAt.Before(createdBefore) {
+			delete(wdb.deliveries, id)
+		}
+	}
+	return nil
+}
+
+func isDue(delivery *model.WebhookDelivery, dueAt time.Time) bool {
+	return delivery.Status == model.WebhookDeliveryPending && delivery.NextAttemptAt != nil &&
+		!delivery.NextAttemptAt.After(dueAt)
+}
+
+func copyWebhook(webhook *model.Webhook) *model.Webhook {
+	cp := *webhook
+	cp.Events = append(model.WebhookEvents(nil), webhook.Events...)
+	return &cp
+}
+
+func copyWebhookDelivery(delivery *model.WebhookDelivery) *model.WebhookDelivery {
+	cp := *delivery
+	if delivery.NextAttemptAt != nil {
+		nextAttemptAt := *delivery.NextAttemptAt
+		cp.NextAttemptAt = &nextAttemptAt
+	}
+	if delivery.LastStatusCode != nil {
+		lastStatusCode := *delivery.LastStatusCode
+		cp.LastStatusCode = &lastStatusCode
+	}
+	if delivery.ReplayOf != nil {
+		replayOf := *delivery.ReplayOf
+		cp.ReplayOf = &replayOf
+	}
+	return &cp
+}
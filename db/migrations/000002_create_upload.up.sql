@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS upload
+(
+    id           INT                       NOT NULL AUTO_INCREMENT,
+    token_hash   CHAR(64)                  NOT NULL,
+    blob_name    VARCHAR(2048)             NOT NULL,
+    owner_id     VARCHAR(36)               NOT NULL,
+    kind         ENUM ('IMAGE', 'AVATAR')  NOT NULL,
+    content_type VARCHAR(100)              NOT NULL,
+    max_size     BIGINT                    NOT NULL,
+    size         BIGINT                    NOT NULL DEFAULT 0,
+    created_at   DATETIME                  NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at   DATETIME                  NOT NULL,
+    completed_at DATETIME,
+    PRIMARY KEY (id),
+    UNIQUE INDEX U_IDX_TOKEN_HASH (token_hash),
+    INDEX IDX_BLOB_NAME (blob_name(255))
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS image_thumbnail;
+
+ALTER TABLE image
+    DROP COLUMN width,
+    DROP COLUMN height;
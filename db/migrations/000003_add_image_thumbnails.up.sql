@@ -0,0 +1,14 @@
+ALTER TABLE image
+    ADD COLUMN width  INT NOT NULL DEFAULT 0,
+    ADD COLUMN height INT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS image_thumbnail
+(
+    id        INT           NOT NULL AUTO_INCREMENT,
+    image_id  INT           NOT NULL,
+    blob_name VARCHAR(2048) NOT NULL,
+    width     INT           NOT NULL,
+    height    INT           NOT NULL,
+    PRIMARY KEY (id),
+    INDEX IDX_BY_IMAGE (image_id)
+);
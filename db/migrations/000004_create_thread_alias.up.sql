@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS thread_alias
+(
+    post_metadata_id INT          NOT NULL,
+    user_id          VARCHAR(36)  NOT NULL,
+    alias            VARCHAR(300) NOT NULL,
+    created_at       DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (post_metadata_id, user_id),
+    UNIQUE INDEX U_IDX_ALIAS_IN_THREAD (post_metadata_id, alias)
+);
@@ -0,0 +1,5 @@
+-- thread_alias.user_id keeps its width, since aliases of sealed creators are keyed by 64 character hashes
+ALTER TABLE content_metadata
+    DROP INDEX IDX_CREATOR_HASH,
+    DROP COLUMN creator_id_enc,
+    DROP COLUMN creator_id_hash;
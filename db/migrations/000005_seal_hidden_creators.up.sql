@@ -0,0 +1,8 @@
+ALTER TABLE content_metadata
+    ADD COLUMN creator_id_enc  VARCHAR(255) NULL,
+    ADD COLUMN creator_id_hash CHAR(64)     NULL,
+    ADD INDEX IDX_CREATOR_HASH (creator_id_hash);
+
+-- thread aliases are keyed by the creator hash when creators are sealed
+ALTER TABLE thread_alias
+    MODIFY COLUMN user_id VARCHAR(64) NOT NULL;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS reveal_audit
+(
+    id         INT         NOT NULL AUTO_INCREMENT,
+    admin_id   VARCHAR(36) NOT NULL,
+    post_id    INT         NOT NULL,
+    comment_id INT         NULL,
+    reason     TEXT        NOT NULL,
+    created_at DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX IDX_REVEAL_BY_ADMIN (admin_id),
+    INDEX IDX_REVEAL_BY_POST (post_id)
+);
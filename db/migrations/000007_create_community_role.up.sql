@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS community_role
+(
+    user_id      VARCHAR(36) NOT NULL,
+    community_id MEDIUMINT   NOT NULL,
+    role         VARCHAR(20) NOT NULL,
+    granted_by   VARCHAR(36) NOT NULL,
+    created_at   DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, community_id),
+    INDEX IDX_ROLE_BY_COMMUNITY (community_id)
+);
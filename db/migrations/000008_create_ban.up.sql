@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS ban
+(
+    id           INT         NOT NULL AUTO_INCREMENT,
+    user_id      VARCHAR(36) NOT NULL,
+    community_id MEDIUMINT   NULL,
+    reason       TEXT        NOT NULL,
+    issued_by    VARCHAR(36) NOT NULL,
+    expires_at   DATETIME    NULL,
+    lifted_at    DATETIME    NULL,
+    lifted_by    VARCHAR(36) NULL,
+    created_at   DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX IDX_BAN_BY_USER (user_id),
+    INDEX IDX_BAN_BY_COMMUNITY (community_id)
+);
@@ -0,0 +1,22 @@
+ALTER TABLE report
+    DROP INDEX IDX_REPORT_BY_REPORTER,
+    ADD COLUMN tgt_metadata_id INT                                      NULL,
+    ADD COLUMN status          ENUM ('SUBMITTED', 'ACCEPTED', 'REJECTED') DEFAULT 'SUBMITTED',
+    ADD INDEX IDX_BY_POST (tgt_metadata_id);
+
+-- tgt_metadata_id held the post id
+UPDATE report
+    JOIN report_group ON report_group.id = report.group_id
+SET report.tgt_metadata_id = report_group.post_id
+WHERE report_group.target_type = 'POST';
+
+-- comments and users couldn't be reported before
+DELETE
+FROM report
+WHERE tgt_metadata_id IS NULL;
+
+ALTER TABLE report
+    MODIFY COLUMN tgt_metadata_id INT NOT NULL,
+    DROP COLUMN group_id;
+
+DROP TABLE IF EXISTS report_group;
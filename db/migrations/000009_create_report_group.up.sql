@@ -0,0 +1,58 @@
+CREATE TABLE IF NOT EXISTS report_group
+(
+    id               INT                                     NOT NULL AUTO_INCREMENT,
+    target_type      ENUM ('POST', 'COMMENT', 'USER')        NOT NULL,
+    post_id          INT                                     NULL,
+    comment_id       INT                                     NULL,
+    user_id          VARCHAR(36)                             NULL,
+    community_id     MEDIUMINT                               NULL,
+    -- the target key while the group is open, so a target has at most one open group
+    open_key         VARCHAR(64)                             NULL,
+    status           ENUM ('OPEN', 'ACTIONED', 'DISMISSED')  NOT NULL DEFAULT 'OPEN',
+    num_reports      INT                                     NOT NULL DEFAULT 0,
+    resolved_by      VARCHAR(36)                             NULL,
+    resolved_at      DATETIME                                NULL,
+    resolution       TEXT                                    NULL,
+    created_at       DATETIME                                NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_reported_at DATETIME                                NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE INDEX IDX_REPORT_GROUP_OPEN_KEY (open_key),
+    INDEX IDX_REPORT_GROUP_BY_POST (post_id),
+    INDEX IDX_REPORT_GROUP_BY_COMMUNITY (community_id),
+    INDEX IDX_REPORT_GROUP_BY_STATUS (status)
+);
+
+-- only posts could be reported so far. despite its name, tgt_metadata_id holds the post id
+INSERT INTO report_group (target_type, post_id, open_key, created_at, last_reported_at)
+SELECT 'POST', post.id, CONCAT('POST:', post.id), MIN(report.created_at), MAX(report.created_at)
+FROM report
+         JOIN post ON post.id = report.tgt_metadata_id
+GROUP BY post.id;
+
+ALTER TABLE report
+    ADD COLUMN group_id INT NULL;
+
+UPDATE report
+    JOIN post ON post.id = report.tgt_metadata_id
+    JOIN report_group ON report_group.post_id = post.id
+SET report.group_id = report_group.id;
+
+-- reports of posts that don't exist and repeated reports by the same user
+DELETE
+FROM report
+WHERE group_id IS NULL;
+DELETE duplicate
+FROM report AS duplicate
+         JOIN report AS original
+              ON original.group_id = duplicate.group_id AND original.creator_id = duplicate.creator_id AND
+                 original.id < duplicate.id;
+
+UPDATE report_group
+SET num_reports = (SELECT COUNT(*) FROM report WHERE report.group_id = report_group.id);
+
+ALTER TABLE report
+    MODIFY COLUMN group_id INT NOT NULL,
+    DROP INDEX IDX_BY_POST,
+    DROP COLUMN tgt_metadata_id,
+    DROP COLUMN status,
+    ADD UNIQUE INDEX IDX_REPORT_BY_REPORTER (group_id, creator_id);
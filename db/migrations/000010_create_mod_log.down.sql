@@ -0,0 +1 @@
+DROP TABLE IF EXISTS mod_log, mod_log_community;
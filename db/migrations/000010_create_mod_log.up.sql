@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS mod_log
+(
+    id         INT         NOT NULL AUTO_INCREMENT,
+    actor_id   VARCHAR(36) NOT NULL,
+    action     VARCHAR(32) NOT NULL,
+    post_id    INT         NULL,
+    comment_id INT         NULL,
+    user_id    VARCHAR(36) NULL,
+    target_id  INT         NULL,
+    role       VARCHAR(16) NOT NULL DEFAULT '',
+    reason     TEXT        NOT NULL,
+    created_at DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX IDX_MOD_LOG_BY_ACTOR (actor_id)
+);
+
+CREATE TABLE IF NOT EXISTS mod_log_community
+(
+    entry_id     INT       NOT NULL,
+    community_id MEDIUMINT NOT NULL,
+    PRIMARY KEY (entry_id, community_id),
+    INDEX IDX_MOD_LOG_BY_COMMUNITY (community_id, entry_id)
+);
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS automod_rule
+(
+    id           INT         NOT NULL AUTO_INCREMENT,
+    community_id MEDIUMINT   NOT NULL,
+    rule_type    VARCHAR(16) NOT NULL,
+    outcome      VARCHAR(16) NOT NULL,
+    applies_to   VARCHAR(16) NOT NULL,
+    params       TEXT        NOT NULL,
+    reason       TEXT        NOT NULL,
+    created_by   VARCHAR(36) NOT NULL,
+    created_at   DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at   DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX IDX_AUTOMOD_RULE_BY_COMMUNITY (community_id)
+);
+
+ALTER TABLE content_metadata
+    ADD held BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- existing users are left without a creation time, so account age rules skip them
+ALTER TABLE person
+    ADD created_at DATETIME NULL;
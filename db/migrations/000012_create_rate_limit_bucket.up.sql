@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS rate_limit_bucket
+(
+    bucket_key    VARCHAR(191) NOT NULL,
+    tokens        DOUBLE       NOT NULL,
+    -- unix milliseconds. buckets refill continuously, so seconds are too coarse
+    updated_at_ms BIGINT       NOT NULL,
+    PRIMARY KEY (bucket_key),
+    INDEX IDX_RATE_LIMIT_BUCKET_BY_UPDATED_AT (updated_at_ms)
+);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS notification
+(
+    id                INT         NOT NULL AUTO_INCREMENT,
+    -- the recipient as stored in thread_alias.user_id (keyed hash when db.creator_key is set)
+    recipient_key     VARCHAR(64) NOT NULL,
+    notification_type VARCHAR(16) NOT NULL,
+    post_id           INT         NOT NULL,
+    comment_id        INT         NULL,
+    mod_action        VARCHAR(32) NOT NULL DEFAULT '',
+    reason            TEXT        NOT NULL,
+    is_read           BOOLEAN     NOT NULL DEFAULT FALSE,
+    created_at        DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX IDX_NOTIFICATION_BY_RECIPIENT (recipient_key, id),
+    INDEX IDX_NOTIFICATION_UNREAD (recipient_key, is_read, id)
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS live_event
+(
+    id                BIGINT      NOT NULL AUTO_INCREMENT,
+    event_type        VARCHAR(16) NOT NULL,
+    post_id           INT         NOT NULL,
+    comment_id        INT         NULL,
+    parent_comment_id INT         NULL,
+    created_at        DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    -- events are only kept for a few minutes
+    INDEX IDX_LIVE_EVENT_BY_CREATED_AT (created_at)
+);
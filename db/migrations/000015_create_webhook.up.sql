@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS webhook
+(
+    id           INT           NOT NULL AUTO_INCREMENT,
+    community_id MEDIUMINT     NOT NULL,
+    url          VARCHAR(2048) NOT NULL,
+    secret       VARCHAR(64)   NOT NULL,
+    events       TEXT          NOT NULL,
+    active       BOOLEAN       NOT NULL DEFAULT TRUE,
+    created_by   VARCHAR(36)   NOT NULL,
+    created_at   DATETIME      NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at   DATETIME      NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX IDX_WEBHOOK_BY_COMMUNITY (community_id)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_delivery
+(
+    id               BIGINT      NOT NULL AUTO_INCREMENT,
+    webhook_id       INT         NOT NULL,
+    event            VARCHAR(32) NOT NULL,
+    payload          MEDIUMTEXT  NOT NULL,
+    status           VARCHAR(16) NOT NULL,
+    attempts         INT         NOT NULL DEFAULT 0,
+    -- null once the delivery succeeded or failed
+    next_attempt_at  DATETIME    NULL,
+    last_status_code INT         NULL,
+    last_error       TEXT        NOT NULL,
+    replay_of        BIGINT      NULL,
+    created_at       DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at       DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX IDX_WEBHOOK_DELIVERY_BY_WEBHOOK (webhook_id, id),
+    INDEX IDX_WEBHOOK_DELIVERY_DUE (status, next_attempt_at),
+    INDEX IDX_WEBHOOK_DELIVERY_BY_CREATED_AT (created_at)
+);
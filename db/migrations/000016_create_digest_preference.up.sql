@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS digest_preference
+(
+    user_id           VARCHAR(36)  NOT NULL,
+    email             VARCHAR(320) NOT NULL,
+    frequency         VARCHAR(16)  NOT NULL,
+    unsubscribe_token VARCHAR(64)  NOT NULL,
+    -- null while the digest is off
+    next_send_at      DATETIME     NULL,
+    last_sent_at      DATETIME     NULL,
+    created_at        DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at        DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id),
+    UNIQUE INDEX IDX_DIGEST_PREFERENCE_BY_TOKEN (unsubscribe_token),
+    INDEX IDX_DIGEST_PREFERENCE_DUE (next_send_at)
+);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS push_subscription
+(
+    id            BIGINT        NOT NULL AUTO_INCREMENT,
+    user_id       VARCHAR(36)   NOT NULL,
+    endpoint      VARCHAR(2048) NOT NULL,
+    -- hex SHA-256 of the endpoint, which is too long to index
+    endpoint_hash CHAR(64)      NOT NULL,
+    p256dh        VARCHAR(128)  NOT NULL,
+    auth          VARCHAR(64)   NOT NULL,
+    created_at    DATETIME      NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at    DATETIME      NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE INDEX IDX_PUSH_SUBSCRIPTION_BY_ENDPOINT (endpoint_hash),
+    INDEX IDX_PUSH_SUBSCRIPTION_BY_USER (user_id)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE upload
+    DROP COLUMN processed_at;
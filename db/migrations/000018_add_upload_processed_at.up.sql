@@ -0,0 +1,2 @@
+ALTER TABLE upload
+    ADD COLUMN processed_at DATETIME;
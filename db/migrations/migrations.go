@@ -0,0 +1,286 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Files holds every migration. File names follow {version}_{name}.{up|down}.sql
+//
+//go:embed *.sql
+var Files embed.FS
+
+//go:embed sqlite/*.sql
+var sqliteFiles embed.FS
+
+// SQLiteFiles returns the SQLite flavored versions of Files. Versions must be kept in sync with Files
+func SQLiteFiles() fs.FS {
+	files, err := fs.Sub(sqliteFiles, "sqlite")
+	if err != nil {
+		panic(err)
+	}
+	return files
+}
+
+const VersionTable = "schema_migrations"
+
+var fileNameRegex = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	*Migration
+	AppliedAt *time.Time
+}
+
+// Load reads the migrations in fsys ordered by version
+func Load(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := fileNameRegex.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %v: %w", entry.Name(), err)
+		}
+		contents, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration version %v is used by both %v and %v", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if len(strings.TrimSpace(migration.Up)) == 0 {
+			return nil, fmt.Errorf("migration %v_%v is missing an up file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Migrator applies migrations and records the applied versions in VersionTable
+type Migrator struct {
+	db         *sql.DB
+	migrations []*Migration
+}
+
+func NewMigrator(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Up applies at most steps pending migrations. steps <= 0 applies all of them
+func (m *Migrator) Up(ctx context.Context, steps int) ([]*Migration, error) {
+	applied, err := m.appliedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ran []*Migration
+	for _, migration := range m.migrations {
+		if steps > 0 && len(ran) == steps {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err := m.run(ctx, migration.Up, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx,
+				"INSERT INTO "+VersionTable+" (version, name, applied_at) VALUES (?, ?, ?)",
+				migration.Version, migration.Name, time.Now().UTC())
+			return err
+		}); err != nil {
+			return ran, fmt.Errorf("applying %v_%v: %w", migration.Version, migration.Name, err)
+		}
+		ran = append(ran, migration)
+	}
+	return ran, nil
+}
+
+// Down rolls back the steps most recently applied migrations
+func (m *Migrator) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	applied, err := m.appliedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ran []*Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(ran) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if len(strings.TrimSpace(migration.Down)) == 0 {
+			return ran, fmt.Errorf("migration %v_%v is irreversible (no down file)", migration.Version, migration.Name)
+		}
+		if err := m.run(ctx, migration.Down, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, "DELETE FROM "+VersionTable+" WHERE version = ?", migration.Version)
+			return err
+		}); err != nil {
+			return ran, fmt.Errorf("rolling back %v_%v: %w", migration.Version, migration.Name, err)
+		}
+		ran = append(ran, migration)
+	}
+	return ran, nil
+}
+
+// Status returns every known migration and when it was applied (nil if pending)
+func (m *Migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	applied, err := m.appliedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]*MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = &MigrationStatus{Migration: migration}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			statuses[i].AppliedAt = &appliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// run executes the script and the bookkeeping in one transaction. DDL is not transactional in MySQL, so a failed
+// script can leave the schema partially migrated
+func (m *Migrator) run(ctx context.Context, script string, record func(tx *sql.Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, statement := range SplitStatements(script) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	if err := record(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *Migrator) appliedVersions(ctx context.Context) (map[int64]time.Time, error) {
+	if _, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+VersionTable+`
+(
+    version    BIGINT       NOT NULL,
+    name       VARCHAR(255) NOT NULL,
+    applied_at DATETIME     NOT NULL,
+    PRIMARY KEY (version)
+)`); err != nil {
+		return nil, err
+	}
+	rows, err := m.db.QueryContext(ctx, "SELECT version, applied_at FROM "+VersionTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// SplitStatements splits a script on semicolons that aren't inside quotes or comments. Comment-only and empty
+// statements are dropped
+func SplitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	hasCode := false
+	flush := func() {
+		if hasCode {
+			statements = append(statements, strings.TrimSpace(current.String()))
+		}
+		current.Reset()
+		hasCode = false
+	}
+
+	for i := 0; i < len(script); i++ {
+		ch := script[i]
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			end := i + 1
+			for ; end < len(script); end++ {
+				if script[end] == '\\' && ch != '`' {
+					end++
+				} else if script[end] == ch {
+					break
+				}
+			}
+			if end >= len(script) {
+				end = len(script) - 1
+			}
+			current.WriteString(script[i : end+1])
+			hasCode = true
+			i = end
+		case ch == '#' || (ch == '-' && strings.HasPrefix(script[i:], "-- ")):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+			i += end - 1
+		case ch == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				end = len(script) - i - 2
+			}
+			i += end + 3
+		case ch == ';':
+			flush()
+		default:
+			current.WriteByte(ch)
+			if !isSpace(ch) {
+				hasCode = true
+			}
+		}
+	}
+	flush()
+	return statements
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\n' || ch == '\t' || ch == '\r'
+}
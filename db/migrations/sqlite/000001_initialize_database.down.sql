@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS comment;
+DROP TABLE IF EXISTS community;
+DROP TABLE IF EXISTS content_metadata;
+DROP TABLE IF EXISTS content_image;
+DROP TABLE IF EXISTS image;
+DROP TABLE IF EXISTS post;
+DROP TABLE IF EXISTS post_communities;
+DROP TABLE IF EXISTS person;
+DROP TABLE IF EXISTS report;
+DROP TABLE IF EXISTS subscription;
+DROP TABLE IF EXISTS vote;
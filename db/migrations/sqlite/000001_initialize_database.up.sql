@@ -0,0 +1,101 @@
+CREATE TABLE IF NOT EXISTS person
+(
+    firebase_id  VARCHAR(36)  NOT NULL,
+    display_name VARCHAR(300) NOT NULL UNIQUE,
+    is_admin     BOOLEAN      NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (firebase_id)
+);
+
+CREATE TABLE IF NOT EXISTS community
+(
+    id         INTEGER      NOT NULL PRIMARY KEY AUTOINCREMENT,
+    name       VARCHAR(500) NOT NULL,
+    parent_id  INTEGER,
+    created_at DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS IDX_BY_PARENT ON community (parent_id);
+CREATE UNIQUE INDEX IF NOT EXISTS U_IDX_NAME_TO_PARENT ON community (parent_id, name);
+
+CREATE TABLE IF NOT EXISTS image
+(
+    id         INTEGER       NOT NULL PRIMARY KEY AUTOINCREMENT,
+    blob_name  VARCHAR(2048) NOT NULL,
+    created_at DATETIME      NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS subscription
+(
+    user_id      VARCHAR(36) NOT NULL,
+    community_id INTEGER     NOT NULL,
+    PRIMARY KEY (user_id, community_id)
+);
+
+-- updated_at has no ON UPDATE equivalent. the sqlite backend sets it on every update
+CREATE TABLE IF NOT EXISTS content_metadata
+(
+    id            INTEGER      NOT NULL PRIMARY KEY AUTOINCREMENT,
+    creator_id    VARCHAR(36)  NOT NULL,
+    creator_alias VARCHAR(300) NOT NULL,
+    visibility    TEXT         NOT NULL CHECK (visibility IN ('NORMAL', 'HIDDEN')),
+    status        TEXT         NOT NULL DEFAULT 'POSTED' CHECK (status IN ('POSTED', 'DELETED')),
+    vote_total    INT                   DEFAULT 0,
+    num_votes     INT                   DEFAULT 0,
+    created_at    DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at    DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS IDX_BY_CREATED_AT ON content_metadata (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS IDX_VOTE_TOTAL ON content_metadata (vote_total DESC, id DESC);
+CREATE INDEX IF NOT EXISTS IDX_CREATOR ON content_metadata (creator_id);
+
+CREATE TABLE IF NOT EXISTS content_image
+(
+    metadata_id INTEGER NOT NULL,
+    image_id    INTEGER NOT NULL,
+    PRIMARY KEY (metadata_id, image_id)
+);
+
+CREATE TABLE IF NOT EXISTS post
+(
+    id            INTEGER      NOT NULL PRIMARY KEY AUTOINCREMENT,
+    metadata_id   INTEGER      NOT NULL UNIQUE,
+    title         VARCHAR(500) NOT NULL,
+    content       TEXT         NOT NULL,
+    comment_count INT          NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS post_communities
+(
+    post_id      INTEGER NOT NULL,
+    community_id INTEGER NOT NULL,
+    PRIMARY KEY (post_id, community_id)
+);
+
+CREATE TABLE IF NOT EXISTS vote
+(
+    value           TINYINT     NOT NULL,
+    tgt_metadata_id INTEGER     NOT NULL,
+    voter_id        VARCHAR(36) NOT NULL,
+    PRIMARY KEY (tgt_metadata_id, voter_id)
+);
+
+CREATE TABLE IF NOT EXISTS comment
+(
+    id                 INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    root_metadata_id   INTEGER NOT NULL,
+    parent_metadata_id INTEGER NOT NULL,
+    metadata_id        INTEGER NOT NULL,
+    content            TEXT    NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS IDX_CONTENT_METADATA ON comment (metadata_id);
+CREATE INDEX IF NOT EXISTS IDX_PARENT ON comment (parent_metadata_id);
+
+CREATE TABLE IF NOT EXISTS report
+(
+    id              INTEGER     NOT NULL PRIMARY KEY AUTOINCREMENT,
+    tgt_metadata_id INTEGER     NOT NULL,
+    creator_id      VARCHAR(36) NOT NULL,
+    reason          TEXT        NOT NULL,
+    created_at      DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    status          TEXT                 DEFAULT 'SUBMITTED' CHECK (status IN ('SUBMITTED', 'ACCEPTED', 'REJECTED'))
+);
+CREATE INDEX IF NOT EXISTS IDX_BY_POST ON report (tgt_metadata_id);
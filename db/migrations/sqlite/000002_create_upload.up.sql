@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS upload
+(
+    id           INTEGER       NOT NULL PRIMARY KEY AUTOINCREMENT,
+    token_hash   CHAR(64)      NOT NULL,
+    blob_name    VARCHAR(2048) NOT NULL,
+    owner_id     VARCHAR(36)   NOT NULL,
+    kind         TEXT          NOT NULL CHECK (kind IN ('IMAGE', 'AVATAR')),
+    content_type VARCHAR(100)  NOT NULL,
+    max_size     BIGINT        NOT NULL,
+    size         BIGINT        NOT NULL DEFAULT 0,
+    created_at   DATETIME      NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at   DATETIME      NOT NULL,
+    completed_at DATETIME
+);
+CREATE UNIQUE INDEX IF NOT EXISTS U_IDX_TOKEN_HASH ON upload (token_hash);
+CREATE INDEX IF NOT EXISTS IDX_BLOB_NAME ON upload (blob_name);
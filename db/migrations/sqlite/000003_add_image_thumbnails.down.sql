@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS image_thumbnail;
+
+ALTER TABLE image DROP COLUMN width;
+ALTER TABLE image DROP COLUMN height;
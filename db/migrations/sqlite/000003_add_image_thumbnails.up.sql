@@ -0,0 +1,12 @@
+ALTER TABLE image ADD COLUMN width INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE image ADD COLUMN height INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS image_thumbnail
+(
+    id        INTEGER       NOT NULL PRIMARY KEY AUTOINCREMENT,
+    image_id  INTEGER       NOT NULL,
+    blob_name VARCHAR(2048) NOT NULL,
+    width     INTEGER       NOT NULL,
+    height    INTEGER       NOT NULL
+);
+CREATE INDEX IF NOT EXISTS IDX_BY_IMAGE ON image_thumbnail (image_id);
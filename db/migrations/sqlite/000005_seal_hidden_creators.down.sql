@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS IDX_CREATOR_HASH;
+ALTER TABLE content_metadata DROP COLUMN creator_id_enc;
+ALTER TABLE content_metadata DROP COLUMN creator_id_hash;
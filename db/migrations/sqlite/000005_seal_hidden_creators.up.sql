@@ -0,0 +1,3 @@
+ALTER TABLE content_metadata ADD COLUMN creator_id_enc VARCHAR(255) NULL;
+ALTER TABLE content_metadata ADD COLUMN creator_id_hash CHAR(64) NULL;
+CREATE INDEX IF NOT EXISTS IDX_CREATOR_HASH ON content_metadata (creator_id_hash);
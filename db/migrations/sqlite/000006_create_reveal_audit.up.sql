@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS reveal_audit
+(
+    id         INTEGER     NOT NULL PRIMARY KEY AUTOINCREMENT,
+    admin_id   VARCHAR(36) NOT NULL,
+    post_id    INTEGER     NOT NULL,
+    comment_id INTEGER     NULL,
+    reason     TEXT        NOT NULL,
+    created_at DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS IDX_REVEAL_BY_ADMIN ON reveal_audit (admin_id);
+CREATE INDEX IF NOT EXISTS IDX_REVEAL_BY_POST ON reveal_audit (post_id);
+
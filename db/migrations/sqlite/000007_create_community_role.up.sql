@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS community_role
+(
+    user_id      VARCHAR(36) NOT NULL,
+    community_id INTEGER     NOT NULL,
+    role         VARCHAR(20) NOT NULL,
+    granted_by   VARCHAR(36) NOT NULL,
+    created_at   DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, community_id)
+);
+CREATE INDEX IF NOT EXISTS IDX_ROLE_BY_COMMUNITY ON community_role (community_id);
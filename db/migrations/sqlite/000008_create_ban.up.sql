@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS ban
+(
+    id           INTEGER     NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id      VARCHAR(36) NOT NULL,
+    community_id INTEGER     NULL,
+    reason       TEXT        NOT NULL,
+    issued_by    VARCHAR(36) NOT NULL,
+    expires_at   DATETIME    NULL,
+    lifted_at    DATETIME    NULL,
+    lifted_by    VARCHAR(36) NULL,
+    created_at   DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS IDX_BAN_BY_USER ON ban (user_id);
+CREATE INDEX IF NOT EXISTS IDX_BAN_BY_COMMUNITY ON ban (community_id);
@@ -0,0 +1,20 @@
+CREATE TABLE report_ungrouped
+(
+    id              INTEGER     NOT NULL PRIMARY KEY AUTOINCREMENT,
+    tgt_metadata_id INTEGER     NOT NULL,
+    creator_id      VARCHAR(36) NOT NULL,
+    reason          TEXT        NOT NULL,
+    created_at      DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    status          TEXT                 DEFAULT 'SUBMITTED' CHECK (status IN ('SUBMITTED', 'ACCEPTED', 'REJECTED'))
+);
+-- tgt_metadata_id held the post id. comments and users couldn't be reported before
+INSERT INTO report_ungrouped (id, tgt_metadata_id, creator_id, reason, created_at)
+SELECT report.id, report_group.post_id, report.creator_id, report.reason, report.created_at
+FROM report
+         JOIN report_group ON report_group.id = report.group_id
+WHERE report_group.target_type = 'POST';
+DROP TABLE report;
+ALTER TABLE report_ungrouped RENAME TO report;
+CREATE INDEX IF NOT EXISTS IDX_BY_POST ON report (tgt_metadata_id);
+
+DROP TABLE IF EXISTS report_group;
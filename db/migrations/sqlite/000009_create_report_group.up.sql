@@ -0,0 +1,55 @@
+CREATE TABLE IF NOT EXISTS report_group
+(
+    id               INTEGER     NOT NULL PRIMARY KEY AUTOINCREMENT,
+    target_type      TEXT        NOT NULL CHECK (target_type IN ('POST', 'COMMENT', 'USER')),
+    post_id          INTEGER     NULL,
+    comment_id       INTEGER     NULL,
+    user_id          VARCHAR(36) NULL,
+    community_id     INTEGER     NULL,
+    -- the target key while the group is open, so a target has at most one open group
+    open_key         VARCHAR(64) NULL,
+    status           TEXT        NOT NULL DEFAULT 'OPEN' CHECK (status IN ('OPEN', 'ACTIONED', 'DISMISSED')),
+    num_reports      INTEGER     NOT NULL DEFAULT 0,
+    resolved_by      VARCHAR(36) NULL,
+    resolved_at      DATETIME    NULL,
+    resolution       TEXT        NULL,
+    created_at       DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_reported_at DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS IDX_REPORT_GROUP_OPEN_KEY ON report_group (open_key);
+CREATE INDEX IF NOT EXISTS IDX_REPORT_GROUP_BY_POST ON report_group (post_id);
+CREATE INDEX IF NOT EXISTS IDX_REPORT_GROUP_BY_COMMUNITY ON report_group (community_id);
+CREATE INDEX IF NOT EXISTS IDX_REPORT_GROUP_BY_STATUS ON report_group (status);
+
+-- only posts could be reported so far. despite its name, tgt_metadata_id holds the post id
+INSERT INTO report_group (target_type, post_id, open_key, created_at, last_reported_at)
+SELECT 'POST', post.id, 'POST:' || post.id, MIN(report.created_at), MAX(report.created_at)
+FROM report
+         JOIN post ON post.id = report.tgt_metadata_id
+GROUP BY post.id;
+
+-- the columns can't be altered in place. reports of posts that don't exist and repeated reports by the same user
+-- are dropped
+CREATE TABLE report_grouped
+(
+    id         INTEGER     NOT NULL PRIMARY KEY AUTOINCREMENT,
+    group_id   INTEGER     NOT NULL,
+    creator_id VARCHAR(36) NOT NULL,
+    reason     TEXT        NOT NULL,
+    created_at DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO report_grouped (id, group_id, creator_id, reason, created_at)
+SELECT report.id, report_group.id, report.creator_id, report.reason, report.created_at
+FROM report
+         JOIN post ON post.id = report.tgt_metadata_id
+         JOIN report_group ON report_group.post_id = post.id
+WHERE report.id = (SELECT MIN(original.id)
+                   FROM report AS original
+                   WHERE original.tgt_metadata_id = report.tgt_metadata_id
+                     AND original.creator_id = report.creator_id);
+DROP TABLE report;
+ALTER TABLE report_grouped RENAME TO report;
+CREATE UNIQUE INDEX IF NOT EXISTS IDX_REPORT_BY_REPORTER ON report (group_id, creator_id);
+
+UPDATE report_group
+SET num_reports = (SELECT COUNT(*) FROM report WHERE report.group_id = report_group.id);
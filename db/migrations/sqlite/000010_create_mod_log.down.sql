@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS mod_log_community;
+DROP TABLE IF EXISTS mod_log;
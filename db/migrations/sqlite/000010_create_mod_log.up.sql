@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS mod_log
+(
+    id         INTEGER     NOT NULL PRIMARY KEY AUTOINCREMENT,
+    actor_id   VARCHAR(36) NOT NULL,
+    action     VARCHAR(32) NOT NULL,
+    post_id    INTEGER     NULL,
+    comment_id INTEGER     NULL,
+    user_id    VARCHAR(36) NULL,
+    target_id  INTEGER     NULL,
+    role       VARCHAR(16) NOT NULL DEFAULT '',
+    reason     TEXT        NOT NULL,
+    created_at DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS IDX_MOD_LOG_BY_ACTOR ON mod_log (actor_id);
+
+CREATE TABLE IF NOT EXISTS mod_log_community
+(
+    entry_id     INTEGER NOT NULL,
+    community_id INTEGER NOT NULL,
+    PRIMARY KEY (entry_id, community_id)
+);
+CREATE INDEX IF NOT EXISTS IDX_MOD_LOG_BY_COMMUNITY ON mod_log_community (community_id, entry_id);
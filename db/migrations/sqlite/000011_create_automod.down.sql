@@ -0,0 +1,7 @@
+ALTER TABLE person
+    DROP COLUMN created_at;
+
+ALTER TABLE content_metadata
+    DROP COLUMN held;
+
+DROP TABLE IF EXISTS automod_rule;
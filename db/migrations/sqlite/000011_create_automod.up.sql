@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS automod_rule
+(
+    id           INTEGER     NOT NULL PRIMARY KEY AUTOINCREMENT,
+    community_id INTEGER     NOT NULL,
+    rule_type    VARCHAR(16) NOT NULL,
+    outcome      VARCHAR(16) NOT NULL,
+    applies_to   VARCHAR(16) NOT NULL,
+    params       TEXT        NOT NULL,
+    reason       TEXT        NOT NULL,
+    created_by   VARCHAR(36) NOT NULL,
+    created_at   DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at   DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS IDX_AUTOMOD_RULE_BY_COMMUNITY ON automod_rule (community_id);
+
+ALTER TABLE content_metadata
+    ADD held BOOLEAN NOT NULL DEFAULT 0;
+
+-- existing users are left without a creation time, so account age rules skip them
+ALTER TABLE person
+    ADD created_at DATETIME NULL;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS rate_limit_bucket
+(
+    bucket_key    VARCHAR(191) NOT NULL PRIMARY KEY,
+    tokens        DOUBLE       NOT NULL,
+    -- unix milliseconds. buckets refill continuously, so seconds are too coarse
+    updated_at_ms BIGINT       NOT NULL
+);
+CREATE INDEX IF NOT EXISTS IDX_RATE_LIMIT_BUCKET_BY_UPDATED_AT ON rate_limit_bucket (updated_at_ms);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS notification
+(
+    id                INTEGER     NOT NULL PRIMARY KEY AUTOINCREMENT,
+    -- the recipient as stored in thread_alias.user_id (keyed hash when db.creator_key is set)
+    recipient_key     VARCHAR(64) NOT NULL,
+    notification_type VARCHAR(16) NOT NULL,
+    post_id           INTEGER     NOT NULL,
+    comment_id        INTEGER     NULL,
+    mod_action        VARCHAR(32) NOT NULL DEFAULT '',
+    reason            TEXT        NOT NULL,
+    is_read           BOOLEAN     NOT NULL DEFAULT FALSE,
+    created_at        DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS IDX_NOTIFICATION_BY_RECIPIENT ON notification (recipient_key, id);
+CREATE INDEX IF NOT EXISTS IDX_NOTIFICATION_UNREAD ON notification (recipient_key, is_read, id);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS live_event
+(
+    id                INTEGER     NOT NULL PRIMARY KEY AUTOINCREMENT,
+    event_type        VARCHAR(16) NOT NULL,
+    post_id           INTEGER     NOT NULL,
+    comment_id        INTEGER     NULL,
+    parent_comment_id INTEGER     NULL,
+    created_at        DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+-- events are only kept for a few minutes
+CREATE INDEX IF NOT EXISTS IDX_LIVE_EVENT_BY_CREATED_AT ON live_event (created_at);
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS webhook
+(
+    id           INTEGER       NOT NULL PRIMARY KEY AUTOINCREMENT,
+    community_id INTEGER       NOT NULL,
+    url          VARCHAR(2048) NOT NULL,
+    secret       VARCHAR(64)   NOT NULL,
+    events       TEXT          NOT NULL,
+    active       BOOLEAN       NOT NULL DEFAULT 1,
+    created_by   VARCHAR(36)   NOT NULL,
+    created_at   DATETIME      NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at   DATETIME      NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS IDX_WEBHOOK_BY_COMMUNITY ON webhook (community_id);
+
+CREATE TABLE IF NOT EXISTS webhook_delivery
+(
+    id               INTEGER     NOT NULL PRIMARY KEY AUTOINCREMENT,
+    webhook_id       INTEGER     NOT NULL,
+    event            VARCHAR(32) NOT NULL,
+    payload          TEXT        NOT NULL,
+    status           VARCHAR(16) NOT NULL,
+    attempts         INTEGER     NOT NULL DEFAULT 0,
+    -- null once the delivery succeeded or failed
+    next_attempt_at  DATETIME    NULL,
+    last_status_code INTEGER     NULL,
+    last_error       TEXT        NOT NULL,
+    replay_of        INTEGER     NULL,
+    created_at       DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at       DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS IDX_WEBHOOK_DELIVERY_BY_WEBHOOK ON webhook_delivery (webhook_id, id);
+CREATE INDEX IF NOT EXISTS IDX_WEBHOOK_DELIVERY_DUE ON webhook_delivery (status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS IDX_WEBHOOK_DELIVERY_BY_CREATED_AT ON webhook_delivery (created_at);
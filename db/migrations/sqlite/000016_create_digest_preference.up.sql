@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS digest_preference
+(
+    user_id           VARCHAR(36)  NOT NULL PRIMARY KEY,
+    email             VARCHAR(320) NOT NULL,
+    frequency         VARCHAR(16)  NOT NULL,
+    unsubscribe_token VARCHAR(64)  NOT NULL,
+    -- null while the digest is off
+    next_send_at      DATETIME     NULL,
+    last_sent_at      DATETIME     NULL,
+    created_at        DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at        DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS IDX_DIGEST_PREFERENCE_BY_TOKEN ON digest_preference (unsubscribe_token);
+CREATE INDEX IF NOT EXISTS IDX_DIGEST_PREFERENCE_DUE ON digest_preference (next_send_at);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS push_subscription
+(
+    id            INTEGER       NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id       VARCHAR(36)   NOT NULL,
+    endpoint      VARCHAR(2048) NOT NULL,
+    -- hex SHA-256 of the endpoint, which is too long to index
+    endpoint_hash CHAR(64)      NOT NULL,
+    p256dh        VARCHAR(128)  NOT NULL,
+    auth          VARCHAR(64)   NOT NULL,
+    created_at    DATETIME      NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at    DATETIME      NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS IDX_PUSH_SUBSCRIPTION_BY_ENDPOINT ON push_subscription (endpoint_hash);
+CREATE INDEX IF NOT EXISTS IDX_PUSH_SUBSCRIPTION_BY_USER ON push_subscription (user_id);
@@ -0,0 +1 @@
+ALTER TABLE upload DROP COLUMN processed_at;
@@ -0,0 +1 @@
+ALTER TABLE upload ADD COLUMN processed_at DATETIME;
@@ -0,0 +1 @@
+-- the backfilled aliases can't be told apart from the ones given out since, so they're kept
@@ -0,0 +1,14 @@
+-- hidden content stored before thread aliases existed keeps the alias it was posted under. when a user posted under
+-- several aliases in a thread, the post's (then the earliest comment's) is kept. sealed creators are keyed by their hash
+INSERT OR IGNORE INTO thread_alias (post_metadata_id, user_id, alias, created_at)
+SELECT p.metadata_id, COALESCE(cm.creator_id_hash, cm.creator_id), cm.creator_alias, cm.created_at
+FROM post p
+         JOIN content_metadata cm ON cm.id = p.metadata_id
+WHERE cm.visibility = 'HIDDEN';
+
+INSERT OR IGNORE INTO thread_alias (post_metadata_id, user_id, alias, created_at)
+SELECT c.root_metadata_id, COALESCE(cm.creator_id_hash, cm.creator_id), cm.creator_alias, cm.created_at
+FROM comment c
+         JOIN content_metadata cm ON cm.id = c.metadata_id
+WHERE cm.visibility = 'HIDDEN'
+ORDER BY cm.id;
@@ -0,0 +1,2 @@
+ALTER TABLE content_metadata
+    DROP COLUMN held_on_create;
@@ -0,0 +1,3 @@
+-- content held before now is treated as held on an edit, so releasing it doesn't announce it as new
+ALTER TABLE content_metadata
+    ADD held_on_create BOOLEAN NOT NULL DEFAULT 0;
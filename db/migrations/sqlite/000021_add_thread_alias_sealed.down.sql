@@ -0,0 +1,2 @@
+ALTER TABLE thread_alias
+    DROP COLUMN sealed;
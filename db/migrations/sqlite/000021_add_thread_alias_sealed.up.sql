@@ -0,0 +1,8 @@
+-- aliases keyed by a creator hash were told apart by their length, which a 64 character user id also has. an alias is
+-- keyed by a hash exactly when the hidden content it was made for has that hash
+ALTER TABLE thread_alias
+    ADD sealed BOOLEAN NOT NULL DEFAULT 0;
+
+UPDATE thread_alias
+SET sealed = 1
+WHERE EXISTS(SELECT 1 FROM content_metadata cm WHERE cm.creator_id_hash = thread_alias.user_id);
@@ -0,0 +1,99 @@
+package planetscale
+
+import (
+	"context"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/upper/db/v4"
+)
+
+type BanDB struct {
+	sess db.Session
+}
+
+func getBanDB(sess db.Session) *BanDB {
+	return &BanDB{sess}
+}
+
+func (bdb *BanDB) CreateBan(ctx context.Context, ban *model.Ban, modLog *model.ModLogEntry) (int64, error) {
+	var banId int64
+	err := bdb.sess.TxContext(ctx, func(sess db.Session) error {
+		var err error
+		banId, err = insertBan(ctx, sess, ban, modLog)
+		return err
+	}, nil)
+	return banId, err
+}
+
+// insertBan records the ban, and the entry with the ban as its target
+func insertBan(ctx context.Context, sess db.Session, ban *model.Ban, modLog *model.ModLogEntry) (int64, error) {
+	res, err := sess.SQL().
+		InsertInto("ban").
+		Columns("user_id", "community_id", "reason", "issued_by", "expires_at").
+		Values(ban.UserId, ban.CommunityId, ban.Reason, ban.IssuedBy, ban.ExpiresAt).
+		ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	banId, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if modLog != nil {
+		modLog.TargetId = &banId
+	}
+	_, err = insertModLogEntry(ctx, sess, modLog)
+	return banId, err
+}
+
+func (bdb *BanDB) GetBan(ctx context.Context, id int64) (*model.Ban, error) {
+	var ban model.Ban
+	if err := bdb.sess.SQL().
+		Select("*").
+		From("ban").
+		Where("id = ?", id).
+		IteratorContext(ctx).
+		One(&ban); err != nil {
+		if err == db.ErrNoMoreRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &ban, nil
+}
+
+func (bdb *BanDB) GetBans(ctx context.Context, query *appDb.BansQuery) ([]*model.Ban, error) {
+	selector := bdb.sess.SQL().
+		Select("*").
+		From("ban").
+		Where("(? = '' OR user_id = ?)", query.UserId, query.UserId).
+		And("(? = 0 OR id < ?)", query.BeforeId, query.BeforeId)
+	if query.CommunityId != nil {
+		selector = selector.And("community_id = ?", *query.CommunityId)
+	}
+	if query.ActiveAt != nil {
+		selector = selector.And("lifted_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", query.ActiveAt)
+	}
+	bans := make([]*model.Ban, 0)
+	err := selector.
+		OrderBy("id DESC").
+		Limit(query.Limit).
+		IteratorContext(ctx).
+		All(&bans)
+	return bans, err
+}
+
+func (bdb *BanDB) LiftBan(ctx context.Context, id int64, liftedBy string, modLog *model.ModLogEntry) error {
+	return bdb.sess.TxContext(ctx, func(sess db.Session) error {
+		if _, err := sess.SQL().
+			Update("ban").
+			Set("lifted_at = CURRENT_TIMESTAMP").
+			Set("lifted_by = ?", liftedBy).
+			Where("id = ? AND lifted_at IS NULL", id).
+			ExecContext(ctx); err != nil {
+			return err
+		}
+		_, err := insertModLogEntry(ctx, sess, modLog)
+		return err
+	}, nil)
+}
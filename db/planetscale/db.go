@@ -1,12 +1,14 @@
 package planetscale
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"github.com/navbryce/next-dorm-be/config"
 	db2 "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/db/internal/sealed"
 	"github.com/upper/db/v4"
 	"github.com/upper/db/v4/adapter/mysql"
-	"os"
 )
 
 type PlanetScaleDB struct {
@@ -14,24 +16,32 @@ type PlanetScaleDB struct {
 	*PostDB
 	*SubscriptionDB
 	*UserDB
-	sess  db.Session
-	sqlDB *sql.DB
+	*UploadDB
+	*AliasDB
+	*RevealDB
+	*RoleDB
+	*BanDB
+	*ReportDB
+	*ModLogDB
+	*AutomodDB
+	*RateLimitDB
+	*NotificationDB
+	*LiveEventDB
+	*WebhookDB
+	*DigestDB
+	*PushDB
+	sess   db.Session
+	sqlDB  *sql.DB
+	sealer *sealed.Sealer
 }
 
-func GetDatabase() (db2.Database, error) {
-	// TODO: MOVE CONFIG PARSING AND VALIDATINO TO SEPARATE MODULE
-	db, err := sql.Open("mysql",
-		fmt.Sprintf("%s:%s@tcp(%s)/next-dorm?tls=true&parseTime=true",
-			os.Getenv("DB_USER"), os.Getenv("DB_PASS"), os.Getenv("DB_HOST")))
+// GetDatabase connects to the database. Creators of hidden content are sealed when sealer isn't nil
+func GetDatabase(cfg *config.DBConfig, sealer *sealed.Sealer) (db2.Database, error) {
+	db, err := OpenSQLDB(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO: Move to config
-	db.SetMaxIdleConns(50)
-	db.SetMaxOpenConns(50)
-	db.SetConnMaxIdleTime(0)
-
 	sess, err := mysql.New(db)
 	if err != nil {
 		return nil, err
@@ -39,14 +49,33 @@ func GetDatabase() (db2.Database, error) {
 
 	return &PlanetScaleDB{
 		CommunityDB:    getCommunityDb(sess),
-		PostDB:         getPostDB(sess),
+		PostDB:         getPostDB(sess, sealer),
 		SubscriptionDB: getSubscriptionDB(sess),
 		UserDB:         getUserDB(sess),
+		UploadDB:       getUploadDB(sess),
+		AliasDB:        getAliasDB(sess, sealer),
+		RevealDB:       getRevealDB(sess),
+		RoleDB:         getRoleDB(sess),
+		BanDB:          getBanDB(sess),
+		ReportDB:       getReportDB(sess),
+		ModLogDB:       getModLogDB(sess),
+		AutomodDB:      getAutomodDB(sess),
+		RateLimitDB:    getRateLimitDB(sess),
+		NotificationDB: getNotificationDB(sess, sealer),
+		LiveEventDB:    getLiveEventDB(sess),
+		WebhookDB:      getWebhookDB(sess),
+		DigestDB:       getDigestDB(sess),
+		PushDB:         getPushDB(sess),
 		sess:           sess,
 		sqlDB:          db,
+		sealer:         sealer,
 	}, nil
 }
 
+func (psdb *PlanetScaleDB) SealCreators(ctx context.Context) (int64, error) {
+	return psdb.sealer.SealExisting(ctx, psdb.sess)
+}
+
 func (psdb *PlanetScaleDB) GetSQLDB() *sql.DB {
 	return psdb.sqlDB
 }
@@ -54,3 +83,17 @@ func (psdb *PlanetScaleDB) GetSQLDB() *sql.DB {
 func (psdb *PlanetScaleDB) Close() error {
 	return psdb.sess.Close()
 }
+
+// OpenSQLDB opens a connection pool to the PlanetScale database without wrapping it in a session
+func OpenSQLDB(cfg *config.DBConfig) (*sql.DB, error) {
+	db, err := sql.Open("mysql",
+		fmt.Sprintf("%s:%s@tcp(%s)/%s?tls=true&parseTime=true", cfg.User, cfg.Pass, cfg.Host, cfg.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetConnMaxIdleTime(0)
+	return db, nil
+}
@@ -0,0 +1,64 @@
+package planetscale
+
+import (
+	"context"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/upper/db/v4"
+	"time"
+)
+
+type LiveEventDB struct {
+	sess db.Session
+}
+
+func getLiveEventDB(sess db.Session) *LiveEventDB {
+	return &LiveEventDB{sess}
+}
+
+func (ldb *LiveEventDB) CreateLiveEvent(ctx context.Context, event *model.LiveEvent) (int64, error) {
+	res, err := ldb.sess.SQL().
+		InsertInto("live_event").
+		Columns("event_type", "post_id", "comment_id", "parent_comment_id").
+		Values(event.Type, event.PostId, event.CommentId, event.ParentCommentId).
+		ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (ldb *LiveEventDB) GetLiveEvents(ctx context.Context, afterId int64, limit int) ([]*model.LiveEvent, error) {
+	events := make([]*model.LiveEvent, 0)
+	if err := ldb.sess.SQL().
+		SelectFrom("live_event").
+		Where("id > ?", afterId).
+		OrderBy("id").
+		Limit(limit).
+		IteratorContext(ctx).
+		All(&events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (ldb *LiveEventDB) GetLastLiveEventId(ctx context.Context) (int64, error) {
+	var last struct {
+		Id int64 `db:"id"`
+	}
+	if err := ldb.sess.SQL().
+		Select(db.Raw("COALESCE(MAX(id), 0) AS id")).
+		From("live_event").
+		IteratorContext(ctx).
+		One(&last); err != nil {
+		return 0, err
+	}
+	return last.Id, nil
+}
+
+func (ldb *LiveEventDB) DeleteLiveEvents(ctx context.Context, createdBefore time.Time) error {
+	_, err := ldb.sess.SQL().
+		DeleteFrom("live_event").
+		Where("created_at < ?", createdBefore).
+		ExecContext(ctx)
+	return err
+}
@@ -0,0 +1,117 @@
+package planetscale
+
+import (
+	"context"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/upper/db/v4"
+)
+
+type ModLogDB struct {
+	sess db.Session
+}
+
+func getModLogDB(sess db.Session) *ModLogDB {
+	return &ModLogDB{sess}
+}
+
+func (mdb *ModLogDB) CreateModLogEntry(ctx context.Context, entry *model.ModLogEntry) (int64, error) {
+	var entryId int64
+	err := mdb.sess.TxContext(ctx, func(sess db.Session) error {
+		var err error
+		entryId, err = insertModLogEntry(ctx, sess, entry)
+		return err
+	}, nil)
+	return entryId, err
+}
+
+// insertModLogEntry adds the entry in the transaction of the action it records. Does nothing if the entry is nil,
+// which is the case when the action isn't logged
+func insertModLogEntry(ctx context.Context, sess db.Session, entry *model.ModLogEntry) (int64, error) {
+	if entry == nil {
+		return 0, nil
+	}
+	res, err := sess.SQL().
+		InsertInto("mod_log").
+		Columns("actor_id", "action", "post_id", "comment_id", "user_id", "target_id", "role", "reason").
+		Values(entry.ActorId, entry.Action, entry.PostId, entry.CommentId, entry.UserId, entry.TargetId, entry.Role,
+			entry.Reason).
+		ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	entryId, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if len(entry.CommunityIds) == 0 {
+		return entryId, nil
+	}
+	batchInserter := sess.SQL().
+		InsertInto("mod_log_community").
+		Columns("entry_id", "community_id").
+		Batch(len(entry.CommunityIds))
+	for _, communityId := range entry.CommunityIds {
+		batchInserter.Values(entryId, communityId)
+	}
+	batchInserter.Done()
+	return entryId, batchInserter.Wait()
+}
+
+func (mdb *ModLogDB) GetModLogEntries(ctx context.Context, query *appDb.ModLogQuery) ([]*model.ModLogEntry, error) {
+	selector := mdb.sess.SQL().
+		Select("*").
+		From("mod_log").
+		Where("(? = '' OR actor_id = ?)", query.ActorId, query.ActorId).
+		And("(? = '' OR action = ?)", query.Action, query.Action).
+		And("(? = 0 OR id < ?)", query.BeforeId, query.BeforeId)
+	if query.CommunityIds != nil {
+		if len(query.CommunityIds) == 0 {
+			return []*model.ModLogEntry{}, nil
+		}
+		selector = selector.And(db.Raw(
+			"EXISTS (SELECT 1 FROM mod_log_community AS mlc WHERE mlc.entry_id = mod_log.id AND mlc.community_id IN ?)",
+			query.CommunityIds))
+	}
+	entries := make([]*model.ModLogEntry, 0)
+	if err := selector.
+		OrderBy("id DESC").
+		Limit(query.Limit).
+		IteratorContext(ctx).
+		All(&entries); err != nil {
+		return nil, err
+	}
+	return entries, loadModLogCommunities(ctx, mdb.sess, entries)
+}
+
+// loadModLogCommunities sets the communities of the entries
+func loadModLogCommunities(ctx context.Context, sess db.Session, entries []*model.ModLogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	byId := make(map[int64]*model.ModLogEntry, len(entries))
+	ids := make([]int64, len(entries))
+	for i, entry := range entries {
+		entry.CommunityIds = []int64{}
+		byId[entry.Id] = entry
+		ids[i] = entry.Id
+	}
+	var rows []struct {
+		EntryId     int64 `db:"entry_id"`
+		CommunityId int64 `db:"community_id"`
+	}
+	if err := sess.SQL().
+		Select("entry_id", "community_id").
+		From("mod_log_community").
+		Where("entry_id IN ?", ids).
+		OrderBy("entry_id", "community_id").
+		IteratorContext(ctx).
+		All(&rows); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		entry := byId[row.EntryId]
+		entry.CommunityIds = append(entry.CommunityIds, row.CommunityId)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package planetscale
+
+import (
+	"context"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/db/internal/sealed"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/upper/db/v4"
+)
+
+type NotificationDB struct {
+	sess   db.Session
+	sealer *sealed.Sealer
+}
+
+func getNotificationDB(sess db.Session, sealer *sealed.Sealer) *NotificationDB {
+	return &NotificationDB{sess, sealer}
+}
+
+// notificationColumns read the sender and excerpt from the content the notification points at. The sender's id is
+// only read from content that isn't hidden, and never for moderator actions
+var notificationColumns = []interface{}{
+	"n.id",
+	"n.notification_type",
+	"n.post_id",
+	"n.comment_id",
+	"n.mod_action",
+	"n.reason",
+	"n.is_read",
+	"n.created_at",
+	db.Raw(`CASE WHEN n.notification_type = 'MOD_ACTION' OR cm.visibility != 'NORMAL' THEN NULL
+		ELSE cm.creator_id END AS sender_id`),
+	db.Raw(`CASE WHEN n.notification_type = 'MOD_ACTION' THEN ''
+		WHEN cm.visibility = 'NORMAL' THEN COALESCE(person.display_name, '')
+		ELSE cm.creator_alias END AS sender_name`),
+	db.Raw("COALESCE(c.content, p.title, '') AS excerpt"),
+}
+
+func (ndb *NotificationDB) CreateNotifications(ctx context.Context, notifications []*model.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	batchInserter := ndb.sess.SQL().
+		InsertInto("notification").
+		Columns("recipient_key", "notification_type", "post_id", "comment_id", "mod_action", "reason").
+		Batch(len(notifications))
+	for _, notification := range notifications {
+		batchInserter.Values(ndb.sealer.UserKey(notification.RecipientId), notification.Type, notification.PostId,
+			notification.CommentId, notification.ModAction, notification.Reason)
+	}
+	batchInserter.Done()
+	return batchInserter.Wait()
+}
+
+func (ndb *NotificationDB) GetNotifications(ctx context.Context, query *appDb.NotificationsQuery) ([]*model.Notification, error) {
+	notifications := make([]*model.Notification, 0)
+	if err := ndb.sess.SQL().
+		Select(notificationColumns...).
+		From("notification AS n").
+		LeftJoin("comment AS c").On("n.comment_id = c.id").
+		LeftJoin("post AS p").On("n.post_id = p.id").
+		LeftJoin("content_metadata AS cm").On("cm.id = COALESCE(c.metadata_id, p.metadata_id)").
+		LeftJoin("person").On("cm.creator_id = person.firebase_id").
+		Where("n.recipient_key = ?", ndb.sealer.UserKey(query.UserId)).
+		And("(? = FALSE OR n.is_read = FALSE)", query.UnreadOnly).
+		And("(? = 0 OR n.id < ?)", query.BeforeId, query.BeforeId).
+		OrderBy("n.id DESC").
+		Limit(query.Limit).
+		IteratorContext(ctx).
+		All(&notifications); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+func (ndb *NotificationDB) CountUnreadNotifications(ctx context.Context, userId string) (int64, error) {
+	var count struct {
+		Count int64 `db:"count"`
+	}
+	if err := ndb.sess.SQL().
+		Select(db.Raw("COUNT(*) AS count")).
+		From("notification").
+		Where("recipient_key = ? AND is_read = FALSE", ndb.sealer.UserKey(userId)).
+		IteratorContext(ctx).
+		One(&count); err != nil {
+		return 0, err
+	}
+	return count.Count, nil
+}
+
+func (ndb *NotificationDB) MarkNotificationsRead(ctx context.Context, userId string, ids []int64) error {
+	if ids != nil && len(ids) == 0 {
+		return nil
+	}
+	_, err := ndb.sess.SQL().
+		Update("notification").
+		Set("is_read = TRUE").
+		Where("recipient_key = ? AND is_read = FALSE", ndb.sealer.UserKey(userId)).
+		And("(? OR id IN ?)", ids == nil, ids).
+		ExecContext(ctx)
+	return err
+}
@@ -3,25 +3,26 @@ package planetscale
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/db/internal/flattened"
+	"github.com/navbryce/next-dorm-be/db/internal/images"
+	"github.com/navbryce/next-dorm-be/db/internal/sealed"
 	"github.com/navbryce/next-dorm-be/model"
-	"github.com/navbryce/next-dorm-be/util"
 	"github.com/upper/db/v4"
-	"time"
 )
 
 type PostDB struct {
-	sess db.Session
+	sess   db.Session
+	sealer *sealed.Sealer
 }
 
-func getPostDB(sess db.Session) *PostDB {
-	return &PostDB{sess}
+func getPostDB(sess db.Session, sealer *sealed.Sealer) *PostDB {
+	return &PostDB{sess, sealer}
 }
 func (cdb *PostDB) CreatePost(ctx context.Context, post *appDb.CreatePost) (int64, error) {
 	var postId int64
 	err := cdb.sess.TxContext(ctx, func(sess db.Session) error {
-		metadataId, err := insertContentMetadata(ctx, sess, post.CreateContentMetadata)
+		metadataId, err := insertContentMetadata(ctx, sess, cdb.sealer, post.CreateContentMetadata)
 		if err != nil {
 			return err
 		}
@@ -37,6 +38,18 @@ func (cdb *PostDB) CreatePost(ctx context.Context, post *appDb.CreatePost) (int6
 		if err != nil {
 			return err
 		}
+		// the thread is new, so the creator's alias can't collide
+		if len(post.CreatorAlias) > 0 {
+			if err := insertThreadAlias(ctx, sess, cdb.sealer, metadataId, post.CreatorId, post.CreatorAlias); err != nil {
+				return err
+			}
+		}
+		if post.AutomodReport != nil {
+			post.AutomodReport.Target.PostId = &postId
+			if err := insertAutomodReport(ctx, sess, post.AutomodReport); err != nil {
+				return err
+			}
+		}
 
 		batchInserter := sess.SQL().
 			InsertInto("post_communities").
@@ -67,7 +80,7 @@ func (cdb *PostDB) EditPost(ctx context.Context, id int64, req *appDb.EditPost)
 			return err
 		}
 
-		err = editContentMetadata(ctx, sess, metadataId.Id, req.EditContentMetadata)
+		err = editContentMetadata(ctx, sess, cdb.sealer, metadataId.Id, req.EditContentMetadata)
 		if err != nil {
 			return err
 		}
@@ -81,7 +94,7 @@ func (cdb *PostDB) EditPost(ctx context.Context, id int64, req *appDb.EditPost)
 			if len(req.Content) > 0 {
 				updater = updater.Set("content = ?", req.Content)
 			}
-			if _, err := updater.ExecContext(ctx); err != nil {
+			if _, err := updater.Where("id = ?", id).ExecContext(ctx); err != nil {
 				return err
 			}
 		}
@@ -90,8 +103,18 @@ func (cdb *PostDB) EditPost(ctx context.Context, id int64, req *appDb.EditPost)
 	}, nil)
 }
 
-func (cdb *PostDB) MarkPostAsDeleted(ctx context.Context, id int64) error {
-	_, err := cdb.sess.SQL().ExecContext(ctx, db.Raw(`
+func (cdb *PostDB) MarkPostAsDeleted(ctx context.Context, id int64, modLog *model.ModLogEntry) error {
+	return cdb.sess.TxContext(ctx, func(sess db.Session) error {
+		if err := markPostAsDeleted(ctx, sess, id); err != nil {
+			return err
+		}
+		_, err := insertModLogEntry(ctx, sess, modLog)
+		return err
+	}, nil)
+}
+
+func markPostAsDeleted(ctx context.Context, sess db.Session, id int64) error {
+	_, err := sess.SQL().ExecContext(ctx, db.Raw(`
 UPDATE post as p
 	INNER JOIN content_metadata as cm ON p.metadata_id = cm.id
 	SET cm.status = 'DELETED', p.content=''
@@ -103,7 +126,7 @@ UPDATE post as p
 func (cdb *PostDB) CreateComment(ctx context.Context, req *appDb.CreateComment) (int64, error) {
 	var commentId int64
 	err := cdb.sess.TxContext(ctx, func(sess db.Session) error {
-		metadataId, err := insertContentMetadata(ctx, sess, req.CreateContentMetadata)
+		metadataId, err := insertContentMetadata(ctx, sess, cdb.sealer, req.CreateContentMetadata)
 		if err != nil {
 			return err
 		}
@@ -116,7 +139,15 @@ func (cdb *PostDB) CreateComment(ctx context.Context, req *appDb.CreateComment)
 		if err != nil {
 			return err
 		}
-		commentId, err = res.LastInsertId()
+		if commentId, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		if req.AutomodReport != nil {
+			req.AutomodReport.Target.CommentId = &commentId
+			if err := insertAutomodReport(ctx, sess, req.AutomodReport); err != nil {
+				return err
+			}
+		}
 
 		if _, err = sess.SQL().
 			Update("post").
@@ -146,9 +177,12 @@ func (cdb *PostDB) EditComment(ctx context.Context, id int64, req *appDb.EditCom
 			return err
 		}
 		// TODO: Don't let images be edited, so make a new EditContentMetadata
-		err = editContentMetadata(ctx, sess, metadataId.Id, &appDb.EditContentMetadata{
-			Visibility:   req.Visibility,
-			CreatorAlias: req.CreatorAlias,
+		err = editContentMetadata(ctx, sess, cdb.sealer, metadataId.Id, &appDb.EditContentMetadata{
+			Visibility:    req.Visibility,
+			CreatorAlias:  req.CreatorAlias,
+			ModLog:        req.ModLog,
+			Held:          req.Held,
+			AutomodReport: req.AutomodReport,
 		})
 		if err != nil {
 			return err
@@ -160,7 +194,7 @@ func (cdb *PostDB) EditComment(ctx context.Context, id int64, req *appDb.EditCom
 				Set("content = ?", req.Content).
 				Where("id = ?", id).
 				ExecContext(ctx); err != nil {
-				return nil
+				return err
 			}
 		}
 		return err
@@ -168,8 +202,18 @@ func (cdb *PostDB) EditComment(ctx context.Context, id int64, req *appDb.EditCom
 	return err
 }
 
-func (cdb *PostDB) MarkCommentAsDeleted(ctx context.Context, id int64) error {
-	_, err := cdb.sess.SQL().ExecContext(ctx, db.Raw(`
+func (cdb *PostDB) MarkCommentAsDeleted(ctx context.Context, id int64, modLog *model.ModLogEntry) error {
+	return cdb.sess.TxContext(ctx, func(sess db.Session) error {
+		if err := markCommentAsDeleted(ctx, sess, id); err != nil {
+			return err
+		}
+		_, err := insertModLogEntry(ctx, sess, modLog)
+		return err
+	}, nil)
+}
+
+func markCommentAsDeleted(ctx context.Context, sess db.Session, id int64) error {
+	_, err := sess.SQL().ExecContext(ctx, db.Raw(`
 UPDATE comment as c
 	INNER JOIN content_metadata as cm ON c.metadata_id = cm.id
 	SET cm.status = 'DELETED', c.content=''
@@ -178,15 +222,64 @@ UPDATE comment as c
 	return err
 }
 
-func insertContentMetadata(ctx context.Context, sess db.Session, metadata *appDb.CreateContentMetadata) (id int64, err error) {
+func (cdb *PostDB) SetContentHeld(ctx context.Context, metadataId int64, held bool) error {
+	_, err := cdb.sess.SQL().
+		Update("content_metadata").
+		Set("held = ?, held_on_create = FALSE", held).
+		Where("id = ?", metadataId).
+		ExecContext(ctx)
+	return err
+}
+
+func (cdb *PostDB) RemovePostFromCommunity(ctx context.Context, postId int64, communityId int64, modLog *model.ModLogEntry) error {
+	return cdb.sess.TxContext(ctx, func(sess db.Session) error {
+		// locking the post's rows keeps concurrent removals from taking it out of every community
+		rows, err := sess.SQL().QueryContext(ctx, `SELECT community_id FROM post_communities
+															WHERE post_id = ?
+														FOR UPDATE`, postId)
+		if err != nil {
+			return err
+		}
+		var postCommunities []struct {
+			CommunityId int64 `db:"community_id"`
+		}
+		if err := sess.SQL().NewIteratorContext(ctx, rows).All(&postCommunities); err != nil {
+			return err
+		}
+		found := false
+		for _, pc := range postCommunities {
+			found = found || pc.CommunityId == communityId
+		}
+		if !found {
+			return appDb.ErrNotFound
+		}
+		if len(postCommunities) == 1 {
+			return appDb.ErrLastCommunity
+		}
+		if _, err := sess.SQL().
+			DeleteFrom("post_communities").
+			Where("post_id = ? AND community_id = ?", postId, communityId).
+			ExecContext(ctx); err != nil {
+			return err
+		}
+		_, err = insertModLogEntry(ctx, sess, modLog)
+		return err
+	}, nil)
+}
+
+func insertContentMetadata(ctx context.Context, sess db.Session, sealer *sealed.Sealer, metadata *appDb.CreateContentMetadata) (id int64, err error) {
 	if err != nil {
 		return 0, err
 	}
 
+	creator, err := sealer.Creator(metadata.CreatorId, metadata.Visibility)
+	if err != nil {
+		return 0, err
+	}
 	res, err := sess.SQL().
 		InsertInto("content_metadata").
-		Columns("creator_id", "creator_alias", "visibility").
-		Values(metadata.CreatorId, metadata.CreatorAlias, metadata.Visibility).
+		Columns("creator_id", "creator_id_enc", "creator_id_hash", "creator_alias", "visibility", "held", "held_on_create").
+		Values(creator.Id, creator.Enc, creator.Hash, metadata.CreatorAlias, metadata.Visibility, metadata.Held, metadata.Held).
 		ExecContext(ctx)
 	if err != nil {
 		return 0, err
@@ -196,10 +289,10 @@ func insertContentMetadata(ctx context.Context, sess db.Session, metadata *appDb
 		return 0, err
 	}
 
-	return id, insertContentImagesFor(ctx, sess, id, metadata.ImageBlobNames)
+	return id, images.InsertForContent(ctx, sess, id, metadata.Images)
 }
 
-func editContentMetadata(ctx context.Context, sess db.Session, metadataId int64, req *appDb.EditContentMetadata) error {
+func editContentMetadata(ctx context.Context, sess db.Session, sealer *sealed.Sealer, metadataId int64, req *appDb.EditContentMetadata) error {
 	if _, err := sess.SQL().ExecContext(ctx, db.Raw(`
 		DELETE ci FROM content_image ci
 		JOIN image i ON ci.image_id = i.id
@@ -208,99 +301,56 @@ func editContentMetadata(ctx context.Context, sess db.Session, metadataId int64,
 		return err
 	}
 
-	err := insertContentImagesFor(ctx, sess, metadataId, req.ImageBlobNamesToAdd)
+	err := images.InsertForContent(ctx, sess, metadataId, req.ImagesToAdd)
 	if err != nil {
-		return nil
+		return err
 	}
 
+	// the creator is (un)sealed when the visibility changes
+	creatorId, err := sealer.CurrentCreator(ctx, sess, metadataId)
+	if err != nil {
+		return err
+	}
+	creator, err := sealer.Creator(creatorId, req.Visibility)
+	if err != nil {
+		return err
+	}
 	updater := sess.SQL().
 		Update("content_metadata").
-		Set("visibility = ?", req.Visibility)
+		Set("visibility = ?", req.Visibility).
+		Set("creator_id = ?", creator.Id).
+		Set("creator_id_enc = ?", creator.Enc).
+		Set("creator_id_hash = ?", creator.Hash)
 
 	if len(req.CreatorAlias) > 0 {
 		updater = updater.Set("creator_alias = ?", req.CreatorAlias)
 	}
-	_, err = updater.Where("id = ?", metadataId).
-		ExecContext(ctx)
-	return err
-}
-
-// TODO: Move to separate file? Simplify image model if not extended upon
-func insertContentImagesFor(ctx context.Context, sess db.Session, metadataId int64, imageBlobNames []string) error {
-	imageIds := make([]int64, len(imageBlobNames))
-	for i, imageBlobName := range imageBlobNames {
-		res, err := sess.SQL().
-			InsertInto("image").
-			Columns("blob_name").
-			Values(imageBlobName).
-			ExecContext(ctx)
-		if err != nil {
-			return err
-		}
-		id, err := res.LastInsertId()
-		if err != nil {
-			return err
-		}
-		imageIds[i] = id
+	if req.Held {
+		updater = updater.Set("held = TRUE")
 	}
-
-	batchInserter := sess.SQL().
-		InsertInto("content_image").
-		Columns("metadata_id", "image_id").
-		Batch(len(imageIds))
-	for _, imageId := range imageIds {
-		batchInserter.Values(metadataId, imageId)
+	if _, err := updater.Where("id = ?", metadataId).
+		ExecContext(ctx); err != nil {
+		return err
 	}
-	batchInserter.Done()
-	if err := batchInserter.Wait(); err != nil {
+	if err := insertAutomodReport(ctx, sess, req.AutomodReport); err != nil {
 		return err
 	}
-	return nil
-}
-
-type flattenedUserVote struct {
-	Value sql.NullInt16 `db:"value"`
-}
-
-type flattenedContentAuthor struct {
-	Id             string `db:"creator_id"`
-	DisplayName    string `db:"display_name"`
-	Alias          string `db:"creator_alias"`
-	AvatarBlobName string `db:"avatar_blob_name"`
-}
-
-type flattenedContentMetadata struct {
-	Id                int64                  `db:"metadata_id"`
-	NumVotes          uint64                 `db:"num_votes"`
-	VoteTotal         int64                  `db:"vote_total"`
-	Creator           flattenedContentAuthor `db:",inline"`
-	Visibility        model.Visibility       `db:"visibility"`
-	Status            model.Status           `db:"status"`
-	flattenedUserVote `db:",inline"`
-	ImageBlobNamesStr string    `db:"image_blob_names"`
-	CreatedAt         time.Time `db:"created_at"`
-	UpdatedAt         time.Time `db:"updated_at"`
-}
-
-type flattenedPost struct {
-	flattenedContentMetadata `db:",inline"`
-	Id                       int64  `db:"id"`
-	Title                    string `db:"title"`
-	Content                  string `db:"content"`
-	CommunityIdsStr          string `db:"community_ids"`
-	CommunityNamesJSONStr    string `db:"community_names"`
-	CommentCount             int64  `db:"comment_count"`
+	_, err = insertModLogEntry(ctx, sess, req.ModLog)
+	return err
 }
 
 var contentMetadataColumns = []interface{}{
 	"cm.id as metadata_id",
 	"cm.creator_id",
-	"person.display_name",
+	"cm.creator_id_enc",
+	db.Raw("COALESCE(person.display_name, '') AS display_name"),
 	"cm.creator_alias",
 	"cm.num_votes",
 	"cm.vote_total",
 	"cm.visibility",
 	"cm.status",
+	"cm.held",
+	"cm.held_on_create",
 	"cm.created_at",
 	"cm.updated_at",
 }
@@ -311,8 +361,14 @@ var postColumns = append(contentMetadataColumns,
 		"p.title",
 		"p.content",
 		"p.comment_count",
-		db.Raw("JSON_ARRAYAGG(image.blob_name) as image_blob_names"),
-		db.Raw("JSON_ARRAYAGG(pc.community_id) as community_ids"), db.Raw("JSON_ARRAYAGG(c.name) as community_names"),
+		// correlated subqueries rather than JSON_ARRAYAGG over joins of both, which repeats every community once per image
+		// and every image once per community. each community is one object, so its id and name can't come apart
+		db.Raw(`COALESCE((SELECT JSON_ARRAYAGG(image.blob_name) FROM content_image AS ci
+			JOIN image ON ci.image_id = image.id
+			WHERE ci.metadata_id = cm.id), JSON_ARRAY()) AS image_blob_names`),
+		db.Raw(`COALESCE((SELECT JSON_ARRAYAGG(JSON_OBJECT('id', pc.community_id, 'name', c.name)) FROM post_communities AS pc
+			JOIN community AS c ON pc.community_id = c.id
+			WHERE pc.post_id = p.id), JSON_ARRAY()) AS communities`),
 	}...)
 
 var voteColumns = []interface{}{
@@ -320,20 +376,15 @@ var voteColumns = []interface{}{
 }
 
 func (cdb *PostDB) GetPostById(ctx context.Context, id int64, opts *appDb.PostQueryOpts) (*model.Post, error) {
-	var post flattenedPost
+	var post flattened.Post
 	if err := cdb.sess.SQL().
 		Select(append(postColumns, voteColumns...)...).
 		From("post AS p").
 		Join("content_metadata as cm").On("p.metadata_id = cm.id").
-		LeftJoin("post_communities as pc").On("p.id = pc.post_id").
 		// TODO: This can be optimized: don't join if VoteHistoryOf empty
 		LeftJoin("vote as v").On("v.voter_id = ? AND cm.id = v.tgt_metadata_id", opts.VoteHistoryOf).
-		Join("person").On("cm.creator_id = person.firebase_id").
-		Join("community as c").On("pc.community_id = c.id").
-		LeftJoin("content_image as ci").On("cm.id = ci.metadata_id").
-		LeftJoin("image").On("ci.image_id = image.id").
+		LeftJoin("person").On("cm.creator_id = person.firebase_id").
 		Where("p.id = ?", id).
-		GroupBy("p.id", "cm.id", "person.firebase_id").
 		IteratorContext(ctx).
 		One(&post); err != nil {
 		if err == db.ErrNoMoreRows {
@@ -341,7 +392,17 @@ func (cdb *PostDB) GetPostById(ctx context.Context, id int64, opts *appDb.PostQu
 		}
 		return nil, err
 	}
-	return buildPostFromFlattened(&post)
+	if err := cdb.sealer.OpenCreators(ctx, cdb.sess, []*flattened.ContentAuthor{&post.Creator}); err != nil {
+		return nil, err
+	}
+	built, err := flattened.BuildPost(&post)
+	if err != nil {
+		return nil, err
+	}
+	if err := images.AttachTo(ctx, cdb.sess, []*model.ContentMetadata{built.ContentMetadata}); err != nil {
+		return nil, err
+	}
+	return built, nil
 }
 
 func (cdb *PostDB) GetPosts(ctx context.Context, query *appDb.PostsListQuery) ([]*model.Post, error) {
@@ -377,11 +438,15 @@ func (cdb *PostDB) GetPosts(ctx context.Context, query *appDb.PostsListQuery) ([
 		panic("must provide a paging option")
 	}
 	if query.CommunityIds != nil {
-		conds = append(conds, db.Raw("(pc.community_id IN ?)", query.CommunityIds))
+		// a post in several of the communities is still one row
+		conds = append(conds, db.Raw(
+			"(EXISTS (SELECT 1 FROM post_communities AS pc WHERE pc.post_id = p.id AND pc.community_id IN ?))",
+			query.CommunityIds))
 	}
 
 	if query.ByUser != nil {
-		conds = append(conds, db.Raw("(cm.creator_id = ?)", query.ByUser.Id))
+		conds = append(conds, db.Raw("(cm.creator_id = ? OR cm.creator_id_hash = ?)",
+			query.ByUser.Id, cdb.sealer.UserKey(query.ByUser.Id)))
 	}
 
 	if query.Visibility != nil {
@@ -391,86 +456,46 @@ func (cdb *PostDB) GetPosts(ctx context.Context, query *appDb.PostsListQuery) ([
 	if !query.IncludeDeleted {
 		conds = append(conds, db.Raw("(cm.status != 'DELETED')"))
 	}
+	if !query.IncludeHeld {
+		conds = append(conds, db.Raw("(cm.held = FALSE)"))
+	}
 
-	var flattenedPosts []flattenedPost
+	var flattenedPosts []flattened.Post
 	if err := cdb.sess.SQL().
 		Select(append(postColumns, voteColumns...)...).
-		From(
-			cdb.sess.SQL().
-				Select("p.id").
-				From("post as p").
-				Join("content_metadata as cm").On("p.metadata_id=cm.id").
-				LeftJoin("post_communities as pc").On("p.id=pc.post_id").
-				Where(convertDbRawToInterface(conds...)...).
-				And("(? OR pc.community_id IN ?)", query.CommunityIds == nil, query.CommunityIds).
-				GroupBy("p.id")).
-		As("p_ids").
-		Join("post as p").On("p_ids.id = p.id").
+		From("post as p").
 		Join("content_metadata as cm").On("p.metadata_id = cm.id").
 		// TODO: This can be optimized: don't join if VoteHistoryOf empty
 		LeftJoin("vote as v").On("v.voter_id = ? AND cm.id = v.tgt_metadata_id", query.VoteHistoryOf).
-		Join("person").On("cm.creator_id = person.firebase_id").
-		LeftJoin("post_communities as pc").On("p.id = pc.post_id").
-		Join("community as c").On("pc.community_id = c.id").
-		LeftJoin("content_image as ci").On("cm.id = ci.metadata_id").
-		LeftJoin("image").On("ci.image_id = image.id").
+		LeftJoin("person").On("cm.creator_id = person.firebase_id").
+		Where(convertDbRawToInterface(conds...)...).
 		OrderBy(orderBy...).
-		GroupBy("p.id", "cm.id", "person.firebase_id").
 		Limit(int(query.Limit)).
 		IteratorContext(ctx).
 		All(&flattenedPosts); err != nil {
 		return nil, err
 	}
+	authors := make([]*flattened.ContentAuthor, len(flattenedPosts))
+	for i := range flattenedPosts {
+		authors[i] = &flattenedPosts[i].Creator
+	}
+	if err := cdb.sealer.OpenCreators(ctx, cdb.sess, authors); err != nil {
+		return nil, err
+	}
 	posts := make([]*model.Post, len(flattenedPosts))
-	for i, flattened := range flattenedPosts {
-		post, err := buildPostFromFlattened(&flattened)
+	metadata := make([]*model.ContentMetadata, len(flattenedPosts))
+	for i, flattenedPost := range flattenedPosts {
+		post, err := flattened.BuildPost(&flattenedPost)
 		if err != nil {
 			return nil, err
 		}
 		posts[i] = post
+		metadata[i] = post.ContentMetadata
 	}
-	return posts, nil
-}
-
-func buildPostFromFlattened(post *flattenedPost) (*model.Post, error) {
-	var communityIds []int64
-	if err := json.Unmarshal([]byte(post.CommunityIdsStr), &communityIds); err != nil {
+	if err := images.AttachTo(ctx, cdb.sess, metadata); err != nil {
 		return nil, err
 	}
-
-	var communityNames []string
-	if err := json.Unmarshal([]byte(post.CommunityNamesJSONStr), &communityNames); err != nil {
-		return nil, err
-	}
-
-	communities := make([]*model.Community, len(communityIds))
-	for i, communityId := range communityIds {
-		communities[i] = &model.Community{
-			Id:   communityId,
-			Name: communityNames[i],
-		}
-	}
-	metadata, err := buildContentMetadataFromFlattened(&post.flattenedContentMetadata)
-	if err != nil {
-		return nil, err
-	}
-
-	return &model.Post{
-		Id:              post.Id,
-		ContentMetadata: metadata,
-		Title:           post.Title,
-		Content:         post.Content,
-		Communities:     communities,
-		CommentCount:    post.CommentCount,
-	}, nil
-}
-
-type flattenedComment struct {
-	flattenedContentMetadata `db:",inline"`
-	Id                       int64  `db:"id"`
-	RootMetadataId           int64  `db:"root_metadata_id"`
-	ParentMetadataId         int64  `db:"parent_metadata_id"`
-	Content                  string `db:"content"`
+	return posts, nil
 }
 
 var commentColumns = append([]interface{}{
@@ -482,12 +507,12 @@ var commentColumns = append([]interface{}{
 }, contentMetadataColumns...)
 
 func (cdb *PostDB) GetCommentById(ctx context.Context, id int64) (*model.Comment, error) {
-	var comment flattenedComment
+	var comment flattened.Comment
 	if err := cdb.sess.SQL().
 		Select(commentColumns...).
 		From("comment as c").
 		Join("content_metadata as cm").On("c.metadata_id = cm.id").
-		Join("person").On("cm.creator_id = person.firebase_id").
+		LeftJoin("person").On("cm.creator_id = person.firebase_id").
 		Where("c.id = ?", id).
 		IteratorContext(ctx).
 		One(&comment); err != nil {
@@ -496,18 +521,21 @@ func (cdb *PostDB) GetCommentById(ctx context.Context, id int64) (*model.Comment
 		}
 		return nil, err
 	}
-	return buildCommentFromFlattened(&comment)
+	if err := cdb.sealer.OpenCreators(ctx, cdb.sess, []*flattened.ContentAuthor{&comment.Creator}); err != nil {
+		return nil, err
+	}
+	return flattened.BuildComment(&comment)
 }
 
 func (cdb *PostDB) GetCommentForest(ctx context.Context, rootMetadataId int64, opts *appDb.CommentTreeQueryOpts) ([]*model.CommentTree, error) {
-	var flattenedComments []flattenedComment
+	var flattenedComments []flattened.Comment
 	if err := cdb.sess.SQL().
 		Select(append(commentColumns, voteColumns...)...).
 		From("comment as c").
 		Join("content_metadata as cm").On("c.metadata_id = cm.id").
 		// TODO: This can be optimized: don't join if VoteHistoryOf empty
 		LeftJoin("vote as v").On("v.voter_id = ? AND cm.id = v.tgt_metadata_id", opts.VoteHistoryOf).
-		Join("person").On("cm.creator_id = person.firebase_id").
+		LeftJoin("person").On("cm.creator_id = person.firebase_id").
 		Where("root_metadata_id = ?", rootMetadataId).
 		OrderBy("created_at").
 		IteratorContext(ctx).
@@ -515,96 +543,25 @@ func (cdb *PostDB) GetCommentForest(ctx context.Context, rootMetadataId int64, o
 		return nil, err
 	}
 
-	comments := make([]*model.Comment, len(flattenedComments))
-	for i, flattenedComment := range flattenedComments {
-		comment, err := buildCommentFromFlattened(&flattenedComment)
-		if err != nil {
-			return nil, err
-		}
-		comments[i] = comment
+	authors := make([]*flattened.ContentAuthor, len(flattenedComments))
+	for i := range flattenedComments {
+		authors[i] = &flattenedComments[i].Creator
 	}
-
-	return buildCommentForest(rootMetadataId, comments), nil
-}
-
-func buildCommentFromFlattened(comment *flattenedComment) (*model.Comment, error) {
-	metadata, err := buildContentMetadataFromFlattened(&comment.flattenedContentMetadata)
-	if err != nil {
+	if err := cdb.sealer.OpenCreators(ctx, cdb.sess, authors); err != nil {
 		return nil, err
 	}
-	return &model.Comment{
-		Id:               comment.Id,
-		ContentMetadata:  metadata,
-		PostMetadataId:   comment.RootMetadataId,
-		ParentMetadataId: comment.ParentMetadataId,
-		Content:          comment.Content,
-	}, nil
-}
-
-func buildContentMetadataFromFlattened(metadata *flattenedContentMetadata) (*model.ContentMetadata, error) {
-	var vote *model.Vote
-	if metadata.flattenedUserVote.Value.Valid {
-		value, err := metadata.flattenedUserVote.Value.Value()
+	comments := make([]*model.Comment, len(flattenedComments))
+	for i, flattenedComment := range flattenedComments {
+		comment, err := flattened.BuildComment(&flattenedComment)
 		if err != nil {
-			panic(err)
-		}
-		vote = &model.Vote{Value: int8(value.(int64))}
-	}
-	var imageBlobNames = []string{} // make sure the array isn't nil
-	if len(metadata.ImageBlobNamesStr) > 0 {
-		if err := json.Unmarshal([]byte(metadata.ImageBlobNamesStr), &imageBlobNames); err != nil {
 			return nil, err
 		}
-		// remove empty blob names (nulls)
-		for i, blobName := range imageBlobNames {
-			if len(blobName) == 0 {
-				imageBlobNames = append(imageBlobNames[0:i], imageBlobNames[i+1:]...)
-			}
-		}
+		comments[i] = comment
 	}
 
-	return &model.ContentMetadata{
-		Id: metadata.Id,
-		Creator: &model.ContentAuthor{
-			LocalUser: &model.LocalUser{
-				Id:          metadata.Creator.Id,
-				DisplayName: metadata.Creator.DisplayName,
-			},
-			AnonymousUser: util.BuildAnonymousUserFromDisplayName(metadata.Creator.Alias), // TODO: Move avatar logic to frontend?
-		},
-		UserVote:       vote,
-		Status:         metadata.Status,
-		NumVotes:       metadata.NumVotes,
-		VoteTotal:      metadata.VoteTotal,
-		Visibility:     metadata.Visibility,
-		ImageBlobNames: imageBlobNames,
-		CreatedAt:      metadata.CreatedAt,
-		UpdatedAt:      metadata.UpdatedAt,
-	}, nil
-}
-
-func buildCommentForest(rootId int64, comments []*model.Comment) []*model.CommentTree {
-	adj := make(map[int64][]*model.Comment)
-	for _, comment := range comments {
-		adj[comment.ParentMetadataId] = append(adj[comment.ParentMetadataId], comment)
-	}
-	return buildCommentForestFromAdjList(adj, rootId)
+	return model.BuildCommentForest(rootMetadataId, comments), nil
 }
 
-func buildCommentForestFromAdjList(adj map[int64][]*model.Comment, rootId int64) []*model.CommentTree {
-	comments, ok := adj[rootId]
-	if !ok {
-		return []*model.CommentTree{}
-	}
-	forest := make([]*model.CommentTree, len(comments))
-	for i, comment := range comments {
-		forest[i] = &model.CommentTree{
-			Comment:  comment,
-			Children: buildCommentForestFromAdjList(adj, comment.ContentMetadata.Id),
-		}
-	}
-	return forest
-}
 func (cdb *PostDB) Vote(ctx context.Context, userId string, targetMetadataId int64, value int8) error {
 	return cdb.sess.TxContext(ctx, func(sess db.Session) error {
 		row, err := sess.SQL().QueryRowContext(ctx, `SELECT value FROM vote 
@@ -674,14 +631,6 @@ func (cdb *PostDB) Vote(ctx context.Context, userId string, targetMetadataId int
 	}, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
 }
 
-func (cdb *PostDB) CreateReport(ctx context.Context, userId string, req *appDb.CreateReport) (int64, error) {
-	res, err := cdb.sess.SQL().
-		InsertInto("report").
-		Columns("tgt_metadata_id", "creator_id", "reason").
-		Values(req.PostId, userId, req.Reason).
-		ExecContext(ctx)
-	if err != nil {
-		return 0, err
-	}
-	return res.LastInsertId()
+func (cdb *PostDB) GetLiveImageBlobNames(ctx context.Context) ([]string, error) {
+	return images.LiveBlobNames(ctx, cdb.sess)
 }
@@ -0,0 +1,73 @@
+package planetscale
+
+import (
+	"context"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/upper/db/v4"
+)
+
+type PushDB struct {
+	sess db.Session
+}
+
+func getPushDB(sess db.Session) *PushDB {
+	return &PushDB{sess}
+}
+
+func (pdb *PushDB) SavePushSubscription(ctx context.Context, subscription *model.PushSubscription) error {
+	// LAST_INSERT_ID(id) reports the id of the row when it's updated instead of inserted
+	res, err := pdb.sess.SQL().ExecContext(ctx, `INSERT INTO push_subscription (user_id, endpoint, endpoint_hash, p256dh, auth)
+	VALUES (?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id), user_id = VALUES(user_id), p256dh = VALUES(p256dh),
+		auth = VALUES(auth)`,
+		subscription.UserId, subscription.Endpoint, subscription.EndpointHash, subscription.P256dh, subscription.Auth)
+	if err != nil {
+		return err
+	}
+	subscription.Id, err = res.LastInsertId()
+	return err
+}
+
+func (pdb *PushDB) DeletePushSubscription(ctx context.Context, userId string, endpointHash string) error {
+	_, err := pdb.sess.SQL().
+		DeleteFrom("push_subscription").
+		Where("user_id = ? AND endpoint_hash = ?", userId, endpointHash).
+		ExecContext(ctx)
+	return err
+}
+
+func (pdb *PushDB) DeletePushSubscriptionById(ctx context.Context, id int64) error {
+	_, err := pdb.sess.SQL().
+		DeleteFrom("push_subscription").
+		Where("id = ?", id).
+		ExecContext(ctx)
+	return err
+}
+
+func (pdb *PushDB) GetPushSubscriptions(ctx context.Context, userIds []string) ([]*model.PushSubscription, error) {
+	subscriptions := make([]*model.PushSubscription, 0)
+	if len(userIds) == 0 {
+		return subscriptions, nil
+	}
+	err := pdb.sess.SQL().
+		SelectFrom("push_subscription").
+		Where("user_id IN ?", userIds).
+		OrderBy("id").
+		IteratorContext(ctx).
+		All(&subscriptions)
+	return subscriptions, err
+}
+
+func (pdb *PushDB) GetCommunityPushSubscriptions(ctx context.Context, communityId int64, afterId int64, limit int) ([]*model.PushSubscription, error) {
+	subscriptions := make([]*model.PushSubscription, 0)
+	err := pdb.sess.SQL().
+		Select("ps.*").
+		From("push_subscription AS ps").
+		Join("subscription AS s").On("s.user_id = ps.user_id").
+		Where("s.community_id = ? AND ps.id > ?", communityId, afterId).
+		OrderBy("ps.id").
+		Limit(limit).
+		IteratorContext(ctx).
+		All(&subscriptions)
+	return subscriptions, err
+}
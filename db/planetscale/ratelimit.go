@@ -0,0 +1,78 @@
+package planetscale
+
+import (
+	"context"
+	"database/sql"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/upper/db/v4"
+	"sort"
+	"time"
+)
+
+type RateLimitDB struct {
+	sess db.Session
+}
+
+func getRateLimitDB(sess db.Session) *RateLimitDB {
+	return &RateLimitDB{sess}
+}
+
+func (rdb *RateLimitDB) UpdateRateLimitBuckets(ctx context.Context, keys []string, update func([]*model.RateLimitBucket) []*model.RateLimitBucket) error {
+	return rdb.sess.TxContext(ctx, func(sess db.Session) error {
+		// the rows are locked in key order, so two updates sharing keys can't each hold one the other waits for
+		order := make([]int, len(keys))
+		for i := range order {
+			order[i] = i
+		}
+		sort.Slice(order, func(a, b int) bool {
+			return keys[order[a]] < keys[order[b]]
+		})
+		buckets := make([]*model.RateLimitBucket, len(keys))
+		for _, i := range order {
+			bucket, err := getRateLimitBucketForUpdate(ctx, sess, keys[i])
+			if err != nil {
+				return err
+			}
+			buckets[i] = bucket
+		}
+
+		for i, bucket := range update(buckets) {
+			// two instances creating the same bucket both see it missing. the later write wins
+			_, err := sess.SQL().ExecContext(ctx, `INSERT INTO rate_limit_bucket (bucket_key, tokens, updated_at_ms)
+	VALUES (?, ?, ?)
+	ON DUPLICATE KEY UPDATE tokens = VALUES(tokens), updated_at_ms = VALUES(updated_at_ms)`,
+				keys[i], bucket.Tokens, bucket.UpdatedAt.UnixMilli())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil)
+}
+
+// getRateLimitBucketForUpdate locks and returns the bucket of the key, or nil if there isn't one
+func getRateLimitBucketForUpdate(ctx context.Context, sess db.Session, key string) (*model.RateLimitBucket, error) {
+	row, err := sess.SQL().QueryRowContext(ctx, `SELECT tokens, updated_at_ms FROM rate_limit_bucket
+															WHERE bucket_key = ?
+														FOR UPDATE`, key)
+	if err != nil {
+		return nil, err
+	}
+	var tokens float64
+	var updatedAtMs int64
+	if err := row.Scan(&tokens, &updatedAtMs); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &model.RateLimitBucket{Tokens: tokens, UpdatedAt: time.UnixMilli(updatedAtMs)}, nil
+}
+
+func (rdb *RateLimitDB) DeleteRateLimitBuckets(ctx context.Context, updatedBefore time.Time) error {
+	_, err := rdb.sess.SQL().
+		DeleteFrom("rate_limit_bucket").
+		Where("updated_at_ms < ?", updatedBefore.UnixMilli()).
+		ExecContext(ctx)
+	return err
+}
@@ -0,0 +1,117 @@
+package planetscale
+
+import (
+	"context"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/upper/db/v4"
+	"time"
+)
+
+type UploadDB struct {
+	sess db.Session
+}
+
+func getUploadDB(sess db.Session) *UploadDB {
+	return &UploadDB{sess}
+}
+
+func (udb *UploadDB) CreateUpload(ctx context.Context, upload *model.Upload) (int64, error) {
+	res, err := udb.sess.WithContext(ctx).SQL().
+		InsertInto("upload").
+		Columns("token_hash", "blob_name", "owner_id", "kind", "content_type", "max_size", "expires_at").
+		Values(upload.TokenHash, upload.BlobName, upload.OwnerId, upload.Kind, upload.ContentType, upload.MaxSize, upload.ExpiresAt).
+		Exec()
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (udb *UploadDB) GetUploadByTokenHash(ctx context.Context, tokenHash string) (*model.Upload, error) {
+	var upload model.Upload
+	if err := udb.sess.SQL().
+		Select("*").
+		From("upload").
+		Where("token_hash = ?", tokenHash).
+		IteratorContext(ctx).
+		One(&upload); err != nil {
+		if err == db.ErrNoMoreRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &upload, nil
+}
+
+func (udb *UploadDB) CompleteUpload(ctx context.Context, id int64, size int64) error {
+	res, err := udb.sess.WithContext(ctx).SQL().
+		Update("upload").
+		Set("size = ?", size).
+		Set("completed_at = CURRENT_TIMESTAMP").
+		Where("id = ? AND completed_at IS NULL", id).
+		Exec()
+	if err != nil {
+		return err
+	}
+	if affected, err := res.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return appDb.ErrNotFound
+	}
+	return nil
+}
+
+func (udb *UploadDB) ReopenUpload(ctx context.Context, id int64) error {
+	_, err := udb.sess.WithContext(ctx).SQL().
+		Update("upload").
+		Set("completed_at = NULL").
+		Where("id = ?", id).
+		Exec()
+	return err
+}
+
+func (udb *UploadDB) GetCompletedUploads(ctx context.Context, blobNames []string) ([]*model.Upload, error) {
+	uploads := make([]*model.Upload, 0)
+	if len(blobNames) == 0 {
+		return uploads, nil
+	}
+	err := udb.sess.SQL().
+		Select("*").
+		From("upload").
+		Where("blob_name IN ? AND completed_at IS NOT NULL", blobNames).
+		IteratorContext(ctx).
+		All(&uploads)
+	return uploads, err
+}
+
+func (udb *UploadDB) SetUploadProcessed(ctx context.Context, blobName string) error {
+	_, err := udb.sess.WithContext(ctx).SQL().
+		Update("upload").
+		Set("processed_at = CURRENT_TIMESTAMP").
+		Where("blob_name = ? AND completed_at IS NOT NULL", blobName).
+		Exec()
+	return err
+}
+
+func (udb *UploadDB) GetAbandonedUploads(ctx context.Context, expiredBefore time.Time) ([]*model.Upload, error) {
+	uploads := make([]*model.Upload, 0)
+	err := udb.sess.SQL().
+		Select("*").
+		From("upload").
+		Where("completed_at IS NULL AND expires_at < ?", expiredBefore).
+		IteratorContext(ctx).
+		All(&uploads)
+	return uploads, err
+}
+
+func (udb *UploadDB) DeleteUploads(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := udb.sess.WithContext(ctx).SQL().
+		DeleteFrom("upload").
+		Where("id IN ?", ids).
+		Exec()
+	return err
+}
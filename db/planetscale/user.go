@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/navbryce/next-dorm-be/model"
 	"github.com/upper/db/v4"
+	"time"
 )
 
 type UserDB struct {
@@ -15,6 +16,10 @@ func getUserDB(sess db.Session) *UserDB {
 }
 
 func (udb *UserDB) CreateUser(ctx context.Context, user *model.LocalUser) error {
+	if user.CreatedAt == nil {
+		now := time.Now().UTC()
+		user.CreatedAt = &now
+	}
 	_, err := udb.sess.Collection("person").
 		Insert(user)
 	return err
@@ -35,3 +40,35 @@ func (udb *UserDB) GetUser(ctx context.Context, id string) (*model.LocalUser, er
 	}
 	return &user, nil
 }
+
+func (udb *UserDB) GetUserIds(ctx context.Context) ([]string, error) {
+	var people []*model.LocalUser
+	if err := udb.sess.SQL().
+		Select("firebase_id").
+		From("person").
+		IteratorContext(ctx).
+		All(&people); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(people))
+	for i, person := range people {
+		ids[i] = person.Id
+	}
+	return ids, nil
+}
+
+func (udb *UserDB) GetUsersByDisplayNames(ctx context.Context, displayNames []string) ([]*model.LocalUser, error) {
+	people := make([]*model.LocalUser, 0)
+	if len(displayNames) == 0 {
+		return people, nil
+	}
+	if err := udb.sess.SQL().
+		Select("*").
+		From("person").
+		Where("display_name IN ?", displayNames).
+		IteratorContext(ctx).
+		All(&people); err != nil {
+		return nil, err
+	}
+	return people, nil
+}
@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/navbryce/next-dorm-be/db/internal/sealed"
+	"github.com/upper/db/v4"
+)
+
+type AliasDB struct {
+	sess   db.Session
+	sealer *sealed.Sealer
+}
+
+func getAliasDB(sess db.Session, sealer *sealed.Sealer) *AliasDB {
+	return &AliasDB{sess, sealer}
+}
+
+func (adb *AliasDB) GetThreadAlias(ctx context.Context, postMetadataId int64, userId string) (string, error) {
+	return getThreadAlias(ctx, adb.sess, postMetadataId, adb.sealer.UserKey(userId))
+}
+
+func (adb *AliasDB) CreateThreadAlias(ctx context.Context, postMetadataId int64, userId string, alias string) error {
+	return translateErr(adb.sess.TxContext(ctx, func(sess db.Session) error {
+		return insertThreadAlias(ctx, sess, adb.sealer, postMetadataId, userId, alias)
+	}, nil))
+}
+
+func getThreadAlias(ctx context.Context, sess db.Session, postMetadataId int64, userId string) (string, error) {
+	var row struct {
+		Alias string `db:"alias"`
+	}
+	if err := sess.SQL().
+		Select("alias").
+		From("thread_alias").
+		Where("post_metadata_id = ? AND user_id = ?", postMetadataId, userId).
+		IteratorContext(ctx).
+		One(&row); err != nil {
+		if err == db.ErrNoMoreRows {
+			return "", nil
+		}
+		return "", err
+	}
+	return row.Alias, nil
+}
+
+// insertThreadAlias keys the alias by the user key, and records whether that's sealed for SealExisting
+func insertThreadAlias(ctx context.Context, sess db.Session, sealer *sealed.Sealer, postMetadataId int64, userId string, alias string) error {
+	_, err := sess.SQL().
+		InsertInto("thread_alias").
+		Columns("post_metadata_id", "user_id", "sealed", "alias").
+		Values(postMetadataId, sealer.UserKey(userId), sealer != nil, alias).
+		ExecContext(ctx)
+	return err
+}
@@ -0,0 +1,100 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/upper/db/v4"
+)
+
+type AutomodDB struct {
+	sess db.Session
+}
+
+func getAutomodDB(sess db.Session) *AutomodDB {
+	return &AutomodDB{sess}
+}
+
+func (adb *AutomodDB) CreateAutomodRule(ctx context.Context, rule *model.AutomodRule, modLog *model.ModLogEntry) (int64, error) {
+	var ruleId int64
+	err := adb.sess.TxContext(ctx, func(sess db.Session) error {
+		res, err := sess.SQL().
+			InsertInto("automod_rule").
+			Columns("community_id", "rule_type", "outcome", "applies_to", "params", "reason", "created_by").
+			Values(rule.CommunityId, rule.Type, rule.Outcome, rule.AppliesTo, rule.Params, rule.Reason, rule.CreatedBy).
+			ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+		if ruleId, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		if modLog != nil {
+			modLog.TargetId = &ruleId
+		}
+		_, err = insertModLogEntry(ctx, sess, modLog)
+		return err
+	}, nil)
+	return ruleId, translateErr(err)
+}
+
+func (adb *AutomodDB) UpdateAutomodRule(ctx context.Context, rule *model.AutomodRule, modLog *model.ModLogEntry) error {
+	return translateErr(adb.sess.TxContext(ctx, func(sess db.Session) error {
+		if _, err := sess.SQL().
+			Update("automod_rule").
+			Set("outcome = ?", rule.Outcome).
+			Set("applies_to = ?", rule.AppliesTo).
+			Set("params = ?", rule.Params).
+			Set("reason = ?", rule.Reason).
+			Set("updated_at = CURRENT_TIMESTAMP").
+			Where("id = ?", rule.Id).
+			ExecContext(ctx); err != nil {
+			return err
+		}
+		_, err := insertModLogEntry(ctx, sess, modLog)
+		return err
+	}, nil))
+}
+
+func (adb *AutomodDB) DeleteAutomodRule(ctx context.Context, id int64, modLog *model.ModLogEntry) error {
+	return translateErr(adb.sess.TxContext(ctx, func(sess db.Session) error {
+		if _, err := sess.SQL().
+			DeleteFrom("automod_rule").
+			Where("id = ?", id).
+			ExecContext(ctx); err != nil {
+			return err
+		}
+		_, err := insertModLogEntry(ctx, sess, modLog)
+		return err
+	}, nil))
+}
+
+func (adb *AutomodDB) GetAutomodRule(ctx context.Context, id int64) (*model.AutomodRule, error) {
+	var rule model.AutomodRule
+	if err := adb.sess.SQL().
+		Select("*").
+		From("automod_rule").
+		Where("id = ?", id).
+		IteratorContext(ctx).
+		One(&rule); err != nil {
+		if err == db.ErrNoMoreRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (adb *AutomodDB) GetAutomodRules(ctx context.Context, communityIds []int64) ([]*model.AutomodRule, error) {
+	rules := make([]*model.AutomodRule, 0)
+	if len(communityIds) == 0 {
+		return rules, nil
+	}
+	err := adb.sess.SQL().
+		Select("*").
+		From("automod_rule").
+		Where("community_id IN ?", communityIds).
+		OrderBy("id").
+		IteratorContext(ctx).
+		All(&rules)
+	return rules, err
+}
@@ -0,0 +1,111 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/db/internal/sealed"
+	"github.com/navbryce/next-dorm-be/db/migrations"
+	"github.com/upper/db/v4"
+	"github.com/upper/db/v4/adapter/sqlite"
+)
+
+// SQLiteDB is a db.Database backed by a single SQLite file. Intended for local development.
+//
+// Every write runs inside TxContext: outside a transaction the upper/db adapter leaks the implicit transaction of a
+// failed statement, which leaves the database locked
+type SQLiteDB struct {
+	*CommunityDB
+	*PostDB
+	*SubscriptionDB
+	*UserDB
+	*UploadDB
+	*AliasDB
+	*RevealDB
+	*RoleDB
+	*BanDB
+	*ReportDB
+	*ModLogDB
+	*AutomodDB
+	*RateLimitDB
+	*NotificationDB
+	*LiveEventDB
+	*WebhookDB
+	*DigestDB
+	*PushDB
+	sess   db.Session
+	sqlDB  *sql.DB
+	sealer *sealed.Sealer
+}
+
+// GetDatabase opens the database file at path (creating it if it doesn't exist) and applies any pending migrations.
+// Creators of hidden content are sealed when sealer isn't nil
+func GetDatabase(path string, sealer *sealed.Sealer) (appDb.Database, error) {
+	sqlDB, err := OpenSQLDB(path)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := migrations.NewMigrator(sqlDB, migrations.SQLiteFiles())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := migrator.Up(context.Background(), 0); err != nil {
+		return nil, err
+	}
+
+	sess, err := sqlite.New(sqlDB)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLiteDB{
+		CommunityDB:    getCommunityDb(sess),
+		PostDB:         getPostDB(sess, sealer),
+		SubscriptionDB: getSubscriptionDB(sess),
+		UserDB:         getUserDB(sess),
+		UploadDB:       getUploadDB(sess),
+		AliasDB:        getAliasDB(sess, sealer),
+		RevealDB:       getRevealDB(sess),
+		RoleDB:         getRoleDB(sess),
+		BanDB:          getBanDB(sess),
+		ReportDB:       getReportDB(sess),
+		ModLogDB:       getModLogDB(sess),
+		AutomodDB:      getAutomodDB(sess),
+		RateLimitDB:    getRateLimitDB(sess),
+		NotificationDB: getNotificationDB(sess, sealer),
+		LiveEventDB:    getLiveEventDB(sess),
+		WebhookDB:      getWebhookDB(sess),
+		DigestDB:       getDigestDB(sess),
+		PushDB:         getPushDB(sess),
+		sess:           sess,
+		sqlDB:          sqlDB,
+		sealer:         sealer,
+	}, nil
+}
+
+// OpenSQLDB opens the database file at path without applying migrations or wrapping it in a session
+func OpenSQLDB(path string) (*sql.DB, error) {
+	sqlDB, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_busy_timeout=5000&_txlock=immediate", path))
+	if err != nil {
+		return nil, err
+	}
+	// a single connection serializes writes, which stands in for the row locks SQLite doesn't have. it also keeps
+	// ":memory:" databases from being opened once per connection
+	sqlDB.SetMaxOpenConns(1)
+	return sqlDB, nil
+}
+
+func (sdb *SQLiteDB) SealCreators(ctx context.Context) (int64, error) {
+	numSealed, err := sdb.sealer.SealExisting(ctx, sdb.sess)
+	return numSealed, translateErr(err)
+}
+
+func (sdb *SQLiteDB) GetSQLDB() *sql.DB {
+	return sdb.sqlDB
+}
+
+func (sdb *SQLiteDB) Close() error {
+	return sdb.sess.Close()
+}
@@ -0,0 +1,110 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/upper/db/v4"
+	"time"
+)
+
+type DigestDB struct {
+	sess db.Session
+}
+
+func getDigestDB(sess db.Session) *DigestDB {
+	return &DigestDB{sess}
+}
+
+func (ddb *DigestDB) CreateDigestPreference(ctx context.Context, preference *model.DigestPreference) error {
+	return translateErr(ddb.sess.TxContext(ctx, func(sess db.Session) error {
+		_, err := sess.SQL().
+			InsertInto("digest_preference").
+			Columns("user_id", "email", "frequency", "unsubscribe_token", "next_send_at").
+			Values(preference.UserId, preference.Email, preference.Frequency, preference.UnsubscribeToken,
+				formatNullableTime(preference.NextSendAt)).
+			ExecContext(ctx)
+		return err
+	}, nil))
+}
+
+func (ddb *DigestDB) UpdateDigestPreference(ctx context.Context, preference *model.DigestPreference) error {
+	return translateErr(ddb.sess.TxContext(ctx, func(sess db.Session) error {
+		_, err := sess.SQL().
+			Update("digest_preference").
+			Set("email = ?", preference.Email).
+			Set("frequency = ?", preference.Frequency).
+			Set("next_send_at = ?", formatNullableTime(preference.NextSendAt)).
+			Set("updated_at = CURRENT_TIMESTAMP").
+			Where("user_id = ?", preference.UserId).
+			ExecContext(ctx)
+		return err
+	}, nil))
+}
+
+func (ddb *DigestDB) GetDigestPreference(ctx context.Context, userId string) (*model.DigestPreference, error) {
+	return ddb.getDigestPreference(ctx, "user_id = ?", userId)
+}
+
+func (ddb *DigestDB) GetDigestPreferenceByToken(ctx context.Context, token string) (*model.DigestPreference, error) {
+	return ddb.getDigestPreference(ctx, "unsubscribe_token = ?", token)
+}
+
+func (ddb *DigestDB) getDigestPreference(ctx context.Context, cond string, arg interface{}) (*model.DigestPreference, error) {
+	var preference model.DigestPreference
+	if err := ddb.sess.SQL().
+		SelectFrom("digest_preference").
+		Where(cond, arg).
+		IteratorContext(ctx).
+		One(&preference); err != nil {
+		if err == db.ErrNoMoreRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &preference, nil
+}
+
+func (ddb *DigestDB) GetDueDigests(ctx context.Context, dueAt time.Time, limit int) ([]*model.DigestPreference, error) {
+	preferences := make([]*model.DigestPreference, 0)
+	if err := ddb.sess.SQL().
+		SelectFrom("digest_preference").
+		Where("frequency != ? AND next_send_at <= ?", model.DigestOff, formatTime(&dueAt)).
+		OrderBy("next_send_at", "user_id").
+		Limit(limit).
+		IteratorContext(ctx).
+		All(&preferences); err != nil {
+		return nil, err
+	}
+	return preferences, nil
+}
+
+func (ddb *DigestDB) ClaimDigest(ctx context.Context, userId string, dueAt time.Time, leaseUntil time.Time) (bool, error) {
+	var claimed bool
+	err := ddb.sess.TxContext(ctx, func(sess db.Session) error {
+		res, err := sess.SQL().
+			Update("digest_preference").
+			Set("next_send_at = ?", formatTime(&leaseUntil)).
+			Where("user_id = ? AND frequency != ? AND next_send_at <= ?", userId, model.DigestOff, formatTime(&dueAt)).
+			ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		claimed = affected == 1
+		return err
+	}, nil)
+	return claimed, translateErr(err)
+}
+
+func (ddb *DigestDB) ScheduleDigest(ctx context.Context, userId string, frequency model.DigestFrequency, nextSendAt time.Time, sentAt *time.Time) error {
+	return translateErr(ddb.sess.TxContext(ctx, func(sess db.Session) error {
+		_, err := sess.SQL().
+			Update("digest_preference").
+			Set("next_send_at = ?", formatTime(&nextSendAt)).
+			Set("last_sent_at = COALESCE(?, last_sent_at)", formatNullableTime(sentAt)).
+			Set("updated_at = CURRENT_TIMESTAMP").
+			Where("user_id = ? AND frequency = ?", userId, frequency).
+			ExecContext(ctx)
+		return err
+	}, nil))
+}
@@ -0,0 +1,24 @@
+package sqlite
+
+import (
+	"github.com/mattn/go-sqlite3"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"strings"
+)
+
+// translateErr converts unique constraint violations into appDb.DupKeyErr so callers don't depend on the driver
+func translateErr(err error) error {
+	sqliteErr, ok := err.(sqlite3.Error)
+	if !ok || sqliteErr.Code != sqlite3.ErrConstraint {
+		return err
+	}
+	if sqliteErr.ExtendedCode != sqlite3.ErrConstraintUnique && sqliteErr.ExtendedCode != sqlite3.ErrConstraintPrimaryKey {
+		return err
+	}
+	// messages look like "UNIQUE constraint failed: person.display_name"
+	key := sqliteErr.Error()[strings.LastIndex(sqliteErr.Error(), ":")+1:]
+	if dot := strings.Index(key, "."); dot >= 0 {
+		key = key[dot+1:]
+	}
+	return &appDb.DupKeyErr{Key: strings.TrimSpace(key)}
+}
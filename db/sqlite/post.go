@@ -0,0 +1,635 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/db/internal/flattened"
+	"github.com/navbryce/next-dorm-be/db/internal/images"
+	"github.com/navbryce/next-dorm-be/db/internal/sealed"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/upper/db/v4"
+)
+
+type PostDB struct {
+	sess   db.Session
+	sealer *sealed.Sealer
+}
+
+func getPostDB(sess db.Session, sealer *sealed.Sealer) *PostDB {
+	return &PostDB{sess, sealer}
+}
+
+func (pdb *PostDB) CreatePost(ctx context.Context, post *appDb.CreatePost) (int64, error) {
+	var postId int64
+	err := pdb.sess.TxContext(ctx, func(sess db.Session) error {
+		metadataId, err := insertContentMetadata(ctx, sess, pdb.sealer, post.CreateContentMetadata)
+		if err != nil {
+			return err
+		}
+		res, err := sess.SQL().
+			InsertInto("post").
+			Columns("title", "content", "metadata_id").
+			Values(post.Title, post.Content, metadataId).
+			ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+		postId, err = res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		// the thread is new, so the creator's alias can't collide
+		if len(post.CreatorAlias) > 0 {
+			if err := insertThreadAlias(ctx, sess, pdb.sealer, metadataId, post.CreatorId, post.CreatorAlias); err != nil {
+				return err
+			}
+		}
+		if post.AutomodReport != nil {
+			post.AutomodReport.Target.PostId = &postId
+			if err := insertAutomodReport(ctx, sess, post.AutomodReport); err != nil {
+				return err
+			}
+		}
+
+		if len(post.Communities) == 0 {
+			return nil
+		}
+		batchInserter := sess.SQL().
+			InsertInto("post_communities").
+			Columns("post_id", "community_id").
+			Batch(len(post.Communities))
+		for _, communityId := range post.Communities {
+			batchInserter.Values(postId, communityId)
+		}
+		batchInserter.Done()
+		return batchInserter.Wait()
+	}, nil)
+	return postId, err
+}
+
+// EditPost updates the post. Only updates title or content if they are non-empty.
+func (pdb *PostDB) EditPost(ctx context.Context, id int64, req *appDb.EditPost) error {
+	return pdb.sess.TxContext(ctx, func(sess db.Session) error {
+		var metadataId struct {
+			Id int64 `db:"metadata_id"`
+		}
+		if err := sess.SQL().
+			Select("metadata_id").
+			From("post").
+			Where("id = ?", id).
+			One(&metadataId); err != nil {
+			return err
+		}
+
+		if err := editContentMetadata(ctx, sess, pdb.sealer, metadataId.Id, req.EditContentMetadata); err != nil {
+			return err
+		}
+
+		if len(req.Title) > 0 || len(req.Content) > 0 {
+			updater := sess.SQL().
+				Update("post")
+			if len(req.Title) > 0 {
+				updater = updater.Set("title = ?", req.Title)
+			}
+			if len(req.Content) > 0 {
+				updater = updater.Set("content = ?", req.Content)
+			}
+			if _, err := updater.Where("id = ?", id).ExecContext(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil)
+}
+
+// MarkPostAsDeleted replaces MySQL's UPDATE ... JOIN with one update per table
+func (pdb *PostDB) MarkPostAsDeleted(ctx context.Context, id int64, modLog *model.ModLogEntry) error {
+	return pdb.sess.TxContext(ctx, func(sess db.Session) error {
+		if err := markPostAsDeleted(ctx, sess, id); err != nil {
+			return err
+		}
+		_, err := insertModLogEntry(ctx, sess, modLog)
+		return err
+	}, nil)
+}
+
+func markPostAsDeleted(ctx context.Context, sess db.Session, id int64) error {
+	if _, err := sess.SQL().
+		Update("content_metadata").
+		Set("status = ?", model.StatusDeleted).
+		Set("updated_at = CURRENT_TIMESTAMP").
+		Where("id = (SELECT metadata_id FROM post WHERE id = ?)", id).
+		ExecContext(ctx); err != nil {
+		return err
+	}
+	_, err := sess.SQL().
+		Update("post").
+		Set("content = ?", "").
+		Where("id = ?", id).
+		ExecContext(ctx)
+	return err
+}
+
+func (pdb *PostDB) CreateComment(ctx context.Context, req *appDb.CreateComment) (int64, error) {
+	var commentId int64
+	err := pdb.sess.TxContext(ctx, func(sess db.Session) error {
+		metadataId, err := insertContentMetadata(ctx, sess, pdb.sealer, req.CreateContentMetadata)
+		if err != nil {
+			return err
+		}
+
+		res, err := sess.SQL().
+			InsertInto("comment").
+			Values(metadataId, req.PostMetadataId, req.ParentMetadataId, req.Content).
+			Columns("metadata_id", "root_metadata_id", "parent_metadata_id", "content").
+			ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+		if commentId, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		if req.AutomodReport != nil {
+			req.AutomodReport.Target.CommentId = &commentId
+			if err := insertAutomodReport(ctx, sess, req.AutomodReport); err != nil {
+				return err
+			}
+		}
+
+		_, err = sess.SQL().
+			Update("post").
+			Set("comment_count = comment_count + 1").
+			Where("metadata_id = ?", req.PostMetadataId).
+			ExecContext(ctx)
+		return err
+	}, nil)
+	return commentId, err
+}
+
+// EditComment edits the comment. currently ignores the images params
+func (pdb *PostDB) EditComment(ctx context.Context, id int64, req *appDb.EditComment) error {
+	return pdb.sess.TxContext(ctx, func(sess db.Session) error {
+		var metadataId struct {
+			Id int64 `db:"metadata_id"`
+		}
+		if err := sess.SQL().
+			Select("metadata_id").
+			From("comment").
+			Where("id = ?", id).
+			One(&metadataId); err != nil {
+			return err
+		}
+		if err := editContentMetadata(ctx, sess, pdb.sealer, metadataId.Id, &appDb.EditContentMetadata{
+			Visibility:    req.Visibility,
+			CreatorAlias:  req.CreatorAlias,
+			ModLog:        req.ModLog,
+			Held:          req.Held,
+			AutomodReport: req.AutomodReport,
+		}); err != nil {
+			return err
+		}
+
+		if len(req.Content) > 0 {
+			if _, err := sess.SQL().
+				Update("comment").
+				Set("content = ?", req.Content).
+				Where("id = ?", id).
+				ExecContext(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil)
+}
+
+func (pdb *PostDB) MarkCommentAsDeleted(ctx context.Context, id int64, modLog *model.ModLogEntry) error {
+	return pdb.sess.TxContext(ctx, func(sess db.Session) error {
+		if err := markCommentAsDeleted(ctx, sess, id); err != nil {
+			return err
+		}
+		_, err := insertModLogEntry(ctx, sess, modLog)
+		return err
+	}, nil)
+}
+
+func markCommentAsDeleted(ctx context.Context, sess db.Session, id int64) error {
+	if _, err := sess.SQL().
+		Update("content_metadata").
+		Set("status = ?", model.StatusDeleted).
+		Set("updated_at = CURRENT_TIMESTAMP").
+		Where("id = (SELECT metadata_id FROM comment WHERE id = ?)", id).
+		ExecContext(ctx); err != nil {
+		return err
+	}
+	_, err := sess.SQL().
+		Update("comment").
+		Set("content = ?", "").
+		Where("id = ?", id).
+		ExecContext(ctx)
+	return err
+}
+
+func (pdb *PostDB) SetContentHeld(ctx context.Context, metadataId int64, held bool) error {
+	return pdb.sess.TxContext(ctx, func(sess db.Session) error {
+		_, err := sess.SQL().
+			Update("content_metadata").
+			Set("held = ?, held_on_create = FALSE", held).
+			Where("id = ?", metadataId).
+			ExecContext(ctx)
+		return err
+	}, nil)
+}
+
+func (pdb *PostDB) RemovePostFromCommunity(ctx context.Context, postId int64, communityId int64, modLog *model.ModLogEntry) error {
+	// transactions take the write lock when they begin, so the post's communities can't change in between
+	return pdb.sess.TxContext(ctx, func(sess db.Session) error {
+		var postCommunities []struct {
+			CommunityId int64 `db:"community_id"`
+		}
+		if err := sess.SQL().
+			Select("community_id").
+			From("post_communities").
+			Where("post_id = ?", postId).
+			IteratorContext(ctx).All(&postCommunities); err != nil {
+			return err
+		}
+		found := false
+		for _, pc := range postCommunities {
+			found = found || pc.CommunityId == communityId
+		}
+		if !found {
+			return appDb.ErrNotFound
+		}
+		if len(postCommunities) == 1 {
+			return appDb.ErrLastCommunity
+		}
+		if _, err := sess.SQL().
+			DeleteFrom("post_communities").
+			Where("post_id = ? AND community_id = ?", postId, communityId).
+			ExecContext(ctx); err != nil {
+			return err
+		}
+		_, err := insertModLogEntry(ctx, sess, modLog)
+		return err
+	}, nil)
+}
+
+func insertContentMetadata(ctx context.Context, sess db.Session, sealer *sealed.Sealer, metadata *appDb.CreateContentMetadata) (int64, error) {
+	creator, err := sealer.Creator(metadata.CreatorId, metadata.Visibility)
+	if err != nil {
+		return 0, err
+	}
+	res, err := sess.SQL().
+		InsertInto("content_metadata").
+		Columns("creator_id", "creator_id_enc", "creator_id_hash", "creator_alias", "visibility", "held", "held_on_create").
+		Values(creator.Id, creator.Enc, creator.Hash, metadata.CreatorAlias, metadata.Visibility, metadata.Held, metadata.Held).
+		ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, images.InsertForContent(ctx, sess, id, metadata.Images)
+}
+
+// editContentMetadata replaces MySQL's JSON_CONTAINS image removal with a plain IN list
+func editContentMetadata(ctx context.Context, sess db.Session, sealer *sealed.Sealer, metadataId int64, req *appDb.EditContentMetadata) error {
+	if len(req.ImageBlobNamesToRemove) > 0 {
+		if _, err := sess.SQL().
+			DeleteFrom("content_image").
+			Where("metadata_id = ? AND image_id IN (SELECT id FROM image WHERE blob_name IN ?)",
+				metadataId, req.ImageBlobNamesToRemove).
+			ExecContext(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := images.InsertForContent(ctx, sess, metadataId, req.ImagesToAdd); err != nil {
+		return err
+	}
+
+	// the creator is (un)sealed when the visibility changes
+	creatorId, err := sealer.CurrentCreator(ctx, sess, metadataId)
+	if err != nil {
+		return err
+	}
+	creator, err := sealer.Creator(creatorId, req.Visibility)
+	if err != nil {
+		return err
+	}
+	updater := sess.SQL().
+		Update("content_metadata").
+		Set("visibility = ?", req.Visibility).
+		Set("creator_id = ?", creator.Id).
+		Set("creator_id_enc = ?", creator.Enc).
+		Set("creator_id_hash = ?", creator.Hash).
+		Set("updated_at = CURRENT_TIMESTAMP")
+	if len(req.CreatorAlias) > 0 {
+		updater = updater.Set("creator_alias = ?", req.CreatorAlias)
+	}
+	if req.Held {
+		updater = updater.Set("held = TRUE")
+	}
+	if _, err := updater.Where("id = ?", metadataId).
+		ExecContext(ctx); err != nil {
+		return err
+	}
+	if err := insertAutomodReport(ctx, sess, req.AutomodReport); err != nil {
+		return err
+	}
+	_, err = insertModLogEntry(ctx, sess, req.ModLog)
+	return err
+}
+
+var contentMetadataColumns = []interface{}{
+	"cm.id as metadata_id",
+	"cm.creator_id",
+	"cm.creator_id_enc",
+	db.Raw("COALESCE(person.display_name, '') AS display_name"),
+	"cm.creator_alias",
+	"cm.num_votes",
+	"cm.vote_total",
+	"cm.visibility",
+	"cm.status",
+	"cm.held",
+	"cm.held_on_create",
+	"cm.created_at",
+	"cm.updated_at",
+	// correlated subqueries instead of MySQL's JSON_ARRAYAGG over joins, so multiple images don't repeat communities
+	db.Raw(`(SELECT json_group_array(image.blob_name) FROM content_image AS ci
+		JOIN image ON ci.image_id = image.id
+		WHERE ci.metadata_id = cm.id) AS image_blob_names`),
+}
+
+var postColumns = append(append([]interface{}{}, contentMetadataColumns...),
+	"p.id",
+	"p.title",
+	"p.content",
+	"p.comment_count",
+	// each community is one object, so its id and name can't come apart
+	db.Raw(`(SELECT json_group_array(json_object('id', pc.community_id, 'name', c.name)) FROM post_communities AS pc
+		JOIN community AS c ON pc.community_id = c.id
+		WHERE pc.post_id = p.id) AS communities`),
+	"v.value",
+)
+
+var commentColumns = append([]interface{}{
+	"c.id",
+	"c.metadata_id",
+	"c.root_metadata_id",
+	"c.parent_metadata_id",
+	"c.content",
+}, contentMetadataColumns...)
+
+var commentWithVoteColumns = append(append([]interface{}{}, commentColumns...), "v.value")
+
+func (pdb *PostDB) GetPostById(ctx context.Context, id int64, opts *appDb.PostQueryOpts) (*model.Post, error) {
+	var post flattened.Post
+	if err := pdb.sess.SQL().
+		Select(postColumns...).
+		From("post AS p").
+		Join("content_metadata as cm").On("p.metadata_id = cm.id").
+		LeftJoin("vote as v").On("v.voter_id = ? AND cm.id = v.tgt_metadata_id", opts.VoteHistoryOf).
+		LeftJoin("person").On("cm.creator_id = person.firebase_id").
+		Where("p.id = ?", id).
+		IteratorContext(ctx).
+		One(&post); err != nil {
+		if err == db.ErrNoMoreRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := pdb.sealer.OpenCreators(ctx, pdb.sess, []*flattened.ContentAuthor{&post.Creator}); err != nil {
+		return nil, err
+	}
+	built, err := flattened.BuildPost(&post)
+	if err != nil {
+		return nil, err
+	}
+	if err := images.AttachTo(ctx, pdb.sess, []*model.ContentMetadata{built.ContentMetadata}); err != nil {
+		return nil, err
+	}
+	return built, nil
+}
+
+func (pdb *PostDB) GetPosts(ctx context.Context, query *appDb.PostsListQuery) ([]*model.Post, error) {
+	if query.CommunityIds != nil && len(query.CommunityIds) == 0 {
+		return []*model.Post{}, nil
+	}
+
+	// times are bound as strings in the CURRENT_TIMESTAMP format. see formatTime
+	conds := []*db.RawExpr{db.Raw("1 = 1")}
+	var orderBy []interface{}
+	if query.PageByVote != nil {
+		orderBy = []interface{}{"cm.vote_total DESC", "cm.id DESC"}
+		if query.PageByVote.Since != nil {
+			conds = append(conds, db.Raw("(cm.created_at > ?)", formatTime(query.PageByVote.Since)))
+		}
+		if query.PageByVote.MaxUpvotes != nil {
+			conds = append(conds,
+				db.Raw("(cm.vote_total < ? OR (cm.vote_total = ? AND (? = '' OR p.id < ?)))",
+					query.PageByVote.MaxUpvotes.Val, query.PageByVote.MaxUpvotes.Val, query.PageByVote.LastId, query.PageByVote.LastId),
+			)
+		}
+	} else if query.PageByDate != nil {
+		orderBy = []interface{}{"cm.created_at DESC", "cm.id DESC"}
+		if query.PageByDate.From != nil {
+			from := formatTime(query.PageByDate.From)
+			conds = append(conds,
+				db.Raw("(cm.created_at < ? OR (cm.created_at = ? AND (? = '' OR p.id < ?)))",
+					from, from, query.PageByDate.LastId, query.PageByDate.LastId),
+			)
+		}
+	} else {
+		panic("must provide a paging option")
+	}
+	if query.CommunityIds != nil {
+		conds = append(conds, db.Raw(
+			"(EXISTS (SELECT 1 FROM post_communities AS pc WHERE pc.post_id = p.id AND pc.community_id IN ?))",
+			query.CommunityIds))
+	}
+
+	if query.ByUser != nil {
+		conds = append(conds, db.Raw("(cm.creator_id = ? OR cm.creator_id_hash = ?)",
+			query.ByUser.Id, pdb.sealer.UserKey(query.ByUser.Id)))
+	}
+
+	if query.Visibility != nil {
+		conds = append(conds, db.Raw("(cm.visibility = ?)", *query.Visibility))
+	}
+
+	if !query.IncludeDeleted {
+		conds = append(conds, db.Raw("(cm.status != 'DELETED')"))
+	}
+	if !query.IncludeHeld {
+		conds = append(conds, db.Raw("(cm.held = FALSE)"))
+	}
+
+	var flattenedPosts []flattened.Post
+	if err := pdb.sess.SQL().
+		Select(postColumns...).
+		From("post AS p").
+		Join("content_metadata as cm").On("p.metadata_id = cm.id").
+		LeftJoin("vote as v").On("v.voter_id = ? AND cm.id = v.tgt_metadata_id", query.VoteHistoryOf).
+		LeftJoin("person").On("cm.creator_id = person.firebase_id").
+		Where(convertDbRawToInterface(conds...)...).
+		OrderBy(orderBy...).
+		Limit(int(query.Limit)).
+		IteratorContext(ctx).
+		All(&flattenedPosts); err != nil {
+		return nil, err
+	}
+	authors := make([]*flattened.ContentAuthor, len(flattenedPosts))
+	for i := range flattenedPosts {
+		authors[i] = &flattenedPosts[i].Creator
+	}
+	if err := pdb.sealer.OpenCreators(ctx, pdb.sess, authors); err != nil {
+		return nil, err
+	}
+	posts := make([]*model.Post, len(flattenedPosts))
+	metadata := make([]*model.ContentMetadata, len(flattenedPosts))
+	for i, flattenedPost := range flattenedPosts {
+		post, err := flattened.BuildPost(&flattenedPost)
+		if err != nil {
+			return nil, err
+		}
+		posts[i] = post
+		metadata[i] = post.ContentMetadata
+	}
+	if err := images.AttachTo(ctx, pdb.sess, metadata); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (pdb *PostDB) GetCommentById(ctx context.Context, id int64) (*model.Comment, error) {
+	var comment flattened.Comment
+	if err := pdb.sess.SQL().
+		Select(commentColumns...).
+		From("comment as c").
+		Join("content_metadata as cm").On("c.metadata_id = cm.id").
+		LeftJoin("person").On("cm.creator_id = person.firebase_id").
+		Where("c.id = ?", id).
+		IteratorContext(ctx).
+		One(&comment); err != nil {
+		if err == db.ErrNoMoreRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := pdb.sealer.OpenCreators(ctx, pdb.sess, []*flattened.ContentAuthor{&comment.Creator}); err != nil {
+		return nil, err
+	}
+	return flattened.BuildComment(&comment)
+}
+
+func (pdb *PostDB) GetCommentForest(ctx context.Context, rootMetadataId int64, opts *appDb.CommentTreeQueryOpts) ([]*model.CommentTree, error) {
+	var flattenedComments []flattened.Comment
+	if err := pdb.sess.SQL().
+		Select(commentWithVoteColumns...).
+		From("comment as c").
+		Join("content_metadata as cm").On("c.metadata_id = cm.id").
+		LeftJoin("vote as v").On("v.voter_id = ? AND cm.id = v.tgt_metadata_id", opts.VoteHistoryOf).
+		LeftJoin("person").On("cm.creator_id = person.firebase_id").
+		Where("c.root_metadata_id = ?", rootMetadataId).
+		OrderBy("cm.created_at", "cm.id").
+		IteratorContext(ctx).
+		All(&flattenedComments); err != nil {
+		return nil, err
+	}
+
+	authors := make([]*flattened.ContentAuthor, len(flattenedComments))
+	for i := range flattenedComments {
+		authors[i] = &flattenedComments[i].Creator
+	}
+	if err := pdb.sealer.OpenCreators(ctx, pdb.sess, authors); err != nil {
+		return nil, err
+	}
+	comments := make([]*model.Comment, len(flattenedComments))
+	for i, flattenedComment := range flattenedComments {
+		comment, err := flattened.BuildComment(&flattenedComment)
+		if err != nil {
+			return nil, err
+		}
+		comments[i] = comment
+	}
+
+	return model.BuildCommentForest(rootMetadataId, comments), nil
+}
+
+// Vote relies on transactions beginning IMMEDIATE (see GetDatabase) in place of SELECT ... FOR UPDATE: the write
+// lock is held from the first read
+func (pdb *PostDB) Vote(ctx context.Context, userId string, targetMetadataId int64, value int8) error {
+	return pdb.sess.TxContext(ctx, func(sess db.Session) error {
+		row, err := sess.SQL().QueryRowContext(ctx, `SELECT value FROM vote WHERE tgt_metadata_id = ? AND voter_id = ?`,
+			targetMetadataId, userId)
+		if err != nil {
+			return err
+		}
+		var previousVoteValue int8
+		if err := row.Scan(&previousVoteValue); err != nil {
+			if err != sql.ErrNoRows {
+				return err
+			}
+		}
+
+		netVoteChange := value
+		var numVotesChange int8
+		if previousVoteValue != 0 {
+			netVoteChange -= previousVoteValue
+
+			// the previous vote value is the same as the new vote value
+			if netVoteChange == 0 {
+				return nil
+			}
+
+			if value == 0 {
+				// delete old vote
+				if _, err := sess.SQL().
+					DeleteFrom("vote").
+					Where("tgt_metadata_id = ? AND voter_id = ?", targetMetadataId, userId).
+					ExecContext(ctx); err != nil {
+					return err
+				}
+				numVotesChange -= 1
+			} else {
+				// update existing vote
+				if _, err := sess.SQL().
+					Update("vote").
+					Set("value", value).
+					Where("tgt_metadata_id = ? AND voter_id = ?", targetMetadataId, userId).
+					ExecContext(ctx); err != nil {
+					return err
+				}
+			}
+		} else if value == 0 {
+			return nil
+		} else {
+			// insert new vote
+			if _, err := sess.SQL().
+				InsertInto("vote").
+				Columns("voter_id", "tgt_metadata_id", "value").
+				Values(userId, targetMetadataId, value).
+				ExecContext(ctx); err != nil {
+				return err
+			}
+			numVotesChange += 1
+		}
+
+		_, err = sess.SQL().
+			Update("content_metadata").
+			Set("vote_total = vote_total + ?, num_votes = num_votes + ?", netVoteChange, numVotesChange).
+			Set("updated_at = CURRENT_TIMESTAMP").
+			Where("id = ?", targetMetadataId).
+			ExecContext(ctx)
+		return err
+	}, nil)
+}
+
+func (pdb *PostDB) GetLiveImageBlobNames(ctx context.Context) ([]string, error) {
+	return images.LiveBlobNames(ctx, pdb.sess)
+}
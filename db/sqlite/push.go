@@ -0,0 +1,83 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/upper/db/v4"
+)
+
+type PushDB struct {
+	sess db.Session
+}
+
+func getPushDB(sess db.Session) *PushDB {
+	return &PushDB{sess}
+}
+
+func (pdb *PushDB) SavePushSubscription(ctx context.Context, subscription *model.PushSubscription) error {
+	return translateErr(pdb.sess.TxContext(ctx, func(sess db.Session) error {
+		if _, err := sess.SQL().ExecContext(ctx, `INSERT INTO push_subscription (user_id, endpoint, endpoint_hash, p256dh, auth)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (endpoint_hash) DO UPDATE SET user_id = excluded.user_id, p256dh = excluded.p256dh, auth = excluded.auth,
+		updated_at = CURRENT_TIMESTAMP`,
+			subscription.UserId, subscription.Endpoint, subscription.EndpointHash, subscription.P256dh,
+			subscription.Auth); err != nil {
+			return err
+		}
+		// the id of an updated row isn't reported, so it's read back
+		row, err := sess.SQL().QueryRowContext(ctx, `SELECT id FROM push_subscription WHERE endpoint_hash = ?`,
+			subscription.EndpointHash)
+		if err != nil {
+			return err
+		}
+		return row.Scan(&subscription.Id)
+	}, nil))
+}
+
+func (pdb *PushDB) DeletePushSubscription(ctx context.Context, userId string, endpointHash string) error {
+	return translateErr(pdb.sess.TxContext(ctx, func(sess db.Session) error {
+		_, err := sess.SQL().
+			DeleteFrom("push_subscription").
+			Where("user_id = ? AND endpoint_hash = ?", userId, endpointHash).
+			ExecContext(ctx)
+		return err
+	}, nil))
+}
+
+func (pdb *PushDB) DeletePushSubscriptionById(ctx context.Context, id int64) error {
+	return translateErr(pdb.sess.TxContext(ctx, func(sess db.Session) error {
+		_, err := sess.SQL().
+			DeleteFrom("push_subscription").
+			Where("id = ?", id).
+			ExecContext(ctx)
+		return err
+	}, nil))
+}
+
+func (pdb *PushDB) GetPushSubscriptions(ctx context.Context, userIds []string) ([]*model.PushSubscription, error) {
+	subscriptions := make([]*model.PushSubscription, 0)
+	if len(userIds) == 0 {
+		return subscriptions, nil
+	}
+	err := pdb.sess.SQL().
+		SelectFrom("push_subscription").
+		Where("user_id IN ?", userIds).
+		OrderBy("id").
+		IteratorContext(ctx).
+		All(&subscriptions)
+	return subscriptions, err
+}
+
+func (pdb *PushDB) GetCommunityPushSubscriptions(ctx context.Context, communityId int64, afterId int64, limit int) ([]*model.PushSubscription, error) {
+	subscriptions := make([]*model.PushSubscription, 0)
+	err := pdb.sess.SQL().
+		Select("ps.*").
+		From("push_subscription AS ps").
+		Join("subscription AS s").On("s.user_id = ps.user_id").
+		Where("s.community_id = ? AND ps.id > ?", communityId, afterId).
+		OrderBy("ps.id").
+		Limit(limit).
+		IteratorContext(ctx).
+		All(&subscriptions)
+	return subscriptions, err
+}
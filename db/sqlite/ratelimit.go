@@ -0,0 +1,70 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/upper/db/v4"
+	"time"
+)
+
+type RateLimitDB struct {
+	sess db.Session
+}
+
+func getRateLimitDB(sess db.Session) *RateLimitDB {
+	return &RateLimitDB{sess}
+}
+
+func (rdb *RateLimitDB) UpdateRateLimitBuckets(ctx context.Context, keys []string, update func([]*model.RateLimitBucket) []*model.RateLimitBucket) error {
+	// transactions take the write lock when they begin (_txlock=immediate), so nothing else touches the buckets
+	return translateErr(rdb.sess.TxContext(ctx, func(sess db.Session) error {
+		buckets := make([]*model.RateLimitBucket, len(keys))
+		for i, key := range keys {
+			bucket, err := getRateLimitBucket(ctx, sess, key)
+			if err != nil {
+				return err
+			}
+			buckets[i] = bucket
+		}
+
+		for i, bucket := range update(buckets) {
+			_, err := sess.SQL().ExecContext(ctx, `INSERT INTO rate_limit_bucket (bucket_key, tokens, updated_at_ms)
+	VALUES (?, ?, ?)
+	ON CONFLICT (bucket_key) DO UPDATE SET tokens = excluded.tokens, updated_at_ms = excluded.updated_at_ms`,
+				keys[i], bucket.Tokens, bucket.UpdatedAt.UnixMilli())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil))
+}
+
+// getRateLimitBucket returns the bucket of the key, or nil if there isn't one
+func getRateLimitBucket(ctx context.Context, sess db.Session, key string) (*model.RateLimitBucket, error) {
+	row, err := sess.SQL().QueryRowContext(ctx, `SELECT tokens, updated_at_ms FROM rate_limit_bucket WHERE bucket_key = ?`,
+		key)
+	if err != nil {
+		return nil, err
+	}
+	var tokens float64
+	var updatedAtMs int64
+	if err := row.Scan(&tokens, &updatedAtMs); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &model.RateLimitBucket{Tokens: tokens, UpdatedAt: time.UnixMilli(updatedAtMs)}, nil
+}
+
+func (rdb *RateLimitDB) DeleteRateLimitBuckets(ctx context.Context, updatedBefore time.Time) error {
+	return translateErr(rdb.sess.TxContext(ctx, func(sess db.Session) error {
+		_, err := sess.SQL().
+			DeleteFrom("rate_limit_bucket").
+			Where("updated_at_ms < ?", updatedBefore.UnixMilli()).
+			ExecContext(ctx)
+		return err
+	}, nil))
+}
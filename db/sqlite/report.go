@@ -0,0 +1,211 @@
+package sqlite
+
+import (
+	"context"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/upper/db/v4"
+)
+
+var reportGroupColumns = []interface{}{
+	"id", "target_type", "post_id", "comment_id", "user_id", "community_id", "status", "num_reports", "resolved_by",
+	"resolved_at", "resolution", "created_at", "last_reported_at",
+}
+
+type ReportDB struct {
+	sess db.Session
+}
+
+func getReportDB(sess db.Session) *ReportDB {
+	return &ReportDB{sess}
+}
+
+func (rdb *ReportDB) CreateReport(ctx context.Context, reporterId string, req *appDb.CreateReport) (*model.Report, error) {
+	var report *model.Report
+	err := rdb.sess.TxContext(ctx, func(sess db.Session) error {
+		var err error
+		report, err = insertReport(ctx, sess, reporterId, req)
+		return err
+	}, nil)
+	if err != nil {
+		return nil, translateErr(err)
+	}
+	return report, nil
+}
+
+func insertReport(ctx context.Context, sess db.Session, reporterId string, req *appDb.CreateReport) (*model.Report, error) {
+	report := &model.Report{ReporterId: reporterId, Reason: req.Reason}
+	var group model.ReportGroup
+	err := sess.SQL().
+		Select("id").
+		From("report_group").
+		Where("open_key = ?", req.Target.Key()).
+		IteratorContext(ctx).
+		One(&group)
+	switch err {
+	case nil:
+		report.GroupId = group.Id
+	case db.ErrNoMoreRows:
+		res, err := sess.SQL().
+			InsertInto("report_group").
+			Columns("target_type", "post_id", "comment_id", "user_id", "community_id", "open_key").
+			Values(req.Target.Type, req.Target.PostId, req.Target.CommentId, req.Target.UserId,
+				req.Target.CommunityId, req.Target.Key()).
+			ExecContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if report.GroupId, err = res.LastInsertId(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	res, err := sess.SQL().
+		InsertInto("report").
+		Columns("group_id", "creator_id", "reason").
+		Values(report.GroupId, reporterId, req.Reason).
+		ExecContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if report.Id, err = res.LastInsertId(); err != nil {
+		return nil, err
+	}
+	if _, err := sess.SQL().
+		Update("report_group").
+		Set("num_reports = num_reports + 1, last_reported_at = CURRENT_TIMESTAMP").
+		Where("id = ?", report.GroupId).
+		ExecContext(ctx); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// insertAutomodReport reports the content as automod, unless automod already reported it in its open group. Does
+// nothing if req is nil
+func insertAutomodReport(ctx context.Context, sess db.Session, req *appDb.CreateReport) error {
+	if req == nil {
+		return nil
+	}
+	var reported struct {
+		Id int64 `db:"id"`
+	}
+	err := sess.SQL().
+		Select("r.id").
+		From("report AS r").
+		Join("report_group AS rg").On("r.group_id = rg.id").
+		Where("rg.open_key = ? AND r.creator_id = ?", req.Target.Key(), model.AutomodReporterId).
+		IteratorContext(ctx).
+		One(&reported)
+	switch err {
+	case nil:
+		return nil
+	case db.ErrNoMoreRows:
+		_, err = insertReport(ctx, sess, model.AutomodReporterId, req)
+		return err
+	default:
+		return err
+	}
+}
+
+func (rdb *ReportDB) GetReportGroup(ctx context.Context, id int64) (*model.ReportGroup, error) {
+	var group model.ReportGroup
+	if err := rdb.sess.SQL().
+		Select(reportGroupColumns...).
+		From("report_group").
+		Where("id = ?", id).
+		IteratorContext(ctx).
+		One(&group); err != nil {
+		if err == db.ErrNoMoreRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (rdb *ReportDB) GetReportGroups(ctx context.Context, query *appDb.ReportGroupsQuery) ([]*model.ReportGroup, error) {
+	selector := rdb.sess.SQL().
+		Select(reportGroupColumns...).
+		From("report_group").
+		Where("(? = '' OR status = ?)", query.Status, query.Status).
+		And("(? = '' OR target_type = ?)", query.TargetType, query.TargetType).
+		And("(? = 0 OR id < ?)", query.BeforeId, query.BeforeId)
+	if query.CommunityIds != nil {
+		if len(query.CommunityIds) == 0 {
+			return []*model.ReportGroup{}, nil
+		}
+		selector = selector.And(db.Raw(
+			"(community_id IN ? OR EXISTS (SELECT 1 FROM post_communities AS pc WHERE pc.post_id = report_group.post_id AND pc.community_id IN ?))",
+			query.CommunityIds, query.CommunityIds))
+	}
+	groups := make([]*model.ReportGroup, 0)
+	err := selector.
+		OrderBy("id DESC").
+		Limit(query.Limit).
+		IteratorContext(ctx).
+		All(&groups)
+	return groups, err
+}
+
+func (rdb *ReportDB) GetReports(ctx context.Context, groupId int64) ([]*model.Report, error) {
+	reports := make([]*model.Report, 0)
+	err := rdb.sess.SQL().
+		Select("id", "group_id", "creator_id", "reason", "created_at").
+		From("report").
+		Where("group_id = ?", groupId).
+		OrderBy("id").
+		IteratorContext(ctx).
+		All(&reports)
+	return reports, err
+}
+
+func (rdb *ReportDB) ResolveReportGroup(ctx context.Context, id int64, req *appDb.ResolveReportGroup) error {
+	return translateErr(rdb.sess.TxContext(ctx, func(sess db.Session) error {
+		res, err := sess.SQL().
+			Update("report_group").
+			Set("status = ?", req.Status).
+			Set("open_key = NULL").
+			Set("resolved_by = ?", req.ResolvedBy).
+			Set("resolved_at = CURRENT_TIMESTAMP").
+			Set("resolution = ?", req.Resolution).
+			Where("id = ? AND status = ?", id, model.ReportStatusOpen).
+			ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+		if affected, err := res.RowsAffected(); err != nil {
+			return err
+		} else if affected == 0 {
+			return appDb.ErrNotFound
+		}
+		// the group is claimed by the update above, so a concurrent resolution takes none of the actions
+		if req.Remove != nil {
+			if req.Remove.CommentId != nil {
+				err = markCommentAsDeleted(ctx, sess, *req.Remove.CommentId)
+			} else {
+				err = markPostAsDeleted(ctx, sess, req.Remove.PostId)
+			}
+			if err != nil {
+				return err
+			}
+			if _, err := insertModLogEntry(ctx, sess, req.Remove.ModLog); err != nil {
+				return err
+			}
+		}
+		if req.Reveal != nil {
+			if req.Reveal.Reveal.Id, err = insertReveal(ctx, sess, req.Reveal.Reveal, req.Reveal.ModLog); err != nil {
+				return err
+			}
+		}
+		if req.Ban != nil {
+			if req.Ban.Ban.Id, err = insertBan(ctx, sess, req.Ban.Ban, req.Ban.ModLog); err != nil {
+				return err
+			}
+		}
+		_, err = insertModLogEntry(ctx, sess, req.ModLog)
+		return err
+	}, nil))
+}
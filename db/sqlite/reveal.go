@@ -0,0 +1,62 @@
+package sqlite
+
+import (
+	"context"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/upper/db/v4"
+)
+
+type RevealDB struct {
+	sess db.Session
+}
+
+func getRevealDB(sess db.Session) *RevealDB {
+	return &RevealDB{sess}
+}
+
+func (rdb *RevealDB) CreateReveal(ctx context.Context, reveal *model.Reveal, modLog *model.ModLogEntry) (int64, error) {
+	var revealId int64
+	err := rdb.sess.TxContext(ctx, func(sess db.Session) error {
+		var err error
+		revealId, err = insertReveal(ctx, sess, reveal, modLog)
+		return err
+	}, nil)
+	return revealId, translateErr(err)
+}
+
+// insertReveal records the reveal, and the entry with the reveal as its target
+func insertReveal(ctx context.Context, sess db.Session, reveal *model.Reveal, modLog *model.ModLogEntry) (int64, error) {
+	res, err := sess.SQL().
+		InsertInto("reveal_audit").
+		Columns("admin_id", "post_id", "comment_id", "reason").
+		Values(reveal.AdminId, reveal.PostId, reveal.CommentId, reveal.Reason).
+		ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	revealId, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if modLog != nil {
+		modLog.TargetId = &revealId
+	}
+	_, err = insertModLogEntry(ctx, sess, modLog)
+	return revealId, err
+}
+
+func (rdb *RevealDB) GetReveals(ctx context.Context, query *appDb.RevealsQuery) ([]*model.Reveal, error) {
+	reveals := make([]*model.Reveal, 0)
+	err := rdb.sess.SQL().
+		Select("*").
+		From("reveal_audit").
+		Where("(? = '' OR admin_id = ?)", query.AdminId, query.AdminId).
+		And("(? = 0 OR post_id = ?)", query.PostId, query.PostId).
+		And("(? = 0 OR id < ?)", query.BeforeId, query.BeforeId).
+		OrderBy("id DESC").
+		Limit(query.Limit).
+		IteratorContext(ctx).
+		All(&reveals)
+	return reveals, err
+}
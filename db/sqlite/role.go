@@ -0,0 +1,70 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/upper/db/v4"
+)
+
+type RoleDB struct {
+	sess db.Session
+}
+
+func getRoleDB(sess db.Session) *RoleDB {
+	return &RoleDB{sess}
+}
+
+func (rdb *RoleDB) GrantRole(ctx context.Context, grant *model.RoleGrant, modLog *model.ModLogEntry) error {
+	return translateErr(rdb.sess.TxContext(ctx, func(sess db.Session) error {
+		if err := deleteRole(ctx, sess, grant.UserId, grant.CommunityId); err != nil {
+			return err
+		}
+		if _, err := sess.SQL().
+			InsertInto("community_role").
+			Columns("user_id", "community_id", "role", "granted_by").
+			Values(grant.UserId, grant.CommunityId, grant.Role, grant.GrantedBy).
+			ExecContext(ctx); err != nil {
+			return err
+		}
+		_, err := insertModLogEntry(ctx, sess, modLog)
+		return err
+	}, nil))
+}
+
+func (rdb *RoleDB) RevokeRole(ctx context.Context, userId string, communityId int64, modLog *model.ModLogEntry) error {
+	return translateErr(rdb.sess.TxContext(ctx, func(sess db.Session) error {
+		if err := deleteRole(ctx, sess, userId, communityId); err != nil {
+			return err
+		}
+		_, err := insertModLogEntry(ctx, sess, modLog)
+		return err
+	}, nil))
+}
+
+func (rdb *RoleDB) GetRolesForUser(ctx context.Context, userId string) ([]*model.RoleGrant, error) {
+	return getRoles(ctx, rdb.sess, db.Cond{"user_id": userId})
+}
+
+func (rdb *RoleDB) GetRolesInCommunity(ctx context.Context, communityId int64) ([]*model.RoleGrant, error) {
+	return getRoles(ctx, rdb.sess, db.Cond{"community_id": communityId})
+}
+
+func deleteRole(ctx context.Context, sess db.Session, userId string, communityId int64) error {
+	_, err := sess.SQL().
+		DeleteFrom("community_role").
+		Where("user_id = ? AND community_id = ?", userId, communityId).
+		ExecContext(ctx)
+	return err
+}
+
+func getRoles(ctx context.Context, sess db.Session, cond db.Cond) ([]*model.RoleGrant, error) {
+	grants := make([]*model.RoleGrant, 0)
+	err := sess.SQL().
+		Select("*").
+		From("community_role").
+		Where(cond).
+		OrderBy("created_at").
+		IteratorContext(ctx).
+		All(&grants)
+	return grants, err
+}
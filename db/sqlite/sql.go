@@ -0,0 +1,29 @@
+package sqlite
+
+import (
+	"github.com/upper/db/v4"
+	"time"
+)
+
+// timeFormat matches how CURRENT_TIMESTAMP is stored so times can be compared as strings
+const timeFormat = "2006-01-02 15:04:05"
+
+func formatTime(t *time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+// formatNullableTime is formatTime for nullable columns
+func formatNullableTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return formatTime(t)
+}
+
+func convertDbRawToInterface(expr ...*db.RawExpr) []interface{} {
+	output := make([]interface{}, len(expr))
+	for i, rawExpr := range expr {
+		output[i] = interface{}(rawExpr)
+	}
+	return output
+}
@@ -0,0 +1,40 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/upper/db/v4"
+)
+
+type SubscriptionDB struct {
+	sess db.Session
+}
+
+func getSubscriptionDB(sess db.Session) *SubscriptionDB {
+	return &SubscriptionDB{sess}
+}
+
+func (sdb *SubscriptionDB) CreateSubForUser(ctx context.Context, sub *model.Subscription) error {
+	return translateErr(sdb.sess.TxContext(ctx, func(sess db.Session) error {
+		_, err := sess.Collection("subscription").Insert(sub)
+		return err
+	}, nil))
+}
+
+func (sdb *SubscriptionDB) DeleteSubForUser(ctx context.Context, sub *model.Subscription) error {
+	return sdb.sess.TxContext(ctx, func(sess db.Session) error {
+		return sess.Collection("subscription").
+			Find("user_id = ? AND community_id = ?", sub.UserId, sub.CommunityId).
+			Delete()
+	}, nil)
+}
+
+func (sdb *SubscriptionDB) GetSubsForUser(ctx context.Context, userId string) ([]*model.Subscription, error) {
+	var subs []*model.Subscription
+	err := sdb.sess.WithContext(ctx).
+		Collection("subscription").
+		Find("user_id = ?", userId).
+		OrderBy("community_id").
+		All(&subs)
+	return subs, err
+}
@@ -0,0 +1,75 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/upper/db/v4"
+	"time"
+)
+
+type UserDB struct {
+	sess db.Session
+}
+
+func getUserDB(sess db.Session) *UserDB {
+	return &UserDB{sess}
+}
+
+func (udb *UserDB) CreateUser(ctx context.Context, user *model.LocalUser) error {
+	if user.CreatedAt == nil {
+		now := time.Now().UTC()
+		user.CreatedAt = &now
+	}
+	return translateErr(udb.sess.TxContext(ctx, func(sess db.Session) error {
+		_, err := sess.Collection("person").Insert(user)
+		return err
+	}, nil))
+}
+
+func (udb *UserDB) GetUser(ctx context.Context, id string) (*model.LocalUser, error) {
+	var user model.LocalUser
+	if err := udb.sess.SQL().
+		Select("*").
+		From("person").
+		Where("firebase_id = ?", id).
+		IteratorContext(ctx).
+		One(&user); err != nil {
+		if err == db.ErrNoMoreRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (udb *UserDB) GetUserIds(ctx context.Context) ([]string, error) {
+	var people []*model.LocalUser
+	if err := udb.sess.SQL().
+		Select("firebase_id").
+		From("person").
+		IteratorContext(ctx).
+		All(&people); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(people))
+	for i, person := range people {
+		ids[i] = person.Id
+	}
+	return ids, nil
+}
+
+func (udb *UserDB) GetUsersByDisplayNames(ctx context.Context, displayNames []string) ([]*model.LocalUser, error) {
+	people := make([]*model.LocalUser, 0)
+	if len(displayNames) == 0 {
+		return people, nil
+	}
+	if err := udb.sess.SQL().
+		Select("*").
+		From("person").
+		Where("display_name IN ?", displayNames).
+		IteratorContext(ctx).
+		All(&people); err != nil {
+		return nil, err
+	}
+	return people, nil
+}
@@ -0,0 +1,217 @@
+package sqlite
+
+import (
+	"context"
+	appDb "github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/upper/db/v4"
+	"time"
+)
+
+type WebhookDB struct {
+	sess db.Session
+}
+
+func getWebhookDB(sess db.Session) *WebhookDB {
+	return &WebhookDB{sess}
+}
+
+func (wdb *WebhookDB) CreateWebhook(ctx context.Context, webhook *model.Webhook, modLog *model.ModLogEntry) (int64, error) {
+	var webhookId int64
+	err := wdb.sess.TxContext(ctx, func(sess db.Session) error {
+		res, err := sess.SQL().
+			InsertInto("webhook").
+			Columns("community_id", "url", "secret", "events", "active", "created_by").
+			Values(webhook.CommunityId, webhook.URL, webhook.Secret, webhook.Events, webhook.Active, webhook.CreatedBy).
+			ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+		if webhookId, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		if modLog != nil {
+			modLog.TargetId = &webhookId
+		}
+		_, err = insertModLogEntry(ctx, sess, modLog)
+		return err
+	}, nil)
+	return webhookId, translateErr(err)
+}
+
+func (wdb *WebhookDB) UpdateWebhook(ctx context.Context, webhook *model.Webhook, modLog *model.ModLogEntry) error {
+	return translateErr(wdb.sess.TxContext(ctx, func(sess db.Session) error {
+		if _, err := sess.SQL().
+			Update("webhook").
+			Set("url = ?", webhook.URL).
+			Set("events = ?", webhook.Events).
+			Set("active = ?", webhook.Active).
+			Set("updated_at = CURRENT_TIMESTAMP").
+			Where("id = ?", webhook.Id).
+			ExecContext(ctx); err != nil {
+			return err
+		}
+		_, err := insertModLogEntry(ctx, sess, modLog)
+		return err
+	}, nil))
+}
+
+func (wdb *WebhookDB) DeleteWebhook(ctx context.Context, id int64, modLog *model.ModLogEntry) error {
+	return translateErr(wdb.sess.TxContext(ctx, func(sess db.Session) error {
+		if _, err := sess.SQL().
+			DeleteFrom("webhook_delivery").
+			Where("webhook_id = ?", id).
+			ExecContext(ctx); err != nil {
+			return err
+		}
+		if _, err := sess.SQL().
+			DeleteFrom("webhook").
+			Where("id = ?", id).
+			ExecContext(ctx); err != nil {
+			return err
+		}
+		_, err := insertModLogEntry(ctx, sess, modLog)
+		return err
+	}, nil))
+}
+
+func (wdb *WebhookDB) GetWebhook(ctx context.Context, id int64) (*model.Webhook, error) {
+	var webhook model.Webhook
+	if err := wdb.sess.SQL().
+		SelectFrom("webhook").
+		Where("id = ?", id).
+		IteratorContext(ctx).
+		One(&webhook); err != nil {
+		if err == db.ErrNoMoreRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (wdb *WebhookDB) GetWebhooks(ctx context.Context, communityIds []int64) ([]*model.Webhook, error) {
+	webhooks := make([]*model.Webhook, 0)
+	if len(communityIds) == 0 {
+		return webhooks, nil
+	}
+	err := wdb.sess.SQL().
+		SelectFrom("webhook").
+		Where("community_id IN ?", communityIds).
+		OrderBy("id").
+		IteratorContext(ctx).
+		All(&webhooks)
+	return webhooks, err
+}
+
+func (wdb *WebhookDB) CreateWebhookDeliveries(ctx context.Context, deliveries []*model.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return translateErr(wdb.sess.TxContext(ctx, func(sess db.Session) error {
+		for _, delivery := range deliveries {
+			res, err := sess.SQL().
+				InsertInto("webhook_delivery").
+				Columns("webhook_id", "event", "payload", "status", "next_attempt_at", "last_error", "replay_of").
+				Values(delivery.WebhookId, delivery.Event, delivery.Payload, delivery.Status,
+					formatNullableTime(delivery.NextAttemptAt), delivery.LastError, delivery.ReplayOf).
+				ExecContext(ctx)
+			if err != nil {
+				return err
+			}
+			if delivery.Id, err = res.LastInsertId(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil))
+}
+
+func (wdb *WebhookDB) GetWebhookDelivery(ctx context.Context, id int64) (*model.WebhookDelivery, error) {
+	var delivery model.WebhookDelivery
+	if err := wdb.sess.SQL().
+		SelectFrom("webhook_delivery").
+		Where("id = ?", id).
+		IteratorContext(ctx).
+		One(&delivery); err != nil {
+		if err == db.ErrNoMoreRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (wdb *WebhookDB) GetWebhookDeliveries(ctx context.Context, query *appDb.WebhookDeliveriesQuery) ([]*model.WebhookDelivery, error) {
+	deliveries := make([]*model.WebhookDelivery, 0)
+	if err := wdb.sess.SQL().
+		SelectFrom("webhook_delivery").
+		Where("webhook_id = ?", query.WebhookId).
+		And("(? = '' OR status = ?)", query.Status, query.Status).
+		And("(? = 0 OR id < ?)", query.BeforeId, query.BeforeId).
+		OrderBy("id DESC").
+		Limit(query.Limit).
+		IteratorContext(ctx).
+		All(&deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (wdb *WebhookDB) GetDueWebhookDeliveries(ctx context.Context, dueAt time.Time, limit int) ([]*model.WebhookDelivery, error) {
+	deliveries := make([]*model.WebhookDelivery, 0)
+	if err := wdb.sess.SQL().
+		SelectFrom("webhook_delivery").
+		Where("status = ? AND next_attempt_at <= ?", model.WebhookDeliveryPending, formatTime(&dueAt)).
+		OrderBy("next_attempt_at", "id").
+		Limit(limit).
+		IteratorContext(ctx).
+		All(&deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (wdb *WebhookDB) ClaimWebhookDelivery(ctx context.Context, id int64, dueAt time.Time, leaseUntil time.Time) (bool, error) {
+	var claimed bool
+	err := wdb.sess.TxContext(ctx, func(sess db.Session) error {
+		res, err := sess.SQL().
+			Update("webhook_delivery").
+			Set("next_attempt_at = ?", formatTime(&leaseUntil)).
+			Where("id = ? AND status = ? AND next_attempt_at <= ?", id, model.WebhookDeliveryPending, formatTime(&dueAt)).
+			ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		claimed = affected == 1
+		return err
+	}, nil)
+	return claimed, translateErr(err)
+}
+
+func (wdb *WebhookDB) UpdateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	return translateErr(wdb.sess.TxContext(ctx, func(sess db.Session) error {
+		_, err := sess.SQL().
+			Update("webhook_delivery").
+			Set("status = ?", delivery.Status).
+			Set("attempts = ?", delivery.Attempts).
+			Set("next_attempt_at = ?", formatNullableTime(delivery.NextAttemptAt)).
+			Set("last_status_code = ?", delivery.LastStatusCode).
+			Set("last_error = ?", delivery.LastError).
+			Set("updated_at = CURRENT_TIMESTAMP").
+			Where("id = ?", delivery.Id).
+			ExecContext(ctx)
+		return err
+	}, nil))
+}
+
+func (wdb *WebhookDB) DeleteWebhookDeliveries(ctx context.Context, createdBefore time.Time) error {
+	return translateErr(wdb.sess.TxContext(ctx, func(sess db.Session) error {
+		_, err := sess.SQL().
+			DeleteFrom("webhook_delivery").
+			Where("status != ? AND created_at < ?", model.WebhookDeliveryPending, formatTime(&createdBefore)).
+			ExecContext(ctx)
+		return err
+	}, nil))
+}
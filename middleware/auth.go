@@ -1,26 +1,56 @@
 package middleware
 
 import (
-	"firebase.google.com/go/v4/auth"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/navbryce/next-dorm-be/db"
 	"github.com/navbryce/next-dorm-be/model"
+	"github.com/navbryce/next-dorm-be/services"
+	"log"
 	"net/http"
 	"strings"
 )
 
 const (
-	TOKEN_KEY = "authToken"
-	USER_KEY  = "user"
+	TOKEN_KEY       = "authToken"
+	USER_KEY        = "user"
+	QUERY_TOKEN_KEY = "queryToken"
 )
 
+// queryTokenParam is the query parameter the streams take the token from, since browsers' EventSource can't set headers
+const queryTokenParam = "access_token"
+
 type AuthConfig struct {
+	// AllowQueryToken takes the token from the access_token query parameter when there's no Authorization header
+	AllowQueryToken bool
+}
+
+// StripQueryToken takes the access_token query parameter out of the URL so it isn't logged, and keeps it for GenAuth.
+// It has to run before the logger
+func StripQueryToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.Contains(c.Request.URL.RawQuery, queryTokenParam) {
+			return
+		}
+		query := c.Request.URL.Query()
+		token := query.Get(queryTokenParam)
+		query.Del(queryTokenParam)
+		c.Request.URL.RawQuery = query.Encode()
+		if token != "" {
+			c.Set(QUERY_TOKEN_KEY, token)
+		}
+	}
 }
 
 // TODO: figure out the best way of handling admin only?
-func GenAuth(userDB db.UserDatabase, authClient *auth.Client, _ *AuthConfig) gin.HandlerFunc {
+func GenAuth(userDB db.UserDatabase, authenticator services.Authenticator, cfg *AuthConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authorizationHeader, ok := c.Request.Header["Authorization"]
+		if !ok && cfg.AllowQueryToken {
+			if token := c.GetString(QUERY_TOKEN_KEY); token != "" {
+				authorizationHeader, ok = []string{"Bearer " + token}, true
+			}
+		}
 		if !ok {
 			return
 		}
@@ -35,12 +65,11 @@ func GenAuth(userDB db.UserDatabase, authClient *auth.Client, _ *AuthConfig) gin
 			c.Abort()
 			return
 		}
-		// TODO: VerifyIDToken and check revoked?
-		token, err := authClient.VerifyIDToken(c, authorizationHeader[0][7:])
-
-		c.Set(TOKEN_KEY, &model.FirebaseToken{Token: token})
-
+		token, err := authenticator.Authenticate(c, authorizationHeader[0][7:])
 		if err != nil {
+			if !errors.Is(err, services.ErrInvalidToken) {
+				log.Printf("error authenticating request: %v\n", err)
+			}
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"success": false,
 				"message": "invalid token",
@@ -48,6 +77,7 @@ func GenAuth(userDB db.UserDatabase, authClient *auth.Client, _ *AuthConfig) gin
 			c.Abort()
 			return
 		}
+		c.Set(TOKEN_KEY, token)
 
 		// TODO: Make hasAccount a custom claim on ID token to short-circuit DB query
 		user, err := userDB.GetUser(c, token.UID)
@@ -90,15 +120,15 @@ func RequireAccount() gin.HandlerFunc {
 	}
 }
 
-func GetToken(c *gin.Context) *model.FirebaseToken {
+func GetToken(c *gin.Context) *model.Identity {
 	tokenMaybe, loggedIn := c.Get(TOKEN_KEY)
 	if !loggedIn {
 		return nil
 	}
-	return tokenMaybe.(*model.FirebaseToken)
+	return tokenMaybe.(*model.Identity)
 }
 
-func MustGetToken(c *gin.Context) *model.FirebaseToken {
+func MustGetToken(c *gin.Context) *model.Identity {
 	token := GetToken(c)
 	if token == nil {
 		panic("expected a token")
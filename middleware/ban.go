@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/navbryce/next-dorm-be/controllers"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/navbryce/next-dorm-be/util"
+	"net/http"
+	"time"
+)
+
+// CommunitiesOf returns the communities a request writes to
+type CommunitiesOf = func(c *gin.Context) ([]int64, *util.HTTPError)
+
+// RequireNotBanned rejects the request if the user is banned globally or from one of the communities it writes to
+// (or one of their ancestors). Must come after RequireAccount
+func RequireNotBanned(policy *controllers.Policy, communitiesOf CommunitiesOf) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		communityIds, httpErr := communitiesOf(c)
+		if httpErr != nil {
+			util.HandleHTTPErrorRes(c, httpErr)
+			c.Abort()
+			return
+		}
+		ban, err := policy.ActiveBan(c, MustGetLocalUser(c), communityIds)
+		if err != nil {
+			util.HandleHTTPErrorRes(c, util.BuildDbHTTPErr(err))
+			c.Abort()
+			return
+		}
+		if ban == nil {
+			return
+		}
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": banMessage(ban),
+			"ban":     ban.Notice(),
+		})
+		c.Abort()
+	}
+}
+
+func banMessage(ban *model.Ban) string {
+	scope := "everywhere"
+	if !ban.IsGlobal() {
+		scope = "in this community"
+	}
+	if ban.ExpiresAt == nil {
+		return fmt.Sprintf("you are permanently banned %v: %v", scope, ban.Reason)
+	}
+	return fmt.Sprintf("you are banned %v until %v: %v", scope, ban.ExpiresAt.UTC().Format(time.RFC3339), ban.Reason)
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/navbryce/next-dorm-be/services"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// RateLimit rejects the request with a 429 if the user or their IP used up the group's limit. Must come after GenAuth.
+// Requests are let through if the store fails, since refusing every write is worse than a missed limit
+func RateLimit(limiter *services.RateLimiter, group string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wait, err := limiter.Take(c, group, GetUserIdMaybe(c), c.ClientIP())
+		if err != nil {
+			log.Println("an error occurred while checking the rate limit of", group, err)
+			return
+		}
+		if wait <= 0 {
+			return
+		}
+		seconds := int(math.Ceil(wait.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("too many requests, retry in %v seconds", seconds),
+		})
+		c.Abort()
+	}
+}
@@ -0,0 +1,125 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AutomodReporterId is the reporter of the reports automod files
+const AutomodReporterId = "automod"
+
+type AutomodRuleType string
+
+const (
+	// AutomodRuleKeyword matches any of Keywords as a whole word, ignoring case
+	AutomodRuleKeyword AutomodRuleType = "KEYWORD"
+	// AutomodRuleRegex matches Pattern
+	AutomodRuleRegex AutomodRuleType = "REGEX"
+	// AutomodRuleLink matches links to any domain other than AllowedDomains (and their subdomains)
+	AutomodRuleLink AutomodRuleType = "LINK"
+	// AutomodRuleAccountAge matches users whose account is younger than MinAccountAgeHours
+	AutomodRuleAccountAge AutomodRuleType = "ACCOUNT_AGE"
+	// AutomodRuleRate matches users who already made MaxPostsPerHour posts in the community in the last hour
+	AutomodRuleRate AutomodRuleType = "RATE"
+	// AutomodRuleImages matches posts with fewer than MinImages images
+	AutomodRuleImages AutomodRuleType = "IMAGES"
+)
+
+// IsPostOnly is true for the rule types that don't make sense for comments
+func (t AutomodRuleType) IsPostOnly() bool {
+	return t == AutomodRuleRate || t == AutomodRuleImages
+}
+
+// AutomodOutcome is what happens to content that matches a rule
+type AutomodOutcome string
+
+const (
+	// AutomodOutcomeFlag files a report and lets the content through
+	AutomodOutcomeFlag AutomodOutcome = "FLAG"
+	// AutomodOutcomeHold creates the content hidden from everyone but its creator and moderators until a moderator
+	// dismisses the report filed for it
+	AutomodOutcomeHold AutomodOutcome = "HOLD"
+	// AutomodOutcomeReject refuses the content
+	AutomodOutcomeReject AutomodOutcome = "REJECT"
+)
+
+var automodOutcomeRanks = map[AutomodOutcome]int{
+	AutomodOutcomeFlag:   1,
+	AutomodOutcomeHold:   2,
+	AutomodOutcomeReject: 3,
+}
+
+func (o AutomodOutcome) IsValid() bool {
+	_, ok := automodOutcomeRanks[o]
+	return ok
+}
+
+// StrongerThan is true if o is stricter than other. Every outcome is stronger than ""
+func (o AutomodOutcome) StrongerThan(other AutomodOutcome) bool {
+	return automodOutcomeRanks[o] > automodOutcomeRanks[other]
+}
+
+type AutomodTarget string
+
+const (
+	AutomodTargetAll      AutomodTarget = "ALL"
+	AutomodTargetPosts    AutomodTarget = "POSTS"
+	AutomodTargetComments AutomodTarget = "COMMENTS"
+)
+
+// AutomodParams holds the parameters of every rule type. Only the ones of the rule's type are set. Stored as JSON
+type AutomodParams struct {
+	Keywords           []string `json:"keywords,omitempty"`
+	Pattern            string   `json:"pattern,omitempty"`
+	AllowedDomains     []string `json:"allowedDomains,omitempty"`
+	MinAccountAgeHours int      `json:"minAccountAgeHours,omitempty"`
+	MaxPostsPerHour    int      `json:"maxPostsPerHour,omitempty"`
+	MinImages          int      `json:"minImages,omitempty"`
+}
+
+func (p AutomodParams) Value() (driver.Value, error) {
+	encoded, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+func (p *AutomodParams) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(value), p)
+	case []byte:
+		return json.Unmarshal(value, p)
+	default:
+		return fmt.Errorf("cannot scan %T into AutomodParams", src)
+	}
+}
+
+// AutomodRule is checked against new and edited content in the community and all of its descendants. Moderators and
+// admins are exempt
+type AutomodRule struct {
+	Id          int64           `db:"id,omitempty" json:"id"`
+	CommunityId int64           `db:"community_id" json:"communityId"`
+	Type        AutomodRuleType `db:"rule_type" json:"type"`
+	Outcome     AutomodOutcome  `db:"outcome" json:"outcome"`
+	AppliesTo   AutomodTarget   `db:"applies_to" json:"appliesTo"`
+	Params      AutomodParams   `db:"params" json:"params"`
+	// Reason is the report reason when the rule flags or holds, and the error message when it rejects
+	Reason    string    `db:"reason" json:"reason"`
+	CreatedBy string    `db:"created_by" json:"createdBy"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt time.Time `db:"updated_at" json:"updatedAt"`
+}
+
+// AppliesToPosts is false for rules limited to comments
+func (r *AutomodRule) AppliesToPosts() bool {
+	return r.AppliesTo != AutomodTargetComments
+}
+
+// AppliesToComments is false for rules limited to posts and for rule types that only make sense for posts
+func (r *AutomodRule) AppliesToComments() bool {
+	return r.AppliesTo != AutomodTargetPosts && !r.Type.IsPostOnly()
+}
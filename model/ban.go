@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// Ban stops a user from writing (posting, commenting, voting and reporting). Lifting a ban keeps it for the record
+type Ban struct {
+	Id     int64  `db:"id,omitempty" json:"id"`
+	UserId string `db:"user_id" json:"userId"`
+	// CommunityId is nil for a global ban. Otherwise the ban covers the community and all of its descendants
+	CommunityId *int64 `db:"community_id" json:"communityId"`
+	Reason      string `db:"reason" json:"reason"`
+	IssuedBy    string `db:"issued_by" json:"issuedBy"`
+	// ExpiresAt is nil for a permanent ban
+	ExpiresAt *time.Time `db:"expires_at" json:"expiresAt"`
+	LiftedAt  *time.Time `db:"lifted_at" json:"liftedAt"`
+	LiftedBy  *string    `db:"lifted_by" json:"liftedBy"`
+	CreatedAt time.Time  `db:"created_at" json:"createdAt"`
+}
+
+func (b *Ban) IsGlobal() bool {
+	return b.CommunityId == nil
+}
+
+func (b *Ban) IsActive(now time.Time) bool {
+	return b.LiftedAt == nil && (b.ExpiresAt == nil || b.ExpiresAt.After(now))
+}
+
+// BanNotice is what the banned user is told. The issuer is left out
+type BanNotice struct {
+	Reason      string     `json:"reason"`
+	CommunityId *int64     `json:"communityId"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+func (b *Ban) Notice() *BanNotice {
+	return &BanNotice{
+		Reason:      b.Reason,
+		CommunityId: b.CommunityId,
+		ExpiresAt:   b.ExpiresAt,
+		CreatedAt:   b.CreatedAt,
+	}
+}
@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// DigestFrequency is how often a user gets the email digest of their communities
+type DigestFrequency string
+
+const (
+	DigestOff    DigestFrequency = "OFF"
+	DigestDaily  DigestFrequency = "DAILY"
+	DigestWeekly DigestFrequency = "WEEKLY"
+)
+
+func (f DigestFrequency) IsValid() bool {
+	return f == DigestOff || f == DigestDaily || f == DigestWeekly
+}
+
+// Period is how far back a digest looks, and how long until the next one. 0 when the digest is off
+func (f DigestFrequency) Period() time.Duration {
+	switch f {
+	case DigestDaily:
+		return 24 * time.Hour
+	case DigestWeekly:
+		return 7 * 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// DigestPreference exists once a user opted in to the digest. Email is the address the user signed in with when they
+// last set their preference. UnsubscribeToken is in the links of every digest, so turning it off doesn't need a session
+type DigestPreference struct {
+	UserId           string          `db:"user_id" json:"-"`
+	Email            string          `db:"email" json:"email"`
+	Frequency        DigestFrequency `db:"frequency" json:"frequency"`
+	UnsubscribeToken string          `db:"unsubscribe_token" json:"-"`
+	// NextSendAt is when the next digest is due. Nil when the digest is off
+	NextSendAt *time.Time `db:"next_send_at" json:"nextSendAt"`
+	// LastSentAt is nil until a digest with at least one post was sent
+	LastSentAt *time.Time `db:"last_sent_at" json:"lastSentAt"`
+	CreatedAt  time.Time  `db:"created_at" json:"-"`
+	UpdatedAt  time.Time  `db:"updated_at" json:"-"`
+}
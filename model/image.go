@@ -0,0 +1,22 @@
+package model
+
+import "fmt"
+
+// Image is an image attached to content. Width, Height and Thumbnails are only known for processed images
+type Image struct {
+	BlobName   string       `json:"blobName"`
+	Width      int          `json:"width"`
+	Height     int          `json:"height"`
+	Thumbnails []*Thumbnail `json:"thumbnails"`
+}
+
+type Thumbnail struct {
+	BlobName string `db:"blob_name" json:"blobName"`
+	Width    int    `db:"width" json:"width"`
+	Height   int    `db:"height" json:"height"`
+}
+
+// ThumbnailBlobName is where the thumbnail of the image that fits in a size x size box is stored
+func ThumbnailBlobName(imageBlobName string, size int) string {
+	return fmt.Sprintf("%v_thumb_%v", imageBlobName, size)
+}
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// LiveEventType is what happened to the post or comment of a LiveEvent
+type LiveEventType string
+
+const (
+	LiveEventCreated LiveEventType = "CREATED"
+	LiveEventEdited  LiveEventType = "EDITED"
+	LiveEventDeleted LiveEventType = "DELETED"
+	LiveEventVoted   LiveEventType = "VOTED"
+)
+
+// LiveEvent tells the live streams that a post or comment changed. It only carries ids: the streams read the content
+// when delivering it and show each subscriber what they're allowed to see
+type LiveEvent struct {
+	Id   int64         `db:"id,omitempty"`
+	Type LiveEventType `db:"event_type"`
+	// PostId is the post, or the post of the comment
+	PostId int64 `db:"post_id"`
+	// CommentId is nil for events about the post
+	CommentId *int64 `db:"comment_id"`
+	// ParentCommentId is the comment a new comment replies to. Nil for comments on the post itself
+	ParentCommentId *int64    `db:"parent_comment_id"`
+	CreatedAt       time.Time `db:"created_at"`
+}
@@ -0,0 +1,52 @@
+package model
+
+import "time"
+
+// ModAction is a privileged action recorded in the moderation log
+type ModAction string
+
+const (
+	ModActionRemovePost    ModAction = "REMOVE_POST"
+	ModActionRemoveComment ModAction = "REMOVE_COMMENT"
+	ModActionEditPost      ModAction = "EDIT_POST"
+	ModActionEditComment   ModAction = "EDIT_COMMENT"
+	ModActionGrantRole     ModAction = "GRANT_ROLE"
+	ModActionRevokeRole    ModAction = "REVOKE_ROLE"
+	ModActionBanUser       ModAction = "BAN_USER"
+	ModActionLiftBan       ModAction = "LIFT_BAN"
+	ModActionResolveReport ModAction = "RESOLVE_REPORT"
+	ModActionRevealCreator ModAction = "REVEAL_CREATOR"
+	ModActionCreateAutomod ModAction = "CREATE_AUTOMOD_RULE"
+	ModActionUpdateAutomod ModAction = "UPDATE_AUTOMOD_RULE"
+	ModActionDeleteAutomod ModAction = "DELETE_AUTOMOD_RULE"
+	ModActionCreateWebhook ModAction = "CREATE_WEBHOOK"
+	ModActionUpdateWebhook ModAction = "UPDATE_WEBHOOK"
+	ModActionDeleteWebhook ModAction = "DELETE_WEBHOOK"
+	// ModActionAnnouncePost pushes a post to the devices of the subscribers of the entry's only community
+	ModActionAnnouncePost ModAction = "ANNOUNCE_POST"
+
+	// ModActionRemovePostFromCommunity takes a cross-posted post out of one of its communities, which is the entry's
+	// only community
+	ModActionRemovePostFromCommunity ModAction = "REMOVE_POST_FROM_COMMUNITY"
+)
+
+// ModLogEntry records a moderator or admin acting on someone else's content or account. Entries are never updated or
+// deleted. The creator of hidden content is never a target, so the log can't be used to de-anonymize it. Bans issued
+// while resolving reports of hidden content are only in the whole log, which only admins read
+type ModLogEntry struct {
+	Id      int64     `db:"id,omitempty" json:"id"`
+	ActorId string    `db:"actor_id" json:"actorId"`
+	Action  ModAction `db:"action" json:"action"`
+	PostId  *int64    `db:"post_id" json:"postId"`
+	// CommentId is set for actions on a comment. PostId is the post of the comment
+	CommentId *int64  `db:"comment_id" json:"commentId"`
+	UserId    *string `db:"user_id" json:"userId"`
+	// TargetId is the id of the ban, report group, reveal, automod rule or webhook the action is about, if any
+	TargetId *int64 `db:"target_id" json:"targetId"`
+	// Role is the role granted or revoked
+	Role Role `db:"role" json:"role,omitempty"`
+	// CommunityIds are the communities the action was in when it was taken. Empty for global actions
+	CommunityIds []int64   `db:"-" json:"communityIds"`
+	Reason       string    `db:"reason" json:"reason"`
+	CreatedAt    time.Time `db:"created_at" json:"createdAt"`
+}
@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+type NotificationType string
+
+const (
+	// NotificationPostReply is a comment on the recipient's post
+	NotificationPostReply NotificationType = "POST_REPLY"
+	// NotificationCommentReply is a reply to the recipient's comment
+	NotificationCommentReply NotificationType = "COMMENT_REPLY"
+	// NotificationMention is a post or comment that mentions the recipient as @displayName
+	NotificationMention NotificationType = "MENTION"
+	// NotificationModAction is a moderator acting on the recipient's post or comment
+	NotificationModAction NotificationType = "MOD_ACTION"
+)
+
+// Notification is an item in a user's inbox. It points at the content that caused it. The sender and excerpt are read
+// from that content, so they follow its edits and a sender who hides their content shows up by their alias
+type Notification struct {
+	Id int64 `db:"id,omitempty" json:"id"`
+	// RecipientId is only set when creating the notification. It's stored the way thread aliases store users, so
+	// notifications about hidden content don't tie it to its creator
+	RecipientId string           `db:"-" json:"-"`
+	Type        NotificationType `db:"notification_type" json:"type"`
+	PostId      int64            `db:"post_id" json:"postId"`
+	// CommentId is the reply or mention, or the comment a moderator acted on. Nil for posts
+	CommentId *int64 `db:"comment_id" json:"commentId"`
+	// SenderId is the creator of the content. Nil when it's hidden and for moderator actions
+	SenderId *string `db:"sender_id" json:"senderId"`
+	// SenderName is the display name of the creator, or their alias when the content is hidden
+	SenderName string `db:"sender_name" json:"senderName"`
+	// Excerpt is the start of the comment, or the title of the post
+	Excerpt string `db:"excerpt" json:"excerpt"`
+	// ModAction and Reason are set for moderator actions. The moderator isn't named
+	ModAction ModAction `db:"mod_action" json:"modAction,omitempty"`
+	Reason    string    `db:"reason" json:"reason,omitempty"`
+	Read      bool      `db:"is_read" json:"read"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+}
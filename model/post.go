@@ -27,10 +27,13 @@ type ContentMetadata struct {
 	Creator        *ContentAuthor `json:"creator"`
 	UserVote       *Vote          `json:"userVote"`
 	Status         `json:"status"`
+	Held           bool       `json:"held"` // waiting for moderator review. only shown to the creator and moderators
+	HeldOnCreate   bool       `json:"-"`    // held since it was created, so nothing announced it yet
 	Visibility     Visibility `json:"visibility"`
 	NumVotes       uint64     `json:"numVotes"`
 	VoteTotal      int64      `json:"voteTotal"`
 	ImageBlobNames []string   `json:"imageBlobNames"`
+	Images         []*Image   `json:"images"`
 	CreatedAt      time.Time  `json:"createdAt"`
 	UpdatedAt      time.Time  `json:"updatedAt"`
 }
@@ -38,8 +41,8 @@ type ContentMetadata struct {
 func (cm *ContentMetadata) MakeDisplayableFor(user *LocalUser) *ContentMetadata {
 	switch cm.Visibility {
 	case VisibilityHidden:
-		// TODO: Refactor into method checking if user is the person or an admin
-		if user != nil && (user.IsAdmin || user.Id == cm.Creator.Id) {
+		// admins see the alias too. revealing the creator to them goes through the audited reveal API
+		if user != nil && user.Id == cm.Creator.Id {
 			return cm
 		}
 		cm.Creator = &ContentAuthor{AnonymousUser: cm.Creator.AnonymousUser}
@@ -50,19 +53,6 @@ func (cm *ContentMetadata) MakeDisplayableFor(user *LocalUser) *ContentMetadata
 	return cm
 }
 
-// TODO: move this logic into controller?
-func (cm *ContentMetadata) CanEdit(user *LocalUser) bool {
-	if cm.Status == StatusDeleted {
-		return false
-	}
-	return user.Id == cm.Creator.Id || user.IsAdmin
-}
-
-// TODO: Move this logic into controller?
-func (cm *ContentMetadata) CanDelete(user *LocalUser) bool {
-	return user.Id == cm.Creator.Id || user.IsAdmin
-}
-
 type Post struct {
 	*ContentMetadata
 	Id           int64        `json:"id"`
@@ -109,10 +99,26 @@ func (ct *CommentTree) MakeDisplayableFor(user *LocalUser) *CommentTree {
 	return ct
 }
 
-// TODO: Add report status
-type Report struct {
-	Id      int64
-	Post    *Post
-	Reason  string
-	Creator *ContentAuthor
+// BuildCommentForest builds the comment trees hanging off of rootId. comments should be ordered by creation
+func BuildCommentForest(rootId int64, comments []*Comment) []*CommentTree {
+	adj := make(map[int64][]*Comment)
+	for _, comment := range comments {
+		adj[comment.ParentMetadataId] = append(adj[comment.ParentMetadataId], comment)
+	}
+	return buildCommentForestFromAdjList(adj, rootId)
+}
+
+func buildCommentForestFromAdjList(adj map[int64][]*Comment, rootId int64) []*CommentTree {
+	comments, ok := adj[rootId]
+	if !ok {
+		return []*CommentTree{}
+	}
+	forest := make([]*CommentTree, len(comments))
+	for i, comment := range comments {
+		forest[i] = &CommentTree{
+			Comment:  comment,
+			Children: buildCommentForestFromAdjList(adj, comment.ContentMetadata.Id),
+		}
+	}
+	return forest
 }
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// PushSubscription is a device (a browser or installed PWA) a user gets Web Push notifications on. Endpoint is the URL
+// of the push service the notifications are posted to, and identifies the device. P256dh and Auth are the keys the
+// notifications are encrypted with (RFC 8291), base64url encoded like the browser hands them out
+type PushSubscription struct {
+	Id       int64  `db:"id,omitempty" json:"id"`
+	UserId   string `db:"user_id" json:"-"`
+	Endpoint string `db:"endpoint" json:"endpoint"`
+	// EndpointHash (hex SHA-256 of the endpoint) is what the endpoint is looked up by, since it can be too long to index
+	EndpointHash string    `db:"endpoint_hash" json:"-"`
+	P256dh       string    `db:"p256dh" json:"-"`
+	Auth         string    `db:"auth" json:"-"`
+	CreatedAt    time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt    time.Time `db:"updated_at" json:"-"`
+}
@@ -0,0 +1,9 @@
+package model
+
+import "time"
+
+// RateLimitBucket is a token bucket as of UpdatedAt. It refills over time, which is applied when it's next used
+type RateLimitBucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+type ReportTargetType string
+
+const (
+	ReportTargetPost    ReportTargetType = "POST"
+	ReportTargetComment ReportTargetType = "COMMENT"
+	ReportTargetUser    ReportTargetType = "USER"
+)
+
+type ReportStatus string
+
+const (
+	ReportStatusOpen      ReportStatus = "OPEN"
+	ReportStatusActioned  ReportStatus = "ACTIONED"
+	ReportStatusDismissed ReportStatus = "DISMISSED"
+)
+
+// ReportTarget is what's reported. Reports of the same target are grouped
+type ReportTarget struct {
+	Type ReportTargetType `db:"target_type" json:"targetType"`
+	// PostId is the reported post, or the post of the reported comment
+	PostId    *int64  `db:"post_id" json:"postId"`
+	CommentId *int64  `db:"comment_id" json:"commentId"`
+	UserId    *string `db:"user_id" json:"userId"`
+	// CommunityId is the community a user was reported in (nil if reported outside of one). Content is in the
+	// communities of its post
+	CommunityId *int64 `db:"community_id" json:"communityId"`
+}
+
+// Key identifies the target among the open report groups
+func (rt *ReportTarget) Key() string {
+	switch rt.Type {
+	case ReportTargetPost:
+		return fmt.Sprintf("POST:%v", *rt.PostId)
+	case ReportTargetComment:
+		return fmt.Sprintf("COMMENT:%v", *rt.CommentId)
+	default:
+		if rt.CommunityId == nil {
+			return fmt.Sprintf("USER:%v", *rt.UserId)
+		}
+		return fmt.Sprintf("USER:%v:%v", *rt.UserId, *rt.CommunityId)
+	}
+}
+
+// ReportGroup is the reports of a target that moderators resolve together. Reporting the target after the group is
+// resolved opens a new group
+type ReportGroup struct {
+	Id           int64 `db:"id,omitempty" json:"id"`
+	ReportTarget `db:",inline"`
+	Status       ReportStatus `db:"status" json:"status"`
+	NumReports   int64        `db:"num_reports" json:"numReports"`
+	ResolvedBy   *string      `db:"resolved_by" json:"resolvedBy"`
+	ResolvedAt   *time.Time   `db:"resolved_at" json:"resolvedAt"`
+	// Resolution is the note left by the moderator who resolved the group
+	Resolution     *string   `db:"resolution" json:"resolution"`
+	CreatedAt      time.Time `db:"created_at" json:"createdAt"`
+	LastReportedAt time.Time `db:"last_reported_at" json:"lastReportedAt"`
+}
+
+type Report struct {
+	Id         int64     `db:"id,omitempty" json:"id"`
+	GroupId    int64     `db:"group_id" json:"groupId"`
+	ReporterId string    `db:"creator_id" json:"reporterId"`
+	Reason     string    `db:"reason" json:"reason"`
+	CreatedAt  time.Time `db:"created_at" json:"createdAt"`
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// Reveal records an admin looking up the creator of hidden content. Reveals are never updated or deleted. The revealed
+// creator isn't stored, so the audit log can't be used to de-anonymize content itself
+type Reveal struct {
+	Id      int64  `db:"id,omitempty" json:"id"`
+	AdminId string `db:"admin_id" json:"adminId"`
+	PostId  int64  `db:"post_id" json:"postId"`
+	// CommentId is nil when the creator of the post was revealed
+	CommentId *int64    `db:"comment_id" json:"commentId"`
+	Reason    string    `db:"reason" json:"reason"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+}
@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+type Role string
+
+const (
+	RoleMember    Role = "MEMBER"
+	RoleModerator Role = "MODERATOR"
+	// RoleAdmin is global. It comes from LocalUser.IsAdmin and is never granted on a community
+	RoleAdmin Role = "ADMIN"
+)
+
+var roleRanks = map[Role]int{
+	RoleMember:    1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+// AtLeast is true if r has every permission of other
+func (r Role) AtLeast(other Role) bool {
+	return roleRanks[r] >= roleRanks[other]
+}
+
+// IsCommunityRole is true for the roles that can be granted on a community
+func (r Role) IsCommunityRole() bool {
+	return r == RoleMember || r == RoleModerator
+}
+
+// RoleGrant gives a user a role in a community and all of its descendants
+type RoleGrant struct {
+	UserId      string    `db:"user_id" json:"userId"`
+	CommunityId int64     `db:"community_id" json:"communityId"`
+	Role        Role      `db:"role" json:"role"`
+	GrantedBy   string    `db:"granted_by" json:"grantedBy"`
+	CreatedAt   time.Time `db:"created_at" json:"createdAt"`
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// UploadsPrefix is the prefix of every blob uploaded by users
+const UploadsPrefix = "uploads/"
+
+type UploadKind string
+
+const (
+	UploadKindImage  UploadKind = "IMAGE"
+	UploadKindAvatar UploadKind = "AVATAR"
+)
+
+// Upload is a server-issued upload session. The blob is only trusted once CompletedAt is set
+type Upload struct {
+	Id          int64      `db:"id,omitempty" json:"-"`
+	TokenHash   string     `db:"token_hash" json:"-"`
+	BlobName    string     `db:"blob_name" json:"blobName"`
+	OwnerId     string     `db:"owner_id" json:"-"`
+	Kind        UploadKind `db:"kind" json:"kind"`
+	ContentType string     `db:"content_type" json:"contentType"`
+	MaxSize     int64      `db:"max_size" json:"maxSize"`
+	Size        int64      `db:"size" json:"size"`
+	CreatedAt   time.Time  `db:"created_at" json:"createdAt"`
+	ExpiresAt   time.Time  `db:"expires_at" json:"expiresAt"`
+	CompletedAt *time.Time `db:"completed_at" json:"completedAt"`
+	// ProcessedAt is set once the image was re-encoded, so attaching it again doesn't re-encode it
+	ProcessedAt *time.Time `db:"processed_at" json:"-"`
+}
+
+func (u *Upload) IsCompleted() bool {
+	return u.CompletedAt != nil
+}
+
+func (u *Upload) IsProcessed() bool {
+	return u.ProcessedAt != nil
+}
+
+// ImageBlobNameForUser is where an image upload with the given (random) key is stored
+func ImageBlobNameForUser(userId string, key string) string {
+	return fmt.Sprintf("%v%v/images/%v", UploadsPrefix, userId, key)
+}
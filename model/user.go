@@ -2,20 +2,23 @@ package model
 
 import (
 	"encoding/json"
-	"firebase.google.com/go/v4/auth"
 	"fmt"
+	"time"
 )
 
 func avatarBlobNameFromId(userId string) string {
 	return fmt.Sprintf("uploads/%v/avatar", userId)
 }
 
-type FirebaseToken struct {
-	*auth.Token
+// Identity is a verified caller as reported by a services.Authenticator
+type Identity struct {
+	UID    string
+	Email  string
+	Claims map[string]interface{}
 }
 
-func (fbu *FirebaseToken) AvatarBlobNameForUser() string {
-	return avatarBlobNameFromId(fbu.UID)
+func (i *Identity) AvatarBlobNameForUser() string {
+	return avatarBlobNameFromId(i.UID)
 }
 
 // LocalUser holds the local user data relevant to the application (outside of firebase db)
@@ -24,6 +27,8 @@ type LocalUser struct {
 	Id          string `db:"firebase_id" json:"id"`
 	DisplayName string `db:"display_name" json:"displayName"`
 	IsAdmin     bool   `db:"is_admin" json:"isAdmin"`
+	// CreatedAt is nil for users created before it was recorded
+	CreatedAt *time.Time `db:"created_at,omitempty" json:"-"`
 }
 
 func (u *LocalUser) AvatarBlobNameForUser() string {
@@ -0,0 +1,116 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// WebhookEvent is a write a webhook can subscribe to
+type WebhookEvent string
+
+const (
+	WebhookEventPostCreated    WebhookEvent = "post.created"
+	WebhookEventPostDeleted    WebhookEvent = "post.deleted"
+	WebhookEventCommentCreated WebhookEvent = "comment.created"
+	WebhookEventCommentDeleted WebhookEvent = "comment.deleted"
+)
+
+var webhookEvents = []WebhookEvent{
+	WebhookEventPostCreated, WebhookEventPostDeleted, WebhookEventCommentCreated, WebhookEventCommentDeleted,
+}
+
+func (e WebhookEvent) IsValid() bool {
+	for _, event := range webhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookEvents are the events a webhook subscribes to. Stored as JSON
+type WebhookEvents []WebhookEvent
+
+func (e WebhookEvents) Value() (driver.Value, error) {
+	if e == nil {
+		e = WebhookEvents{}
+	}
+	encoded, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+func (e *WebhookEvents) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(value), e)
+	case []byte:
+		return json.Unmarshal(value, e)
+	default:
+		return fmt.Errorf("cannot scan %T into WebhookEvents", src)
+	}
+}
+
+func (e WebhookEvents) Contains(event WebhookEvent) bool {
+	for _, subscribed := range e {
+		if subscribed == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook receives the events of the community and all of its descendants. Secret signs the deliveries and is only
+// shown when the webhook is created
+type Webhook struct {
+	Id          int64         `db:"id,omitempty" json:"id"`
+	CommunityId int64         `db:"community_id" json:"communityId"`
+	URL         string        `db:"url" json:"url"`
+	Secret      string        `db:"secret" json:"-"`
+	Events      WebhookEvents `db:"events" json:"events"`
+	// Active is false for webhooks paused by a moderator. Nothing is queued for them
+	Active    bool      `db:"active" json:"active"`
+	CreatedBy string    `db:"created_by" json:"createdBy"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt time.Time `db:"updated_at" json:"updatedAt"`
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	// WebhookDeliveryPending is waiting for its first attempt or a retry
+	WebhookDeliveryPending WebhookDeliveryStatus = "PENDING"
+	// WebhookDeliverySucceeded got a 2xx response
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "SUCCEEDED"
+	// WebhookDeliveryFailed ran out of attempts. It can still be replayed
+	WebhookDeliveryFailed WebhookDeliveryStatus = "FAILED"
+)
+
+func (s WebhookDeliveryStatus) IsValid() bool {
+	return s == WebhookDeliveryPending || s == WebhookDeliverySucceeded || s == WebhookDeliveryFailed
+}
+
+// WebhookDelivery is one event sent (or to be sent) to a webhook. Payload is the JSON body, built when the event
+// happened, so a retry or replay sends what was true then
+type WebhookDelivery struct {
+	Id        int64                 `db:"id,omitempty" json:"id"`
+	WebhookId int64                 `db:"webhook_id" json:"webhookId"`
+	Event     WebhookEvent          `db:"event" json:"event"`
+	Payload   string                `db:"payload" json:"payload"`
+	Status    WebhookDeliveryStatus `db:"status" json:"status"`
+	Attempts  int                   `db:"attempts" json:"attempts"`
+	// NextAttemptAt is when a pending delivery is sent next. Nil once it succeeded or failed
+	NextAttemptAt *time.Time `db:"next_attempt_at" json:"nextAttemptAt"`
+	// LastStatusCode is the response to the last attempt. Nil if there wasn't one (or no attempt yet)
+	LastStatusCode *int `db:"last_status_code" json:"lastStatusCode"`
+	// LastError is why the last attempt failed. Empty if it didn't
+	LastError string `db:"last_error" json:"lastError"`
+	// ReplayOf is the delivery this one replays, if any
+	ReplayOf  *int64    `db:"replay_of" json:"replayOf"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt time.Time `db:"updated_at" json:"updatedAt"`
+}
@@ -0,0 +1,213 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/navbryce/next-dorm-be/controllers"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/middleware"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/navbryce/next-dorm-be/services"
+	"github.com/navbryce/next-dorm-be/util"
+	"net/http"
+	"strings"
+)
+
+type automodRoutes struct {
+	db      db.Database
+	policy  *controllers.Policy
+	automod *controllers.AutomodController
+}
+
+// AddAutomodRoutes adds the API moderators manage the automod rules of a community with. A rule applies to the
+// community and everything below it
+func AddAutomodRoutes(group *gin.RouterGroup, db db.Database, authenticator services.Authenticator, policy *controllers.Policy, automod *controllers.AutomodController) {
+	routes := automodRoutes{db, policy, automod}
+	rules := group.Group("/communities/:id/automod", middleware.GenAuth(db, authenticator, &middleware.AuthConfig{}), middleware.RequireAccount())
+	rules.GET("", util.HandlerWrapper(routes.getRules, &util.HandlerOpts{}))
+	rules.PUT("", util.HandlerWrapper(routes.createRule, &util.HandlerOpts{}))
+	rules.PUT("/:rule-id", util.HandlerWrapper(routes.updateRule, &util.HandlerOpts{}))
+	rules.DELETE("/:rule-id", util.HandlerWrapper(routes.deleteRule, &util.HandlerOpts{}))
+}
+
+// getRules returns the rules that apply in the community, including the ones inherited from its ancestors. Those have
+// the id of the ancestor as their communityId
+func (ar *automodRoutes) getRules(c *gin.Context) (interface{}, *util.HTTPError) {
+	communityId, httpErr := ar.authorizeManage(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	rules, err := ar.automod.Rules(c, communityId)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return rules, nil
+}
+
+type automodRuleReq struct {
+	Type      model.AutomodRuleType `json:"type"`
+	Outcome   model.AutomodOutcome  `json:"outcome"`
+	AppliesTo model.AutomodTarget   `json:"appliesTo"`
+	Params    model.AutomodParams   `json:"params"`
+	Reason    string                `json:"reason"`
+}
+
+func (ar *automodRoutes) createRule(c *gin.Context) (interface{}, *util.HTTPError) {
+	var req automodRuleReq
+	if err := c.BindJSON(&req); err != nil {
+		return nil, util.BuildJSONBindHTTPErr(err)
+	}
+	communityId, httpErr := ar.authorizeManage(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	rule := &model.AutomodRule{
+		CommunityId: communityId,
+		Type:        req.Type,
+		CreatedBy:   middleware.MustGetLocalUser(c).Id,
+	}
+	if httpErr := applyAutomodRuleReq(rule, &req); httpErr != nil {
+		return nil, httpErr
+	}
+
+	var err error
+	if rule.Id, err = ar.db.CreateAutomodRule(c, rule, modLogEntry(c, &model.ModLogEntry{
+		Action:       model.ModActionCreateAutomod,
+		CommunityIds: []int64{communityId},
+		Reason:       rule.Reason,
+	})); err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	ar.automod.RuleSaved(rule)
+	return gin.H{"id": rule.Id}, nil
+}
+
+// updateRule replaces everything but the type of the rule
+func (ar *automodRoutes) updateRule(c *gin.Context) (interface{}, *util.HTTPError) {
+	var req automodRuleReq
+	if err := c.BindJSON(&req); err != nil {
+		return nil, util.BuildJSONBindHTTPErr(err)
+	}
+	rule, httpErr := ar.mustGetRule(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	if req.Type != "" && req.Type != rule.Type {
+		return nil, &util.HTTPError{Status: http.StatusBadRequest, Message: "the type of a rule can't be changed"}
+	}
+	if httpErr := applyAutomodRuleReq(rule, &req); httpErr != nil {
+		return nil, httpErr
+	}
+
+	if err := ar.db.UpdateAutomodRule(c, rule, modLogEntry(c, &model.ModLogEntry{
+		Action:       model.ModActionUpdateAutomod,
+		TargetId:     &rule.Id,
+		CommunityIds: []int64{rule.CommunityId},
+		Reason:       rule.Reason,
+	})); err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	ar.automod.RuleSaved(rule)
+	return nil, nil
+}
+
+func (ar *automodRoutes) deleteRule(c *gin.Context) (interface{}, *util.HTTPError) {
+	rule, httpErr := ar.mustGetRule(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	reason, httpErr := modReasonParam(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	if err := ar.db.DeleteAutomodRule(c, rule.Id, modLogEntry(c, &model.ModLogEntry{
+		Action:       model.ModActionDeleteAutomod,
+		TargetId:     &rule.Id,
+		CommunityIds: []int64{rule.CommunityId},
+		Reason:       reason,
+	})); err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	ar.automod.RuleDeleted(rule.Id)
+	return nil, nil
+}
+
+// authorizeManage checks the caller moderates the community in the path and returns its id
+func (ar *automodRoutes) authorizeManage(c *gin.Context) (int64, *util.HTTPError) {
+	communityId, httpErr := mustGetCommunityId(c, ar.db)
+	if httpErr != nil {
+		return 0, httpErr
+	}
+	if httpErr := authorize(c, ar.policy, controllers.ActionManageAutomod, &controllers.Resource{
+		CommunityIds: []int64{communityId},
+	}, "only moderators of the community can manage its automod rules"); httpErr != nil {
+		return 0, httpErr
+	}
+	return communityId, nil
+}
+
+// mustGetRule returns the rule in the path. Rules inherited from an ancestor are managed through the ancestor
+func (ar *automodRoutes) mustGetRule(c *gin.Context) (*model.AutomodRule, *util.HTTPError) {
+	communityId, httpErr := ar.authorizeManage(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	id, httpErr := util.ParseId(c.Param("rule-id"))
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	rule, err := ar.db.GetAutomodRule(c, id)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	if rule == nil || rule.CommunityId != communityId {
+		return nil, util.BuildDoesNotExistHTTPErr("automod rule")
+	}
+	return rule, nil
+}
+
+// applyAutomodRuleReq validates the request and sets it on the rule
+func applyAutomodRuleReq(rule *model.AutomodRule, req *automodRuleReq) *util.HTTPError {
+	rule.Outcome = req.Outcome
+	rule.AppliesTo = req.AppliesTo
+	rule.Params = req.Params
+	if err := controllers.ValidateAutomodRule(rule); err != nil {
+		return &util.HTTPError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) > maxReportReasonLength {
+		return &util.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("reason must be at most %v characters", maxReportReasonLength),
+		}
+	}
+	rule.Reason = util.XSSSanitize(req.Reason)
+	return nil
+}
+
+// checkAutomod runs automod on the content the caller is writing. Rejected content is a 422 with the rule's reason
+func checkAutomod(c *gin.Context, automod *controllers.AutomodController, content *controllers.AutomodContent) (*controllers.AutomodVerdict, *util.HTTPError) {
+	verdict, err := automod.Check(c, middleware.MustGetLocalUser(c), content)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	if verdict != nil && verdict.Outcome == model.AutomodOutcomeReject {
+		return nil, &util.HTTPError{Status: http.StatusUnprocessableEntity, Message: verdict.Reason()}
+	}
+	return verdict, nil
+}
+
+// isHeld is true if the verdict holds the content for review
+func isHeld(verdict *controllers.AutomodVerdict) bool {
+	return verdict != nil && verdict.Outcome == model.AutomodOutcomeHold
+}
+
+// automodReport is the report that puts held and flagged content in the moderation queue, written along with the
+// content. Once automod reported a target, it isn't reported again until the group is resolved. nil if automod let
+// the content through
+func automodReport(verdict *controllers.AutomodVerdict, target *model.ReportTarget) *db.CreateReport {
+	if verdict == nil {
+		return nil
+	}
+	return &db.CreateReport{Target: target, Reason: verdict.Reason()}
+}
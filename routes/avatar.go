@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/navbryce/next-dorm-be/config"
+	"github.com/navbryce/next-dorm-be/services"
+	"github.com/navbryce/next-dorm-be/util"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	MinAvatarSize = 16
+	MaxAvatarSize = 512
+)
+
+// AddAvatarRoutes serves the generated avatars of anonymous aliases. The avatar only depends on the path, so responses
+// can be cached forever
+func AddAvatarRoutes(group *gin.RouterGroup) {
+	avatars := group.Group("/avatars")
+	avatars.GET("/:seed", getAvatar)
+}
+
+// getAvatar serves /avatars/{seed}.svg or /avatars/{seed}.png. Not wrapped by util.HandlerWrapper since the response
+// is an image
+func getAvatar(c *gin.Context) {
+	seed := c.Param("seed")
+	format := "svg"
+	if ext := strings.LastIndex(seed, "."); ext >= 0 && (seed[ext+1:] == "svg" || seed[ext+1:] == "png") {
+		seed, format = seed[:ext], seed[ext+1:]
+	}
+	if len(seed) == 0 {
+		util.HandleHTTPErrorRes(c, &util.HTTPError{Status: http.StatusBadRequest, Message: "seed must not be empty"})
+		return
+	}
+	size := config.AVATAR_SIZE
+	if sizeStr := c.Query("size"); sizeStr != "" {
+		var err error
+		if size, err = strconv.Atoi(sizeStr); err != nil || size < MinAvatarSize || size > MaxAvatarSize {
+			util.HandleHTTPErrorRes(c, &util.HTTPError{
+				Status:  http.StatusBadRequest,
+				Message: fmt.Sprintf("size must be between %v and %v", MinAvatarSize, MaxAvatarSize),
+			})
+			return
+		}
+	}
+
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%v\x00%v\x00%v", seed, format, size)))
+	etag := `"` + hex.EncodeToString(hash[:16]) + `"`
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	if format == "png" {
+		contents, err := services.IdenticonPNG(seed, size)
+		if err != nil {
+			util.HandleHTTPErrorRes(c, &util.HTTPError{Status: http.StatusInternalServerError, Message: "error drawing avatar"})
+			return
+		}
+		c.Data(http.StatusOK, "image/png", contents)
+		return
+	}
+	c.Data(http.StatusOK, "image/svg+xml", services.IdenticonSVG(seed, size))
+}
@@ -0,0 +1,236 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/navbryce/next-dorm-be/controllers"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/middleware"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/navbryce/next-dorm-be/services"
+	"github.com/navbryce/next-dorm-be/util"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxBanReasonLength = 1000
+	defaultBansLimit   = 50
+	maxBansLimit       = 200
+)
+
+type banRoutes struct {
+	db     db.Database
+	policy *controllers.Policy
+}
+
+// AddBanRoutes adds the API for issuing, listing and lifting bans. Bans are enforced by middleware.RequireNotBanned
+func AddBanRoutes(group *gin.RouterGroup, db db.Database, authenticator services.Authenticator, policy *controllers.Policy) {
+	routes := banRoutes{db, policy}
+	bans := group.Group("/bans", middleware.GenAuth(db, authenticator, &middleware.AuthConfig{}), middleware.RequireAccount())
+	bans.PUT("", util.HandlerWrapper(routes.issueBan, &util.HandlerOpts{}))
+	bans.GET("", util.HandlerWrapper(routes.getBans, &util.HandlerOpts{}))
+	bans.GET("/me", util.HandlerWrapper(routes.getMyBans, &util.HandlerOpts{}))
+	bans.DELETE("/:id", util.HandlerWrapper(routes.liftBan, &util.HandlerOpts{}))
+}
+
+type issueBanReq struct {
+	UserId string `json:"userId"`
+	// CommunityId bans from the community and its descendants. Omitted for a global ban
+	CommunityId *int64 `json:"communityId"`
+	Reason      string `json:"reason"`
+	// ExpiresAt is omitted for a permanent ban
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+func (br *banRoutes) issueBan(c *gin.Context) (interface{}, *util.HTTPError) {
+	var req issueBanReq
+	if err := c.BindJSON(&req); err != nil {
+		return nil, util.BuildJSONBindHTTPErr(err)
+	}
+	user, err := br.db.GetUser(c, req.UserId)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	if user == nil {
+		return nil, util.BuildDoesNotExistHTTPErr("user")
+	}
+	ban, httpErr := authorizeBan(c, br.db, br.policy, user, req.CommunityId, req.Reason, req.ExpiresAt)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	if ban.Id, err = br.db.CreateBan(c, ban, modLogEntry(c, banModLogEntry(ban))); err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return gin.H{"id": ban.Id}, nil
+}
+
+// authorizeBan validates a ban of the user and checks the caller may issue it. Returns the ban to create
+func authorizeBan(c *gin.Context, database db.Database, policy *controllers.Policy, user *model.LocalUser, communityId *int64, reason string, expiresAt *time.Time) (*model.Ban, *util.HTTPError) {
+	reason = strings.TrimSpace(reason)
+	if len(reason) == 0 || len(reason) > maxBanReasonLength {
+		return nil, &util.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("reason must be between 1 and %v characters", maxBanReasonLength),
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, &util.HTTPError{Status: http.StatusBadRequest, Message: "expiresAt must be in the future"}
+	}
+
+	resource := &controllers.Resource{User: user}
+	if communityId != nil {
+		communities, err := database.GetCommunitiesByIds(c, []int64{*communityId}, &db.GetCommunitiesQueryOpts{})
+		if err != nil {
+			return nil, util.BuildDbHTTPErr(err)
+		}
+		if len(communities) == 0 {
+			return nil, util.BuildDoesNotExistHTTPErr("community")
+		}
+		resource.CommunityIds = []int64{*communityId}
+	}
+	if httpErr := authorize(c, policy, controllers.ActionBanUser, resource,
+		"only moderators of the community can ban its members and only admins can ban globally"); httpErr != nil {
+		return nil, httpErr
+	}
+	return &model.Ban{
+		UserId:      user.Id,
+		CommunityId: communityId,
+		Reason:      reason,
+		IssuedBy:    middleware.MustGetLocalUser(c).Id,
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+// getBans pages through the bans, newest first. Filtered by the userId, communityId and active query params. Only
+// admins can list bans across communities
+func (br *banRoutes) getBans(c *gin.Context) (interface{}, *util.HTTPError) {
+	query := &db.BansQuery{
+		UserId: c.Query("userId"),
+		Limit:  defaultBansLimit,
+	}
+	resource := &controllers.Resource{}
+	if communityId := c.Query("communityId"); communityId != "" {
+		id, httpErr := util.ParseId(communityId)
+		if httpErr != nil {
+			return nil, httpErr
+		}
+		query.CommunityId = &id
+		resource.CommunityIds = []int64{id}
+	}
+	if c.Query("active") == "true" {
+		now := time.Now()
+		query.ActiveAt = &now
+	}
+	if before := c.Query("before"); before != "" {
+		var httpErr *util.HTTPError
+		if query.BeforeId, httpErr = util.ParseId(before); httpErr != nil {
+			return nil, httpErr
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		var err error
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 || query.Limit > maxBansLimit {
+			return nil, &util.HTTPError{
+				Status:  http.StatusBadRequest,
+				Message: fmt.Sprintf("limit must be between 1 and %v", maxBansLimit),
+			}
+		}
+	}
+	if httpErr := authorize(c, br.policy, controllers.ActionViewBans, resource,
+		"only moderators can list the bans of their communities and only admins can list every ban"); httpErr != nil {
+		return nil, httpErr
+	}
+
+	bans, err := br.db.GetBans(c, query)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	var nextBefore *int64
+	if len(bans) == query.Limit {
+		nextBefore = &bans[len(bans)-1].Id
+	}
+	return gin.H{
+		"bans":       bans,
+		"nextBefore": nextBefore,
+	}, nil
+}
+
+// getMyBans returns the active bans of the user without saying who issued them
+func (br *banRoutes) getMyBans(c *gin.Context) (interface{}, *util.HTTPError) {
+	now := time.Now()
+	bans, err := br.db.GetBans(c, &db.BansQuery{
+		UserId:   middleware.MustGetLocalUser(c).Id,
+		ActiveAt: &now,
+		Limit:    maxBansLimit,
+	})
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	notices := make([]*model.BanNotice, len(bans))
+	for i, ban := range bans {
+		notices[i] = ban.Notice()
+	}
+	return notices, nil
+}
+
+// liftBan takes the same permission as issuing the ban
+func (br *banRoutes) liftBan(c *gin.Context) (interface{}, *util.HTTPError) {
+	id, httpErr := util.ParseId(c.Param("id"))
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	ban, err := br.db.GetBan(c, id)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	if ban == nil {
+		return nil, util.BuildDoesNotExistHTTPErr("ban")
+	}
+	if ban.LiftedAt != nil {
+		return nil, &util.HTTPError{Status: http.StatusConflict, Message: "ban already lifted"}
+	}
+
+	user, err := br.db.GetUser(c, ban.UserId)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	if user == nil {
+		user = &model.LocalUser{Id: ban.UserId}
+	}
+	resource := &controllers.Resource{User: user}
+	if !ban.IsGlobal() {
+		resource.CommunityIds = []int64{*ban.CommunityId}
+	}
+	if httpErr := authorize(c, br.policy, controllers.ActionBanUser, resource,
+		"only moderators of the community can lift its bans and only admins can lift global bans"); httpErr != nil {
+		return nil, httpErr
+	}
+	reason, httpErr := modReasonParam(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	entry := banModLogEntry(ban)
+	entry.Action = model.ModActionLiftBan
+	entry.TargetId = &ban.Id
+	entry.Reason = reason
+	if err := br.db.LiftBan(c, ban.Id, middleware.MustGetLocalUser(c).Id, modLogEntry(c, entry)); err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return nil, nil
+}
+
+// banModLogEntry is the entry of issuing the ban. The database sets its target once the ban is created
+func banModLogEntry(ban *model.Ban) *model.ModLogEntry {
+	entry := &model.ModLogEntry{
+		Action: model.ModActionBanUser,
+		UserId: &ban.UserId,
+		Reason: ban.Reason,
+	}
+	if !ban.IsGlobal() {
+		entry.CommunityIds = []int64{*ban.CommunityId}
+	}
+	return entry
+}
@@ -1,11 +1,11 @@
 package routes
 
 import (
-	"firebase.google.com/go/v4/auth"
 	"github.com/gin-gonic/gin"
 	"github.com/navbryce/next-dorm-be/controllers"
 	"github.com/navbryce/next-dorm-be/db"
 	"github.com/navbryce/next-dorm-be/middleware"
+	"github.com/navbryce/next-dorm-be/services"
 	"github.com/navbryce/next-dorm-be/util"
 	"net/http"
 )
@@ -13,13 +13,16 @@ import (
 type communityRoutes struct {
 	db         db.Database
 	controller *controllers.CommunityController
+	live       *controllers.LiveController
 }
 
-func AddCommunityRoutes(group *gin.RouterGroup, db db.Database, controller *controllers.CommunityController, authClient *auth.Client) {
-	routes := communityRoutes{db, controller}
-	posts := group.Group("/communities", middleware.GenAuth(db, authClient, &middleware.AuthConfig{}))
+func AddCommunityRoutes(group *gin.RouterGroup, db db.Database, controller *controllers.CommunityController, authenticator services.Authenticator, live *controllers.LiveController) {
+	routes := communityRoutes{db, controller, live}
+	posts := group.Group("/communities", middleware.GenAuth(db, authenticator, &middleware.AuthConfig{}))
 	posts.GET("/:id", util.HandlerWrapper(routes.getCommunityById, &util.HandlerOpts{}))
 	posts.GET("/:id/pos", util.HandlerWrapper(routes.getCommunityPos, &util.HandlerOpts{}))
+	streams := group.Group("/communities", middleware.GenAuth(db, authenticator, &middleware.AuthConfig{AllowQueryToken: true}))
+	streams.GET("/:id/stream", routes.streamCommunity)
 	//posts.PUT("", util.HandlerWrapper(routes.createCommunity, &util.HandlerOpts{}))
 }
 
@@ -68,3 +71,13 @@ func (cr *communityRoutes) getCommunityPos(c *gin.Context) (interface{}, *util.H
 	}
 	return communityPos, nil
 }
+
+// streamCommunity streams the new posts of the community's feed
+func (cr *communityRoutes) streamCommunity(c *gin.Context) {
+	id, httpErr := mustGetCommunityId(c, cr.db)
+	if httpErr != nil {
+		util.HandleHTTPErrorRes(c, httpErr)
+		return
+	}
+	streamLive(c, cr.live, controllers.CommunityTopic(id))
+}
@@ -0,0 +1,201 @@
+package routes
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/navbryce/next-dorm-be/controllers"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/middleware"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/navbryce/next-dorm-be/services"
+	"github.com/navbryce/next-dorm-be/util"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+)
+
+// unsubscribePage is shown to people following the unsubscribe link of a digest. Following the link only shows the
+// button, so link scanners don't unsubscribe anyone
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Unsubscribe</title>
+</head>
+<body style="margin: 0 auto; max-width: 600px; padding: 16px; font-family: sans-serif; color: #222;">
+  <p>{{.Message}}</p>
+  {{if .Confirm}}<form method="post"><button type="submit">Unsubscribe</button></form>{{end}}
+</body>
+</html>
+`))
+
+type digestRoutes struct {
+	db db.Database
+}
+
+// AddDigestRoutes adds the caller's digest preference, and the unsubscribe links of the digests. The digests are sent
+// by controllers.Digester
+func AddDigestRoutes(group *gin.RouterGroup, db db.Database, authenticator services.Authenticator) {
+	routes := digestRoutes{db}
+	digest := group.Group("/digest", middleware.GenAuth(db, authenticator, &middleware.AuthConfig{}), middleware.RequireAccount())
+	digest.GET("", util.HandlerWrapper(routes.getPreference, &util.HandlerOpts{}))
+	digest.PUT("", util.HandlerWrapper(routes.setPreference, &util.HandlerOpts{}))
+	group.GET(controllers.DigestUnsubscribePath, routes.confirmUnsubscribe)
+	// mail clients unsubscribe in one click by posting here (RFC 8058)
+	group.POST(controllers.DigestUnsubscribePath, routes.unsubscribe)
+}
+
+// getPreference returns the caller's preference, or what it would be if they opted in
+func (dr *digestRoutes) getPreference(c *gin.Context) (interface{}, *util.HTTPError) {
+	preference, err := dr.db.GetDigestPreference(c, middleware.MustGetLocalUser(c).Id)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	if preference == nil {
+		preference = &model.DigestPreference{
+			Email:     middleware.MustGetToken(c).Email,
+			Frequency: model.DigestOff,
+		}
+	}
+	return preference, nil
+}
+
+type digestPreferenceReq struct {
+	Frequency model.DigestFrequency `json:"frequency"`
+}
+
+// setPreference turns the digest on or off and sets how often it's sent. The digest goes to the email address of the
+// caller's account, which is updated every time the preference is set. A new (or changed) frequency sends a digest
+// with the next run
+func (dr *digestRoutes) setPreference(c *gin.Context) (interface{}, *util.HTTPError) {
+	var req digestPreferenceReq
+	if err := c.BindJSON(&req); err != nil {
+		return nil, util.BuildJSONBindHTTPErr(err)
+	}
+	if !req.Frequency.IsValid() {
+		return nil, &util.HTTPError{
+			Status: http.StatusBadRequest,
+			Message: fmt.Sprintf("frequency must be %v, %v or %v", model.DigestOff, model.DigestDaily,
+				model.DigestWeekly),
+		}
+	}
+	identity := middleware.MustGetToken(c)
+	if req.Frequency != model.DigestOff {
+		if identity.Email == "" {
+			return nil, &util.HTTPError{Status: http.StatusBadRequest, Message: "your account has no email address"}
+		}
+		if verified, ok := identity.Claims["email_verified"].(bool); ok && !verified {
+			return nil, &util.HTTPError{Status: http.StatusBadRequest, Message: "verify your email address first"}
+		}
+	}
+
+	userId := middleware.MustGetLocalUser(c).Id
+	preference, err := dr.db.GetDigestPreference(c, userId)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	now := time.Now()
+	if preference == nil {
+		if req.Frequency == model.DigestOff {
+			return &model.DigestPreference{Email: identity.Email, Frequency: model.DigestOff}, nil
+		}
+		token, err := controllers.NewUnsubscribeToken()
+		if err != nil {
+			return nil, &util.HTTPError{Status: http.StatusInternalServerError, Message: "could not generate a token"}
+		}
+		preference = &model.DigestPreference{
+			UserId:           userId,
+			Email:            identity.Email,
+			Frequency:        req.Frequency,
+			UnsubscribeToken: token,
+			NextSendAt:       &now,
+		}
+		if err := dr.db.CreateDigestPreference(c, preference); err != nil {
+			return nil, util.BuildDbHTTPErr(err)
+		}
+		return preference, nil
+	}
+
+	if identity.Email != "" {
+		preference.Email = identity.Email
+	}
+	if preference.Frequency != req.Frequency {
+		preference.Frequency = req.Frequency
+		preference.NextSendAt = &now
+		if req.Frequency == model.DigestOff {
+			preference.NextSendAt = nil
+		}
+	}
+	if err := dr.db.UpdateDigestPreference(c, preference); err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return preference, nil
+}
+
+type unsubscribePageData struct {
+	Message string
+	Confirm bool
+}
+
+func (dr *digestRoutes) confirmUnsubscribe(c *gin.Context) {
+	preference, httpErr := dr.getPreferenceByToken(c)
+	switch {
+	case httpErr != nil:
+		renderUnsubscribePage(c, httpErr.Status, &unsubscribePageData{Message: httpErr.Message})
+	case preference.Frequency == model.DigestOff:
+		renderUnsubscribePage(c, http.StatusOK, &unsubscribePageData{Message: "You're already unsubscribed from the digest."})
+	default:
+		renderUnsubscribePage(c, http.StatusOK, &unsubscribePageData{
+			Message: fmt.Sprintf("Stop emailing the digest to %v?", preference.Email),
+			Confirm: true,
+		})
+	}
+}
+
+// unsubscribe turns the digest off. Unsubscribing twice is fine
+func (dr *digestRoutes) unsubscribe(c *gin.Context) {
+	preference, httpErr := dr.getPreferenceByToken(c)
+	if httpErr != nil {
+		renderUnsubscribePage(c, httpErr.Status, &unsubscribePageData{Message: httpErr.Message})
+		return
+	}
+	if preference.Frequency != model.DigestOff {
+		preference.Frequency = model.DigestOff
+		preference.NextSendAt = nil
+		if err := dr.db.UpdateDigestPreference(c, preference); err != nil {
+			httpErr := util.BuildDbHTTPErr(err)
+			renderUnsubscribePage(c, httpErr.Status, &unsubscribePageData{Message: httpErr.Message})
+			return
+		}
+	}
+	renderUnsubscribePage(c, http.StatusOK, &unsubscribePageData{
+		Message: fmt.Sprintf("You won't get the digest at %v anymore.", preference.Email),
+	})
+}
+
+func (dr *digestRoutes) getPreferenceByToken(c *gin.Context) (*model.DigestPreference, *util.HTTPError) {
+	token := c.Query("token")
+	if token == "" {
+		return nil, &util.HTTPError{Status: http.StatusBadRequest, Message: "The unsubscribe link is missing its token."}
+	}
+	preference, err := dr.db.GetDigestPreferenceByToken(c, token)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	if preference == nil {
+		return nil, &util.HTTPError{Status: http.StatusNotFound, Message: "The unsubscribe link is no longer valid."}
+	}
+	return preference, nil
+}
+
+func renderUnsubscribePage(c *gin.Context, status int, data *unsubscribePageData) {
+	var page bytes.Buffer
+	if err := unsubscribePage.Execute(&page, data); err != nil {
+		log.Println("an error occurred while rendering the unsubscribe page", err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", page.Bytes())
+}
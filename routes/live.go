@@ -0,0 +1,41 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/navbryce/next-dorm-be/controllers"
+	"github.com/navbryce/next-dorm-be/middleware"
+	"io"
+	"net/http"
+	"time"
+)
+
+// streamLive writes the messages of the topic to the response as Server-Sent Events until the client leaves or falls
+// too far behind. Not wrapped by util.HandlerWrapper since the response is a stream
+func streamLive(c *gin.Context, live *controllers.LiveController, topic string) {
+	sub := live.Subscribe(topic, middleware.GetLocalUser(c))
+	defer live.Unsubscribe(sub)
+	heartbeat := time.NewTicker(live.Heartbeat())
+	defer heartbeat.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	// proxies such as nginx would otherwise buffer the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case message, ok := <-sub.Messages:
+			if !ok {
+				return false
+			}
+			c.SSEvent(message.Event, message.Data)
+			return true
+		case <-heartbeat.C:
+			c.SSEvent("ping", "")
+			return true
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/navbryce/next-dorm-be/controllers"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/middleware"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/navbryce/next-dorm-be/services"
+	"github.com/navbryce/next-dorm-be/util"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxModLogReasonLength = 1000
+	defaultModLogLimit    = 50
+	maxModLogLimit        = 200
+)
+
+type modLogRoutes struct {
+	db          db.Database
+	policy      *controllers.Policy
+	communities *controllers.CommunityController
+}
+
+// AddModLogRoutes adds the read API of the moderation log. Entries are written by the routes that take the actions
+func AddModLogRoutes(group *gin.RouterGroup, db db.Database, authenticator services.Authenticator, policy *controllers.Policy, communities *controllers.CommunityController) {
+	routes := modLogRoutes{db, policy, communities}
+	modLog := group.Group("/modlog", middleware.GenAuth(db, authenticator, &middleware.AuthConfig{}), middleware.RequireAccount())
+	modLog.GET("", util.HandlerWrapper(routes.getModLog, &util.HandlerOpts{}))
+}
+
+// getModLog pages through the log, newest first. Filtered by the communityId (which includes its descendants),
+// actorId and action query params. Only admins can read the log across communities
+func (mr *modLogRoutes) getModLog(c *gin.Context) (interface{}, *util.HTTPError) {
+	query := &db.ModLogQuery{
+		ActorId: c.Query("actorId"),
+		Action:  model.ModAction(c.Query("action")),
+		Limit:   defaultModLogLimit,
+	}
+	resource := &controllers.Resource{}
+	if communityId := c.Query("communityId"); communityId != "" {
+		id, httpErr := util.ParseId(communityId)
+		if httpErr != nil {
+			return nil, httpErr
+		}
+		query.CommunityIds = mr.communities.Descendants(id)
+		resource.CommunityIds = []int64{id}
+	}
+	if before := c.Query("before"); before != "" {
+		var httpErr *util.HTTPError
+		if query.BeforeId, httpErr = util.ParseId(before); httpErr != nil {
+			return nil, httpErr
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		var err error
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 || query.Limit > maxModLogLimit {
+			return nil, &util.HTTPError{
+				Status:  http.StatusBadRequest,
+				Message: fmt.Sprintf("limit must be between 1 and %v", maxModLogLimit),
+			}
+		}
+	}
+	if httpErr := authorize(c, mr.policy, controllers.ActionViewModLog, resource,
+		"only moderators can read the log of their communities and only admins can read the whole log"); httpErr != nil {
+		return nil, httpErr
+	}
+
+	entries, err := mr.db.GetModLogEntries(c, query)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	var nextBefore *int64
+	if len(entries) == query.Limit {
+		nextBefore = &entries[len(entries)-1].Id
+	}
+	return gin.H{
+		"entries":    entries,
+		"nextBefore": nextBefore,
+	}, nil
+}
+
+// modLogEntry makes the caller the actor of the entry. The database records the entry along with the action
+func modLogEntry(c *gin.Context, entry *model.ModLogEntry) *model.ModLogEntry {
+	entry.ActorId = middleware.MustGetLocalUser(c).Id
+	if entry.CommunityIds == nil {
+		entry.CommunityIds = []int64{}
+	}
+	return entry
+}
+
+// contentModLogEntry is the entry of the action taken on the post or comment, or nil if it's the caller's own
+func contentModLogEntry(c *gin.Context, content *model.ContentMetadata, entry *model.ModLogEntry) *model.ModLogEntry {
+	if isOwnContent(c, content) {
+		return nil
+	}
+	return modLogEntry(c, entry)
+}
+
+// recordModAction adds the action taken by the caller to the moderation log, for actions that aren't in the database.
+// Called before the action
+func recordModAction(c *gin.Context, modLog db.ModLogDatabase, entry *model.ModLogEntry) *util.HTTPError {
+	if _, err := modLog.CreateModLogEntry(c, modLogEntry(c, entry)); err != nil {
+		log.Println("error recording moderation action", entry.Action, err)
+		return util.BuildDbHTTPErr(err)
+	}
+	return nil
+}
+
+// modReasonParam is the optional reason query param of privileged deletes
+func modReasonParam(c *gin.Context) (string, *util.HTTPError) {
+	reason := strings.TrimSpace(c.Query("reason"))
+	if len(reason) > maxModLogReasonLength {
+		return "", &util.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("reason must be at most %v characters", maxModLogReasonLength),
+		}
+	}
+	return util.XSSSanitize(reason), nil
+}
+
+// isOwnContent is true if the caller created the content, in which case acting on it isn't logged
+func isOwnContent(c *gin.Context, content *model.ContentMetadata) bool {
+	user := middleware.GetLocalUser(c)
+	return user != nil && content.Creator.LocalUser != nil && content.Creator.Id == user.Id
+}
@@ -0,0 +1,113 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/middleware"
+	"github.com/navbryce/next-dorm-be/services"
+	"github.com/navbryce/next-dorm-be/util"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultNotificationLimit = 50
+	maxNotificationLimit     = 200
+	maxNotificationExcerpt   = 200 // characters
+	maxMarkReadIds           = 200
+)
+
+type notificationRoutes struct {
+	db db.Database
+}
+
+// AddNotificationRoutes adds the caller's inbox. Notifications are created by the routes that write the content they're
+// about
+func AddNotificationRoutes(group *gin.RouterGroup, db db.Database, authenticator services.Authenticator) {
+	routes := notificationRoutes{db}
+	notifications := group.Group("/notifications", middleware.GenAuth(db, authenticator, &middleware.AuthConfig{}), middleware.RequireAccount())
+	notifications.GET("", util.HandlerWrapper(routes.getNotifications, &util.HandlerOpts{}))
+	notifications.GET("/unread-count", util.HandlerWrapper(routes.getUnreadCount, &util.HandlerOpts{}))
+	notifications.PUT("/read", util.HandlerWrapper(routes.markRead, &util.HandlerOpts{}))
+}
+
+// getNotifications pages through the inbox, newest first. unread=true leaves out the notifications already read
+func (nr *notificationRoutes) getNotifications(c *gin.Context) (interface{}, *util.HTTPError) {
+	query := &db.NotificationsQuery{
+		UserId:     middleware.MustGetLocalUser(c).Id,
+		UnreadOnly: c.Query("unread") == "true",
+		Limit:      defaultNotificationLimit,
+	}
+	if before := c.Query("before"); before != "" {
+		var httpErr *util.HTTPError
+		if query.BeforeId, httpErr = util.ParseId(before); httpErr != nil {
+			return nil, httpErr
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		var err error
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 || query.Limit > maxNotificationLimit {
+			return nil, &util.HTTPError{
+				Status:  http.StatusBadRequest,
+				Message: fmt.Sprintf("limit must be between 1 and %v", maxNotificationLimit),
+			}
+		}
+	}
+
+	notifications, err := nr.db.GetNotifications(c, query)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	for _, notification := range notifications {
+		if excerpt := []rune(notification.Excerpt); len(excerpt) > maxNotificationExcerpt {
+			notification.Excerpt = string(excerpt[:maxNotificationExcerpt]) + "…"
+		}
+	}
+	var nextBefore *int64
+	if len(notifications) == query.Limit {
+		nextBefore = &notifications[len(notifications)-1].Id
+	}
+	return gin.H{
+		"notifications": notifications,
+		"nextBefore":    nextBefore,
+	}, nil
+}
+
+func (nr *notificationRoutes) getUnreadCount(c *gin.Context) (interface{}, *util.HTTPError) {
+	count, err := nr.db.CountUnreadNotifications(c, middleware.MustGetLocalUser(c).Id)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return gin.H{"count": count}, nil
+}
+
+type markReadReq struct {
+	Ids []int64 `json:"ids"`
+	All bool    `json:"all"`
+}
+
+// markRead marks the notifications with the ids read, or all of them. Ids of other users' notifications are ignored
+func (nr *notificationRoutes) markRead(c *gin.Context) (interface{}, *util.HTTPError) {
+	var req markReadReq
+	if err := c.BindJSON(&req); err != nil {
+		return nil, util.BuildJSONBindHTTPErr(err)
+	}
+	if req.All == (len(req.Ids) > 0) {
+		return nil, &util.HTTPError{Status: http.StatusBadRequest, Message: "either ids or all must be set"}
+	}
+	if len(req.Ids) > maxMarkReadIds {
+		return nil, &util.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("at most %v notifications can be marked read at once", maxMarkReadIds),
+		}
+	}
+	var ids []int64
+	if !req.All {
+		ids = req.Ids
+	}
+	if err := nr.db.MarkNotificationsRead(c, middleware.MustGetLocalUser(c).Id, ids); err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return nil, nil
+}
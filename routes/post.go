@@ -1,15 +1,20 @@
 package routes
 
 import (
-	"firebase.google.com/go/v4/auth"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/navbryce/next-dorm-be/app"
+	"github.com/navbryce/next-dorm-be/config"
+	"github.com/navbryce/next-dorm-be/controllers"
 	"github.com/navbryce/next-dorm-be/db"
 	"github.com/navbryce/next-dorm-be/middleware"
 	"github.com/navbryce/next-dorm-be/model"
 	"github.com/navbryce/next-dorm-be/services"
 	"github.com/navbryce/next-dorm-be/util"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
@@ -17,25 +22,44 @@ import (
 
 type postRoutes struct {
 	db                db.Database
-	userUploadsBucket *services.StorageBucket
+	userUploadsBucket services.BlobStore
+	imageProcessor    *services.ImageProcessor
+	aliases           *services.AliasService
+	policy            *controllers.Policy
+	automod           *controllers.AutomodController
+	cfg               *config.PostConfig
+	notifier          *controllers.Notifier
+	live              *controllers.LiveController
+	webhooks          *controllers.WebhookController
+	avatars           *util.AvatarBuilder
 }
 
-func AddPostRoutes(group *gin.RouterGroup, db db.Database, authClient *auth.Client, userUploadsBucket *services.StorageBucket) {
-	routes := postRoutes{db, userUploadsBucket}
-	posts := group.Group("/posts", middleware.GenAuth(db, authClient, &middleware.AuthConfig{}))
+func AddPostRoutes(group *gin.RouterGroup, db db.Database, authenticator services.Authenticator, userUploadsBucket services.BlobStore, imageProcessor *services.ImageProcessor, aliases *services.AliasService, policy *controllers.Policy, automod *controllers.AutomodController, limiter *services.RateLimiter, cfg *config.PostConfig, notifier *controllers.Notifier, live *controllers.LiveController, webhooks *controllers.WebhookController, avatars *util.AvatarBuilder) {
+	routes := postRoutes{db, userUploadsBucket, imageProcessor, aliases, policy, automod, cfg, notifier, live, webhooks, avatars}
+	posts := group.Group("/posts", middleware.GenAuth(db, authenticator, &middleware.AuthConfig{}))
+	streams := group.Group("/posts", middleware.GenAuth(db, authenticator, &middleware.AuthConfig{AllowQueryToken: true}))
+	streams.GET("/:id/stream", routes.streamPost)
 	posts.POST("",
 		util.HandlerWrapper(routes.getPosts, &util.HandlerOpts{}))
-	posts.PUT("", middleware.RequireAccount(), util.HandlerWrapper(routes.createPost, &util.HandlerOpts{}))
+	notBannedFromNewPost := middleware.RequireNotBanned(policy, newPostCommunities)
+	notBannedFromPost := middleware.RequireNotBanned(policy, routes.postCommunities)
+	postLimit := middleware.RateLimit(limiter, config.RateLimitGroupPosts)
+	commentLimit := middleware.RateLimit(limiter, config.RateLimitGroupComments)
+	voteLimit := middleware.RateLimit(limiter, config.RateLimitGroupVotes)
+	reportLimit := middleware.RateLimit(limiter, config.RateLimitGroupReports)
+	posts.PUT("", middleware.RequireAccount(), postLimit, notBannedFromNewPost, util.HandlerWrapper(routes.createPost, &util.HandlerOpts{}))
 	posts.GET("/:id", util.HandlerWrapper(routes.getPostById, &util.HandlerOpts{}))
-	posts.PUT("/:id", middleware.RequireAccount(), util.HandlerWrapper(routes.editPost, &util.HandlerOpts{}))
+	posts.PUT("/:id", middleware.RequireAccount(), postLimit, notBannedFromPost, util.HandlerWrapper(routes.editPost, &util.HandlerOpts{}))
 	posts.DELETE("/:id", middleware.RequireAccount(), util.HandlerWrapper(routes.deletePost, &util.HandlerOpts{}))
-	posts.PUT("/:id/votes", middleware.RequireAccount(), util.HandlerWrapper(routes.voteForPost, &util.HandlerOpts{}))
-	posts.PUT("/:id/comments", middleware.RequireAccount(), util.HandlerWrapper(routes.createComment, &util.HandlerOpts{}))
+	posts.DELETE("/:id/communities/:community-id", middleware.RequireAccount(), util.HandlerWrapper(routes.removePostFromCommunity, &util.HandlerOpts{}))
+	posts.PUT("/:id/votes", middleware.RequireAccount(), voteLimit, notBannedFromPost, util.HandlerWrapper(routes.voteForPost, &util.HandlerOpts{}))
+	posts.PUT("/:id/comments", middleware.RequireAccount(), commentLimit, notBannedFromPost, util.HandlerWrapper(routes.createComment, &util.HandlerOpts{}))
 	posts.GET("/:id/comments", util.HandlerWrapper(routes.getComments, &util.HandlerOpts{}))
-	posts.PUT("/:id/comments/:comment-id", middleware.RequireAccount(), util.HandlerWrapper(routes.editComment, &util.HandlerOpts{}))
+	posts.PUT("/:id/comments/:comment-id", middleware.RequireAccount(), commentLimit, notBannedFromPost, util.HandlerWrapper(routes.editComment, &util.HandlerOpts{}))
 	posts.DELETE("/:id/comments/:comment-id", middleware.RequireAccount(), util.HandlerWrapper(routes.deleteComment, &util.HandlerOpts{}))
-	posts.PUT("/:id/comments/:comment-id/votes", middleware.RequireAccount(), util.HandlerWrapper(routes.voteForComment, &util.HandlerOpts{}))
-	posts.PUT("/:id/reports", middleware.RequireAccount(), util.HandlerWrapper(routes.report, &util.HandlerOpts{}))
+	posts.PUT("/:id/comments/:comment-id/votes", middleware.RequireAccount(), voteLimit, notBannedFromPost, util.HandlerWrapper(routes.voteForComment, &util.HandlerOpts{}))
+	posts.PUT("/:id/comments/:comment-id/reports", middleware.RequireAccount(), reportLimit, notBannedFromPost, util.HandlerWrapper(routes.reportComment, &util.HandlerOpts{}))
+	posts.PUT("/:id/reports", middleware.RequireAccount(), reportLimit, notBannedFromPost, util.HandlerWrapper(routes.reportPost, &util.HandlerOpts{}))
 }
 
 type createPostReq struct {
@@ -80,11 +104,18 @@ func (pr *postRoutes) createPost(c *gin.Context) (interface{}, *util.HTTPError)
 		}
 	}
 
-	// TODO: Enable multiple communities in the future?
-	if len(req.Communities) != 1 {
+	// a post can be cross-posted to several communities. bans and automod apply per community
+	var communityIds []int64
+	for _, communityId := range req.Communities {
+		if !containsId(communityIds, communityId) {
+			communityIds = append(communityIds, communityId)
+		}
+	}
+	req.Communities = communityIds
+	if len(req.Communities) == 0 || len(req.Communities) > pr.cfg.MaxCommunities {
 		return nil, &util.HTTPError{
 			Status:  http.StatusBadRequest,
-			Message: "post must belong to at exactly one community",
+			Message: fmt.Sprintf("post must belong to between 1 and %v communities", pr.cfg.MaxCommunities),
 		}
 	}
 
@@ -96,13 +127,29 @@ func (pr *postRoutes) createPost(c *gin.Context) (interface{}, *util.HTTPError)
 		return nil, util.BuildDoesNotExistHTTPErr("community")
 	}
 
-	if err := pr.imagesMustExist(c, req.ImageBlobNames); err != nil {
+	if err := pr.imagesMustBeOwned(c, req.ImageBlobNames); err != nil {
 		return nil, err
 	}
+	verdict, httpErr := checkAutomod(c, pr.automod, &controllers.AutomodContent{
+		IsNew:        true,
+		Text:         req.Title + "\n" + req.Content,
+		NumImages:    len(req.ImageBlobNames),
+		CommunityIds: req.Communities,
+	})
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	images, httpErr := pr.processImages(c, req.ImageBlobNames)
+	if httpErr != nil {
+		return nil, httpErr
+	}
 
-	var creatorAlias model.AnonymousUser
+	// the post starts a new thread, so any alias is unique in it
+	creatorAlias := ""
 	if req.Visibility == model.VisibilityHidden {
-		creatorAlias = *util.GenerateAnonymousUser()
+		if creatorAlias, err = services.NewAlias(); err != nil {
+			return nil, buildAliasHTTPErr(err)
+		}
 	}
 
 	id, err := pr.db.CreatePost(c, &db.CreatePost{
@@ -110,17 +157,31 @@ func (pr *postRoutes) createPost(c *gin.Context) (interface{}, *util.HTTPError)
 		Content:     req.Content,
 		Communities: req.Communities,
 		CreateContentMetadata: &db.CreateContentMetadata{
-			CreatorId:      middleware.MustGetToken(c).UID,
-			Visibility:     req.Visibility,
-			CreatorAlias:   creatorAlias.DisplayName,
-			ImageBlobNames: req.ImageBlobNames,
+			CreatorId:    middleware.MustGetToken(c).UID,
+			Visibility:   req.Visibility,
+			CreatorAlias: creatorAlias,
+			Images:       images,
+			Held:         isHeld(verdict),
+			// the id of the post is set once it's created
+			AutomodReport: automodReport(verdict, &model.ReportTarget{Type: model.ReportTargetPost}),
 		},
 	})
 	if err != nil {
 		return nil, util.BuildDbHTTPErr(err)
 	}
+	// held content notifies and streams once a moderator releases it
+	if !isHeld(verdict) {
+		pr.notifier.ContentCreated(c, &controllers.NewContent{
+			SenderId: middleware.MustGetToken(c).UID,
+			PostId:   id,
+			Text:     req.Title + "\n" + req.Content,
+		})
+		pr.live.Publish(c, &model.LiveEvent{Type: model.LiveEventCreated, PostId: id})
+		pr.webhooks.PostCreated(c, id)
+	}
 	return gin.H{
-		"id": id,
+		"id":   id,
+		"held": isHeld(verdict),
 	}, nil
 }
 
@@ -161,33 +222,74 @@ func (pr *postRoutes) editPost(c *gin.Context) (interface{}, *util.HTTPError) {
 		return nil, err
 	}
 
-	if !post.CanEdit(middleware.GetLocalUser(c)) {
-		// TODO: Create permission checking system where model just defines a permission object
-		return nil, util.BuildOperationForbidden("must be owner or admin. or the content is deleted")
+	if httpErr := authorize(c, pr.policy, controllers.ActionEditContent, postResource(post),
+		"must be owner or admin. or the content is deleted"); httpErr != nil {
+		return nil, httpErr
+	}
+	reason, httpErr := modReasonParam(c)
+	if httpErr != nil {
+		return nil, httpErr
 	}
 
-	if err := pr.imagesMustExist(c, req.ImageBlobNames.Added); err != nil {
+	if err := pr.imagesMustBeOwned(c, req.ImageBlobNames.Added); err != nil {
 		return nil, err
 	}
+	removed := make(map[string]bool)
+	for _, blobName := range req.ImageBlobNames.Removed {
+		removed[blobName] = true
+	}
+	numImages := len(req.ImageBlobNames.Added)
+	for _, blobName := range post.ImageBlobNames {
+		if !removed[blobName] {
+			numImages++
+		}
+	}
+	verdict, httpErr := checkAutomod(c, pr.automod, &controllers.AutomodContent{
+		Text:         req.Title + "\n" + req.Content,
+		NumImages:    numImages,
+		CommunityIds: postResource(post).CommunityIds,
+	})
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	imagesToAdd, httpErr := pr.processImages(c, req.ImageBlobNames.Added)
+	if httpErr != nil {
+		return nil, httpErr
+	}
 
-	var newAlias model.AnonymousUser
+	newAlias := ""
 	if len(post.Creator.AnonymousUser.DisplayName) == 0 && req.Visibility == model.VisibilityHidden {
-		newAlias = *util.GenerateAnonymousUser()
+		alias, err := pr.aliases.ThreadAlias(c, post.ContentMetadata.Id, post.Creator.Id)
+		if err != nil {
+			return nil, buildAliasHTTPErr(err)
+		}
+		newAlias = alias.DisplayName
 	}
 
+	entry := contentModLogEntry(c, post.ContentMetadata, &model.ModLogEntry{
+		Action:       model.ModActionEditPost,
+		PostId:       &post.Id,
+		CommunityIds: postResource(post).CommunityIds,
+		Reason:       reason,
+	})
 	if err := pr.db.EditPost(c, post.Id, &db.EditPost{
 		Title:   req.Title,
 		Content: req.Content,
 		EditContentMetadata: &db.EditContentMetadata{
-			ImageBlobNamesToAdd:    req.ImageBlobNames.Added,
+			ImagesToAdd:            imagesToAdd,
 			ImageBlobNamesToRemove: req.ImageBlobNames.Removed,
 			Visibility:             req.Visibility,
-			CreatorAlias:           newAlias.DisplayName,
+			CreatorAlias:           newAlias,
+			ModLog:                 entry,
+			Held:                   isHeld(verdict),
+			AutomodReport:          automodReport(verdict, &model.ReportTarget{Type: model.ReportTargetPost, PostId: &post.Id}),
 		},
 	},
 	); err != nil {
 		return nil, util.BuildDbHTTPErr(err)
 	}
+	pr.live.Publish(c, &model.LiveEvent{Type: model.LiveEventEdited, PostId: post.Id})
+	pr.notifier.ModAction(c, post.ContentMetadata, entry)
 	return nil, nil
 }
 
@@ -197,13 +299,76 @@ func (pr *postRoutes) deletePost(c *gin.Context) (interface{}, *util.HTTPError)
 	if httpErr != nil {
 		return nil, httpErr
 	}
-	if !post.CanDelete(middleware.MustGetLocalUser(c)) {
-		// TODO: Switch to permission system
-		return nil, util.BuildOperationForbidden("user is not the owner of the post or an admin")
+	if httpErr := authorize(c, pr.policy, controllers.ActionRemoveContent, postResource(post),
+		"user is not the owner of the post or a moderator of its community"); httpErr != nil {
+		return nil, httpErr
 	}
-	if err := pr.db.MarkPostAsDeleted(c, post.Id); err != nil {
+	reason, httpErr := modReasonParam(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	entry := contentModLogEntry(c, post.ContentMetadata, &model.ModLogEntry{
+		Action:       model.ModActionRemovePost,
+		PostId:       &post.Id,
+		CommunityIds: postResource(post).CommunityIds,
+		Reason:       reason,
+	})
+	if err := pr.db.MarkPostAsDeleted(c, post.Id, entry); err != nil {
 		return nil, util.BuildDbHTTPErr(err)
 	}
+	pr.live.Publish(c, &model.LiveEvent{Type: model.LiveEventDeleted, PostId: post.Id})
+	pr.webhooks.PostDeleted(c, post)
+	pr.notifier.ModAction(c, post.ContentMetadata, entry)
+	return nil, nil
+}
+
+// removePostFromCommunity takes a cross-posted post out of one community and leaves it in the others. Moderators of
+// the community can do it without moderating the rest
+func (pr *postRoutes) removePostFromCommunity(c *gin.Context) (interface{}, *util.HTTPError) {
+	post, httpErr := pr.mustGetPostByIdStr(c, c.Param("id"))
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	communityId, httpErr := util.ParseId(c.Param("community-id"))
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	notInCommunity := &util.HTTPError{Status: http.StatusNotFound, Message: "the post isn't in the community"}
+	if !containsId(postResource(post).CommunityIds, communityId) {
+		return nil, notInCommunity
+	}
+	if httpErr := authorize(c, pr.policy, controllers.ActionRemoveContent, &controllers.Resource{
+		Content:      post.ContentMetadata,
+		CommunityIds: []int64{communityId},
+	}, "user is not the owner of the post or a moderator of the community"); httpErr != nil {
+		return nil, httpErr
+	}
+	reason, httpErr := modReasonParam(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	entry := contentModLogEntry(c, post.ContentMetadata, &model.ModLogEntry{
+		Action:       model.ModActionRemovePostFromCommunity,
+		PostId:       &post.Id,
+		CommunityIds: []int64{communityId},
+		Reason:       reason,
+	})
+	if err := pr.db.RemovePostFromCommunity(c, post.Id, communityId, entry); err != nil {
+		switch err {
+		case db.ErrNotFound:
+			return nil, notInCommunity
+		case db.ErrLastCommunity:
+			return nil, &util.HTTPError{
+				Status:  http.StatusBadRequest,
+				Message: "the post is only in this community. delete it instead",
+			}
+		default:
+			return nil, util.BuildDbHTTPErr(err)
+		}
+	}
+	pr.live.Publish(c, &model.LiveEvent{Type: model.LiveEventEdited, PostId: post.Id})
+	pr.webhooks.PostRemovedFromCommunity(c, post, communityId)
+	pr.notifier.ModAction(c, post.ContentMetadata, entry)
 	return nil, nil
 }
 
@@ -236,32 +401,43 @@ func (pr *postRoutes) createComment(c *gin.Context) (interface{}, *util.HTTPErro
 		}
 	}
 
-	var parentMetadataId int64
-	var rootMetadataId int64
-	var httpErr *util.HTTPError
-	if req.ParentCommentId == 0 {
-		var post *model.Post
-		post, httpErr = pr.mustGetPostByIdStr(c, c.Param("id"))
-		if httpErr != nil {
-			return nil, httpErr
-		}
-		rootMetadataId = post.ContentMetadata.Id
-		parentMetadataId = rootMetadataId
-	} else {
+	// automod checks the comment against the rules of the post's communities
+	post, httpErr := pr.mustGetPostByIdStr(c, c.Param("id"))
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	rootMetadataId := post.ContentMetadata.Id
+	parentMetadataId := rootMetadataId
+	var parent *model.ContentMetadata
+	var parentCommentId *int64
+	if req.ParentCommentId != 0 {
 		comment, err := pr.db.GetCommentById(c, req.ParentCommentId)
 		if err != nil {
 			return nil, util.BuildDbHTTPErr(err)
-		} else if comment == nil {
+		} else if comment == nil || comment.PostMetadataId != rootMetadataId {
 			return nil, util.BuildDoesNotExistHTTPErr("comment")
 		}
-		rootMetadataId = comment.PostMetadataId
 		parentMetadataId = comment.ContentMetadata.Id
+		parent = comment.ContentMetadata
+		parentCommentId = &comment.Id
+	}
+	verdict, httpErr := checkAutomod(c, pr.automod, &controllers.AutomodContent{
+		IsComment:    true,
+		IsNew:        true,
+		Text:         req.Content,
+		CommunityIds: postResource(post).CommunityIds,
+	})
+	if httpErr != nil {
+		return nil, httpErr
 	}
 
 	var alias *model.AnonymousUser
 	aliasDisplayName := ""
 	if req.Visibility == model.VisibilityHidden {
-		alias = util.GenerateAnonymousUser()
+		var err error
+		if alias, err = pr.aliases.ThreadAlias(c, rootMetadataId, middleware.MustGetToken(c).UID); err != nil {
+			return nil, buildAliasHTTPErr(err)
+		}
 		aliasDisplayName = alias.DisplayName
 	}
 
@@ -273,14 +449,35 @@ func (pr *postRoutes) createComment(c *gin.Context) (interface{}, *util.HTTPErro
 			CreatorId:    middleware.MustGetToken(c).UID,
 			Visibility:   req.Visibility,
 			CreatorAlias: aliasDisplayName,
+			Held:         isHeld(verdict),
+			// the id of the comment is set once it's created
+			AutomodReport: automodReport(verdict, &model.ReportTarget{Type: model.ReportTargetComment, PostId: &post.Id}),
 		},
 	})
 	if err != nil {
 		return nil, util.BuildDbHTTPErr(err)
 	}
+	if !isHeld(verdict) {
+		pr.notifier.ContentCreated(c, &controllers.NewContent{
+			SenderId:  middleware.MustGetToken(c).UID,
+			PostId:    post.Id,
+			CommentId: &id,
+			Post:      post.ContentMetadata,
+			Parent:    parent,
+			Text:      req.Content,
+		})
+		pr.live.Publish(c, &model.LiveEvent{
+			Type:            model.LiveEventCreated,
+			PostId:          post.Id,
+			CommentId:       &id,
+			ParentCommentId: parentCommentId,
+		})
+		pr.webhooks.CommentCreated(c, post, id, parentCommentId)
+	}
 	return &gin.H{
 		"id":    id,
 		"alias": alias,
+		"held":  isHeld(verdict),
 	}, nil
 }
 
@@ -311,45 +508,109 @@ func (pr *postRoutes) editComment(c *gin.Context) (interface{}, *util.HTTPError)
 		return nil, httpErr
 	}
 	// TODO: Check if comment exists under post?
-	if !comment.CanEdit(middleware.MustGetLocalUser(c)) {
-		return nil, util.BuildOperationForbidden("user is not owner of the comment or admin. or the content is deleted.")
+	if httpErr := authorize(c, pr.policy, controllers.ActionEditContent, &controllers.Resource{Content: comment.ContentMetadata},
+		"user is not owner of the comment or admin. or the content is deleted."); httpErr != nil {
+		return nil, httpErr
+	}
+	reason, httpErr := modReasonParam(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	// automod and the moderation log go by the communities of the post
+	post, httpErr := pr.mustGetPostByIdStr(c, c.Param("id"))
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	if comment.PostMetadataId != post.ContentMetadata.Id {
+		return nil, util.BuildDoesNotExistHTTPErr("comment")
+	}
+	verdict, httpErr := checkAutomod(c, pr.automod, &controllers.AutomodContent{
+		IsComment:    true,
+		Text:         req.Content,
+		CommunityIds: postResource(post).CommunityIds,
+	})
+	if httpErr != nil {
+		return nil, httpErr
 	}
 
 	newAliasDisplayName := ""
 	var alias *model.AnonymousUser
 	if req.Visibility == model.VisibilityHidden {
-		alias = comment.Creator.AnonymousUser
+		alias = pr.avatars.AnonymousUser(comment.Creator.AnonymousUser.DisplayName)
 		if len(comment.Creator.AnonymousUser.DisplayName) == 0 && req.Visibility == model.VisibilityHidden {
-			alias = util.GenerateAnonymousUser()
+			var err error
+			if alias, err = pr.aliases.ThreadAlias(c, comment.PostMetadataId, comment.Creator.Id); err != nil {
+				return nil, buildAliasHTTPErr(err)
+			}
 			newAliasDisplayName = alias.DisplayName
 		}
 	}
 
+	entry := contentModLogEntry(c, comment.ContentMetadata, &model.ModLogEntry{
+		Action:       model.ModActionEditComment,
+		PostId:       &post.Id,
+		CommentId:    &comment.Id,
+		CommunityIds: postResource(post).CommunityIds,
+		Reason:       reason,
+	})
 	if err := pr.db.EditComment(c, comment.Id, &db.EditComment{
 		EditContentMetadata: &db.EditContentMetadata{
 			Visibility:   req.Visibility,
 			CreatorAlias: newAliasDisplayName,
+			ModLog:       entry,
+			Held:         isHeld(verdict),
+			AutomodReport: automodReport(verdict, &model.ReportTarget{
+				Type:      model.ReportTargetComment,
+				PostId:    &post.Id,
+				CommentId: &comment.Id,
+			}),
 		},
 		Content: req.Content,
 	}); err != nil {
 		return nil, util.BuildDbHTTPErr(err)
 	}
+	pr.live.Publish(c, &model.LiveEvent{Type: model.LiveEventEdited, PostId: post.Id, CommentId: &comment.Id})
+	pr.notifier.ModAction(c, comment.ContentMetadata, entry)
 
 	return gin.H{"alias": alias}, nil
 }
 
 func (pr *postRoutes) deleteComment(c *gin.Context) (interface{}, *util.HTTPError) {
+	post, httpErr := pr.mustGetPostByIdStr(c, c.Param("id"))
+	if httpErr != nil {
+		return nil, httpErr
+	}
 	comment, httpErr := pr.mustGetCommentByIdStr(c, c.Param("comment-id"))
 	if httpErr != nil {
 		return nil, httpErr
 	}
-	// TODO: Check if comment exists under post?
-	if !comment.CanDelete(middleware.MustGetLocalUser(c)) {
-		return nil, util.BuildOperationForbidden("user is not owner of the post")
+	// moderators are checked against the communities of the post, so the comment has to be under it
+	if comment.PostMetadataId != post.ContentMetadata.Id {
+		return nil, util.BuildDoesNotExistHTTPErr("comment")
+	}
+	resource := postResource(post)
+	resource.Content = comment.ContentMetadata
+	if httpErr := authorize(c, pr.policy, controllers.ActionRemoveContent, resource,
+		"user is not owner of the comment or a moderator of the post's community"); httpErr != nil {
+		return nil, httpErr
+	}
+	reason, httpErr := modReasonParam(c)
+	if httpErr != nil {
+		return nil, httpErr
 	}
-	if err := pr.db.MarkCommentAsDeleted(c, comment.Id); err != nil {
+	entry := contentModLogEntry(c, comment.ContentMetadata, &model.ModLogEntry{
+		Action:       model.ModActionRemoveComment,
+		PostId:       &post.Id,
+		CommentId:    &comment.Id,
+		CommunityIds: resource.CommunityIds,
+		Reason:       reason,
+	})
+	if err := pr.db.MarkCommentAsDeleted(c, comment.Id, entry); err != nil {
 		return nil, util.BuildDbHTTPErr(err)
 	}
+	pr.live.Publish(c, &model.LiveEvent{Type: model.LiveEventDeleted, PostId: post.Id, CommentId: &comment.Id})
+	pr.webhooks.CommentDeleted(c, post, comment)
+	pr.notifier.ModAction(c, comment.ContentMetadata, entry)
 	return nil, nil
 }
 
@@ -358,7 +619,31 @@ func (pr *postRoutes) getPostById(c *gin.Context) (interface{}, *util.HTTPError)
 	if httpErr != nil {
 		return nil, httpErr
 	}
-	return post.MakeDisplayableFor(middleware.GetLocalUser(c)), nil
+	if canView, httpErr := pr.canViewHeld(c, post.ContentMetadata, post); httpErr != nil {
+		return nil, httpErr
+	} else if !canView {
+		return nil, util.BuildDoesNotExistHTTPErr("post")
+	}
+	post = post.MakeDisplayableFor(middleware.GetLocalUser(c))
+	pr.avatars.AddTo(post.ContentMetadata)
+	return post, nil
+}
+
+// streamPost streams the new comments of the post, and the edits, deletes and votes of the post and its comments
+func (pr *postRoutes) streamPost(c *gin.Context) {
+	post, httpErr := pr.mustGetPostByIdStr(c, c.Param("id"))
+	if httpErr != nil {
+		util.HandleHTTPErrorRes(c, httpErr)
+		return
+	}
+	if canView, httpErr := pr.canViewHeld(c, post.ContentMetadata, post); httpErr != nil {
+		util.HandleHTTPErrorRes(c, httpErr)
+		return
+	} else if !canView {
+		util.HandleHTTPErrorRes(c, util.BuildDoesNotExistHTTPErr("post"))
+		return
+	}
+	streamLive(c, pr.live, controllers.PostTopic(post.Id))
 }
 
 // TODO: Turn cursor into struct with fields for each type and add methods for each type. No enum
@@ -375,12 +660,16 @@ func (pr *postRoutes) getPosts(c *gin.Context) (interface{}, *util.HTTPError) {
 	cursor := req.PostCursor
 	switch v := cursor.(type) {
 	case *app.MostRecentCursor:
-		if !canViewHiddenPostsByUser(middleware.GetLocalUser(c), v.ByUser) {
+		if canView, err := pr.canViewHiddenPostsByUser(c, v.ByUser); err != nil {
+			return nil, util.BuildDbHTTPErr(err)
+		} else if !canView {
 			visibility := model.VisibilityNormal
 			v.Visibility = &visibility
 		}
 	case *app.MostPopularCursor:
-		if !canViewHiddenPostsByUser(middleware.GetLocalUser(c), v.ByUser) {
+		if canView, err := pr.canViewHiddenPostsByUser(c, v.ByUser); err != nil {
+			return nil, util.BuildDbHTTPErr(err)
+		} else if !canView {
 			visibility := model.VisibilityNormal
 			v.Visibility = &visibility
 		}
@@ -390,15 +679,130 @@ func (pr *postRoutes) getPosts(c *gin.Context) (interface{}, *util.HTTPError) {
 		return nil, util.BuildDbHTTPErr(err)
 	}
 
+	posts = model.MakePostsDisplayableFor(posts, middleware.GetLocalUser(c))
+	for _, post := range posts {
+		pr.avatars.AddTo(post.ContentMetadata)
+	}
 	return gin.H{
-		"posts":      model.MakePostsDisplayableFor(posts, middleware.GetLocalUser(c)),
+		"posts":      posts,
 		"nextCursor": nextCursor,
 	}, nil
 }
 
-func canViewHiddenPostsByUser(userMaybe *model.LocalUser, byUserMaybe *app.SerializableByUser) bool {
-	return byUserMaybe == nil ||
-		(userMaybe != nil && (userMaybe.Id == byUserMaybe.Id || userMaybe.IsAdmin))
+func (pr *postRoutes) canViewHiddenPostsByUser(c *gin.Context, byUserMaybe *app.SerializableByUser) (bool, error) {
+	if byUserMaybe == nil {
+		return true, nil
+	}
+	return pr.policy.Can(c, middleware.GetLocalUser(c), controllers.ActionViewHiddenByUser,
+		&controllers.Resource{UserId: byUserMaybe.Id})
+}
+
+// postCommunities returns the communities of the post in the path, for ban checks
+func (pr *postRoutes) postCommunities(c *gin.Context) ([]int64, *util.HTTPError) {
+	post, httpErr := pr.mustGetPostByIdStr(c, c.Param("id"))
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	return postResource(post).CommunityIds, nil
+}
+
+// newPostCommunities returns the communities a post is being created in, for ban checks
+func newPostCommunities(c *gin.Context) ([]int64, *util.HTTPError) {
+	var req createPostReq
+	if httpErr := peekJSON(c, &req); httpErr != nil {
+		return nil, httpErr
+	}
+	return req.Communities, nil
+}
+
+// peekJSON unmarshals the body without consuming it, so middleware can look at what the handler will bind
+func peekJSON(c *gin.Context, obj interface{}) *util.HTTPError {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return &util.HTTPError{Status: http.StatusBadRequest, Message: "error reading body"}
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err := json.Unmarshal(body, obj); err != nil {
+		return util.BuildJSONBindHTTPErr(err)
+	}
+	return nil
+}
+
+// canViewHeld is true if the content isn't held or the caller created it or moderates the post
+func (pr *postRoutes) canViewHeld(c *gin.Context, content *model.ContentMetadata, post *model.Post) (bool, *util.HTTPError) {
+	if !content.Held {
+		return true, nil
+	}
+	resource := postResource(post)
+	resource.Content = content
+	canView, err := pr.policy.Can(c, middleware.GetLocalUser(c), controllers.ActionViewHeld, resource)
+	if err != nil {
+		return false, util.BuildDbHTTPErr(err)
+	}
+	return canView, nil
+}
+
+// withoutHeldComments drops the held comments the caller can't see, along with the replies to them. Whether the caller
+// moderates the post is looked up once, the first time a held comment by someone else comes up
+func (pr *postRoutes) withoutHeldComments(c *gin.Context, trees []*model.CommentTree, post *model.Post) ([]*model.CommentTree, *util.HTTPError) {
+	var moderates *bool
+	canView := func(content *model.ContentMetadata) (bool, error) {
+		if !content.Held || isOwnContent(c, content) {
+			return true, nil
+		}
+		if moderates == nil {
+			isModerator, err := pr.policy.ModeratesAny(c, middleware.GetLocalUser(c), postResource(post).CommunityIds)
+			if err != nil {
+				return false, err
+			}
+			moderates = &isModerator
+		}
+		return *moderates, nil
+	}
+	visible, err := filterComments(trees, canView)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return visible, nil
+}
+
+// filterComments drops the comments canView is false for, along with the replies to them
+func filterComments(trees []*model.CommentTree, canView func(*model.ContentMetadata) (bool, error)) ([]*model.CommentTree, error) {
+	if len(trees) == 0 {
+		return trees, nil
+	}
+	visible := make([]*model.CommentTree, 0, len(trees))
+	for _, tree := range trees {
+		if ok, err := canView(tree.ContentMetadata); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		children, err := filterComments(tree.Children, canView)
+		if err != nil {
+			return nil, err
+		}
+		tree.Children = children
+		visible = append(visible, tree)
+	}
+	return visible, nil
+}
+
+func containsId(ids []int64, id int64) bool {
+	for _, other := range ids {
+		if other == id {
+			return true
+		}
+	}
+	return false
+}
+
+func postResource(post *model.Post) *controllers.Resource {
+	communityIds := make([]int64, len(post.Communities))
+	for i, community := range post.Communities {
+		communityIds[i] = community.Id
+	}
+	return &controllers.Resource{Content: post.ContentMetadata, CommunityIds: communityIds}
 }
 
 func (pr *postRoutes) getComments(c *gin.Context) (interface{}, *util.HTTPError) {
@@ -415,9 +819,13 @@ func (pr *postRoutes) getComments(c *gin.Context) (interface{}, *util.HTTPError)
 		return nil, util.BuildDbHTTPErr(err)
 	}
 
+	if comments, httpErr = pr.withoutHeldComments(c, comments, post); httpErr != nil {
+		return nil, httpErr
+	}
 	for i, comment := range comments {
 		comments[i] = comment.MakeDisplayableFor(middleware.GetLocalUser(c))
 	}
+	pr.avatars.AddToComments(comments)
 
 	return comments, nil
 }
@@ -439,6 +847,7 @@ func (pr *postRoutes) voteForPost(c *gin.Context) (interface{}, *util.HTTPError)
 	if err := pr.db.Vote(c, middleware.MustGetToken(c).UID, post.ContentMetadata.Id, normalizeVote(req.Value)); err != nil {
 		return nil, util.BuildDbHTTPErr(err)
 	}
+	pr.live.Publish(c, &model.LiveEvent{Type: model.LiveEventVoted, PostId: post.Id})
 	return nil, nil
 }
 
@@ -463,6 +872,12 @@ func (pr *postRoutes) voteForComment(c *gin.Context) (interface{}, *util.HTTPErr
 	if err := pr.db.Vote(c, middleware.MustGetToken(c).UID, comment.ContentMetadata.Id, normalizeVote(req.Value)); err != nil {
 		return nil, util.BuildDbHTTPErr(err)
 	}
+	// the path's post id was checked against the comment above
+	postId, httpErr := util.ParseId(c.Param("id"))
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	pr.live.Publish(c, &model.LiveEvent{Type: model.LiveEventVoted, PostId: postId, CommentId: &comment.Id})
 	return nil, nil
 }
 
@@ -476,35 +891,43 @@ func normalizeVote(value int8) int8 {
 
 }
 
-type reportReq struct {
-	Reason string
+func (pr *postRoutes) reportPost(c *gin.Context) (interface{}, *util.HTTPError) {
+	var req reportReq
+	if err := c.BindJSON(&req); err != nil {
+		return nil, util.BuildJSONBindHTTPErr(err)
+	}
+	post, httpErr := pr.mustGetPostByIdStr(c, c.Param("id"))
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	if post.Status == model.StatusDeleted {
+		return nil, util.BuildDoesNotExistHTTPErr("post")
+	}
+	return createReport(c, pr.db, &model.ReportTarget{Type: model.ReportTargetPost, PostId: &post.Id}, &req)
 }
 
-// TODO: Add GetReportByPost and GetReportByCommunity
-func (pr *postRoutes) report(c *gin.Context) (interface{}, *util.HTTPError) {
+func (pr *postRoutes) reportComment(c *gin.Context) (interface{}, *util.HTTPError) {
 	var req reportReq
 	if err := c.BindJSON(&req); err != nil {
 		return nil, util.BuildJSONBindHTTPErr(err)
 	}
-
-	/* TODO: Possible race condition if post was deleted
-	right after report created
-	*/
 	post, httpErr := pr.mustGetPostByIdStr(c, c.Param("id"))
 	if httpErr != nil {
 		return nil, httpErr
 	}
-
-	reportId, err := pr.db.CreateReport(c, middleware.MustGetToken(c).UID, &db.CreateReport{
-		PostId: post.Id,
-		Reason: req.Reason,
-	})
-	if err != nil {
-		return nil, util.BuildDbHTTPErr(err)
+	comment, httpErr := pr.mustGetCommentByIdStr(c, c.Param("comment-id"))
+	if httpErr != nil {
+		return nil, httpErr
 	}
-	return gin.H{
-		"id": reportId,
-	}, nil
+	// moderators find the report through the communities of the post, so the comment has to be under it
+	if comment.PostMetadataId != post.ContentMetadata.Id || comment.Status == model.StatusDeleted {
+		return nil, util.BuildDoesNotExistHTTPErr("comment")
+	}
+	return createReport(c, pr.db, &model.ReportTarget{
+		Type:      model.ReportTargetComment,
+		PostId:    &post.Id,
+		CommentId: &comment.Id,
+	}, &req)
 }
 
 // mustGetPostByIdStr attempts to get post by id str
@@ -551,15 +974,23 @@ func mustGetByIdStr(ctx *gin.Context, fetch FetchById, entityType string, idStr
 	return entity, nil
 }
 
-func (pr *postRoutes) imagesMustExist(c *gin.Context, imageBlobNames []string) *util.HTTPError {
+// imagesMustBeOwned checks every blob was uploaded (through an upload session) by the caller
+func (pr *postRoutes) imagesMustBeOwned(c *gin.Context, imageBlobNames []string) *util.HTTPError {
+	if len(imageBlobNames) == 0 {
+		return nil
+	}
+	uploads, err := pr.db.GetCompletedUploads(c, imageBlobNames)
+	if err != nil {
+		return util.BuildDbHTTPErr(err)
+	}
+	owned := make(map[string]bool)
+	for _, upload := range uploads {
+		if upload.OwnerId == middleware.MustGetToken(c).UID && upload.Kind == model.UploadKindImage {
+			owned[upload.BlobName] = true
+		}
+	}
 	for _, blobName := range imageBlobNames {
-		if exists, err := pr.userUploadsBucket.Exists(c, blobName); err != nil {
-			log.Println("a storage error occurred", err)
-			return &util.HTTPError{
-				Status:  http.StatusInternalServerError,
-				Message: "a storage error occurred",
-			}
-		} else if !exists {
+		if !owned[blobName] {
 			return &util.HTTPError{
 				Status:  http.StatusBadRequest,
 				Message: fmt.Sprintf("uploaded image does not exist %v", blobName),
@@ -568,3 +999,34 @@ func (pr *postRoutes) imagesMustExist(c *gin.Context, imageBlobNames []string) *
 	}
 	return nil
 }
+
+func buildAliasHTTPErr(err error) *util.HTTPError {
+	log.Println("error assigning alias", err)
+	return &util.HTTPError{
+		Status:  http.StatusInternalServerError,
+		Message: "error assigning alias",
+	}
+}
+
+// processImages strips metadata from the attached images and generates their thumbnails
+func (pr *postRoutes) processImages(c *gin.Context, imageBlobNames []string) ([]*model.Image, *util.HTTPError) {
+	images := make([]*model.Image, 0, len(imageBlobNames))
+	for _, blobName := range imageBlobNames {
+		image, err := pr.imageProcessor.Process(c, blobName)
+		if errors.Is(err, services.ErrInvalidImage) {
+			return nil, &util.HTTPError{
+				Status:  http.StatusBadRequest,
+				Message: fmt.Sprintf("could not process image %v", blobName),
+			}
+		}
+		if err != nil {
+			log.Println("error processing image", blobName, err)
+			return nil, &util.HTTPError{
+				Status:  http.StatusInternalServerError,
+				Message: "error processing image",
+			}
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
@@ -0,0 +1,149 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/navbryce/next-dorm-be/controllers"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/middleware"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/navbryce/next-dorm-be/services"
+	"github.com/navbryce/next-dorm-be/util"
+	"net/http"
+)
+
+type pushRoutes struct {
+	db     db.Database
+	policy *controllers.Policy
+	push   *controllers.PushController
+	// pusher is nil when push isn't configured
+	pusher *services.WebPusher
+}
+
+// AddPushRoutes adds the API the PWA registers devices for Web Push notifications with, and the announcements moderators
+// push to the subscribers of a community. Notifications are sent by services.WebPusher
+func AddPushRoutes(group *gin.RouterGroup, db db.Database, authenticator services.Authenticator, policy *controllers.Policy, push *controllers.PushController, pusher *services.WebPusher) {
+	routes := pushRoutes{db, policy, push, pusher}
+	group.GET("/push/vapid-public-key", util.HandlerWrapper(routes.getPublicKey, &util.HandlerOpts{}))
+	auth := []gin.HandlerFunc{middleware.GenAuth(db, authenticator, &middleware.AuthConfig{}), middleware.RequireAccount()}
+	subscriptions := group.Group("/push/subscriptions", auth...)
+	subscriptions.PUT("", util.HandlerWrapper(routes.subscribe, &util.HandlerOpts{}))
+	subscriptions.DELETE("", util.HandlerWrapper(routes.unsubscribe, &util.HandlerOpts{}))
+	announcements := group.Group("/communities/:id/announcements", auth...)
+	announcements.PUT("", util.HandlerWrapper(routes.announce, &util.HandlerOpts{}))
+}
+
+// getPublicKey returns the applicationServerKey the PWA subscribes with
+func (pr *pushRoutes) getPublicKey(c *gin.Context) (interface{}, *util.HTTPError) {
+	if pr.pusher == nil {
+		return nil, pushDisabledErr()
+	}
+	return gin.H{"publicKey": pr.pusher.PublicKey()}, nil
+}
+
+// pushSubscriptionReq is the JSON of a browser's PushSubscription
+type pushSubscriptionReq struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// subscribe registers the device for the caller's notifications. Registering a device again (such as after signing in
+// with another account) replaces its keys and owner
+func (pr *pushRoutes) subscribe(c *gin.Context) (interface{}, *util.HTTPError) {
+	if pr.pusher == nil {
+		return nil, pushDisabledErr()
+	}
+	var req pushSubscriptionReq
+	if err := c.BindJSON(&req); err != nil {
+		return nil, util.BuildJSONBindHTTPErr(err)
+	}
+	subscription := &model.PushSubscription{
+		UserId:       middleware.MustGetLocalUser(c).Id,
+		Endpoint:     req.Endpoint,
+		EndpointHash: services.HashPushEndpoint(req.Endpoint),
+		P256dh:       req.Keys.P256dh,
+		Auth:         req.Keys.Auth,
+	}
+	if err := pr.pusher.CheckSubscription(subscription); err != nil {
+		return nil, &util.HTTPError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+	if err := pr.db.SavePushSubscription(c, subscription); err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return gin.H{"id": subscription.Id}, nil
+}
+
+// unsubscribe unregisters the device with the endpoint query param. Unregistering twice is fine
+func (pr *pushRoutes) unsubscribe(c *gin.Context) (interface{}, *util.HTTPError) {
+	endpoint := c.Query("endpoint")
+	if endpoint == "" {
+		return nil, &util.HTTPError{Status: http.StatusBadRequest, Message: "endpoint must be set"}
+	}
+	if err := pr.db.DeletePushSubscription(c, middleware.MustGetLocalUser(c).Id, services.HashPushEndpoint(endpoint)); err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return nil, nil
+}
+
+type announcementReq struct {
+	PostId int64 `json:"postId"`
+}
+
+// announce pushes a post of the community to the devices of its subscribers. Returns how many devices it was sent to
+func (pr *pushRoutes) announce(c *gin.Context) (interface{}, *util.HTTPError) {
+	if pr.pusher == nil {
+		return nil, pushDisabledErr()
+	}
+	var req announcementReq
+	if err := c.BindJSON(&req); err != nil {
+		return nil, util.BuildJSONBindHTTPErr(err)
+	}
+	communityId, httpErr := mustGetCommunityId(c, pr.db)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	if httpErr := authorize(c, pr.policy, controllers.ActionAnnounce, &controllers.Resource{
+		CommunityIds: []int64{communityId},
+	}, "only moderators of the community can make announcements"); httpErr != nil {
+		return nil, httpErr
+	}
+	post, err := pr.db.GetPostById(c, req.PostId, &db.PostQueryOpts{})
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	var community *model.Community
+	if post != nil {
+		for _, postCommunity := range post.Communities {
+			if postCommunity.Id == communityId {
+				community = postCommunity
+			}
+		}
+	}
+	if community == nil {
+		return nil, &util.HTTPError{Status: http.StatusNotFound, Message: "the post isn't in the community"}
+	}
+	if post.Held || post.Status == model.StatusDeleted {
+		return nil, &util.HTTPError{Status: http.StatusBadRequest, Message: "only visible posts can be announced"}
+	}
+
+	// logged first, since the pushes can't be taken back
+	if httpErr := recordModAction(c, pr.db, &model.ModLogEntry{
+		Action:       model.ModActionAnnouncePost,
+		PostId:       &post.Id,
+		CommunityIds: []int64{communityId},
+	}); httpErr != nil {
+		return nil, httpErr
+	}
+	userId := middleware.MustGetLocalUser(c).Id
+	devices, err := pr.push.Announce(c, community, post, userId)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return gin.H{"devices": devices}, nil
+}
+
+func pushDisabledErr() *util.HTTPError {
+	return &util.HTTPError{Status: http.StatusNotFound, Message: "push notifications aren't enabled on this server"}
+}
@@ -0,0 +1,504 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/navbryce/next-dorm-be/config"
+	"github.com/navbryce/next-dorm-be/controllers"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/middleware"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/navbryce/next-dorm-be/services"
+	"github.com/navbryce/next-dorm-be/util"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxReportReasonLength    = 1000
+	maxResolutionLength      = 1000
+	defaultReportGroupsLimit = 50
+	maxReportGroupsLimit     = 200
+)
+
+type reportRoutes struct {
+	db          db.Database
+	policy      *controllers.Policy
+	communities *controllers.CommunityController
+	notifier    *controllers.Notifier
+	live        *controllers.LiveController
+	webhooks    *controllers.WebhookController
+}
+
+// AddReportRoutes adds the moderation queue. Reports are filed on the posts, comments and users they're about and
+// grouped per target, and moderators resolve a group as a whole
+func AddReportRoutes(group *gin.RouterGroup, db db.Database, authenticator services.Authenticator, policy *controllers.Policy, communities *controllers.CommunityController, limiter *services.RateLimiter, notifier *controllers.Notifier, live *controllers.LiveController, webhooks *controllers.WebhookController) {
+	routes := reportRoutes{db, policy, communities, notifier, live, webhooks}
+	reports := group.Group("/reports", middleware.GenAuth(db, authenticator, &middleware.AuthConfig{}), middleware.RequireAccount())
+	reports.GET("", util.HandlerWrapper(routes.getReportGroups, &util.HandlerOpts{}))
+	reports.GET("/:id", util.HandlerWrapper(routes.getReportGroup, &util.HandlerOpts{}))
+	reports.PUT("/:id", util.HandlerWrapper(routes.resolveReportGroup, &util.HandlerOpts{}))
+	reports.PUT("/users/:user-id", middleware.RateLimit(limiter, config.RateLimitGroupReports), middleware.RequireNotBanned(policy, userReportCommunities),
+		util.HandlerWrapper(routes.reportUser, &util.HandlerOpts{}))
+}
+
+type reportReq struct {
+	Reason string `json:"reason"`
+	// CommunityId is the community a user is reported in. Ignored for content
+	CommunityId *int64 `json:"communityId"`
+}
+
+// createReport files the report against the target
+func createReport(c *gin.Context, reports db.ReportDatabase, target *model.ReportTarget, req *reportReq) (interface{}, *util.HTTPError) {
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) == 0 || len(req.Reason) > maxReportReasonLength {
+		return nil, &util.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("reason must be between 1 and %v characters", maxReportReasonLength),
+		}
+	}
+	report, err := reports.CreateReport(c, middleware.MustGetLocalUser(c).Id, &db.CreateReport{
+		Target: target,
+		Reason: util.XSSSanitize(req.Reason),
+	})
+	if err != nil {
+		if db.IsDupKeyErr(err) {
+			return nil, &util.HTTPError{Status: http.StatusConflict, Message: "already reported"}
+		}
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return gin.H{
+		"id":      report.Id,
+		"groupId": report.GroupId,
+	}, nil
+}
+
+func (rr *reportRoutes) reportUser(c *gin.Context) (interface{}, *util.HTTPError) {
+	userId := c.Param("user-id")
+	user, err := rr.db.GetUser(c, userId)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	if user == nil {
+		return nil, util.BuildDoesNotExistHTTPErr("user")
+	}
+	var req reportReq
+	if err := c.BindJSON(&req); err != nil {
+		return nil, util.BuildJSONBindHTTPErr(err)
+	}
+	if req.CommunityId != nil {
+		communities, err := rr.db.GetCommunitiesByIds(c, []int64{*req.CommunityId}, &db.GetCommunitiesQueryOpts{})
+		if err != nil {
+			return nil, util.BuildDbHTTPErr(err)
+		}
+		if len(communities) == 0 {
+			return nil, util.BuildDoesNotExistHTTPErr("community")
+		}
+	}
+	return createReport(c, rr.db, &model.ReportTarget{
+		Type:        model.ReportTargetUser,
+		UserId:      &user.Id,
+		CommunityId: req.CommunityId,
+	}, &req)
+}
+
+// userReportCommunities returns the community a user is reported in, for ban checks
+func userReportCommunities(c *gin.Context) ([]int64, *util.HTTPError) {
+	var req reportReq
+	if httpErr := peekJSON(c, &req); httpErr != nil {
+		return nil, httpErr
+	}
+	if req.CommunityId == nil {
+		return nil, nil
+	}
+	return []int64{*req.CommunityId}, nil
+}
+
+// getReportGroups pages through the report groups, newest first. Filtered by the communityId (which includes its
+// descendants), status and targetType query params. Only admins can list reports across communities
+func (rr *reportRoutes) getReportGroups(c *gin.Context) (interface{}, *util.HTTPError) {
+	query := &db.ReportGroupsQuery{
+		Status:     model.ReportStatus(c.Query("status")),
+		TargetType: model.ReportTargetType(c.Query("targetType")),
+		Limit:      defaultReportGroupsLimit,
+	}
+	switch query.Status {
+	case "", model.ReportStatusOpen, model.ReportStatusActioned, model.ReportStatusDismissed:
+	default:
+		return nil, &util.HTTPError{Status: http.StatusBadRequest, Message: "unknown status"}
+	}
+	switch query.TargetType {
+	case "", model.ReportTargetPost, model.ReportTargetComment, model.ReportTargetUser:
+	default:
+		return nil, &util.HTTPError{Status: http.StatusBadRequest, Message: "unknown targetType"}
+	}
+	resource := &controllers.Resource{}
+	if communityId := c.Query("communityId"); communityId != "" {
+		id, httpErr := util.ParseId(communityId)
+		if httpErr != nil {
+			return nil, httpErr
+		}
+		query.CommunityIds = rr.communities.Descendants(id)
+		resource.CommunityIds = []int64{id}
+	}
+	if before := c.Query("before"); before != "" {
+		var httpErr *util.HTTPError
+		if query.BeforeId, httpErr = util.ParseId(before); httpErr != nil {
+			return nil, httpErr
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		var err error
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 || query.Limit > maxReportGroupsLimit {
+			return nil, &util.HTTPError{
+				Status:  http.StatusBadRequest,
+				Message: fmt.Sprintf("limit must be between 1 and %v", maxReportGroupsLimit),
+			}
+		}
+	}
+	if httpErr := authorize(c, rr.policy, controllers.ActionViewReports, resource,
+		"only moderators can list the reports of their communities and only admins can list every report"); httpErr != nil {
+		return nil, httpErr
+	}
+
+	groups, err := rr.db.GetReportGroups(c, query)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	var nextBefore *int64
+	if len(groups) == query.Limit {
+		nextBefore = &groups[len(groups)-1].Id
+	}
+	return gin.H{
+		"groups":     groups,
+		"nextBefore": nextBefore,
+	}, nil
+}
+
+// getReportGroup returns the group with all of its reports
+func (rr *reportRoutes) getReportGroup(c *gin.Context) (interface{}, *util.HTTPError) {
+	group, httpErr := rr.mustGetReportGroup(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	if _, _, httpErr := rr.authorizeResolve(c, group); httpErr != nil {
+		return nil, httpErr
+	}
+	reports, err := rr.db.GetReports(c, group.Id)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return gin.H{
+		"group":   group,
+		"reports": reports,
+	}, nil
+}
+
+type resolveReportReq struct {
+	Status     model.ReportStatus `json:"status"`
+	Resolution string             `json:"resolution"`
+	// RemoveContent deletes the reported post or comment
+	RemoveContent bool `json:"removeContent"`
+	// BanAuthor bans the reported user or the creator of the reported content
+	BanAuthor *banAuthorReq `json:"banAuthor"`
+}
+
+type banAuthorReq struct {
+	// CommunityId is omitted for a global ban
+	CommunityId *int64     `json:"communityId"`
+	Reason      string     `json:"reason"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+}
+
+// resolveReportGroup closes the group and, when actioned, removes the content and bans its author in the same request.
+// Banning the creator of hidden content ties them to it, so it takes an admin and is recorded as a reveal
+func (rr *reportRoutes) resolveReportGroup(c *gin.Context) (interface{}, *util.HTTPError) {
+	var req resolveReportReq
+	if err := c.BindJSON(&req); err != nil {
+		return nil, util.BuildJSONBindHTTPErr(err)
+	}
+	switch req.Status {
+	case model.ReportStatusActioned:
+	case model.ReportStatusDismissed:
+		if req.RemoveContent || req.BanAuthor != nil {
+			return nil, &util.HTTPError{
+				Status:  http.StatusBadRequest,
+				Message: "a dismissed report can't remove content or ban",
+			}
+		}
+	default:
+		return nil, &util.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("status must be %v or %v", model.ReportStatusActioned, model.ReportStatusDismissed),
+		}
+	}
+	req.Resolution = strings.TrimSpace(req.Resolution)
+	if len(req.Resolution) > maxResolutionLength {
+		return nil, &util.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("resolution must be at most %v characters", maxResolutionLength),
+		}
+	}
+
+	group, httpErr := rr.mustGetReportGroup(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	if group.Status != model.ReportStatusOpen {
+		return nil, &util.HTTPError{Status: http.StatusConflict, Message: "report already resolved"}
+	}
+	post, communityIds, httpErr := rr.authorizeResolve(c, group)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	// everything is checked before anything is changed
+	var content *model.ContentMetadata
+	var comment *model.Comment
+	if group.Type != model.ReportTargetUser && (req.RemoveContent || req.BanAuthor != nil) {
+		if post == nil {
+			return nil, util.BuildDoesNotExistHTTPErr("post")
+		}
+		content = post.ContentMetadata
+		if group.Type == model.ReportTargetComment {
+			var err error
+			if comment, err = rr.db.GetCommentById(c, *group.CommentId); err != nil {
+				return nil, util.BuildDbHTTPErr(err)
+			}
+			if comment == nil {
+				return nil, util.BuildDoesNotExistHTTPErr("comment")
+			}
+			content = comment.ContentMetadata
+		}
+	}
+	if req.RemoveContent && group.Type == model.ReportTargetUser {
+		return nil, &util.HTTPError{Status: http.StatusBadRequest, Message: "a reported user has no content to remove"}
+	}
+	var ban *model.Ban
+	var reveal *model.Reveal
+	if req.BanAuthor != nil {
+		authorId := ""
+		if group.Type == model.ReportTargetUser {
+			authorId = *group.UserId
+		} else {
+			authorId = content.Creator.Id
+			if content.Visibility == model.VisibilityHidden {
+				if httpErr := authorize(c, rr.policy, controllers.ActionRevealCreator, &controllers.Resource{},
+					"only admins can ban the creator of hidden content"); httpErr != nil {
+					return nil, httpErr
+				}
+				reveal = &model.Reveal{
+					AdminId: middleware.MustGetLocalUser(c).Id,
+					PostId:  post.Id,
+					Reason:  fmt.Sprintf("banned while resolving report %v: %v", group.Id, strings.TrimSpace(req.BanAuthor.Reason)),
+				}
+				if comment != nil {
+					reveal.CommentId = &comment.Id
+				}
+			}
+		}
+		author, err := rr.db.GetUser(c, authorId)
+		if err != nil {
+			return nil, util.BuildDbHTTPErr(err)
+		}
+		if author == nil {
+			return nil, util.BuildDoesNotExistHTTPErr("user")
+		}
+		if ban, httpErr = authorizeBan(c, rr.db, rr.policy, author, req.BanAuthor.CommunityId, req.BanAuthor.Reason,
+			req.BanAuthor.ExpiresAt); httpErr != nil {
+			return nil, httpErr
+		}
+	}
+
+	var resolution *string
+	if req.Resolution != "" {
+		resolution = &req.Resolution
+	}
+	resolve := &db.ResolveReportGroup{
+		Status:     req.Status,
+		ResolvedBy: middleware.MustGetLocalUser(c).Id,
+		Resolution: resolution,
+		ModLog: modLogEntry(c, &model.ModLogEntry{
+			Action:       model.ModActionResolveReport,
+			PostId:       group.PostId,
+			CommentId:    group.CommentId,
+			UserId:       group.UserId,
+			TargetId:     &group.Id,
+			CommunityIds: communityIds,
+			Reason:       util.XSSSanitize(req.Resolution),
+		}),
+	}
+	if req.RemoveContent && content.Status != model.StatusDeleted {
+		resolve.Remove = &db.RemoveReportedContent{
+			PostId: post.Id,
+			ModLog: modLogEntry(c, &model.ModLogEntry{
+				Action:       model.ModActionRemovePost,
+				PostId:       &post.Id,
+				CommunityIds: communityIds,
+				Reason:       util.XSSSanitize(req.Resolution),
+			}),
+		}
+		if comment != nil {
+			resolve.Remove.CommentId = &comment.Id
+			resolve.Remove.ModLog.Action = model.ModActionRemoveComment
+			resolve.Remove.ModLog.CommentId = &comment.Id
+		}
+	}
+	if reveal != nil {
+		resolve.Reveal = &db.CreateReveal{Reveal: reveal, ModLog: modLogEntry(c, revealModLogEntry(reveal, communityIds))}
+	}
+	if ban != nil {
+		// not tied to the content, which may be hidden
+		entry := modLogEntry(c, banModLogEntry(ban))
+		if reveal != nil {
+			// kept out of the logs of the communities, since moderators could tie the ban to the hidden content
+			// resolved in the same breath. Admins read it in the whole log
+			entry.CommunityIds = []int64{}
+		}
+		resolve.Ban = &db.CreateBan{Ban: ban, ModLog: entry}
+	}
+	// the group is claimed before anything is changed, so only one of two moderators resolving it at once acts on it
+	if err := rr.db.ResolveReportGroup(c, group.Id, resolve); err != nil {
+		if err == db.ErrNotFound {
+			return nil, &util.HTTPError{Status: http.StatusConflict, Message: "report already resolved"}
+		}
+		return nil, util.BuildDbHTTPErr(err)
+	}
+
+	if resolve.Remove != nil {
+		rr.live.Publish(c, &model.LiveEvent{Type: model.LiveEventDeleted, PostId: post.Id, CommentId: resolve.Remove.CommentId})
+		if comment != nil {
+			rr.webhooks.CommentDeleted(c, post, comment)
+		} else {
+			rr.webhooks.PostDeleted(c, post)
+		}
+		rr.notifier.ModAction(c, content, resolve.Remove.ModLog)
+	}
+	var banId *int64
+	if ban != nil {
+		banId = &ban.Id
+	}
+	if req.Status == model.ReportStatusDismissed && post != nil {
+		if httpErr := rr.releaseHeld(c, group, post); httpErr != nil {
+			return nil, httpErr
+		}
+	}
+	return gin.H{"banId": banId}, nil
+}
+
+// releaseHeld shows the reported post or comment again if automod held it. Dismissing the report clears it. Content held
+// since it was created gets the notifications, live events and webhooks held back with it. Content held on an edit was
+// already announced, so only the edit is published
+func (rr *reportRoutes) releaseHeld(c *gin.Context, group *model.ReportGroup, post *model.Post) *util.HTTPError {
+	if group.Type != model.ReportTargetComment {
+		if !post.Held {
+			return nil
+		}
+		if err := rr.db.SetContentHeld(c, post.ContentMetadata.Id, false); err != nil {
+			return util.BuildDbHTTPErr(err)
+		}
+		if !post.HeldOnCreate {
+			rr.live.Publish(c, &model.LiveEvent{Type: model.LiveEventEdited, PostId: post.Id})
+			return nil
+		}
+		rr.notifier.ContentCreated(c, &controllers.NewContent{
+			SenderId: post.Creator.Id,
+			PostId:   post.Id,
+			Text:     post.Title + "\n" + post.Content,
+		})
+		rr.live.Publish(c, &model.LiveEvent{Type: model.LiveEventCreated, PostId: post.Id})
+		rr.webhooks.PostCreated(c, post.Id)
+		return nil
+	}
+
+	comment, err := rr.db.GetCommentById(c, *group.CommentId)
+	if err != nil {
+		return util.BuildDbHTTPErr(err)
+	}
+	if comment == nil || !comment.Held {
+		return nil
+	}
+	if err := rr.db.SetContentHeld(c, comment.ContentMetadata.Id, false); err != nil {
+		return util.BuildDbHTTPErr(err)
+	}
+	if !comment.HeldOnCreate {
+		rr.live.Publish(c, &model.LiveEvent{Type: model.LiveEventEdited, PostId: post.Id, CommentId: &comment.Id})
+		return nil
+	}
+	released := &controllers.NewContent{
+		SenderId:  comment.Creator.Id,
+		PostId:    post.Id,
+		CommentId: &comment.Id,
+		Post:      post.ContentMetadata,
+		Text:      comment.Content,
+	}
+	event := &model.LiveEvent{Type: model.LiveEventCreated, PostId: post.Id, CommentId: &comment.Id}
+	// only the metadata id of the parent is known, so it's looked up in the thread
+	if comment.ParentMetadataId != post.ContentMetadata.Id {
+		forest, err := rr.db.GetCommentForest(c, post.ContentMetadata.Id, &db.CommentTreeQueryOpts{})
+		if err != nil {
+			return util.BuildDbHTTPErr(err)
+		}
+		if parent := findComment(forest, comment.ParentMetadataId); parent != nil {
+			released.Parent = parent.ContentMetadata
+			event.ParentCommentId = &parent.Id
+		}
+	}
+	rr.notifier.ContentCreated(c, released)
+	rr.live.Publish(c, event)
+	rr.webhooks.CommentCreated(c, post, comment.Id, event.ParentCommentId)
+	return nil
+}
+
+// findComment returns the comment of the forest with the metadata id, or nil
+func findComment(forest []*model.CommentTree, metadataId int64) *model.Comment {
+	for _, tree := range forest {
+		if tree.ContentMetadata.Id == metadataId {
+			return tree.Comment
+		}
+		if comment := findComment(tree.Children, metadataId); comment != nil {
+			return comment
+		}
+	}
+	return nil
+}
+
+func (rr *reportRoutes) mustGetReportGroup(c *gin.Context) (*model.ReportGroup, *util.HTTPError) {
+	id, httpErr := util.ParseId(c.Param("id"))
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	group, err := rr.db.GetReportGroup(c, id)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	if group == nil {
+		return nil, util.BuildDoesNotExistHTTPErr("report")
+	}
+	return group, nil
+}
+
+// authorizeResolve checks the caller moderates the target of the group. Returns the reported post (or the post of the
+// reported comment), nil for users or if the post doesn't exist anymore, and the communities of the target
+func (rr *reportRoutes) authorizeResolve(c *gin.Context, group *model.ReportGroup) (*model.Post, []int64, *util.HTTPError) {
+	resource := &controllers.Resource{CommunityIds: []int64{}}
+	var post *model.Post
+	if group.PostId != nil {
+		var err error
+		if post, err = rr.db.GetPostById(c, *group.PostId, &db.PostQueryOpts{}); err != nil {
+			return nil, nil, util.BuildDbHTTPErr(err)
+		}
+		if post != nil {
+			resource = postResource(post)
+		}
+	} else if group.CommunityId != nil {
+		resource.CommunityIds = []int64{*group.CommunityId}
+	}
+	if httpErr := authorize(c, rr.policy, controllers.ActionResolveReport, resource,
+		"only moderators of the community can handle its reports"); httpErr != nil {
+		return nil, nil, httpErr
+	}
+	return post, resource.CommunityIds, nil
+}
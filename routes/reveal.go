@@ -0,0 +1,156 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/navbryce/next-dorm-be/controllers"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/middleware"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/navbryce/next-dorm-be/services"
+	"github.com/navbryce/next-dorm-be/util"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxRevealReasonLength = 1000
+	defaultRevealsLimit   = 50
+	maxRevealsLimit       = 200
+)
+
+type revealRoutes struct {
+	db      db.Database
+	policy  *controllers.Policy
+	avatars *util.AvatarBuilder
+}
+
+// AddRevealRoutes adds the admin API for revealing the creator of hidden content. Every reveal is recorded with its
+// reason, and the records can be queried but never changed
+func AddRevealRoutes(group *gin.RouterGroup, db db.Database, authenticator services.Authenticator, policy *controllers.Policy, avatars *util.AvatarBuilder) {
+	routes := revealRoutes{db, policy, avatars}
+	reveals := group.Group("/reveals", middleware.GenAuth(db, authenticator, &middleware.AuthConfig{}),
+		middleware.RequireAccount(), routes.requireRevealPermission)
+	reveals.PUT("", util.HandlerWrapper(routes.reveal, &util.HandlerOpts{}))
+	reveals.GET("", util.HandlerWrapper(routes.getReveals, &util.HandlerOpts{}))
+}
+
+// requireRevealPermission guards the whole API: reading the log takes the same permission as revealing
+func (rr *revealRoutes) requireRevealPermission(c *gin.Context) {
+	if httpErr := authorize(c, rr.policy, controllers.ActionRevealCreator, &controllers.Resource{}, "must be an admin"); httpErr != nil {
+		util.HandleHTTPErrorRes(c, httpErr)
+		c.Abort()
+	}
+}
+
+type revealReq struct {
+	PostId int64 `json:"postId"`
+	// CommentId reveals the creator of a comment on the post instead of the post
+	CommentId *int64 `json:"commentId"`
+	Reason    string `json:"reason"`
+}
+
+func (rr *revealRoutes) reveal(c *gin.Context) (interface{}, *util.HTTPError) {
+	var req revealReq
+	if err := c.BindJSON(&req); err != nil {
+		return nil, util.BuildJSONBindHTTPErr(err)
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) == 0 || len(req.Reason) > maxRevealReasonLength {
+		return nil, &util.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("reason must be between 1 and %v characters", maxRevealReasonLength),
+		}
+	}
+
+	post, err := rr.db.GetPostById(c, req.PostId, &db.PostQueryOpts{})
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	if post == nil {
+		return nil, util.BuildDoesNotExistHTTPErr("post")
+	}
+	metadata := post.ContentMetadata
+	if req.CommentId != nil {
+		comment, err := rr.db.GetCommentById(c, *req.CommentId)
+		if err != nil {
+			return nil, util.BuildDbHTTPErr(err)
+		}
+		if comment == nil || comment.PostMetadataId != post.ContentMetadata.Id {
+			return nil, util.BuildDoesNotExistHTTPErr("comment")
+		}
+		metadata = comment.ContentMetadata
+	}
+	if metadata.Visibility != model.VisibilityHidden {
+		return nil, &util.HTTPError{Status: http.StatusBadRequest, Message: "the creator isn't hidden"}
+	}
+
+	// recorded before the creator is returned, so there are no unaudited reveals
+	reveal := &model.Reveal{
+		AdminId:   middleware.MustGetLocalUser(c).Id,
+		PostId:    post.Id,
+		CommentId: req.CommentId,
+		Reason:    req.Reason,
+	}
+	if reveal.Id, err = rr.db.CreateReveal(c, reveal,
+		modLogEntry(c, revealModLogEntry(reveal, postResource(post).CommunityIds))); err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	rr.avatars.AddTo(metadata)
+	return gin.H{
+		"revealId": reveal.Id,
+		"creator":  metadata.Creator,
+	}, nil
+}
+
+// getReveals pages through the audit log, newest first. Filtered by the adminId and postId query params
+func (rr *revealRoutes) getReveals(c *gin.Context) (interface{}, *util.HTTPError) {
+	query := &db.RevealsQuery{
+		AdminId: c.Query("adminId"),
+		Limit:   defaultRevealsLimit,
+	}
+	var httpErr *util.HTTPError
+	if postId := c.Query("postId"); postId != "" {
+		if query.PostId, httpErr = util.ParseId(postId); httpErr != nil {
+			return nil, httpErr
+		}
+	}
+	if before := c.Query("before"); before != "" {
+		if query.BeforeId, httpErr = util.ParseId(before); httpErr != nil {
+			return nil, httpErr
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		var err error
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 || query.Limit > maxRevealsLimit {
+			return nil, &util.HTTPError{
+				Status:  http.StatusBadRequest,
+				Message: fmt.Sprintf("limit must be between 1 and %v", maxRevealsLimit),
+			}
+		}
+	}
+
+	reveals, err := rr.db.GetReveals(c, query)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	var nextBefore *int64
+	if len(reveals) == query.Limit {
+		nextBefore = &reveals[len(reveals)-1].Id
+	}
+	return gin.H{
+		"reveals":    reveals,
+		"nextBefore": nextBefore,
+	}, nil
+}
+
+func revealModLogEntry(reveal *model.Reveal, communityIds []int64) *model.ModLogEntry {
+	return &model.ModLogEntry{
+		Action:       model.ModActionRevealCreator,
+		PostId:       &reveal.PostId,
+		CommentId:    reveal.CommentId,
+		CommunityIds: communityIds,
+		Reason:       reveal.Reason,
+	}
+}
@@ -0,0 +1,209 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/navbryce/next-dorm-be/controllers"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/middleware"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/navbryce/next-dorm-be/services"
+	"github.com/navbryce/next-dorm-be/util"
+	"net/http"
+	"strings"
+)
+
+type roleRoutes struct {
+	db     db.Database
+	policy *controllers.Policy
+}
+
+// AddRoleRoutes adds the API for the roles granted on a community. A role applies to the community and everything
+// below it
+func AddRoleRoutes(group *gin.RouterGroup, db db.Database, authenticator services.Authenticator, policy *controllers.Policy) {
+	routes := roleRoutes{db, policy}
+	roles := group.Group("/communities/:id/roles", middleware.GenAuth(db, authenticator, &middleware.AuthConfig{}))
+	roles.GET("", util.HandlerWrapper(routes.getRoles, &util.HandlerOpts{}))
+	roles.GET("/me", middleware.RequireAccount(), util.HandlerWrapper(routes.getMyRole, &util.HandlerOpts{}))
+	roles.PUT("", middleware.RequireAccount(), util.HandlerWrapper(routes.grantRole, &util.HandlerOpts{}))
+	roles.DELETE("/:user-id", middleware.RequireAccount(), util.HandlerWrapper(routes.revokeRole, &util.HandlerOpts{}))
+}
+
+// getRoles returns the roles granted on the community itself, not the ones inherited from its ancestors
+func (rr *roleRoutes) getRoles(c *gin.Context) (interface{}, *util.HTTPError) {
+	communityId, httpErr := mustGetCommunityId(c, rr.db)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	grants, err := rr.db.GetRolesInCommunity(c, communityId)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return grants, nil
+}
+
+func (rr *roleRoutes) getMyRole(c *gin.Context) (interface{}, *util.HTTPError) {
+	communityId, httpErr := mustGetCommunityId(c, rr.db)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	role, err := rr.policy.RoleIn(c, middleware.MustGetLocalUser(c), communityId)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return gin.H{"role": role}, nil
+}
+
+type grantRoleReq struct {
+	UserId string     `json:"userId"`
+	Role   model.Role `json:"role"`
+	// Reason is recorded in the moderation log
+	Reason string `json:"reason"`
+}
+
+func (rr *roleRoutes) grantRole(c *gin.Context) (interface{}, *util.HTTPError) {
+	var req grantRoleReq
+	if err := c.BindJSON(&req); err != nil {
+		return nil, util.BuildJSONBindHTTPErr(err)
+	}
+	if !req.Role.IsCommunityRole() {
+		return nil, &util.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("role must be %v or %v", model.RoleMember, model.RoleModerator),
+		}
+	}
+	communityId, httpErr := mustGetCommunityId(c, rr.db)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	if httpErr := authorize(c, rr.policy, controllers.ActionManageRole, &controllers.Resource{
+		CommunityIds: []int64{communityId},
+		Role:         req.Role,
+	}, "only moderators can grant membership and only admins can appoint moderators"); httpErr != nil {
+		return nil, httpErr
+	}
+	// granting replaces the user's role, which takes the same permission as revoking it. moderators can't demote
+	// each other
+	existing, httpErr := rr.getGrant(c, communityId, req.UserId)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	if existing != nil {
+		if httpErr := rr.authorizeRevoke(c, existing); httpErr != nil {
+			return nil, httpErr
+		}
+	}
+
+	user, err := rr.db.GetUser(c, req.UserId)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	if user == nil {
+		return nil, util.BuildDoesNotExistHTTPErr("user")
+	}
+	grant := &model.RoleGrant{
+		UserId:      user.Id,
+		CommunityId: communityId,
+		Role:        req.Role,
+		GrantedBy:   middleware.MustGetLocalUser(c).Id,
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) > maxModLogReasonLength {
+		return nil, &util.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("reason must be at most %v characters", maxModLogReasonLength),
+		}
+	}
+	if err := rr.db.GrantRole(c, grant, modLogEntry(c, &model.ModLogEntry{
+		Action:       model.ModActionGrantRole,
+		UserId:       &user.Id,
+		Role:         req.Role,
+		CommunityIds: []int64{communityId},
+		Reason:       util.XSSSanitize(req.Reason),
+	})); err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return nil, nil
+}
+
+func (rr *roleRoutes) revokeRole(c *gin.Context) (interface{}, *util.HTTPError) {
+	communityId, httpErr := mustGetCommunityId(c, rr.db)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	grant, httpErr := rr.getGrant(c, communityId, c.Param("user-id"))
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	if grant == nil {
+		return nil, util.BuildDoesNotExistHTTPErr("role")
+	}
+	if httpErr := rr.authorizeRevoke(c, grant); httpErr != nil {
+		return nil, httpErr
+	}
+	reason, httpErr := modReasonParam(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	if err := rr.db.RevokeRole(c, grant.UserId, communityId, modLogEntry(c, &model.ModLogEntry{
+		Action:       model.ModActionRevokeRole,
+		UserId:       &grant.UserId,
+		Role:         grant.Role,
+		CommunityIds: []int64{communityId},
+		Reason:       reason,
+	})); err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return nil, nil
+}
+
+// getGrant returns the role granted to the user on the community itself, or nil if there isn't one
+func (rr *roleRoutes) getGrant(c *gin.Context, communityId int64, userId string) (*model.RoleGrant, *util.HTTPError) {
+	grants, err := rr.db.GetRolesInCommunity(c, communityId)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	for _, grant := range grants {
+		if grant.UserId == userId {
+			return grant, nil
+		}
+	}
+	return nil, nil
+}
+
+// authorizeRevoke checks the caller may take the grant away, by revoking or replacing it. It takes the same permission
+// as granting the role
+func (rr *roleRoutes) authorizeRevoke(c *gin.Context, grant *model.RoleGrant) *util.HTTPError {
+	return authorize(c, rr.policy, controllers.ActionManageRole, &controllers.Resource{
+		CommunityIds: []int64{grant.CommunityId},
+		Role:         grant.Role,
+	}, "only moderators can revoke membership and only admins can remove moderators")
+}
+
+// mustGetCommunityId parses the community id in the path and checks the community exists
+func mustGetCommunityId(c *gin.Context, communities db.CommunityDatabase) (int64, *util.HTTPError) {
+	communityId, httpErr := util.ParseId(c.Param("id"))
+	if httpErr != nil {
+		return 0, httpErr
+	}
+	found, err := communities.GetCommunitiesByIds(c, []int64{communityId}, &db.GetCommunitiesQueryOpts{})
+	if err != nil {
+		return 0, util.BuildDbHTTPErr(err)
+	}
+	if len(found) == 0 {
+		return 0, util.BuildDoesNotExistHTTPErr("community")
+	}
+	return communityId, nil
+}
+
+// authorize checks the action with the policy. Returns a 403 with the reason if the user (if any) isn't allowed
+func authorize(c *gin.Context, policy *controllers.Policy, action controllers.Action, resource *controllers.Resource, reason string) *util.HTTPError {
+	allowed, err := policy.Can(c, middleware.GetLocalUser(c), action, resource)
+	if err != nil {
+		return util.BuildDbHTTPErr(err)
+	}
+	if !allowed {
+		return util.BuildOperationForbidden(reason)
+	}
+	return nil
+}
@@ -1,12 +1,11 @@
 package routes
 
 import (
-	"firebase.google.com/go/v4/auth"
 	"github.com/gin-gonic/gin"
-	"github.com/go-sql-driver/mysql"
 	"github.com/navbryce/next-dorm-be/db"
 	"github.com/navbryce/next-dorm-be/middleware"
 	"github.com/navbryce/next-dorm-be/model"
+	"github.com/navbryce/next-dorm-be/services"
 	"github.com/navbryce/next-dorm-be/util"
 	"net/http"
 )
@@ -15,9 +14,9 @@ type subscriptionRoutes struct {
 	db db.Database
 }
 
-func AddSubscriptionRoutes(group *gin.RouterGroup, db db.Database, authClient *auth.Client) {
+func AddSubscriptionRoutes(group *gin.RouterGroup, db db.Database, authenticator services.Authenticator) {
 	routes := subscriptionRoutes{db: db}
-	subs := group.Group("/subscriptions", middleware.GenAuth(db, authClient, &middleware.AuthConfig{}))
+	subs := group.Group("/subscriptions", middleware.GenAuth(db, authenticator, &middleware.AuthConfig{}))
 	subs.POST("", util.HandlerWrapper(routes.subscribe, &util.HandlerOpts{}))
 	subs.GET("", util.HandlerWrapper(routes.getSubscriptions, &util.HandlerOpts{}))
 }
@@ -53,8 +52,7 @@ func (sr *subscriptionRoutes) subscribe(c *gin.Context) (interface{}, *util.HTTP
 			UserId:      middleware.MustGetLocalUser(c).Id,
 			CommunityId: communityId,
 		}); err != nil {
-			err, ok := err.(*mysql.MySQLError)
-			if !ok || !db.IsDupKeyErr(err) {
+			if !db.IsDupKeyErr(err) {
 				return nil, util.BuildDbHTTPErr(err)
 			}
 		}
@@ -0,0 +1,215 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/navbryce/next-dorm-be/config"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/middleware"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/navbryce/next-dorm-be/services"
+	"github.com/navbryce/next-dorm-be/util"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+)
+
+type uploadRoutes struct {
+	db         db.Database
+	userBucket services.BlobStore
+	cfg        *config.UploadConfig
+}
+
+// AddUploadRoutes adds the upload session API. Clients request a session for a blob, then PUT the bytes to the
+// returned path. Only blobs uploaded this way can be attached to content
+func AddUploadRoutes(group *gin.RouterGroup, db db.Database, authenticator services.Authenticator, userBucket services.BlobStore, cfg *config.UploadConfig, limiter *services.RateLimiter) {
+	routes := uploadRoutes{db, userBucket, cfg}
+	uploads := group.Group("/uploads", middleware.GenAuth(db, authenticator, &middleware.AuthConfig{}))
+	uploadLimit := middleware.RateLimit(limiter, config.RateLimitGroupUploads)
+	uploads.POST("", middleware.RequireToken(), uploadLimit, util.HandlerWrapper(routes.createUpload, &util.HandlerOpts{}))
+	uploads.PUT("/:token", middleware.RequireToken(), uploadLimit, util.HandlerWrapper(routes.upload, &util.HandlerOpts{}))
+}
+
+type createUploadReq struct {
+	Kind        model.UploadKind `json:"kind"`
+	ContentType string           `json:"contentType"`
+	Size        int64            `json:"size"`
+}
+
+type createUploadRes struct {
+	*model.Upload
+	Token      string `json:"token"`
+	UploadPath string `json:"uploadPath"`
+}
+
+func (ur *uploadRoutes) createUpload(c *gin.Context) (interface{}, *util.HTTPError) {
+	var req createUploadReq
+	if err := c.BindJSON(&req); err != nil {
+		return nil, util.BuildJSONBindHTTPErr(err)
+	}
+
+	identity := middleware.MustGetToken(c)
+	var blobName string
+	var maxSize int
+	switch req.Kind {
+	case model.UploadKindAvatar:
+		blobName = identity.AvatarBlobNameForUser()
+		maxSize = ur.cfg.MaxAvatarBytes
+	case model.UploadKindImage:
+		// avatars are uploaded before the profile exists, images are only for content
+		if middleware.GetLocalUser(c) == nil {
+			return nil, util.BuildOperationForbidden("must have a user profile")
+		}
+		key, err := randomString(16)
+		if err != nil {
+			return nil, buildTokenHTTPErr(err)
+		}
+		blobName = model.ImageBlobNameForUser(identity.UID, key)
+		maxSize = ur.cfg.MaxImageBytes
+	default:
+		return nil, &util.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("kind must be %v or %v", model.UploadKindImage, model.UploadKindAvatar),
+		}
+	}
+
+	if !ur.isAllowedType(req.ContentType) {
+		return nil, &util.HTTPError{
+			Status:  http.StatusUnsupportedMediaType,
+			Message: fmt.Sprintf("content type must be one of %v", ur.cfg.AllowedTypes),
+		}
+	}
+	if req.Size <= 0 || req.Size > int64(maxSize) {
+		return nil, &util.HTTPError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("size must be between 1 and %v bytes", maxSize),
+		}
+	}
+
+	token, err := randomString(32)
+	if err != nil {
+		return nil, buildTokenHTTPErr(err)
+	}
+	now := time.Now().UTC()
+	upload := &model.Upload{
+		TokenHash:   hashUploadToken(token),
+		BlobName:    blobName,
+		OwnerId:     identity.UID,
+		Kind:        req.Kind,
+		ContentType: req.ContentType,
+		MaxSize:     req.Size,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ur.cfg.TokenTTL),
+	}
+	if upload.Id, err = ur.db.CreateUpload(c, upload); err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return &createUploadRes{
+		Upload:     upload,
+		Token:      token,
+		UploadPath: fmt.Sprintf("/uploads/%v", token),
+	}, nil
+}
+
+// upload stores the request body as the blob of the session. The body must match the declared content type and size
+func (ur *uploadRoutes) upload(c *gin.Context) (interface{}, *util.HTTPError) {
+	upload, err := ur.db.GetUploadByTokenHash(c, hashUploadToken(c.Param("token")))
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	if upload == nil {
+		return nil, util.BuildDoesNotExistHTTPErr("upload")
+	}
+	if upload.OwnerId != middleware.MustGetToken(c).UID {
+		return nil, util.BuildOperationForbidden("upload belongs to another user")
+	}
+	if upload.IsCompleted() {
+		return nil, &util.HTTPError{Status: http.StatusConflict, Message: "upload already completed"}
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		return nil, &util.HTTPError{Status: http.StatusGone, Message: "upload expired"}
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(c.ContentType()); err != nil || mediaType != upload.ContentType {
+		return nil, &util.HTTPError{
+			Status:  http.StatusUnsupportedMediaType,
+			Message: fmt.Sprintf("Content-Type must be %v", upload.ContentType),
+		}
+	}
+	contents, err := io.ReadAll(io.LimitReader(c.Request.Body, upload.MaxSize+1))
+	if err != nil {
+		return nil, &util.HTTPError{Status: http.StatusBadRequest, Message: "error reading body"}
+	}
+	if int64(len(contents)) > upload.MaxSize {
+		return nil, &util.HTTPError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("body is larger than the declared %v bytes", upload.MaxSize),
+		}
+	}
+	if sniffed := http.DetectContentType(contents); sniffed != upload.ContentType {
+		return nil, &util.HTTPError{
+			Status:  http.StatusUnsupportedMediaType,
+			Message: fmt.Sprintf("body is not %v", upload.ContentType),
+		}
+	}
+
+	// completing the upload claims it, so two requests with the same token can't both write the blob
+	if err := ur.db.CompleteUpload(c, upload.Id, int64(len(contents))); err != nil {
+		if err == db.ErrNotFound {
+			return nil, &util.HTTPError{Status: http.StatusConflict, Message: "upload already completed"}
+		}
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	if err := ur.userBucket.Put(c, upload.BlobName, bytes.NewReader(contents), upload.ContentType); err != nil {
+		log.Println("a storage error occurred", err)
+		if err := ur.db.ReopenUpload(c, upload.Id); err != nil {
+			log.Println("an error occurred while reopening upload", upload.Id, err)
+		}
+		return nil, &util.HTTPError{
+			Status:  http.StatusInternalServerError,
+			Message: "a storage error occurred",
+		}
+	}
+	return gin.H{
+		"blobName": upload.BlobName,
+		"size":     len(contents),
+	}, nil
+}
+
+func (ur *uploadRoutes) isAllowedType(contentType string) bool {
+	for _, allowed := range ur.cfg.AllowedTypes {
+		if contentType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// hashUploadToken is what's stored, so a leaked upload table can't be used to upload
+func hashUploadToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func randomString(numBytes int) (string, error) {
+	raw := make([]byte, numBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func buildTokenHTTPErr(err error) *util.HTTPError {
+	log.Println("error generating random token", err)
+	return &util.HTTPError{
+		Status:  http.StatusInternalServerError,
+		Message: "error generating token",
+	}
+}
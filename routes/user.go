@@ -1,10 +1,8 @@
 package routes
 
 import (
-	"firebase.google.com/go/v4/auth"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/go-sql-driver/mysql"
 	"github.com/navbryce/next-dorm-be/db"
 	"github.com/navbryce/next-dorm-be/middleware"
 	"github.com/navbryce/next-dorm-be/model"
@@ -18,13 +16,13 @@ import (
 const MinDisplayNameLength = 4
 
 type userRoutes struct {
-	db         db.UserDatabase
-	userBucket *services.StorageBucket
+	db      db.UserDatabase
+	uploads db.UploadDatabase
 }
 
-func AddUserRoutes(group *gin.RouterGroup, userDatabase db.UserDatabase, authClient *auth.Client, userBucket *services.StorageBucket) {
-	routes := userRoutes{userDatabase, userBucket}
-	users := group.Group("/users", middleware.GenAuth(userDatabase, authClient, &middleware.AuthConfig{}))
+func AddUserRoutes(group *gin.RouterGroup, userDatabase db.UserDatabase, uploads db.UploadDatabase, authenticator services.Authenticator) {
+	routes := userRoutes{userDatabase, uploads}
+	users := group.Group("/users", middleware.GenAuth(userDatabase, authenticator, &middleware.AuthConfig{}))
 	users.GET("/:userId", util.HandlerWrapper(routes.GetLocalUser, &util.HandlerOpts{}))
 	users.PUT("",
 		middleware.RequireToken(),
@@ -63,13 +61,8 @@ func (ur userRoutes) CreateLocalUser(c *gin.Context) (interface{}, *util.HTTPErr
 	if err := req.Validate(); err != nil {
 		return nil, err
 	}
-	if exists, err := ur.userBucket.Exists(c, middleware.MustGetToken(c).AvatarBlobNameForUser()); err != nil {
-		return nil, util.BuildDbHTTPErr(err)
-	} else if !exists {
-		return nil, &util.HTTPError{
-			Status:  http.StatusBadRequest,
-			Message: "must have an avatar",
-		}
+	if err := ur.avatarMustBeUploaded(c); err != nil {
+		return nil, err
 	}
 
 	user := &model.LocalUser{
@@ -77,8 +70,7 @@ func (ur userRoutes) CreateLocalUser(c *gin.Context) (interface{}, *util.HTTPErr
 		DisplayName: req.DisplayName,
 	}
 	if err := ur.db.CreateUser(c, user); err != nil {
-		err, ok := err.(*mysql.MySQLError)
-		if ok && db.IsDupKeyErr(err) {
+		if db.IsDupKeyErr(err) {
 			dupKey := db.GetDupKey(err)
 			log.Println(dupKey)
 			if strings.Contains(db.GetDupKey(err), "display_name") {
@@ -97,6 +89,26 @@ func (ur userRoutes) CreateLocalUser(c *gin.Context) (interface{}, *util.HTTPErr
 	// return the user to get the generated avatar if not specified in req
 	return user, nil
 }
+
+// avatarMustBeUploaded checks the caller uploaded their avatar through an upload session, which enforces the avatar
+// limits
+func (ur userRoutes) avatarMustBeUploaded(c *gin.Context) *util.HTTPError {
+	identity := middleware.MustGetToken(c)
+	uploads, err := ur.uploads.GetCompletedUploads(c, []string{identity.AvatarBlobNameForUser()})
+	if err != nil {
+		return util.BuildDbHTTPErr(err)
+	}
+	for _, upload := range uploads {
+		if upload.OwnerId == identity.UID && upload.Kind == model.UploadKindAvatar {
+			return nil
+		}
+	}
+	return &util.HTTPError{
+		Status:  http.StatusBadRequest,
+		Message: "must have an avatar",
+	}
+}
+
 func (ur userRoutes) GetCurrentLocalUser(c *gin.Context) (interface{}, *util.HTTPError) {
 
 	user, err := ur.db.GetUser(c, middleware.MustGetToken(c).UID)
@@ -0,0 +1,290 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/navbryce/next-dorm-be/controllers"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/middleware"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/navbryce/next-dorm-be/services"
+	"github.com/navbryce/next-dorm-be/util"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxWebhookURLLength  = 2048
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 200
+)
+
+type webhookRoutes struct {
+	db     db.Database
+	policy *controllers.Policy
+}
+
+// AddWebhookRoutes adds the API moderators manage the webhooks of a community with. A webhook receives the events of
+// the community and everything below it. Deliveries are queued by the routes that write the content, and sent by
+// services.WebhookSender
+func AddWebhookRoutes(group *gin.RouterGroup, db db.Database, authenticator services.Authenticator, policy *controllers.Policy) {
+	routes := webhookRoutes{db, policy}
+	webhooks := group.Group("/communities/:id/webhooks", middleware.GenAuth(db, authenticator, &middleware.AuthConfig{}), middleware.RequireAccount())
+	webhooks.GET("", util.HandlerWrapper(routes.getWebhooks, &util.HandlerOpts{}))
+	webhooks.PUT("", util.HandlerWrapper(routes.createWebhook, &util.HandlerOpts{}))
+	webhooks.PUT("/:webhook-id", util.HandlerWrapper(routes.updateWebhook, &util.HandlerOpts{}))
+	webhooks.DELETE("/:webhook-id", util.HandlerWrapper(routes.deleteWebhook, &util.HandlerOpts{}))
+	webhooks.GET("/:webhook-id/deliveries", util.HandlerWrapper(routes.getDeliveries, &util.HandlerOpts{}))
+	webhooks.PUT("/:webhook-id/deliveries/:delivery-id/replay", util.HandlerWrapper(routes.replayDelivery, &util.HandlerOpts{}))
+}
+
+// getWebhooks returns the webhooks set on the community. Webhooks of its ancestors are managed through the ancestors
+func (wr *webhookRoutes) getWebhooks(c *gin.Context) (interface{}, *util.HTTPError) {
+	communityId, httpErr := wr.authorizeManage(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	webhooks, err := wr.db.GetWebhooks(c, []int64{communityId})
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return webhooks, nil
+}
+
+type webhookReq struct {
+	URL    string               `json:"url"`
+	Events []model.WebhookEvent `json:"events"`
+	// Active pauses (false) or resumes (true) the webhook. Unchanged if unset, and true for new webhooks
+	Active *bool `json:"active"`
+}
+
+// createWebhook returns the secret the deliveries are signed with. It's never shown again
+func (wr *webhookRoutes) createWebhook(c *gin.Context) (interface{}, *util.HTTPError) {
+	var req webhookReq
+	if err := c.BindJSON(&req); err != nil {
+		return nil, util.BuildJSONBindHTTPErr(err)
+	}
+	communityId, httpErr := wr.authorizeManage(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	secret, err := services.NewWebhookSecret()
+	if err != nil {
+		return nil, &util.HTTPError{Status: http.StatusInternalServerError, Message: "could not generate a secret"}
+	}
+	webhook := &model.Webhook{
+		CommunityId: communityId,
+		Secret:      secret,
+		Active:      true,
+		CreatedBy:   middleware.MustGetLocalUser(c).Id,
+	}
+	if httpErr := applyWebhookReq(webhook, &req); httpErr != nil {
+		return nil, httpErr
+	}
+
+	if webhook.Id, err = wr.db.CreateWebhook(c, webhook, modLogEntry(c, &model.ModLogEntry{
+		Action:       model.ModActionCreateWebhook,
+		CommunityIds: []int64{communityId},
+	})); err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return gin.H{
+		"id":     webhook.Id,
+		"secret": webhook.Secret,
+	}, nil
+}
+
+// updateWebhook replaces the url and events of the webhook, and pauses or resumes it
+func (wr *webhookRoutes) updateWebhook(c *gin.Context) (interface{}, *util.HTTPError) {
+	var req webhookReq
+	if err := c.BindJSON(&req); err != nil {
+		return nil, util.BuildJSONBindHTTPErr(err)
+	}
+	webhook, httpErr := wr.mustGetWebhook(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	if httpErr := applyWebhookReq(webhook, &req); httpErr != nil {
+		return nil, httpErr
+	}
+
+	if err := wr.db.UpdateWebhook(c, webhook, modLogEntry(c, &model.ModLogEntry{
+		Action:       model.ModActionUpdateWebhook,
+		TargetId:     &webhook.Id,
+		CommunityIds: []int64{webhook.CommunityId},
+	})); err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return nil, nil
+}
+
+// deleteWebhook removes the webhook along with its delivery log
+func (wr *webhookRoutes) deleteWebhook(c *gin.Context) (interface{}, *util.HTTPError) {
+	webhook, httpErr := wr.mustGetWebhook(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	reason, httpErr := modReasonParam(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	if err := wr.db.DeleteWebhook(c, webhook.Id, modLogEntry(c, &model.ModLogEntry{
+		Action:       model.ModActionDeleteWebhook,
+		TargetId:     &webhook.Id,
+		CommunityIds: []int64{webhook.CommunityId},
+		Reason:       reason,
+	})); err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return nil, nil
+}
+
+// getDeliveries pages through the delivery log of the webhook, newest first. Filtered by the status query param
+func (wr *webhookRoutes) getDeliveries(c *gin.Context) (interface{}, *util.HTTPError) {
+	webhook, httpErr := wr.mustGetWebhook(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	query := &db.WebhookDeliveriesQuery{
+		WebhookId: webhook.Id,
+		Status:    model.WebhookDeliveryStatus(c.Query("status")),
+		Limit:     defaultDeliveryLimit,
+	}
+	if query.Status != "" && !query.Status.IsValid() {
+		return nil, &util.HTTPError{Status: http.StatusBadRequest, Message: fmt.Sprintf("unknown status %v", query.Status)}
+	}
+	if before := c.Query("before"); before != "" {
+		if query.BeforeId, httpErr = util.ParseId(before); httpErr != nil {
+			return nil, httpErr
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		var err error
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 || query.Limit > maxDeliveryLimit {
+			return nil, &util.HTTPError{
+				Status:  http.StatusBadRequest,
+				Message: fmt.Sprintf("limit must be between 1 and %v", maxDeliveryLimit),
+			}
+		}
+	}
+
+	deliveries, err := wr.db.GetWebhookDeliveries(c, query)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	var nextBefore *int64
+	if len(deliveries) == query.Limit {
+		nextBefore = &deliveries[len(deliveries)-1].Id
+	}
+	return gin.H{
+		"deliveries": deliveries,
+		"nextBefore": nextBefore,
+	}, nil
+}
+
+// replayDelivery queues the payload of a past delivery again, as a new delivery signed with the webhook's secret.
+// Receivers can tell replays apart by the new delivery id
+func (wr *webhookRoutes) replayDelivery(c *gin.Context) (interface{}, *util.HTTPError) {
+	webhook, httpErr := wr.mustGetWebhook(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	if !webhook.Active {
+		return nil, &util.HTTPError{Status: http.StatusConflict, Message: "the webhook is inactive"}
+	}
+	deliveryId, httpErr := util.ParseId(c.Param("delivery-id"))
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	delivery, err := wr.db.GetWebhookDelivery(c, deliveryId)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	if delivery == nil || delivery.WebhookId != webhook.Id {
+		return nil, util.BuildDoesNotExistHTTPErr("delivery")
+	}
+
+	now := time.Now()
+	replay := &model.WebhookDelivery{
+		WebhookId:     webhook.Id,
+		Event:         delivery.Event,
+		Payload:       delivery.Payload,
+		Status:        model.WebhookDeliveryPending,
+		NextAttemptAt: &now,
+		ReplayOf:      &delivery.Id,
+	}
+	if err := wr.db.CreateWebhookDeliveries(c, []*model.WebhookDelivery{replay}); err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	return gin.H{"id": replay.Id}, nil
+}
+
+// authorizeManage checks the caller moderates the community in the path and returns its id
+func (wr *webhookRoutes) authorizeManage(c *gin.Context) (int64, *util.HTTPError) {
+	communityId, httpErr := mustGetCommunityId(c, wr.db)
+	if httpErr != nil {
+		return 0, httpErr
+	}
+	if httpErr := authorize(c, wr.policy, controllers.ActionManageWebhooks, &controllers.Resource{
+		CommunityIds: []int64{communityId},
+	}, "only moderators of the community can manage its webhooks"); httpErr != nil {
+		return 0, httpErr
+	}
+	return communityId, nil
+}
+
+// mustGetWebhook returns the webhook in the path. Webhooks of an ancestor are managed through the ancestor
+func (wr *webhookRoutes) mustGetWebhook(c *gin.Context) (*model.Webhook, *util.HTTPError) {
+	communityId, httpErr := wr.authorizeManage(c)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	id, httpErr := util.ParseId(c.Param("webhook-id"))
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	webhook, err := wr.db.GetWebhook(c, id)
+	if err != nil {
+		return nil, util.BuildDbHTTPErr(err)
+	}
+	if webhook == nil || webhook.CommunityId != communityId {
+		return nil, util.BuildDoesNotExistHTTPErr("webhook")
+	}
+	return webhook, nil
+}
+
+// applyWebhookReq validates the request and sets it on the webhook
+func applyWebhookReq(webhook *model.Webhook, req *webhookReq) *util.HTTPError {
+	req.URL = strings.TrimSpace(req.URL)
+	parsed, err := url.Parse(req.URL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" || parsed.User != nil {
+		return &util.HTTPError{Status: http.StatusBadRequest, Message: "url must be an absolute http or https URL"}
+	}
+	if len(req.URL) > maxWebhookURLLength {
+		return &util.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("url must be at most %v characters", maxWebhookURLLength),
+		}
+	}
+	if len(req.Events) == 0 {
+		return &util.HTTPError{Status: http.StatusBadRequest, Message: "events must list at least one event"}
+	}
+	events := make(model.WebhookEvents, 0, len(req.Events))
+	for _, event := range req.Events {
+		if !event.IsValid() {
+			return &util.HTTPError{Status: http.StatusBadRequest, Message: fmt.Sprintf("unknown event %v", event)}
+		}
+		if !events.Contains(event) {
+			events = append(events, event)
+		}
+	}
+	webhook.URL = req.URL
+	webhook.Events = events
+	if req.Active != nil {
+		webhook.Active = *req.Active
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"github.com/navbryce/next-dorm-be/util"
+	"math/big"
+)
+
+// aliasAttempts bounds how many random aliases are tried before giving up on a thread. With ~400k aliases a thread
+// would need to be enormous for collisions to matter
+const aliasAttempts = 10
+
+var ErrNoAliasAvailable = errors.New("no alias available in thread")
+
+var aliasAdjectives = []string{
+	"Amber", "Ancient", "Bold", "Brave", "Breezy", "Bright", "Calm", "Clever", "Cosmic", "Cozy", "Crimson", "Curious",
+	"Daring", "Dizzy", "Dreamy", "Eager", "Electric", "Fancy", "Fearless", "Fluffy", "Friendly", "Gentle", "Giddy",
+	"Golden", "Grumpy", "Happy", "Hidden", "Humble", "Icy", "Jolly", "Jumpy", "Kind", "Lazy", "Lucky", "Lunar",
+	"Mellow", "Mighty", "Misty", "Noble", "Quiet", "Quick", "Rapid", "Rustic", "Shy", "Silent", "Silver", "Sleepy",
+	"Sneaky", "Snowy", "Solar", "Speedy", "Spicy", "Stormy", "Sunny", "Swift", "Tiny", "Twinkly", "Velvet",
+	"Wandering", "Whimsical", "Wild", "Witty", "Zany", "Zesty",
+}
+
+var aliasAnimals = []string{
+	"Aardvark", "Albatross", "Alpaca", "Badger", "Beaver", "Bison", "Capybara", "Cheetah", "Chinchilla", "Cobra",
+	"Coyote", "Crane", "Dingo", "Dolphin", "Dragonfly", "Eagle", "Ferret", "Flamingo", "Fox", "Frog", "Gazelle",
+	"Gecko", "Giraffe", "Hedgehog", "Heron", "Hippo", "Ibis", "Iguana", "Jackal", "Jaguar", "Kangaroo", "Koala",
+	"Lemur", "Leopard", "Llama", "Lynx", "Manatee", "Meerkat", "Moose", "Narwhal", "Newt", "Ocelot", "Octopus",
+	"Otter", "Owl", "Panda", "Pangolin", "Penguin", "Puffin", "Quokka", "Raccoon", "Raven", "Salamander", "Seal",
+	"Sloth", "Sparrow", "Squid", "Tapir", "Tiger", "Toucan", "Turtle", "Walrus", "Wombat", "Yak",
+}
+
+const maxAliasNumber = 99
+
+// AliasService hands out the aliases hidden content is posted under. A user keeps the same alias throughout a thread
+// (a post and its comments) and no two users share one in the same thread
+type AliasService struct {
+	db      db.AliasDatabase
+	avatars *util.AvatarBuilder
+}
+
+func NewAliasService(db db.AliasDatabase, avatars *util.AvatarBuilder) *AliasService {
+	return &AliasService{db: db, avatars: avatars}
+}
+
+// NewAlias returns a random alias such as "Quiet Otter 42". It's only unique within a thread once stored through
+// ThreadAlias (or db.CreatePost, for the first alias of a thread)
+func NewAlias() (string, error) {
+	adjective, err := randomIndex(len(aliasAdjectives))
+	if err != nil {
+		return "", err
+	}
+	animal, err := randomIndex(len(aliasAnimals))
+	if err != nil {
+		return "", err
+	}
+	number, err := randomIndex(maxAliasNumber)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v %v %v", aliasAdjectives[adjective], aliasAnimals[animal], number+1), nil
+}
+
+// ThreadAlias returns the alias of the user in the thread of the post, creating one if the user doesn't have one yet
+func (as *AliasService) ThreadAlias(ctx context.Context, postMetadataId int64, userId string) (*model.AnonymousUser, error) {
+	for attempt := 0; attempt < aliasAttempts; attempt++ {
+		alias, err := as.db.GetThreadAlias(ctx, postMetadataId, userId)
+		if err != nil {
+			return nil, err
+		}
+		if len(alias) > 0 {
+			return as.avatars.AnonymousUser(alias), nil
+		}
+
+		if alias, err = NewAlias(); err != nil {
+			return nil, err
+		}
+		err = as.db.CreateThreadAlias(ctx, postMetadataId, userId, alias)
+		if err == nil {
+			return as.avatars.AnonymousUser(alias), nil
+		}
+		// either another user has the alias or a concurrent request already gave this user one. the next attempt
+		// handles both
+		if !db.IsDupKeyErr(err) {
+			return nil, err
+		}
+	}
+	return nil, ErrNoAliasAvailable
+}
+
+func randomIndex(n int) (int, error) {
+	index, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(index.Int64()), nil
+}
@@ -0,0 +1,15 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/navbryce/next-dorm-be/model"
+)
+
+// ErrInvalidToken is returned (possibly wrapped) by an Authenticator when the token can't be trusted
+var ErrInvalidToken = errors.New("invalid token")
+
+// Authenticator verifies a bearer token and returns who it belongs to
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*model.Identity, error)
+}
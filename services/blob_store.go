@@ -0,0 +1,44 @@
+package services
+
+import (
+	"context"
+	"errors"
+	firebase "firebase.google.com/go/v4"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/config"
+	"io"
+	"time"
+)
+
+// ErrBlobNotExist is returned by BlobStore.Get and BlobStore.Delete for missing blobs
+var ErrBlobNotExist = errors.New("blob does not exist")
+
+// BlobStore holds user uploads. Blob names are "/" separated paths such as uploads/{userId}/avatar
+type BlobStore interface {
+	Exists(ctx context.Context, blobName string) (bool, error)
+	Put(ctx context.Context, blobName string, contents io.Reader, contentType string) error
+	// Get returns a reader the caller must close
+	Get(ctx context.Context, blobName string) (io.ReadCloser, error)
+	Delete(ctx context.Context, blobName string) error
+	// List returns every blob whose name starts with prefix
+	List(ctx context.Context, prefix string) ([]*BlobAttrs, error)
+}
+
+type BlobAttrs struct {
+	Name        string
+	Size        int64
+	ContentType string
+	Created     time.Time
+}
+
+// NewBlobStore returns the BlobStore named by cfg.Backend. app is only used by the gcs backend
+func NewBlobStore(ctx context.Context, cfg *config.StorageConfig, app *firebase.App) (BlobStore, error) {
+	switch cfg.Backend {
+	case config.StorageBackendGCS:
+		return NewGCSBlobStore(ctx, app, cfg.Bucket)
+	case config.StorageBackendFilesystem:
+		return NewFSBlobStore(cfg.Path)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %v", cfg.Backend)
+	}
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+const exifOrientationTag = 0x0112
+
+// jpegOrientation reads the EXIF orientation (1-8) of a JPEG. Returns 1 (upright) when there isn't one
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		// EXIF lives in APP1, which comes before the image data
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// tiffOrientation looks for the orientation tag in the first IFD of the EXIF TIFF structure
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	numEntries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < numEntries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) != exifOrientationTag {
+			continue
+		}
+		// the value of a single SHORT is stored inline
+		if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+			return orientation
+		}
+		return 1
+	}
+	return 1
+}
+
+// applyOrientation rotates/flips img so it displays upright without the EXIF orientation
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	src := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = width-1-x, y
+			case 3: // upside down
+				sx, sy = width-1-x, height-1-y
+			case 4: // mirrored upside down
+				sx, sy = x, height-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // rotated 90 degrees counterclockwise
+				sx, sy = y, height-1-x
+			case 7: // transversed
+				sx, sy = width-1-y, height-1-x
+			case 8: // rotated 90 degrees clockwise
+				sx, sy = width-1-y, x
+			}
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], src.Pix[sy*src.Stride+sx*4:sy*src.Stride+sx*4+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileMailer writes every email to its own .eml file under a directory instead of sending it. Intended for local
+// development
+type FileMailer struct {
+	from string
+	dir  string
+}
+
+var _ Mailer = (*FileMailer)(nil)
+
+// NewFileMailer creates dir if it doesn't exist
+func NewFileMailer(from string, dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{from: from, dir: dir}, nil
+}
+
+func (fm *FileMailer) Send(_ context.Context, email *Email) error {
+	msg, err := buildMessage(fm.from, email)
+	if err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	// named after when they were sent, so listing the directory lists them in order
+	name := fmt.Sprintf("%v-%v.eml", time.Now().UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(fm.dir, name), msg, 0600)
+}
+
+// WriterMailer writes every email to a writer, such as stdout, instead of sending it. Intended for local development
+type WriterMailer struct {
+	from string
+	mu   sync.Mutex
+	w    io.Writer
+}
+
+var _ Mailer = (*WriterMailer)(nil)
+
+func NewWriterMailer(from string, w io.Writer) *WriterMailer {
+	return &WriterMailer{from: from, w: w}
+}
+
+func (wm *WriterMailer) Send(_ context.Context, email *Email) error {
+	msg, err := buildMessage(wm.from, email)
+	if err != nil {
+		return err
+	}
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	_, err = fmt.Fprintf(wm.w, "----- email to %v -----\r\n%s\r\n", email.To, msg)
+	return err
+}
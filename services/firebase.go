@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	firebase "firebase.google.com/go/v4"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/config"
+	"log"
+	"os"
+)
+
+const (
+	CredentialsPathEnvVar = "GOOGLE_APPLICATION_CREDENTIALS"
+	TargetCredentialsFile = "./google-application-credentials.json"
+)
+
+// NewFirebaseApp initializes the firebase SDK with the configured credentials
+func NewFirebaseApp(ctx context.Context, cfg *config.FirebaseConfig) (*firebase.App, error) {
+	if err := configureFirebaseCredentials(cfg); err != nil {
+		return nil, fmt.Errorf("an error occurred while configuring firebase credentials: %w", err)
+	}
+	return firebase.NewApp(ctx, nil)
+}
+
+// configureFirebaseCredentials makes the credentials available to the firebase SDK, which only reads them from a file
+// named by GOOGLE_APPLICATION_CREDENTIALS
+func configureFirebaseCredentials(cfg *config.FirebaseConfig) error {
+	if cfg.CredentialsPath != "" {
+		log.Printf("Credentials path detected in config. Expecting credentails to be at %v\n", cfg.CredentialsPath)
+		return os.Setenv(CredentialsPathEnvVar, cfg.CredentialsPath)
+	}
+	if cfg.CredentialsJSON != "" {
+		log.Println("Credentials JSON string detected in config.")
+		err := os.WriteFile(TargetCredentialsFile, []byte(cfg.CredentialsJSON), 400)
+		if err != nil {
+			return fmt.Errorf("error writing credentials to temp file, %w", err)
+		}
+		err = os.Setenv(CredentialsPathEnvVar, TargetCredentialsFile)
+		if err != nil {
+			return fmt.Errorf("error setting %v env var %w", CredentialsPathEnvVar, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("must specify either firebase.credentials_path (a path)" +
+		" or firebase.credentials_json (credentials as JSON string)")
+}
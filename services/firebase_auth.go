@@ -0,0 +1,35 @@
+package services
+
+import (
+	"context"
+	"firebase.google.com/go/v4/auth"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/model"
+)
+
+// FirebaseAuthenticator verifies Firebase ID tokens
+type FirebaseAuthenticator struct {
+	client *auth.Client
+}
+
+var _ Authenticator = (*FirebaseAuthenticator)(nil)
+
+func NewFirebaseAuthenticator(client *auth.Client) *FirebaseAuthenticator {
+	return &FirebaseAuthenticator{client: client}
+}
+
+func (fa *FirebaseAuthenticator) Authenticate(ctx context.Context, token string) (*model.Identity, error) {
+	// TODO: VerifyIDToken and check revoked?
+	verified, err := fa.client.VerifyIDToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	identity := &model.Identity{
+		UID:    verified.UID,
+		Claims: verified.Claims,
+	}
+	if email, ok := verified.Claims["email"].(string); ok {
+		identity.Email = email
+	}
+	return identity, nil
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FSBlobStore is a BlobStore that keeps blobs as files under a root directory. Intended for local development.
+// Content types aren't stored; List sniffs them from the file contents
+type FSBlobStore struct {
+	root string
+}
+
+var _ BlobStore = (*FSBlobStore)(nil)
+
+// NewFSBlobStore creates root if it doesn't exist
+func NewFSBlobStore(root string) (*FSBlobStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &FSBlobStore{root: root}, nil
+}
+
+// pathFor maps a blob name to a file under root, rejecting names that would escape it
+func (fbs *FSBlobStore) pathFor(blobName string) (string, error) {
+	cleaned := path.Clean("/" + blobName)[1:]
+	if len(blobName) == 0 || cleaned != blobName {
+		return "", fmt.Errorf("invalid blob name %q", blobName)
+	}
+	return filepath.Join(fbs.root, filepath.FromSlash(cleaned)), nil
+}
+
+func (fbs *FSBlobStore) Exists(_ context.Context, blobName string) (bool, error) {
+	if len(blobName) == 0 {
+		return false, nil
+	}
+	filePath, err := fbs.pathFor(blobName)
+	if err != nil {
+		return false, nil
+	}
+	info, err := os.Stat(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return info.Mode().IsRegular(), nil
+}
+
+// Put writes to a temp file first so readers never see a partial blob
+func (fbs *FSBlobStore) Put(_ context.Context, blobName string, contents io.Reader, _ string) error {
+	filePath, err := fbs.pathFor(blobName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, contents); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+func (fbs *FSBlobStore) Get(_ context.Context, blobName string) (io.ReadCloser, error) {
+	filePath, err := fbs.pathFor(blobName)
+	if err != nil {
+		return nil, ErrBlobNotExist
+	}
+	file, err := os.Open(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrBlobNotExist
+	}
+	return file, err
+}
+
+func (fbs *FSBlobStore) Delete(_ context.Context, blobName string) error {
+	filePath, err := fbs.pathFor(blobName)
+	if err != nil {
+		return ErrBlobNotExist
+	}
+	err = os.Remove(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrBlobNotExist
+	}
+	return err
+}
+
+func (fbs *FSBlobStore) List(_ context.Context, prefix string) ([]*BlobAttrs, error) {
+	var blobs []*BlobAttrs
+	err := filepath.WalkDir(fbs.root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(fbs.root, filePath)
+		if err != nil {
+			return err
+		}
+		blobName := filepath.ToSlash(rel)
+		if !strings.HasPrefix(blobName, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		contentType, err := sniffContentType(filePath)
+		if err != nil {
+			return err
+		}
+		blobs = append(blobs, &BlobAttrs{
+			Name:        blobName,
+			Size:        info.Size(),
+			ContentType: contentType,
+			Created:     info.ModTime(),
+		})
+		return nil
+	})
+	return blobs, err
+}
+
+func sniffContentType(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return http.DetectContentType(head[:n]), nil
+}
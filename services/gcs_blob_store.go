@@ -0,0 +1,91 @@
+package services
+
+import (
+	"cloud.google.com/go/storage"
+	"context"
+	firebase "firebase.google.com/go/v4"
+	"google.golang.org/api/iterator"
+	"io"
+)
+
+// GCSBlobStore is a BlobStore backed by the firebase (GCS) storage bucket
+type GCSBlobStore struct {
+	*storage.BucketHandle
+}
+
+var _ BlobStore = (*GCSBlobStore)(nil)
+
+func NewGCSBlobStore(ctx context.Context, app *firebase.App, bucketName string) (*GCSBlobStore, error) {
+	client, err := app.Storage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bucketHandle, err := client.Bucket(bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GCSBlobStore{
+		bucketHandle,
+	}, nil
+}
+
+func (gbs *GCSBlobStore) Exists(ctx context.Context, blobName string) (bool, error) {
+	if len(blobName) == 0 {
+		return false, nil
+	}
+	handle := gbs.Object(blobName)
+	if _, err := handle.Attrs(ctx); err != nil {
+		if err == storage.ErrObjectNotExist {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (gbs *GCSBlobStore) Put(ctx context.Context, blobName string, contents io.Reader, contentType string) error {
+	writer := gbs.Object(blobName).NewWriter(ctx)
+	writer.ContentType = contentType
+	if _, err := io.Copy(writer, contents); err != nil {
+		_ = writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+func (gbs *GCSBlobStore) Get(ctx context.Context, blobName string) (io.ReadCloser, error) {
+	reader, err := gbs.Object(blobName).NewReader(ctx)
+	if err == storage.ErrObjectNotExist {
+		return nil, ErrBlobNotExist
+	}
+	return reader, err
+}
+
+func (gbs *GCSBlobStore) Delete(ctx context.Context, blobName string) error {
+	err := gbs.Object(blobName).Delete(ctx)
+	if err == storage.ErrObjectNotExist {
+		return ErrBlobNotExist
+	}
+	return err
+}
+
+func (gbs *GCSBlobStore) List(ctx context.Context, prefix string) ([]*BlobAttrs, error) {
+	var blobs []*BlobAttrs
+	it := gbs.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return blobs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, &BlobAttrs{
+			Name:        attrs.Name,
+			Size:        attrs.Size,
+			ContentType: attrs.ContentType,
+			Created:     attrs.Created,
+		})
+	}
+}
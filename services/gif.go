@@ -0,0 +1,62 @@
+package services
+
+import "encoding/binary"
+
+const (
+	gifExtension       = 0x21
+	gifImageDescriptor = 0x2C
+	gifColorTableFlag  = 0x80
+)
+
+// gifFramePixels sums the pixels (width * height) of every frame of a GIF by walking its blocks, without decoding
+// them. Walking stops at the first malformed or truncated block, since the decoder can't get frames past it either
+func gifFramePixels(data []byte) int {
+	// header (6 bytes) and logical screen descriptor (7 bytes)
+	if len(data) < 13 {
+		return 0
+	}
+	i := 13 + colorTableSize(data[10])
+	var pixels int
+	for i < len(data) {
+		switch data[i] {
+		case gifExtension:
+			// introducer and label, then data sub-blocks
+			i = skipSubBlocks(data, i+2)
+		case gifImageDescriptor:
+			if i+10 > len(data) {
+				return pixels
+			}
+			width := int(binary.LittleEndian.Uint16(data[i+5:]))
+			height := int(binary.LittleEndian.Uint16(data[i+7:]))
+			pixels += width * height
+			// descriptor, local color table and LZW minimum code size, then data sub-blocks
+			i = skipSubBlocks(data, i+10+colorTableSize(data[i+9])+1)
+		default:
+			// the trailer, or a malformed block
+			return pixels
+		}
+	}
+	return pixels
+}
+
+// colorTableSize is the size of the color table that follows a descriptor with the packed field
+func colorTableSize(packed byte) int {
+	if packed&gifColorTableFlag == 0 {
+		return 0
+	}
+	return 3 << (packed&0x07 + 1)
+}
+
+// skipSubBlocks returns the index after the sub-blocks starting at i. Each is a length byte and that many bytes, until
+// a 0 length
+func skipSubBlocks(data []byte, i int) int {
+	for i < len(data) {
+		length := int(data[i])
+		i++
+		if length == 0 {
+			return i
+		}
+		i += length
+	}
+	return i
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+// gifFrameSize is the size of each frame testGIF writes: a graphic control extension (8 bytes), an image descriptor
+// (10 bytes) and the image data (5 bytes)
+const gifFrameSize = 23
+
+// gifHeaderSize is the header, logical screen descriptor and 2 color global table testGIF writes
+const gifHeaderSize = 13 + 6
+
+// testGIF writes a GIF with a frame of each size by hand, so the offsets of its blocks are known
+func testGIF(sizes ...[2]int) []byte {
+	data := []byte("GIF89a")
+	data = append(data, 1, 0, 1, 0, gifColorTableFlag, 0, 0)
+	data = append(data, 0, 0, 0, 255, 255, 255)
+	for _, size := range sizes {
+		width, height := size[0], size[1]
+		data = append(data, gifExtension, 0xF9, 4, 0, 0, 0, 0, 0)
+		data = append(data, gifImageDescriptor, 0, 0, 0, 0, byte(width), byte(width>>8), byte(height), byte(height>>8), 0)
+		// the LZW minimum code size, a sub-block and the terminator
+		data = append(data, 2, 2, 0x4C, 0x01, 0)
+	}
+	return append(data, 0x3B)
+}
+
+// encodedGIF encodes frames of the size with the gif package. Each frame has its own palette, so they're written with
+// local color tables
+func encodedGIF(t *testing.T, width, height, frames int) []byte {
+	animation := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		palette := color.Palette{color.Black, color.RGBA{R: uint8(i * 40), A: 255}}
+		animation.Image = append(animation.Image, image.NewPaletted(image.Rect(0, 0, width, height), palette))
+		animation.Delay = append(animation.Delay, 10)
+	}
+	var encoded bytes.Buffer
+	if err := gif.EncodeAll(&encoded, animation); err != nil {
+		t.Fatal(err)
+	}
+	return encoded.Bytes()
+}
+
+func TestGIFFramePixels(t *testing.T) {
+	threeFrames := testGIF([2]int{10, 20}, [2]int{30, 40}, [2]int{5, 5})
+	malformed := append([]byte{}, threeFrames...)
+	malformed[gifHeaderSize+gifFrameSize] = 0
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{name: "one frame", data: testGIF([2]int{10, 20}), want: 200},
+		{name: "every frame counts", data: threeFrames, want: 200 + 1200 + 25},
+		{name: "the largest frames", data: testGIF([2]int{65535, 65535}, [2]int{65535, 65535}), want: 2 * 65535 * 65535},
+		{name: "local color tables", data: encodedGIF(t, 64, 32, 4), want: 4 * 64 * 32},
+		{name: "shorter than the header", data: threeFrames[:12], want: 0},
+		{name: "no frames", data: testGIF(), want: 0},
+		{
+			name: "truncated in a descriptor",
+			data: threeFrames[:gifHeaderSize+gifFrameSize+8+5],
+			want: 200,
+		},
+		{
+			name: "truncated in the data of a frame",
+			data: threeFrames[:gifHeaderSize+gifFrameSize+8+10+2],
+			want: 200 + 1200,
+		},
+		{name: "a malformed block", data: malformed, want: 200},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := gifFramePixels(test.data); got != test.want {
+				t.Errorf("gifFramePixels() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
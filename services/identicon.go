@@ -0,0 +1,118 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+)
+
+const identiconCells = 5
+
+var identiconBackground = color.RGBA{R: 0xf0, G: 0xf0, B: 0xf0, A: 0xff}
+
+// identicon is a horizontally symmetric 5x5 grid of cells in a single color, both derived from a hash of the seed, so
+// the same seed always draws the same avatar
+type identicon struct {
+	cells [identiconCells][identiconCells]bool
+	color color.RGBA
+}
+
+func newIdenticon(seed string) *identicon {
+	hash := sha256.Sum256([]byte(seed))
+	icon := &identicon{
+		color: hslToRGB(float64(int(hash[0])<<8|int(hash[1]))/65536, 0.55, 0.5),
+	}
+	// only the left half (and the middle column) is random. the right half mirrors it
+	bit := 0
+	for x := 0; x < (identiconCells+1)/2; x++ {
+		for y := 0; y < identiconCells; y++ {
+			on := hash[2+bit/8]&(1<<(bit%8)) != 0
+			icon.cells[y][x] = on
+			icon.cells[y][identiconCells-1-x] = on
+			bit++
+		}
+	}
+	return icon
+}
+
+// IdenticonSVG draws the avatar for seed as a size x size SVG
+func IdenticonSVG(seed string, size int) []byte {
+	icon := newIdenticon(seed)
+	var svg bytes.Buffer
+	// a cell is 2 units wide with a margin of 1 unit around the grid
+	viewBox := identiconCells*2 + 2
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%v" height="%v" viewBox="0 0 %v %v" shape-rendering="crispEdges">`,
+		size, size, viewBox, viewBox)
+	fmt.Fprintf(&svg, `<rect width="%v" height="%v" fill="%v"/>`, viewBox, viewBox, hexColor(identiconBackground))
+	fmt.Fprintf(&svg, `<g fill="%v">`, hexColor(icon.color))
+	for y, row := range icon.cells {
+		for x, on := range row {
+			if on {
+				fmt.Fprintf(&svg, `<rect x="%v" y="%v" width="2" height="2"/>`, 1+x*2, 1+y*2)
+			}
+		}
+	}
+	svg.WriteString(`</g></svg>`)
+	return svg.Bytes()
+}
+
+// IdenticonPNG draws the avatar for seed as a size x size PNG
+func IdenticonPNG(seed string, size int) ([]byte, error) {
+	icon := newIdenticon(seed)
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	units := identiconCells*2 + 2
+	for py := 0; py < size; py++ {
+		for px := 0; px < size; px++ {
+			// which cell, if any, the pixel falls in
+			x, y := (px*units/size-1)/2, (py*units/size-1)/2
+			inGrid := px*units/size >= 1 && py*units/size >= 1 && x < identiconCells && y < identiconCells
+			if inGrid && icon.cells[y][x] {
+				img.SetRGBA(px, py, icon.color)
+			} else {
+				img.SetRGBA(px, py, identiconBackground)
+			}
+		}
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		return nil, err
+	}
+	return encoded.Bytes(), nil
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// hslToRGB converts a hue, saturation and lightness (each between 0 and 1)
+func hslToRGB(h, s, l float64) color.RGBA {
+	chroma := (1 - math.Abs(2*l-1)) * s
+	hPrime := h * 6
+	x := chroma * (1 - math.Abs(math.Mod(hPrime, 2)-1))
+	var r, g, b float64
+	switch int(hPrime) {
+	case 0:
+		r, g, b = chroma, x, 0
+	case 1:
+		r, g, b = x, chroma, 0
+	case 2:
+		r, g, b = 0, chroma, x
+	case 3:
+		r, g, b = 0, x, chroma
+	case 4:
+		r, g, b = x, 0, chroma
+	default:
+		r, g, b = chroma, 0, x
+	}
+	m := l - chroma/2
+	return color.RGBA{
+		R: uint8(math.Round((r + m) * 255)),
+		G: uint8(math.Round((g + m) * 255)),
+		B: uint8(math.Round((b + m) * 255)),
+		A: 0xff,
+	}
+}
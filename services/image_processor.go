@@ -0,0 +1,244 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/config"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// ErrInvalidImage is returned (possibly wrapped) by ImageProcessor.Process when the blob isn't a supported image
+var ErrInvalidImage = errors.New("invalid image")
+
+// ImageProcessor sanitizes uploaded images. Re-encoding from the decoded pixels drops every kind of metadata (EXIF,
+// GPS, comments), which is the point. The EXIF orientation is applied to the pixels first so photos stay upright.
+// Blobs are only processed once; their uploads are marked so attaching them again doesn't re-compress them
+type ImageProcessor struct {
+	store   BlobStore
+	uploads db.UploadDatabase
+	cfg     *config.ImageConfig
+}
+
+func NewImageProcessor(store BlobStore, uploads db.UploadDatabase, cfg *config.ImageConfig) *ImageProcessor {
+	return &ImageProcessor{store: store, uploads: uploads, cfg: cfg}
+}
+
+// Process replaces the blob with a re-encoded copy and writes a thumbnail next to it for every configured size smaller
+// than the image. A blob that was already processed is only described
+func (ip *ImageProcessor) Process(ctx context.Context, blobName string) (*model.Image, error) {
+	uploads, err := ip.uploads.GetCompletedUploads(ctx, []string{blobName})
+	if err != nil {
+		return nil, err
+	}
+	for _, upload := range uploads {
+		if upload.IsProcessed() {
+			return ip.describe(ctx, blobName)
+		}
+	}
+
+	original, err := ip.read(ctx, blobName)
+	if err != nil {
+		return nil, err
+	}
+	imageConfig, format, err := image.DecodeConfig(bytes.NewReader(original))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	// checked before decoding so a tiny file claiming huge dimensions can't exhaust memory
+	if imageConfig.Width <= 0 || imageConfig.Height <= 0 || imageConfig.Width*imageConfig.Height > ip.cfg.MaxPixels {
+		return nil, fmt.Errorf("%w: %vx%v is too large", ErrInvalidImage, imageConfig.Width, imageConfig.Height)
+	}
+
+	var img image.Image
+	var encoded bytes.Buffer
+	var contentType string
+	switch format {
+	case "jpeg":
+		if img, err = jpeg.Decode(bytes.NewReader(original)); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+		img = applyOrientation(img, jpegOrientation(original))
+		contentType = "image/jpeg"
+		err = jpeg.Encode(&encoded, img, &jpeg.Options{Quality: ip.cfg.JPEGQuality})
+	case "png":
+		if img, err = png.Decode(bytes.NewReader(original)); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+		contentType = "image/png"
+		err = png.Encode(&encoded, img)
+	case "gif":
+		// every frame is kept so animations survive. only the first is used for thumbnails. each frame is decoded into
+		// its own image, so the pixels of all of them count towards the limit
+		if pixels := gifFramePixels(original); pixels > ip.cfg.MaxPixels {
+			return nil, fmt.Errorf("%w: the frames have %v pixels", ErrInvalidImage, pixels)
+		}
+		var animation *gif.GIF
+		if animation, err = gif.DecodeAll(bytes.NewReader(original)); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+		img = animation.Image[0]
+		contentType = "image/gif"
+		err = gif.EncodeAll(&encoded, animation)
+	default:
+		return nil, fmt.Errorf("%w: unsupported format %v", ErrInvalidImage, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := ip.store.Put(ctx, blobName, &encoded, contentType); err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	processed := &model.Image{
+		BlobName:   blobName,
+		Width:      bounds.Dx(),
+		Height:     bounds.Dy(),
+		Thumbnails: []*model.Thumbnail{},
+	}
+	for _, size := range ip.cfg.ThumbnailSizes {
+		if size >= bounds.Dx() && size >= bounds.Dy() {
+			continue
+		}
+		thumbnail, err := ip.writeThumbnail(ctx, blobName, img, size, format == "jpeg")
+		if err != nil {
+			return nil, err
+		}
+		processed.Thumbnails = append(processed.Thumbnails, thumbnail)
+	}
+	if err := ip.uploads.SetUploadProcessed(ctx, blobName); err != nil {
+		return nil, err
+	}
+	return processed, nil
+}
+
+// describe returns the dimensions and thumbnails of a processed blob without decoding its pixels
+func (ip *ImageProcessor) describe(ctx context.Context, blobName string) (*model.Image, error) {
+	processed, err := ip.read(ctx, blobName)
+	if err != nil {
+		return nil, err
+	}
+	imageConfig, _, err := image.DecodeConfig(bytes.NewReader(processed))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	described := &model.Image{
+		BlobName:   blobName,
+		Width:      imageConfig.Width,
+		Height:     imageConfig.Height,
+		Thumbnails: []*model.Thumbnail{},
+	}
+	for _, size := range ip.cfg.ThumbnailSizes {
+		if size >= imageConfig.Width && size >= imageConfig.Height {
+			continue
+		}
+		// the sizes may have changed since the blob was processed
+		thumbnailBlobName := model.ThumbnailBlobName(blobName, size)
+		if exists, err := ip.store.Exists(ctx, thumbnailBlobName); err != nil {
+			return nil, err
+		} else if !exists {
+			continue
+		}
+		width, height := fitWithin(imageConfig.Width, imageConfig.Height, size)
+		described.Thumbnails = append(described.Thumbnails, &model.Thumbnail{
+			BlobName: thumbnailBlobName,
+			Width:    width,
+			Height:   height,
+		})
+	}
+	return described, nil
+}
+
+func (ip *ImageProcessor) read(ctx context.Context, blobName string) ([]byte, error) {
+	reader, err := ip.store.Get(ctx, blobName)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// writeThumbnail scales img to fit in a size x size box. Photos are stored as JPEG, everything else as PNG to keep
+// transparency
+func (ip *ImageProcessor) writeThumbnail(ctx context.Context, blobName string, img image.Image, size int, isPhoto bool) (*model.Thumbnail, error) {
+	width, height := fitWithin(img.Bounds().Dx(), img.Bounds().Dy(), size)
+	scaled := downscale(img, width, height)
+
+	var encoded bytes.Buffer
+	contentType := "image/png"
+	var err error
+	if isPhoto {
+		contentType = "image/jpeg"
+		err = jpeg.Encode(&encoded, scaled, &jpeg.Options{Quality: ip.cfg.JPEGQuality})
+	} else {
+		err = png.Encode(&encoded, scaled)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	thumbnail := &model.Thumbnail{
+		BlobName: model.ThumbnailBlobName(blobName, size),
+		Width:    width,
+		Height:   height,
+	}
+	if err := ip.store.Put(ctx, thumbnail.BlobName, &encoded, contentType); err != nil {
+		return nil, err
+	}
+	return thumbnail, nil
+}
+
+func fitWithin(width, height, size int) (int, int) {
+	if width >= height {
+		return size, maxInt(1, height*size/width)
+	}
+	return maxInt(1, width*size/height), size
+}
+
+// downscale resizes with a box filter: each destination pixel is the average of the source pixels it covers
+func downscale(img image.Image, width, height int) *image.RGBA {
+	src := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*srcHeight/height, maxInt((y+1)*srcHeight/height, y*srcHeight/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*srcWidth/width, maxInt((x+1)*srcWidth/width, x*srcWidth/width+1)
+			var r, g, b, a, count int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					r += int(row[sx*4])
+					g += int(row[sx*4+1])
+					b += int(row[sx*4+2])
+					a += int(row[sx*4+3])
+					count++
+				}
+			}
+			offset := y*dst.Stride + x*4
+			dst.Pix[offset] = uint8(r / count)
+			dst.Pix[offset+1] = uint8(g / count)
+			dst.Pix[offset+2] = uint8(b / count)
+			dst.Pix[offset+3] = uint8(a / count)
+		}
+	}
+	return dst
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
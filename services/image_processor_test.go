@@ -0,0 +1,97 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/navbryce/next-dorm-be/config"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"image"
+	"image/png"
+	"testing"
+)
+
+type fakeUploadDatabase struct {
+	db.UploadDatabase
+	processed []string
+}
+
+func (fdb *fakeUploadDatabase) GetCompletedUploads(ctx context.Context, blobNames []string) ([]*model.Upload, error) {
+	return nil, nil
+}
+
+func (fdb *fakeUploadDatabase) SetUploadProcessed(ctx context.Context, blobName string) error {
+	fdb.processed = append(fdb.processed, blobName)
+	return nil
+}
+
+func encodedPNG(t *testing.T, width, height int) []byte {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return encoded.Bytes()
+}
+
+func TestImageProcessorBounds(t *testing.T) {
+	animation := encodedGIF(t, 40, 40, 3)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		maxPixels int
+		// wantWidth is 0 when the image should be refused
+		wantWidth      int
+		wantThumbnails int
+	}{
+		{name: "an image within the bound", data: encodedPNG(t, 200, 100), maxPixels: 200 * 100, wantWidth: 200, wantThumbnails: 1},
+		{name: "an image over the bound", data: encodedPNG(t, 200, 100), maxPixels: 200*100 - 1},
+		{name: "a gif within the bound", data: animation, maxPixels: 3 * 40 * 40, wantWidth: 40, wantThumbnails: 1},
+		// every frame is within the bound, and so is the screen DecodeConfig reports
+		{name: "a gif whose frames exceed the bound", data: animation, maxPixels: 3*40*40 - 1},
+		{name: "a truncated gif", data: animation[:len(animation)/2], maxPixels: 3 * 40 * 40},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, err := NewFSBlobStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+			const blobName = "uploads/u1/image"
+			if err := store.Put(ctx, blobName, bytes.NewReader(test.data), ""); err != nil {
+				t.Fatal(err)
+			}
+			uploads := &fakeUploadDatabase{}
+			processor := NewImageProcessor(store, uploads, &config.ImageConfig{
+				ThumbnailSizes: []int{30, 400},
+				MaxPixels:      test.maxPixels,
+				JPEGQuality:    85,
+			})
+
+			processed, err := processor.Process(ctx, blobName)
+			if test.wantWidth == 0 {
+				if !errors.Is(err, ErrInvalidImage) {
+					t.Errorf("Process() = %v, want ErrInvalidImage", err)
+				}
+				if len(uploads.processed) != 0 {
+					t.Error("a refused image was marked processed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Process() = %v", err)
+			}
+			if processed.Width != test.wantWidth {
+				t.Errorf("Process() width = %v, want %v", processed.Width, test.wantWidth)
+			}
+			if len(processed.Thumbnails) != test.wantThumbnails {
+				t.Errorf("Process() made %v thumbnails, want %v", len(processed.Thumbnails), test.wantThumbnails)
+			}
+			if len(uploads.processed) != 1 {
+				t.Errorf("the image was marked processed %v times, want once", len(uploads.processed))
+			}
+		})
+	}
+}
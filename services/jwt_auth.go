@@ -0,0 +1,351 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/config"
+	"github.com/navbryce/next-dorm-be/model"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// clockSkew is how far exp/nbf/iat may be off before a token is rejected
+	clockSkew = time.Minute
+	// minJWKSRefetch stops tokens with unknown key ids from hammering the JWKS endpoint
+	minJWKSRefetch = 30 * time.Second
+)
+
+// JWTAuthenticator verifies RS256 and ES256 signed JWTs against a JSON Web Key Set read from a file or URL
+type JWTAuthenticator struct {
+	cfg  *config.JWTConfig
+	keys *keySet
+	now  func() time.Time
+}
+
+var _ Authenticator = (*JWTAuthenticator)(nil)
+
+// NewJWTAuthenticator loads the key set immediately so a bad JWKS fails at startup
+func NewJWTAuthenticator(ctx context.Context, cfg *config.JWTConfig) (*JWTAuthenticator, error) {
+	var load func(ctx context.Context) ([]byte, error)
+	if cfg.JWKSFile != "" {
+		load = func(_ context.Context) ([]byte, error) {
+			return os.ReadFile(cfg.JWKSFile)
+		}
+	} else {
+		client := &http.Client{Timeout: 10 * time.Second}
+		load = func(ctx context.Context) ([]byte, error) {
+			return fetchJWKS(ctx, client, cfg.JWKSURL)
+		}
+	}
+	keys := &keySet{load: load, refresh: cfg.JWKSRefresh}
+	if err := keys.reload(ctx); err != nil {
+		return nil, fmt.Errorf("loading JWKS: %w", err)
+	}
+	return &JWTAuthenticator{cfg: cfg, keys: keys, now: time.Now}, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+func (ja *JWTAuthenticator) Authenticate(ctx context.Context, token string) (*model.Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: expected 3 segments", ErrInvalidToken)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	key, err := ja.keys.get(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	if err := ja.validateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	uid, _ := claims[ja.cfg.UIDClaim].(string)
+	if uid == "" {
+		return nil, fmt.Errorf("%w: missing %v claim", ErrInvalidToken, ja.cfg.UIDClaim)
+	}
+	identity := &model.Identity{
+		UID:    uid,
+		Claims: claims,
+	}
+	if email, ok := claims["email"].(string); ok {
+		identity.Email = email
+	}
+	return identity, nil
+}
+
+func (ja *JWTAuthenticator) validateClaims(claims map[string]interface{}) error {
+	now := ja.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("%w: missing exp claim", ErrInvalidToken)
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(clockSkew).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+	if iat, ok := claims["iat"].(float64); ok && now.Add(clockSkew).Before(time.Unix(int64(iat), 0)) {
+		return fmt.Errorf("%w: issued in the future", ErrInvalidToken)
+	}
+	if ja.cfg.Issuer != "" && claims["iss"] != ja.cfg.Issuer {
+		return fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	}
+	if ja.cfg.Audience != "" && !hasAudience(claims["aud"], ja.cfg.Audience) {
+		return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+	return nil
+}
+
+// hasAudience handles aud being either a single string or a list of them
+func hasAudience(aud interface{}, expected string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == expected
+	case []interface{}:
+		for _, candidate := range aud {
+			if candidate == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signingInput string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: RS256 token signed with a non-RSA key", ErrInvalidToken)
+		}
+		if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || ecKey.Curve != elliptic.P256() {
+			return fmt.Errorf("%w: ES256 token signed with a non P-256 key", ErrInvalidToken)
+		}
+		// JWS encodes ECDSA signatures as the fixed width concatenation r || s
+		if len(signature) != 64 {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported alg %q", ErrInvalidToken, alg)
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(decoded, v)
+}
+
+// keySet caches the parsed JWKS by key id. It's reloaded when older than refresh or when a token names a key that
+// isn't in it (key rotation)
+type keySet struct {
+	load    func(ctx context.Context) ([]byte, error)
+	refresh time.Duration
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func (ks *keySet) get(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	ks.mu.RLock()
+	key, found := ks.lookup(kid)
+	stale := ks.refresh > 0 && time.Since(ks.fetchedAt) > ks.refresh
+	canRefetch := time.Since(ks.fetchedAt) > minJWKSRefetch
+	ks.mu.RUnlock()
+
+	if (stale || !found) && canRefetch {
+		if err := ks.reload(ctx); err != nil && !found {
+			return nil, fmt.Errorf("refreshing JWKS: %w", err)
+		}
+		ks.mu.RLock()
+		key, found = ks.lookup(kid)
+		ks.mu.RUnlock()
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: unknown key id %q", ErrInvalidToken, kid)
+	}
+	return key, nil
+}
+
+// lookup must hold the read lock. A token without a kid is accepted when the set only has one key
+func (ks *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+func (ks *keySet) reload(ctx context.Context) error {
+	raw, err := ks.load(ctx)
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(raw)
+	if err != nil {
+		return err
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = keys
+	ks.fetchedAt = time.Now()
+	return nil
+}
+
+func fetchJWKS(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %v returned %v", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS keeps the RSA and P-256 signing keys. Other keys are skipped rather than rejected so a provider adding
+// new key types doesn't lock everyone out
+func parseJWKS(raw []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []*jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		var key crypto.PublicKey
+		var err error
+		switch jwk.Kty {
+		case "RSA":
+			key, err = jwk.rsaKey()
+		case "EC":
+			if jwk.Crv != "P-256" {
+				continue
+			}
+			key, err = jwk.ecKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no usable RSA or P-256 signing keys")
+	}
+	return keys, nil
+}
+
+func (jwk *jsonWebKey) rsaKey() (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(jwk.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := decodeBigInt(jwk.E)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("unsupported RSA exponent")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (jwk *jsonWebKey) ecKey() (*ecdsa.PublicKey, error) {
+	x, err := decodeBigInt(jwk.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeBigInt(jwk.Y)
+	if err != nil {
+		return nil, err
+	}
+	curve := elliptic.P256()
+	if !curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("point is not on P-256")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	return new(big.Int).SetBytes(decoded), nil
+}
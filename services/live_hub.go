@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/config"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"log"
+	"time"
+)
+
+const (
+	// memoryLiveHubBuffer is how many events the memory hub holds for a slow listener before dropping them
+	memoryLiveHubBuffer = 256
+	// liveEventBatch is how many events the db hub reads per query
+	liveEventBatch = 100
+)
+
+// LiveHub carries live events from the write paths to the streams
+type LiveHub interface {
+	Publish(ctx context.Context, event *model.LiveEvent) error
+	// Listen passes every event published through the hub, by any instance, to deliver until ctx is done. Events are
+	// best effort: streams are hints to refetch, so a dropped event isn't retried
+	Listen(ctx context.Context, deliver func(*model.LiveEvent))
+}
+
+// NewLiveHub returns the LiveHub named by cfg.Hub. liveEvents is only used by the db hub
+func NewLiveHub(cfg *config.LiveConfig, liveEvents db.LiveEventDatabase) (LiveHub, error) {
+	switch cfg.Hub {
+	case config.LiveHubMemory:
+		return NewMemoryLiveHub(), nil
+	case config.LiveHubDB:
+		return NewDBLiveHub(liveEvents, cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown live hub %v", cfg.Hub)
+	}
+}
+
+// MemoryLiveHub passes events between the goroutines of a single instance
+type MemoryLiveHub struct {
+	events chan *model.LiveEvent
+}
+
+func NewMemoryLiveHub() *MemoryLiveHub {
+	return &MemoryLiveHub{events: make(chan *model.LiveEvent, memoryLiveHubBuffer)}
+}
+
+func (mh *MemoryLiveHub) Publish(ctx context.Context, event *model.LiveEvent) error {
+	select {
+	case mh.events <- event:
+		return nil
+	default:
+		return fmt.Errorf("live hub is full")
+	}
+}
+
+func (mh *MemoryLiveHub) Listen(ctx context.Context, deliver func(*model.LiveEvent)) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-mh.events:
+				deliverLiveEvent(deliver, event)
+			}
+		}
+	}()
+}
+
+// DBLiveHub passes events between instances through the database. Every instance polls for the events after the last
+// one it read, and drops the events older than the retention
+type DBLiveHub struct {
+	db  db.LiveEventDatabase
+	cfg *config.LiveConfig
+}
+
+func NewDBLiveHub(liveEvents db.LiveEventDatabase, cfg *config.LiveConfig) *DBLiveHub {
+	return &DBLiveHub{db: liveEvents, cfg: cfg}
+}
+
+func (dh *DBLiveHub) Publish(ctx context.Context, event *model.LiveEvent) error {
+	_, err := dh.db.CreateLiveEvent(ctx, event)
+	return err
+}
+
+func (dh *DBLiveHub) Listen(ctx context.Context, deliver func(*model.LiveEvent)) {
+	go func() {
+		// events from before the instance started are stale
+		lastId, err := dh.db.GetLastLiveEventId(ctx)
+		if err != nil {
+			log.Println("an error occurred while reading the last live event", err)
+		}
+		poll := time.NewTicker(dh.cfg.PollInterval)
+		defer poll.Stop()
+		prune := time.NewTicker(dh.cfg.Retention)
+		defer prune.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-poll.C:
+				lastId = dh.poll(ctx, lastId, deliver)
+			case <-prune.C:
+				if err := dh.db.DeleteLiveEvents(ctx, time.Now().Add(-dh.cfg.Retention)); err != nil {
+					log.Println("an error occurred while pruning live events", err)
+				}
+			}
+		}
+	}()
+}
+
+// poll delivers the events after lastId and returns the id of the last one. MySQL can commit a lower id after a
+// higher one was read, in which case the lower one is missed
+func (dh *DBLiveHub) poll(ctx context.Context, lastId int64, deliver func(*model.LiveEvent)) int64 {
+	for {
+		events, err := dh.db.GetLiveEvents(ctx, lastId, liveEventBatch)
+		if err != nil {
+			log.Println("an error occurred while reading live events", err)
+			return lastId
+		}
+		for _, event := range events {
+			deliverLiveEvent(deliver, event)
+			lastId = event.Id
+		}
+		if len(events) < liveEventBatch {
+			return lastId
+		}
+	}
+}
+
+// deliverLiveEvent keeps a panic while delivering one event from stopping the hub
+func deliverLiveEvent(deliver func(*model.LiveEvent), event *model.LiveEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("recovered while delivering live event", event.Type, event.PostId, r)
+		}
+	}()
+	deliver(event)
+}
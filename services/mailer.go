@@ -0,0 +1,116 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/config"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Email is a message to a single recipient, in plain text and HTML
+type Email struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	// Headers are added to the message, such as List-Unsubscribe
+	Headers map[string]string
+}
+
+// Mailer sends emails
+type Mailer interface {
+	Send(ctx context.Context, email *Email) error
+}
+
+// NewMailer returns the Mailer named by cfg.Mailer
+func NewMailer(cfg *config.MailConfig) (Mailer, error) {
+	switch cfg.Mailer {
+	case config.MailerSMTP:
+		return NewSMTPMailer(cfg), nil
+	case config.MailerFile:
+		return NewFileMailer(cfg.From, cfg.Path)
+	case config.MailerStdout:
+		return NewWriterMailer(cfg.From, os.Stdout), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer %v", cfg.Mailer)
+	}
+}
+
+// buildMessage encodes the email as a multipart/alternative message, the text part first so clients prefer the HTML
+func buildMessage(from string, email *Email) ([]byte, error) {
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender: %w", err)
+	}
+	recipient, err := mail.ParseAddress(email.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	messageId := make([]byte, 16)
+	if _, err := rand.Read(messageId); err != nil {
+		return nil, err
+	}
+	domain := sender.Address[strings.LastIndex(sender.Address, "@")+1:]
+
+	var msg bytes.Buffer
+	body := multipart.NewWriter(&msg)
+	headers := map[string]string{
+		"From":         sender.String(),
+		"To":           recipient.String(),
+		"Subject":      mime.QEncoding.Encode("utf-8", email.Subject),
+		"Date":         time.Now().Format(time.RFC1123Z),
+		"Message-ID":   fmt.Sprintf("<%v@%v>", hex.EncodeToString(messageId), domain),
+		"MIME-Version": "1.0",
+		"Content-Type": fmt.Sprintf("multipart/alternative; boundary=%q", body.Boundary()),
+	}
+	for name, value := range email.Headers {
+		headers[textproto.CanonicalMIMEHeaderKey(name)] = value
+	}
+	names := make([]string, 0, len(headers))
+	for name, value := range headers {
+		if strings.ContainsAny(name+value, "\r\n") {
+			return nil, fmt.Errorf("header %v contains a line break", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&msg, "%v: %v\r\n", name, headers[name])
+	}
+	msg.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", email.Text},
+		{"text/html; charset=utf-8", email.HTML},
+	} {
+		writer, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := quotedprintable.NewWriter(writer)
+		if _, err := encoder.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
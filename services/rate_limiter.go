@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/config"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// rateLimitPruneInterval is how often idle buckets are dropped
+const rateLimitPruneInterval = 10 * time.Minute
+
+// RateLimitStore holds token buckets by key
+type RateLimitStore interface {
+	// Take takes a token from each of the buckets if they all have one, checking and taking them together. Otherwise
+	// nothing is taken and the time until they all have a token is returned
+	Take(ctx context.Context, buckets []RateLimitKey) (time.Duration, error)
+	// Prune drops the buckets not used since the time. They are full by then, so dropping them changes nothing
+	Prune(ctx context.Context, unusedSince time.Time) error
+}
+
+// RateLimitKey is the key of a bucket and the limit it refills at
+type RateLimitKey struct {
+	Key   string
+	Limit config.RateLimit
+}
+
+// NewRateLimitStore returns the RateLimitStore named by cfg.Store. rateLimits is only used by the db store
+func NewRateLimitStore(cfg *config.RateLimitConfig, rateLimits db.RateLimitDatabase) (RateLimitStore, error) {
+	switch cfg.Store {
+	case config.RateLimitStoreMemory:
+		return NewMemoryRateLimitStore(), nil
+	case config.RateLimitStoreDB:
+		return NewDBRateLimitStore(rateLimits), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %v", cfg.Store)
+	}
+}
+
+// MemoryRateLimitStore keeps the buckets of a single instance
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*model.RateLimitBucket
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*model.RateLimitBucket)}
+}
+
+func (ms *MemoryRateLimitStore) Take(ctx context.Context, buckets []RateLimitKey) (time.Duration, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	current := make([]*model.RateLimitBucket, len(buckets))
+	for i, bucket := range buckets {
+		current[i] = ms.buckets[bucket.Key]
+	}
+	updated, wait := takeTokens(current, buckets, time.Now())
+	for i, bucket := range buckets {
+		ms.buckets[bucket.Key] = updated[i]
+	}
+	return wait, nil
+}
+
+func (ms *MemoryRateLimitStore) Prune(ctx context.Context, unusedSince time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for key, bucket := range ms.buckets {
+		if bucket.UpdatedAt.Before(unusedSince) {
+			delete(ms.buckets, key)
+		}
+	}
+	return nil
+}
+
+// DBRateLimitStore keeps the buckets in the database so every instance shares them
+type DBRateLimitStore struct {
+	db db.RateLimitDatabase
+}
+
+func NewDBRateLimitStore(rateLimits db.RateLimitDatabase) *DBRateLimitStore {
+	return &DBRateLimitStore{db: rateLimits}
+}
+
+func (ds *DBRateLimitStore) Take(ctx context.Context, buckets []RateLimitKey) (time.Duration, error) {
+	keys := make([]string, len(buckets))
+	for i, bucket := range buckets {
+		keys[i] = bucket.Key
+	}
+	var wait time.Duration
+	err := ds.db.UpdateRateLimitBuckets(ctx, keys, func(current []*model.RateLimitBucket) []*model.RateLimitBucket {
+		var updated []*model.RateLimitBucket
+		updated, wait = takeTokens(current, buckets, time.Now())
+		return updated
+	})
+	return wait, err
+}
+
+func (ds *DBRateLimitStore) Prune(ctx context.Context, unusedSince time.Time) error {
+	return ds.db.DeleteRateLimitBuckets(ctx, unusedSince)
+}
+
+// takeTokens refills the buckets and takes a token from each if they all have one. Otherwise nothing is taken and it
+// returns how long until they all have one. A request refused by one bucket doesn't drain the others, or a user being
+// limited would drain the IP the rest of the dorm shares
+func takeTokens(buckets []*model.RateLimitBucket, keys []RateLimitKey, now time.Time) ([]*model.RateLimitBucket, time.Duration) {
+	updated := make([]*model.RateLimitBucket, len(buckets))
+	var wait time.Duration
+	for i, bucket := range buckets {
+		tokens := refill(bucket, keys[i].Limit, now)
+		updated[i] = &model.RateLimitBucket{Tokens: tokens, UpdatedAt: now}
+		if bucketWait := waitForToken(tokens, keys[i].Limit); bucketWait > wait {
+			wait = bucketWait
+		}
+	}
+	if wait > 0 {
+		return updated, wait
+	}
+	for _, bucket := range updated {
+		bucket.Tokens--
+	}
+	return updated, 0
+}
+
+// refill returns the tokens in the bucket at the time. A missing bucket is full
+func refill(bucket *model.RateLimitBucket, limit config.RateLimit, now time.Time) float64 {
+	capacity := float64(limit.Requests)
+	if bucket == nil {
+		return capacity
+	}
+	// the clocks of the instances sharing a store can disagree
+	elapsed := math.Max(now.Sub(bucket.UpdatedAt).Seconds(), 0)
+	return math.Min(capacity, bucket.Tokens+elapsed*capacity/limit.Per.Seconds())
+}
+
+// waitForToken is how long until a bucket with the tokens has a whole one
+func waitForToken(tokens float64, limit config.RateLimit) time.Duration {
+	if tokens >= 1 {
+		return 0
+	}
+	perSecond := float64(limit.Requests) / limit.Per.Seconds()
+	return time.Duration((1 - tokens) / perSecond * float64(time.Second))
+}
+
+// RateLimiter applies the limits of the route groups. Every group has a bucket per user and a bucket per IP
+type RateLimiter struct {
+	store  RateLimitStore
+	groups map[string]config.RateLimitGroup
+}
+
+func NewRateLimiter(store RateLimitStore, cfg *config.RateLimitConfig) *RateLimiter {
+	return &RateLimiter{store: store, groups: cfg.Groups}
+}
+
+// Take takes a token from the user's and the IP's buckets of the group. If either is empty, nothing is taken and it
+// returns how long until the request would be allowed. userId can be empty
+func (rl *RateLimiter) Take(ctx context.Context, group string, userId string, ip string) (time.Duration, error) {
+	limits, ok := rl.groups[group]
+	if !ok {
+		return 0, nil
+	}
+	var buckets []RateLimitKey
+	if limits.User.IsEnabled() && len(userId) > 0 {
+		buckets = append(buckets, RateLimitKey{Key: fmt.Sprintf("%v:user:%v", group, userId), Limit: limits.User})
+	}
+	if limits.IP.IsEnabled() {
+		buckets = append(buckets, RateLimitKey{Key: fmt.Sprintf("%v:ip:%v", group, ip), Limit: limits.IP})
+	}
+	if len(buckets) == 0 {
+		return 0, nil
+	}
+	return rl.store.Take(ctx, buckets)
+}
+
+// Start drops idle buckets every rateLimitPruneInterval until ctx is done
+func (rl *RateLimiter) Start(ctx context.Context) {
+	var longest time.Duration
+	for _, limits := range rl.groups {
+		for _, limit := range []config.RateLimit{limits.User, limits.IP} {
+			if limit.IsEnabled() && limit.Per > longest {
+				longest = limit.Per
+			}
+		}
+	}
+	ticker := time.NewTicker(rateLimitPruneInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				rl.prunePeriodically(ctx, longest)
+			}
+		}
+	}()
+}
+
+// prunePeriodically keeps a panic during one prune from stopping the ones after it
+func (rl *RateLimiter) prunePeriodically(ctx context.Context, longest time.Duration) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("recovered while pruning rate limit buckets", r)
+		}
+	}()
+	if err := rl.store.Prune(ctx, time.Now().Add(-longest)); err != nil {
+		log.Println("an error occurred while pruning rate limit buckets", err)
+	}
+}
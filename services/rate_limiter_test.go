@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"github.com/navbryce/next-dorm-be/config"
+	"github.com/navbryce/next-dorm-be/model"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTakeTokens(t *testing.T) {
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	// a token every 10 seconds
+	tenPerMinute := RateLimitKey{Key: "a", Limit: config.RateLimit{Requests: 6, Per: time.Minute}}
+	onePerMinute := RateLimitKey{Key: "b", Limit: config.RateLimit{Requests: 1, Per: time.Minute}}
+	bucket := func(tokens float64, age time.Duration) *model.RateLimitBucket {
+		return &model.RateLimitBucket{Tokens: tokens, UpdatedAt: now.Add(-age)}
+	}
+
+	tests := []struct {
+		name       string
+		buckets    []*model.RateLimitBucket
+		keys       []RateLimitKey
+		wantTokens []float64
+		wantWait   time.Duration
+	}{
+		{
+			name:       "a missing bucket is full",
+			buckets:    []*model.RateLimitBucket{nil},
+			keys:       []RateLimitKey{tenPerMinute},
+			wantTokens: []float64{5},
+		},
+		{
+			name:       "refills with time",
+			buckets:    []*model.RateLimitBucket{bucket(0, 25*time.Second)},
+			keys:       []RateLimitKey{tenPerMinute},
+			wantTokens: []float64{1.5},
+		},
+		{
+			name:       "refills up to the capacity",
+			buckets:    []*model.RateLimitBucket{bucket(2, time.Hour)},
+			keys:       []RateLimitKey{tenPerMinute},
+			wantTokens: []float64{5},
+		},
+		{
+			name:       "an empty bucket waits for the rest of a token",
+			buckets:    []*model.RateLimitBucket{bucket(0.25, 0)},
+			keys:       []RateLimitKey{tenPerMinute},
+			wantTokens: []float64{0.25},
+			wantWait:   7500 * time.Millisecond,
+		},
+		{
+			name:       "a bucket from the future isn't drained",
+			buckets:    []*model.RateLimitBucket{bucket(0.5, -time.Minute)},
+			keys:       []RateLimitKey{tenPerMinute},
+			wantTokens: []float64{0.5},
+			wantWait:   5 * time.Second,
+		},
+		{
+			name:       "takes from every bucket",
+			buckets:    []*model.RateLimitBucket{bucket(3, 0), nil},
+			keys:       []RateLimitKey{tenPerMinute, onePerMinute},
+			wantTokens: []float64{2, 0},
+		},
+		{
+			name:       "a refused request takes from none of the buckets",
+			buckets:    []*model.RateLimitBucket{bucket(3, 0), bucket(0, 30*time.Second)},
+			keys:       []RateLimitKey{tenPerMinute, onePerMinute},
+			wantTokens: []float64{3, 0.5},
+			wantWait:   30 * time.Second,
+		},
+		{
+			name:       "waits for the slowest bucket",
+			buckets:    []*model.RateLimitBucket{bucket(0, 0), bucket(0.5, 0)},
+			keys:       []RateLimitKey{tenPerMinute, onePerMinute},
+			wantTokens: []float64{0, 0.5},
+			wantWait:   30 * time.Second,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			updated, wait := takeTokens(test.buckets, test.keys, now)
+			if wait != test.wantWait {
+				t.Errorf("takeTokens() wait = %v, want %v", wait, test.wantWait)
+			}
+			for i, bucket := range updated {
+				if math.Abs(bucket.Tokens-test.wantTokens[i]) > 1e-9 {
+					t.Errorf("takeTokens() bucket %v has %v tokens, want %v", i, bucket.Tokens, test.wantTokens[i])
+				}
+				if !bucket.UpdatedAt.Equal(now) {
+					t.Errorf("takeTokens() bucket %v was updated at %v, want %v", i, bucket.UpdatedAt, now)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(NewMemoryRateLimitStore(), &config.RateLimitConfig{
+		Groups: map[string]config.RateLimitGroup{
+			"posts": {
+				User: config.RateLimit{Requests: 2, Per: time.Hour},
+				IP:   config.RateLimit{Requests: 3, Per: time.Hour},
+			},
+		},
+	})
+	ctx := context.Background()
+	take := func(userId string) bool {
+		wait, err := limiter.Take(ctx, "posts", userId, "10.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return wait == 0
+	}
+
+	for i, want := range []bool{true, true, false, false} {
+		if got := take("a"); got != want {
+			t.Errorf("request %v of a allowed = %v, want %v", i, got, want)
+		}
+	}
+	// a's refused requests left the IP with a token
+	if !take("b") {
+		t.Error("b was refused after a was limited")
+	}
+	if take("c") {
+		t.Error("c was allowed after the IP was used up")
+	}
+	if wait, err := limiter.Take(ctx, "comments", "a", "10.0.0.1"); err != nil || wait != 0 {
+		t.Errorf("Take() of a group without limits = %v, %v, want 0, nil", wait, err)
+	}
+}
+
+func TestRateLimiterConcurrent(t *testing.T) {
+	limiter := NewRateLimiter(NewMemoryRateLimitStore(), &config.RateLimitConfig{
+		Groups: map[string]config.RateLimitGroup{
+			"posts": {
+				User: config.RateLimit{Requests: 5, Per: time.Hour},
+				IP:   config.RateLimit{Requests: 5, Per: time.Hour},
+			},
+		},
+	})
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := limiter.Take(context.Background(), "posts", "a", "10.0.0.1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if wait == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 5 {
+		t.Errorf("%v concurrent requests were allowed, want 5", allowed)
+	}
+}
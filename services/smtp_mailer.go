@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/navbryce/next-dorm-be/config"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// smtpTimeout bounds a whole conversation with the server, so a stuck server doesn't hold up the caller
+const smtpTimeout = 30 * time.Second
+
+// SMTPMailer submits every email over its own connection to an SMTP server
+type SMTPMailer struct {
+	cfg *config.MailConfig
+}
+
+var _ Mailer = (*SMTPMailer)(nil)
+
+func NewSMTPMailer(cfg *config.MailConfig) *SMTPMailer {
+	return &SMTPMailer{cfg: cfg}
+}
+
+func (sm *SMTPMailer) Send(ctx context.Context, email *Email) error {
+	msg, err := buildMessage(sm.cfg.From, email)
+	if err != nil {
+		return err
+	}
+	sender, err := mail.ParseAddress(sm.cfg.From)
+	if err != nil {
+		return err
+	}
+	recipient, err := mail.ParseAddress(email.To)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+	host := sm.cfg.SMTP.Host
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(sm.cfg.SMTP.Port)))
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if sm.cfg.SMTP.User != "" {
+		// PlainAuth refuses to send the credentials unless the connection is encrypted or goes to localhost
+		if err := client.Auth(smtp.PlainAuth("", sm.cfg.SMTP.User, sm.cfg.SMTP.Pass, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(sender.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(recipient.Address); err != nil {
+		return err
+	}
+	data, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := data.Write(msg); err != nil {
+		return err
+	}
+	if err := data.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
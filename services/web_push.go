@@ -0,0 +1,414 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/config"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// pushRecordSize is the record size of the encrypted body (RFC 8188). A payload always fits in one record
+	pushRecordSize = 4096
+	// pushHeaderSize is the salt, record size, key id length and key id (the server's public key) the body starts with
+	pushHeaderSize = 16 + 4 + 1 + 65
+	// MaxPushPayload is the largest payload every push service accepts: a 4096 byte body holds the header, the payload,
+	// its padding delimiter and the AEAD tag (RFC 8291)
+	MaxPushPayload = 4096 - pushHeaderSize - 1 - 16
+	// MaxPushEndpointLength bounds the endpoints of subscriptions
+	MaxPushEndpointLength = 2048
+	// pushSenders is how many notifications are sent at once
+	pushSenders = 4
+	// pushQueueSize is how many notifications can wait to be sent. Notifications queued past it are dropped
+	pushQueueSize = 10000
+	// pushRetryDelay is the wait before the first retry. It doubles with every retry, up to maxPushRetryDelay
+	pushRetryDelay    = 30 * time.Second
+	maxPushRetryDelay = 10 * time.Minute
+	// vapidTokenTTL is how long the token the server identifies itself to a push service with is valid. At most 24h
+	vapidTokenTTL     = 12 * time.Hour
+	maxPushErrorBytes = 512
+)
+
+// NewVAPIDKeys returns a new P-256 key pair, base64url encoded: the private key (32 bytes) for
+// config.PushConfig.VAPIDPrivateKey and the public key (uncompressed point, 65 bytes) browsers subscribe with
+func NewVAPIDKeys() (privateKey string, publicKey string, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	d := make([]byte, 32)
+	key.D.FillBytes(d)
+	return base64.RawURLEncoding.EncodeToString(d),
+		base64.RawURLEncoding.EncodeToString(elliptic.Marshal(key.Curve, key.X, key.Y)), nil
+}
+
+// HashPushEndpoint returns what the subscription with the endpoint is stored and looked up by
+func HashPushEndpoint(endpoint string) string {
+	hash := sha256.Sum256([]byte(endpoint))
+	return hex.EncodeToString(hash[:])
+}
+
+type pushJob struct {
+	subscription *model.PushSubscription
+	payload      []byte
+	attempts     int
+}
+
+// WebPusher sends Web Push notifications. Payloads are encrypted for each device (RFC 8291) and the requests are signed
+// with the server's VAPID key (RFC 8292). Notifications are queued in memory and sent in the background: a push
+// service that is unavailable or rate limits the server gets the notification again later, and a subscription the push
+// service no longer knows (404 or 410) is deleted
+type WebPusher struct {
+	db       db.PushDatabase
+	cfg      *config.PushConfig
+	key      *ecdsa.PrivateKey
+	services []*url.URL
+	client   *http.Client
+	jobs     chan *pushJob
+	// retryDelay is the wait before the first retry
+	retryDelay time.Duration
+}
+
+func NewWebPusher(subscriptions db.PushDatabase, cfg *config.PushConfig) (*WebPusher, error) {
+	key, err := parseVAPIDKey(cfg.VAPIDPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	services := make([]*url.URL, len(cfg.Services))
+	for i, service := range cfg.Services {
+		if services[i], err = url.Parse(service); err != nil {
+			return nil, fmt.Errorf("parsing push service %v: %w", service, err)
+		}
+	}
+	return &WebPusher{
+		db:       subscriptions,
+		cfg:      cfg,
+		key:      key,
+		services: services,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// push services answer directly. a redirect could point anywhere
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		jobs:       make(chan *pushJob, pushQueueSize),
+		retryDelay: pushRetryDelay,
+	}, nil
+}
+
+// PublicKey is the applicationServerKey browsers subscribe with, base64url encoded
+func (wp *WebPusher) PublicKey() string {
+	return base64.RawURLEncoding.EncodeToString(elliptic.Marshal(wp.key.Curve, wp.key.X, wp.key.Y))
+}
+
+// CheckSubscription returns why notifications can't be sent to the subscription, if they can't: its endpoint isn't on
+// one of the configured push services, or its keys aren't usable
+func (wp *WebPusher) CheckSubscription(subscription *model.PushSubscription) error {
+	if len(subscription.Endpoint) > MaxPushEndpointLength || !wp.isPushService(subscription.Endpoint) {
+		return errors.New("the endpoint isn't on a supported push service")
+	}
+	if _, _, err := decodePushKeys(subscription); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Start sends the queued notifications until ctx is done
+func (wp *WebPusher) Start(ctx context.Context) {
+	for i := 0; i < pushSenders; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-wp.jobs:
+					wp.attempt(ctx, job)
+				}
+			}
+		}()
+	}
+}
+
+// Push queues the payload for every subscription. It doesn't wait for them to be sent
+func (wp *WebPusher) Push(subscriptions []*model.PushSubscription, payload []byte) {
+	if len(payload) > MaxPushPayload {
+		log.Printf("a push payload of %v bytes is over the limit of %v bytes\n", len(payload), MaxPushPayload)
+		return
+	}
+	for _, subscription := range subscriptions {
+		wp.queue(&pushJob{subscription: subscription, payload: payload})
+	}
+}
+
+func (wp *WebPusher) queue(job *pushJob) {
+	select {
+	case wp.jobs <- job:
+	default:
+		log.Println("the push queue is full. dropped a notification for push subscription", job.subscription.Id)
+	}
+}
+
+// attempt sends the notification once. It's queued again after a backoff if the push service may take it later
+func (wp *WebPusher) attempt(ctx context.Context, job *pushJob) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("recovered while sending a notification to push subscription", job.subscription.Id, r)
+		}
+	}()
+	status, retryAfter, err := wp.send(ctx, job.subscription, job.payload)
+	job.attempts++
+	switch {
+	case err == nil:
+	case status == http.StatusNotFound || status == http.StatusGone:
+		// the browser unsubscribed, or the subscription expired
+		if err := wp.db.DeletePushSubscriptionById(ctx, job.subscription.Id); err != nil {
+			log.Println("an error occurred while deleting expired push subscription", job.subscription.Id, err)
+		}
+	case (status == 0 || status == http.StatusTooManyRequests || status >= 500) && job.attempts < wp.cfg.MaxAttempts:
+		delay := wp.backoff(job.attempts)
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		time.AfterFunc(delay, func() {
+			wp.queue(job)
+		})
+	default:
+		log.Println("an error occurred while sending a notification to push subscription", job.subscription.Id, err)
+	}
+}
+
+// send encrypts the payload for the subscription and posts it to its push service. Returns the status of the response
+// (0 if there wasn't one) and how long the push service asked to wait before trying again. Any status other than 2xx
+// is an error
+func (wp *WebPusher) send(ctx context.Context, subscription *model.PushSubscription, payload []byte) (int, time.Duration, error) {
+	p256dh, authSecret, err := decodePushKeys(subscription)
+	if err != nil {
+		return 0, 0, err
+	}
+	body, err := encryptPushPayload(payload, p256dh, authSecret)
+	if err != nil {
+		return 0, 0, err
+	}
+	authorization, err := wp.vapidAuthorization(subscription.Endpoint)
+	if err != nil {
+		return 0, 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.FormatInt(int64(wp.cfg.TTL/time.Second), 10))
+	req.Header.Set("Urgency", "normal")
+
+	res, err := wp.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res.StatusCode, 0, nil
+	}
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		retryAfter = time.Duration(seconds) * time.Second
+		if retryAfter > maxPushRetryDelay {
+			retryAfter = maxPushRetryDelay
+		}
+	}
+	excerpt, _ := io.ReadAll(io.LimitReader(res.Body, maxPushErrorBytes))
+	return res.StatusCode, retryAfter, fmt.Errorf("the push service responded %v: %v", res.Status,
+		strings.TrimSpace(string(excerpt)))
+}
+
+// backoff is how long to wait after the attempt before the next one
+func (wp *WebPusher) backoff(attempts int) time.Duration {
+	backoff := wp.retryDelay
+	for i := 1; i < attempts && backoff < maxPushRetryDelay; i++ {
+		backoff *= 2
+	}
+	if backoff > maxPushRetryDelay {
+		return maxPushRetryDelay
+	}
+	return backoff
+}
+
+type vapidClaims struct {
+	Audience  string `json:"aud"`
+	ExpiresAt int64  `json:"exp"`
+	Subject   string `json:"sub"`
+}
+
+// vapidAuthorization returns the Authorization header of a request to the endpoint: an ES256 JWT for the origin of the
+// push service, and the public key it's signed with (RFC 8292)
+func (wp *WebPusher) vapidAuthorization(endpoint string) (string, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(&vapidClaims{
+		Audience:  parsed.Scheme + "://" + parsed.Host,
+		ExpiresAt: time.Now().Add(vapidTokenTTL).Unix(),
+		Subject:   wp.cfg.Subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, wp.key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	// JWS signatures are r and s as fixed size big-endian integers, not ASN.1
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return fmt.Sprintf("vapid t=%v.%v, k=%v", signingInput, base64.RawURLEncoding.EncodeToString(signature),
+		wp.PublicKey()), nil
+}
+
+func (wp *WebPusher) isPushService(endpoint string) bool {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.User != nil || parsed.Host == "" {
+		return false
+	}
+	host := strings.ToLower(parsed.Host)
+	for _, service := range wp.services {
+		if parsed.Scheme != service.Scheme || !strings.HasPrefix(parsed.Path, service.Path) {
+			continue
+		}
+		serviceHost := strings.ToLower(service.Host)
+		if strings.HasPrefix(serviceHost, "*.") {
+			if strings.HasSuffix(host, serviceHost[1:]) {
+				return true
+			}
+		} else if host == serviceHost {
+			return true
+		}
+	}
+	return false
+}
+
+// encryptPushPayload encrypts the payload for the device with the p256dh public key and auth secret, as a single
+// aes128gcm record (RFC 8291 and RFC 8188). Every payload gets a new key pair and salt
+func encryptPushPayload(payload []byte, p256dh []byte, authSecret []byte) ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return encryptPushRecord(payload, p256dh, authSecret, key, salt)
+}
+
+// encryptPushRecord is encryptPushPayload with the key pair of the server and the salt given
+func encryptPushRecord(payload []byte, p256dh []byte, authSecret []byte, key *ecdsa.PrivateKey, salt []byte) ([]byte, error) {
+	curve := elliptic.P256()
+	deviceX, deviceY := elliptic.Unmarshal(curve, p256dh)
+	if deviceX == nil {
+		return nil, errors.New("the p256dh key isn't a P-256 public key")
+	}
+	publicKey := elliptic.Marshal(curve, key.X, key.Y)
+	sharedX, _ := curve.ScalarMult(deviceX, deviceY, key.D.Bytes())
+	ecdhSecret := make([]byte, 32)
+	sharedX.FillBytes(ecdhSecret)
+
+	keyInfo := append(append([]byte("WebPush: info\x00"), p256dh...), publicKey...)
+	ikm := hkdfSHA256(authSecret, ecdhSecret, keyInfo, 32)
+	contentKey := hkdfSHA256(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdfSHA256(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	recordSize := make([]byte, 4)
+	binary.BigEndian.PutUint32(recordSize, pushRecordSize)
+	body := make([]byte, 0, pushHeaderSize+len(payload)+1+gcm.Overhead())
+	body = append(body, salt...)
+	body = append(body, recordSize...)
+	body = append(body, byte(len(publicKey)))
+	body = append(body, publicKey...)
+	// 0x02 marks the last (and only) record, without padding
+	plaintext := append(append(make([]byte, 0, len(payload)+1), payload...), 0x02)
+	return gcm.Seal(body, nonce, plaintext, nil), nil
+}
+
+// hkdfSHA256 is HKDF with SHA-256 (RFC 5869) for outputs of at most 32 bytes, which take a single expansion step
+func hkdfSHA256(salt []byte, ikm []byte, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(ikm)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write(info)
+	expand.Write([]byte{1})
+	return expand.Sum(nil)[:length]
+}
+
+// decodePushKeys decodes the p256dh public key and auth secret of the subscription
+func decodePushKeys(subscription *model.PushSubscription) ([]byte, []byte, error) {
+	p256dh, err := decodeBase64URL(subscription.P256dh)
+	if err != nil || len(p256dh) != 65 {
+		return nil, nil, errors.New("keys.p256dh must be an uncompressed P-256 public key encoded as base64url")
+	}
+	if x, _ := elliptic.Unmarshal(elliptic.P256(), p256dh); x == nil {
+		return nil, nil, errors.New("keys.p256dh isn't a point on P-256")
+	}
+	authSecret, err := decodeBase64URL(subscription.Auth)
+	if err != nil || len(authSecret) != 16 {
+		return nil, nil, errors.New("keys.auth must be 16 bytes encoded as base64url")
+	}
+	return p256dh, authSecret, nil
+}
+
+func parseVAPIDKey(encoded string) (*ecdsa.PrivateKey, error) {
+	d, err := decodeBase64URL(encoded)
+	if err != nil || len(d) != 32 {
+		return nil, errors.New("the VAPID private key must be 32 bytes encoded as base64url")
+	}
+	curve := elliptic.P256()
+	key := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(d)}
+	if key.D.Sign() == 0 || key.D.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("the VAPID private key isn't a valid P-256 key")
+	}
+	key.Curve = curve
+	key.X, key.Y = curve.ScalarBaseMult(d)
+	return key, nil
+}
+
+// decodeBase64URL accepts base64url with or without padding, since browsers and libraries differ
+func decodeBase64URL(encoded string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"github.com/navbryce/next-dorm-be/config"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// the example of RFC 8291 Appendix A
+const (
+	rfc8291Plaintext       = "When I grow up, I want to be a watermelon"
+	rfc8291ServerPrivate   = "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"
+	rfc8291DevicePublic    = "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"
+	rfc8291AuthSecret      = "BTBZMqHH6r4Tts7J_aSIgg"
+	rfc8291Salt            = "DGv6ra1nlYgDCS1FRnbzlw"
+	rfc8291EncryptedRecord = "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+)
+
+func TestEncryptPushRecord(t *testing.T) {
+	key, err := parseVAPIDKey(rfc8291ServerPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256dh, authSecret, err := decodePushKeys(&model.PushSubscription{P256dh: rfc8291DevicePublic, Auth: rfc8291AuthSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt, _ := decodeBase64URL(rfc8291Salt)
+	want, _ := decodeBase64URL(rfc8291EncryptedRecord)
+
+	got, err := encryptPushRecord([]byte(rfc8291Plaintext), p256dh, authSecret, key, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("encryptPushRecord() = %x, want %x", got, want)
+	}
+}
+
+func TestEncryptPushPayloadUsesNewKeys(t *testing.T) {
+	p256dh, authSecret, err := decodePushKeys(&model.PushSubscription{P256dh: rfc8291DevicePublic, Auth: rfc8291AuthSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := encryptPushPayload([]byte(rfc8291Plaintext), p256dh, authSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := encryptPushPayload([]byte(rfc8291Plaintext), p256dh, authSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != pushHeaderSize+len(rfc8291Plaintext)+1+16 {
+		t.Errorf("the body is %v bytes, want %v", len(first), pushHeaderSize+len(rfc8291Plaintext)+1+16)
+	}
+	if bytes.Equal(first[:pushHeaderSize], second[:pushHeaderSize]) {
+		t.Error("two payloads were encrypted with the same salt and key pair")
+	}
+}
+
+type fakePushDatabase struct {
+	db.PushDatabase
+	mu      sync.Mutex
+	deleted []int64
+}
+
+func (fdb *fakePushDatabase) DeletePushSubscriptionById(ctx context.Context, id int64) error {
+	fdb.mu.Lock()
+	defer fdb.mu.Unlock()
+	fdb.deleted = append(fdb.deleted, id)
+	return nil
+}
+
+func (fdb *fakePushDatabase) deletedIds() []int64 {
+	fdb.mu.Lock()
+	defer fdb.mu.Unlock()
+	return append([]int64{}, fdb.deleted...)
+}
+
+// fakePushService answers each path with its statuses in order, and the last one once they run out
+type fakePushService struct {
+	mu       sync.Mutex
+	statuses map[string][]int
+	requests map[string]int
+}
+
+func (fps *fakePushService) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	fps.mu.Lock()
+	defer fps.mu.Unlock()
+	statuses := fps.statuses[req.URL.Path]
+	status := statuses[len(statuses)-1]
+	if n := fps.requests[req.URL.Path]; n < len(statuses) {
+		status = statuses[n]
+	}
+	fps.requests[req.URL.Path]++
+	if req.Header.Get("Content-Encoding") != "aes128gcm" || req.Header.Get("Authorization") == "" {
+		status = http.StatusBadRequest
+	}
+	w.WriteHeader(status)
+}
+
+func (fps *fakePushService) requestCount(path string) int {
+	fps.mu.Lock()
+	defer fps.mu.Unlock()
+	return fps.requests[path]
+}
+
+func TestWebPusher(t *testing.T) {
+	service := &fakePushService{
+		statuses: map[string][]int{
+			"/ok":      {http.StatusCreated},
+			"/missing": {http.StatusNotFound},
+			"/gone":    {http.StatusGone},
+			"/limited": {http.StatusTooManyRequests, http.StatusCreated},
+			"/busy":    {http.StatusServiceUnavailable, http.StatusInternalServerError, http.StatusCreated},
+			"/down":    {http.StatusBadGateway},
+			"/refused": {http.StatusForbidden},
+		},
+		requests: make(map[string]int),
+	}
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	vapidKey, _, err := NewVAPIDKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscriptions := &fakePushDatabase{}
+	pusher, err := NewWebPusher(subscriptions, &config.PushConfig{
+		VAPIDPrivateKey: vapidKey,
+		Subject:         "mailto:admin@example.edu",
+		Services:        []string{server.URL},
+		TTL:             time.Hour,
+		Timeout:         time.Second,
+		MaxAttempts:     3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pusher.retryDelay = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pusher.Start(ctx)
+
+	paths := []string{"/ok", "/missing", "/gone", "/limited", "/busy", "/down", "/refused"}
+	devices := make([]*model.PushSubscription, len(paths))
+	for i, path := range paths {
+		devices[i] = &model.PushSubscription{
+			Id:       int64(i + 1),
+			Endpoint: server.URL + path,
+			P256dh:   rfc8291DevicePublic,
+			Auth:     rfc8291AuthSecret,
+		}
+		if err := pusher.CheckSubscription(devices[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pusher.Push(devices, []byte(`{"title":"hi"}`))
+
+	want := map[string]int{
+		"/ok":      1,
+		"/missing": 1,
+		"/gone":    1,
+		"/limited": 2, // retried until it's accepted
+		"/busy":    3,
+		"/down":    3, // retried until the attempts run out
+		"/refused": 1, // other errors aren't retried
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for _, path := range paths {
+		for service.requestCount(path) < want[path] && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	// long enough for a retry that shouldn't happen to show up
+	time.Sleep(50 * time.Millisecond)
+	for _, path := range paths {
+		if got := service.requestCount(path); got != want[path] {
+			t.Errorf("%v got %v requests, want %v", path, got, want[path])
+		}
+	}
+
+	deleted := subscriptions.deletedIds()
+	if len(deleted) != 2 || deleted[0]+deleted[1] != 2+3 {
+		t.Errorf("deleted subscriptions %v, want the 404 and 410 ones (2 and 3)", deleted)
+	}
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/navbryce/next-dorm-be/config"
+	"github.com/navbryce/next-dorm-be/db"
+	"github.com/navbryce/next-dorm-be/model"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// webhookDeliveryBatch is how many due deliveries are read per query
+	webhookDeliveryBatch = 50
+	// webhookSenders is how many deliveries are sent at once
+	webhookSenders = 8
+	// webhookPruneInterval is how often finished deliveries older than the retention are dropped
+	webhookPruneInterval = time.Hour
+	// maxWebhookErrorBytes is how much of a failed response is kept in the delivery log
+	maxWebhookErrorBytes = 512
+	webhookSecretBytes   = 32
+)
+
+// The headers of a delivery
+const (
+	WebhookHeaderEvent     = "X-Next-Dorm-Event"
+	WebhookHeaderDelivery  = "X-Next-Dorm-Delivery"
+	WebhookHeaderTimestamp = "X-Next-Dorm-Timestamp"
+	WebhookHeaderSignature = "X-Next-Dorm-Signature"
+)
+
+// NewWebhookSecret returns a random secret to sign the deliveries of a webhook with
+func NewWebhookSecret() (string, error) {
+	secret := make([]byte, webhookSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// SignWebhook returns the signature header of a delivery: "sha256=" followed by the hex HMAC-SHA256 of the timestamp, a
+// '.' and the body, keyed with the secret of the webhook. The timestamp lets receivers refuse old deliveries
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookSender sends the deliveries that are due. Any instance can send any delivery: each one is claimed before it's
+// sent, so two instances don't send it at the same time
+type WebhookSender struct {
+	db     db.WebhookDatabase
+	cfg    *config.WebhookConfig
+	client *http.Client
+}
+
+func NewWebhookSender(webhooks db.WebhookDatabase, cfg *config.WebhookConfig) *WebhookSender {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivateHosts {
+		dialer.Control = refusePrivateHosts
+	}
+	return &WebhookSender{
+		db:  webhooks,
+		cfg: cfg,
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+			// a redirect could point anywhere, so it counts as a failed attempt
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Start sends the due deliveries every cfg.PollInterval, and prunes the delivery log, until ctx is done
+func (ws *WebhookSender) Start(ctx context.Context) {
+	poll := time.NewTicker(ws.cfg.PollInterval)
+	prune := time.NewTicker(webhookPruneInterval)
+	go func() {
+		defer poll.Stop()
+		defer prune.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-poll.C:
+				ws.sendDue(ctx)
+			case <-prune.C:
+				if err := ws.db.DeleteWebhookDeliveries(ctx, time.Now().Add(-ws.cfg.Retention)); err != nil {
+					log.Println("an error occurred while pruning webhook deliveries", err)
+				}
+			}
+		}
+	}()
+}
+
+// sendDue sends every due delivery. A delivery is only claimed once a sender is free to attempt it, so its claim doesn't
+// run out while it waits behind the others
+func (ws *WebhookSender) sendDue(ctx context.Context) {
+	senders := make(chan struct{}, webhookSenders)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		deliveries, err := ws.db.GetDueWebhookDeliveries(ctx, time.Now(), webhookDeliveryBatch)
+		if err != nil {
+			log.Println("an error occurred while reading due webhook deliveries", err)
+			return
+		}
+		for _, delivery := range deliveries {
+			senders <- struct{}{}
+			now := time.Now()
+			// the claim outlives the attempt, so a delivery whose instance died is retried once the claim expires
+			claimed, err := ws.db.ClaimWebhookDelivery(ctx, delivery.Id, now, now.Add(2*ws.cfg.Timeout))
+			if err != nil {
+				log.Println("an error occurred while claiming webhook delivery", delivery.Id, err)
+				<-senders
+				continue
+			}
+			if !claimed {
+				<-senders
+				continue
+			}
+			wg.Add(1)
+			go func(delivery *model.WebhookDelivery) {
+				defer func() {
+					if r := recover(); r != nil {
+						log.Println("recovered while sending webhook delivery", delivery.Id, r)
+					}
+					<-senders
+					wg.Done()
+				}()
+				ws.attempt(ctx, delivery)
+			}(delivery)
+		}
+		if len(deliveries) < webhookDeliveryBatch {
+			return
+		}
+	}
+}
+
+// attempt sends the delivery once and records the outcome: success, a retry after the backoff, or failure once the
+// attempts run out
+func (ws *WebhookSender) attempt(ctx context.Context, delivery *model.WebhookDelivery) {
+	webhook, err := ws.db.GetWebhook(ctx, delivery.WebhookId)
+	if err != nil {
+		log.Println("an error occurred while reading the webhook of delivery", delivery.Id, err)
+		return
+	}
+	if webhook == nil {
+		return
+	}
+
+	delivery.NextAttemptAt = nil
+	// deliveries queued before the webhook was deactivated aren't sent. they can be replayed once it's active again
+	if !webhook.Active {
+		delivery.Status = model.WebhookDeliveryFailed
+		delivery.LastError = "the webhook is inactive"
+	} else {
+		delivery.LastStatusCode, err = ws.send(ctx, webhook, delivery)
+		delivery.Attempts++
+		switch {
+		case err == nil:
+			delivery.Status = model.WebhookDeliverySucceeded
+			delivery.LastError = ""
+		case delivery.Attempts >= ws.cfg.MaxAttempts:
+			delivery.Status = model.WebhookDeliveryFailed
+			delivery.LastError = err.Error()
+		default:
+			nextAttemptAt := time.Now().Add(ws.backoff(delivery.Attempts))
+			delivery.NextAttemptAt = &nextAttemptAt
+			delivery.LastError = err.Error()
+		}
+	}
+	if err := ws.db.UpdateWebhookDelivery(ctx, delivery); err != nil {
+		log.Println("an error occurred while saving webhook delivery", delivery.Id, err)
+	}
+}
+
+// send posts the payload and returns the status code of the response, if there was one. Any status other than 2xx is
+// an error
+func (ws *WebhookSender) send(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery) (*int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "next-dorm-webhooks")
+	req.Header.Set(WebhookHeaderEvent, string(delivery.Event))
+	req.Header.Set(WebhookHeaderDelivery, strconv.FormatInt(delivery.Id, 10))
+	req.Header.Set(WebhookHeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookHeaderSignature, SignWebhook(webhook.Secret, timestamp, body))
+
+	res, err := ws.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return &res.StatusCode, nil
+	}
+	excerpt, _ := io.ReadAll(io.LimitReader(res.Body, maxWebhookErrorBytes))
+	return &res.StatusCode, fmt.Errorf("the receiver responded %v: %v", res.Status, strings.TrimSpace(string(excerpt)))
+}
+
+// backoff is how long to wait after the attempt before the next one. It doubles with every attempt
+func (ws *WebhookSender) backoff(attempts int) time.Duration {
+	backoff := ws.cfg.InitialBackoff
+	for i := 1; i < attempts && backoff < ws.cfg.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > ws.cfg.MaxBackoff {
+		return ws.cfg.MaxBackoff
+	}
+	return backoff
+}
+
+// refusePrivateHosts keeps webhooks from reaching the network the web server runs in. It checks the address actually
+// dialed, so a public hostname resolving to a private address is refused too
+func refusePrivateHosts(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("webhooks can't reach %v", host)
+	}
+	return nil
+}
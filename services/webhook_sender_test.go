@@ -0,0 +1,18 @@
+package services
+
+import (
+	"testing"
+)
+
+func TestSignWebhook(t *testing.T) {
+	secret := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	body := []byte(`{"event":"post.created"}`)
+	// HMAC-SHA256 of `1700000000.{"event":"post.created"}`
+	want := "sha256=866fd72a40b801c4f256476b002d5cfc38a1a9b78e004be992cc49dce054a2c9"
+	if got := SignWebhook(secret, 1700000000, body); got != want {
+		t.Errorf("SignWebhook() = %v, want %v", got, want)
+	}
+	if got := SignWebhook(secret, 1700000001, body); got == want {
+		t.Error("the signature doesn't cover the timestamp")
+	}
+}
@@ -3,8 +3,51 @@ package util
 import (
 	"fmt"
 	"github.com/navbryce/next-dorm-be/config"
+	"github.com/navbryce/next-dorm-be/model"
+	"net/url"
+	"strings"
 )
 
-func Avatar(seed string) string {
-	return fmt.Sprintf("https://avatars.dicebear.com/api/bottts/%v.svg?size=%v", seed, config.AVATAR_SIZE)
+// AvatarBuilder builds the URLs of the avatars generated by the /avatars route. The database only stores the alias, so
+// its avatar is added where content is shown
+type AvatarBuilder struct {
+	baseURL string
+}
+
+// NewAvatarBuilder builds URLs on the public URL of the web server (config public_url). They're relative to the origin
+// if it's empty
+func NewAvatarBuilder(publicURL string) *AvatarBuilder {
+	return &AvatarBuilder{baseURL: strings.TrimSuffix(publicURL, "/")}
+}
+
+// URL is the URL of the avatar generated for seed
+func (ab *AvatarBuilder) URL(seed string) string {
+	return fmt.Sprintf("%v/avatars/%v.svg?size=%v", ab.baseURL, url.PathEscape(seed), config.AVATAR_SIZE)
+}
+
+// AnonymousUser is the alias with its avatar
+func (ab *AvatarBuilder) AnonymousUser(displayName string) *model.AnonymousUser {
+	return &model.AnonymousUser{
+		DisplayName: displayName,
+		AvatarUrl:   ab.URL(displayName),
+	}
+}
+
+// AddTo gives the alias of the content its avatar. The creator is replaced rather than changed, since the content it
+// was read with can be shared
+func (ab *AvatarBuilder) AddTo(metadata *model.ContentMetadata) {
+	if metadata.Creator == nil || metadata.Creator.AnonymousUser == nil || len(metadata.Creator.AnonymousUser.DisplayName) == 0 {
+		return
+	}
+	creator := *metadata.Creator
+	creator.AnonymousUser = ab.AnonymousUser(creator.AnonymousUser.DisplayName)
+	metadata.Creator = &creator
+}
+
+// AddToComments is AddTo for every comment of the trees
+func (ab *AvatarBuilder) AddToComments(trees []*model.CommentTree) {
+	for _, tree := range trees {
+		ab.AddTo(tree.ContentMetadata)
+		ab.AddToComments(tree.Children)
+	}
 }
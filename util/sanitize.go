@@ -11,3 +11,10 @@ var XSSPolicy = bluemonday.UGCPolicy()
 func XSSSanitize(val string) string {
 	return html.UnescapeString(XSSPolicy.Sanitize(val))
 }
+
+var plainTextPolicy = bluemonday.StrictPolicy()
+
+// StripHTML removes every tag and returns the unescaped text
+func StripHTML(val string) string {
+	return html.UnescapeString(plainTextPolicy.Sanitize(val))
+}